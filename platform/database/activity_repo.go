@@ -1,11 +1,15 @@
 package database
 
 import (
+	"errors"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"time"
 )
 
+// ErrVersionConflict is returned when saving an edit draft whose workout was changed after the draft was made.
+var ErrVersionConflict = errors.New("workout was changed since this draft was made")
+
 type ActivityRepo struct {
 	DB *gorm.DB
 }
@@ -31,6 +35,303 @@ func (r *ActivityRepo) GetActivitiesByUserID(userID uint) ([]*Activity, error) {
 	return activities, nil
 }
 
+// GetRoutes returns the user's activities that have a route, with only their IDs, names, sport
+// types and routes loaded.
+func (r *ActivityRepo) GetRoutes(userID uint) ([]*Activity, error) {
+	var activities []*Activity
+	result := r.DB.Select("id", "name", "sport_type", "activity_time", "polyline").
+		Where("user_id = ? AND status = ? AND polyline <> ''", userID, StatusActive).
+		Order("activity_time desc").
+		Find(&activities)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return activities, nil
+}
+
+// GetStreams returns the readings saved for an activity, or nil if none have been.
+func (r *ActivityRepo) GetStreams(activityID uint) (*ActivityStream, error) {
+	var stream ActivityStream
+	err := r.DB.Where("activity_id = ?", activityID).First(&stream).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stream, nil
+}
+
+// GetStreamsBetween returns the readings saved for a user's cardio activities between two times,
+// with the activity each is for.
+func (r *ActivityRepo) GetStreamsBetween(userID uint, from, to time.Time) ([]*ActivityStream, error) {
+	var streams []*ActivityStream
+	result := r.DB.Joins("Activity").
+		Where(`"Activity".user_id = ? AND "Activity".status = ? AND "Activity".activity_time >= ? AND "Activity".activity_time < ?`, userID, StatusActive, from, to).
+		Where("activity_streams.points > 0").
+		Find(&streams)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return streams, nil
+}
+
+// GetStreamsByUserID returns the readings saved for all of a user's finished activities.
+func (r *ActivityRepo) GetStreamsByUserID(userID uint) ([]*ActivityStream, error) {
+	var streams []*ActivityStream
+	err := r.DB.Joins("JOIN activities ON activities.id = activity_streams.activity_id").
+		Where("activities.user_id = ? AND activities.status = ? AND activities.deleted_at IS NULL", userID, StatusActive).
+		Where("activity_streams.points > 0").
+		Find(&streams).Error
+	return streams, err
+}
+
+// CountWithoutStreamsBetween counts a user's activities synced from Strava between two times
+// whose readings haven't been fetched yet.
+func (r *ActivityRepo) CountWithoutStreamsBetween(userID uint, from, to time.Time) (int64, error) {
+	var count int64
+	err := r.DB.Model(&Activity{}).Scopes(withoutStreams).
+		Where("user_id = ? AND activity_time >= ? AND activity_time < ?", userID, from, to).
+		Count(&count).Error
+	return count, err
+}
+
+// SaveStreams saves the readings through an activity, replacing any it had.
+func (r *ActivityRepo) SaveStreams(activityID uint, streams Streams) (*ActivityStream, error) {
+	return saveStreams(r.DB, activityID, streams)
+}
+
+func saveStreams(db *gorm.DB, activityID uint, streams Streams) (*ActivityStream, error) {
+	stream := &ActivityStream{ActivityID: activityID, Points: streams.Len(), Streams: streams}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "activity_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"points", "streams"}),
+	}).Omit("Activity").Create(stream).Error
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// ListActivitiesByUserID returns one page of a user's activities, newest first, along with
+// how many there are in total. An empty status lists activities of every status.
+func (r *ActivityRepo) ListActivitiesByUserID(userID uint, status ExerciseStatus, offset, limit int) ([]*Activity, int64, error) {
+	query := r.DB.Model(&Activity{}).Where("user_id = ?", userID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var activities []*Activity
+	err := query.Order("activity_time desc").Offset(offset).Limit(limit).Find(&activities).Error
+	return activities, total, err
+}
+
+// CountFinishedActivities returns how many finished activities a user has.
+func (r *ActivityRepo) CountFinishedActivities(userID uint) (int64, error) {
+	var count int64
+	err := r.DB.Model(&Activity{}).Where("user_id = ? AND status = ?", userID, StatusActive).Count(&count).Error
+	return count, err
+}
+
+// GetFinishedActivitiesWithSets returns all of a user's finished activities, oldest first, with
+// their exercises, exercise definitions and sets loaded in order.
+func (r *ActivityRepo) GetFinishedActivitiesWithSets(userID uint) ([]*Activity, error) {
+	var activities []*Activity
+	err := r.DB.
+		Where("user_id = ? AND status = ?", userID, StatusActive).
+		Preload("GymExercises", func(db *gorm.DB) *gorm.DB { return db.Order("sort_number asc, id asc") }).
+		Preload("GymExercises.ExerciseDefinition").
+		Preload("GymExercises.Sets", func(db *gorm.DB) *gorm.DB { return db.Order("set_number asc, id asc") }).
+		Order("activity_time asc, id asc").
+		Find(&activities).Error
+	return activities, err
+}
+
+// ImportActivity saves a finished activity brought in from a file, along with its exercises
+// and sets, and the readings through it if there are any. An activity the user already has,
+// with the same type, name and time, is skipped so that importing a file twice doesn't
+// duplicate it. It reports whether it was saved.
+func (r *ActivityRepo) ImportActivity(activity *Activity, streams Streams) (bool, error) {
+	created := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&Activity{}).
+			Where("user_id = ? AND type = ? AND name = ? AND activity_time = ?", activity.UserID, activity.Type, activity.Name, activity.ActivityTime).
+			Count(&count).Error
+		if err != nil || count > 0 {
+			return err
+		}
+
+		activity.Status = StatusActive
+		if err := tx.Omit("User", "GymExercises.ExerciseDefinition").Create(activity).Error; err != nil {
+			return err
+		}
+		if streams.Len() > 0 {
+			stream := &ActivityStream{ActivityID: activity.ID, Points: streams.Len(), Streams: streams}
+			if err := tx.Omit("Activity").Create(stream).Error; err != nil {
+				return err
+			}
+		}
+		created = true
+		return nil
+	})
+	return created, err
+}
+
+// ImportTrack saves a run, ride or other session read from a device's file, with the readings
+// through it. If the user already has one that started within window of it, such as the same
+// session synced from Strava or the file imported before, nothing is saved and that one is
+// returned instead.
+func (r *ActivityRepo) ImportTrack(activity *Activity, streams Streams, window time.Duration) (*Activity, error) {
+	var duplicate *Activity
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var existing Activity
+		err := tx.Where("user_id = ? AND type <> ? AND status = ?", activity.UserID, "GYM_WORKOUT", StatusActive).
+			Where("start_time BETWEEN ? AND ?", activity.StartTime.Add(-window), activity.StartTime.Add(window)).
+			First(&existing).Error
+		if err == nil {
+			duplicate = &existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		activity.Status = StatusActive
+		if err := tx.Omit("User").Create(activity).Error; err != nil {
+			return err
+		}
+		return tx.Omit("Activity").Create(&ActivityStream{ActivityID: activity.ID, Points: streams.Len(), Streams: streams}).Error
+	})
+	return duplicate, err
+}
+
+// GetActivityTimesBetween returns the type, name and time of a user's workouts between two times,
+// so an import can tell which of its workouts the user already has.
+func (r *ActivityRepo) GetActivityTimesBetween(userID uint, from, to time.Time) ([]*Activity, error) {
+	var activities []*Activity
+	err := r.DB.Select("id", "type", "name", "activity_time").
+		Where("user_id = ? AND activity_time BETWEEN ? AND ?", userID, from, to).
+		Find(&activities).Error
+	return activities, err
+}
+
+// GetDraftsByUserID returns a user's unfinished workouts, most recently worked on first
+func (r *ActivityRepo) GetDraftsByUserID(userID uint) ([]*Activity, error) {
+	var activities []*Activity
+	result := r.DB.Where("user_id = ? AND status = ?", userID, StatusDraft).Order("updated_at desc").Find(&activities)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return activities, nil
+}
+
+// GetActiveDraft returns the draft workout a user is working on, or nil if they have none.
+// If the user's active draft has gone, their most recently changed draft is used instead.
+func (r *ActivityRepo) GetActiveDraft(userID uint) (*Activity, error) {
+	var user User
+	if err := r.DB.Select("id", "active_activity_id").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var drafts []*Activity
+	query := r.DB.Where("user_id = ? AND status = ?", userID, StatusDraft)
+	if user.ActiveActivityID != nil {
+		// Put the active draft first when it is still there.
+		query = query.Order(clause.OrderBy{Expression: clause.Expr{SQL: "id = ? DESC", Vars: []interface{}{*user.ActiveActivityID}, WithoutParentheses: true}})
+	}
+	if err := query.Order("updated_at desc").Limit(1).Find(&drafts).Error; err != nil {
+		return nil, err
+	}
+	if len(drafts) == 0 {
+		return nil, nil
+	}
+	return drafts[0], nil
+}
+
+// StaleDraft is a draft workout along with the last time anything in it was changed.
+type StaleDraft struct {
+	Activity      *Activity
+	LastTouchedAt time.Time
+}
+
+// draftLastTouchedSQL is when a draft, or any of its exercises and sets, was last changed.
+const draftLastTouchedSQL = `GREATEST(activities.updated_at,
+	COALESCE((SELECT MAX(gym_exercises.updated_at) FROM gym_exercises
+		WHERE gym_exercises.activity_id = activities.id), activities.updated_at),
+	COALESCE((SELECT MAX(gym_sets.updated_at) FROM gym_sets
+		JOIN gym_exercises ON gym_exercises.id = gym_sets.gym_exercise_id
+		WHERE gym_exercises.activity_id = activities.id), activities.updated_at))`
+
+// GetStaleDrafts returns drafts that nothing has been changed in since before the given time,
+// oldest first, with their user and sets loaded. A userID of 0 returns every user's drafts.
+func (r *ActivityRepo) GetStaleDrafts(userID uint, before time.Time) ([]StaleDraft, error) {
+	var rows []struct {
+		ID            uint
+		LastTouchedAt time.Time
+	}
+	query := r.DB.Model(&Activity{}).
+		Select("activities.id, "+draftLastTouchedSQL+" AS last_touched_at").
+		Where("activities.status = ?", StatusDraft).
+		Where(draftLastTouchedSQL+" < ?", before).
+		Order("last_touched_at asc")
+	if userID != 0 {
+		query = query.Where("activities.user_id = ?", userID)
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	var activities []*Activity
+	if err := r.DB.Preload("User").Preload("GymExercises.Sets").Where("id IN ?", ids).Find(&activities).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*Activity, len(activities))
+	for _, activity := range activities {
+		byID[activity.ID] = activity
+	}
+
+	drafts := make([]StaleDraft, 0, len(rows))
+	for _, row := range rows {
+		if activity, ok := byID[row.ID]; ok {
+			drafts = append(drafts, StaleDraft{Activity: activity, LastTouchedAt: row.LastTouchedAt})
+		}
+	}
+	return drafts, nil
+}
+
+// clearActiveActivity stops any user from pointing at an activity as their active draft.
+func clearActiveActivity(tx *gorm.DB, activityID uint) error {
+	return tx.Model(&User{}).Where("active_activity_id = ?", activityID).Update("active_activity_id", nil).Error
+}
+
+// GetActivitiesByUserIDForDay returns the finished activities a user logged on the given calendar day
+func (r *ActivityRepo) GetActivitiesByUserIDForDay(userID uint, day time.Time) ([]*Activity, error) {
+	var activities []*Activity
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	result := r.DB.
+		Where("user_id = ? AND status = ?", userID, StatusActive).
+		Where("activity_time >= ? AND activity_time < ?", start, start.AddDate(0, 0, 1)).
+		Order("activity_time asc").
+		Find(&activities)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return activities, nil
+}
+
 // GetActivityByID returns the activity based on its database id
 func (r *ActivityRepo) GetActivityByID(id uint) (*Activity, error) {
 	var activity Activity
@@ -44,6 +345,31 @@ func (r *ActivityRepo) GetActivityByID(id uint) (*Activity, error) {
 	return &activity, nil
 }
 
+// GetActivityByShareToken returns a finished activity from its public share token
+func (r *ActivityRepo) GetActivityByShareToken(token string) (*Activity, error) {
+	var activity Activity
+	result := r.DB.
+		Preload("GymExercises.Sets").
+		Preload("GymExercises.ExerciseDefinition").
+		Preload("User").
+		Where("share_token = ? AND status = ?", token, StatusActive).
+		First(&activity)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &activity, nil
+}
+
+// SetShareToken stores the public share token for an activity.
+func (r *ActivityRepo) SetShareToken(activityID uint, token string) error {
+	return r.DB.Model(&Activity{}).Where("id = ?", activityID).Update("share_token", token).Error
+}
+
+// ClearShareToken removes an activity's share token, so its share link stops working.
+func (r *ActivityRepo) ClearShareToken(activityID uint) error {
+	return r.DB.Model(&Activity{}).Where("id = ?", activityID).Update("share_token", nil).Error
+}
+
 // UpdateActivityStatus updates the status of a specific activity.
 func (r *ActivityRepo) UpdateActivityStatus(activityID uint, status ExerciseStatus) error {
 	err := r.DB.Model(&Activity{}).Where("id = ?", activityID).Update("status", status).Error
@@ -52,47 +378,72 @@ func (r *ActivityRepo) UpdateActivityStatus(activityID uint, status ExerciseStat
 
 // UpdateActivityName updates the name of a specific activity and returns the updated record.
 func (r *ActivityRepo) UpdateActivityName(activityID uint, name string) (*Activity, error) {
-	var activity Activity
-
-	// Use Clauses(clause.Returning{}) to update and return the data in one query.
-
-	// This is more efficient than a separate UPDATE and SELECT.
-	err := r.DB.Model(&activity).
-		Clauses(clause.Returning{}).
-		Where("id = ?", activityID).
-		Update("name", name).Error
-
-	if err != nil {
-		return nil, err
-	}
-
-	// If the update affected 0 rows (e.g., wrong ID), the returned activity.ID will be 0.
-	// We check for this and return a standard "not found" error.
-	if activity.ID == 0 {
-		return nil, gorm.ErrRecordNotFound
-	}
-
-	return &activity, nil
+	return r.updateActivityField(activityID, "name", name)
 }
 
 // UpdateActivityNotes updates the notes of a specific activity and returns the updated record.
 func (r *ActivityRepo) UpdateActivityNotes(activityID uint, notes string) (*Activity, error) {
+	return r.updateActivityField(activityID, "notes", notes)
+}
+
+// UpdateActivityTime changes when an activity took place, e.g. to backdate a workout.
+func (r *ActivityRepo) UpdateActivityTime(activityID uint, activityTime time.Time) (*Activity, error) {
+	return r.updateActivityField(activityID, "activity_time", activityTime)
+}
+
+// updateActivityField changes one of an activity's own fields and returns the updated record.
+// A finished workout is saved as a revision first and moves on a version, just as saving an
+// edit draft does, so that any open edit draft sees the change as a conflict.
+func (r *ActivityRepo) updateActivityField(activityID uint, column string, value interface{}) (*Activity, error) {
 	var activity Activity
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var current Activity
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&current, activityID).Error; err != nil {
+			return err
+		}
 
-	err := r.DB.Model(&activity).
-		Clauses(clause.Returning{}).
-		Where("id = ?", activityID).
-		Update("notes", notes).Error
+		updates := map[string]interface{}{column: value}
+		if current.Status == StatusActive {
+			if err := saveRevision(tx, activityID); err != nil {
+				return err
+			}
+			updates["version"] = gorm.Expr("version + 1")
+		}
 
+		// Use Clauses(clause.Returning{}) to update and return the data in one query.
+		return tx.Model(&activity).
+			Clauses(clause.Returning{}).
+			Where("id = ?", activityID).
+			Updates(updates).Error
+	})
 	if err != nil {
 		return nil, err
 	}
+	return &activity, nil
+}
 
-	if activity.ID == 0 {
-		return nil, gorm.ErrRecordNotFound
+// PauseActivity pauses the session clock of a draft. Pausing an already paused draft does nothing.
+func (r *ActivityRepo) PauseActivity(activityID uint) error {
+	return r.DB.Model(&Activity{}).
+		Where("id = ? AND paused_at IS NULL", activityID).
+		Update("paused_at", time.Now()).Error
+}
+
+// ResumeActivity restarts the session clock, adding the time spent paused to the total.
+func (r *ActivityRepo) ResumeActivity(activityID uint) error {
+	var activity Activity
+	if err := r.DB.First(&activity, activityID).Error; err != nil {
+		return err
+	}
+	if activity.PausedAt == nil {
+		return nil
 	}
 
-	return &activity, nil
+	pausedFor := int(time.Since(*activity.PausedAt).Seconds())
+	return r.DB.Model(&activity).Updates(map[string]interface{}{
+		"paused_seconds": activity.PausedSeconds + pausedFor,
+		"paused_at":      nil,
+	}).Error
 }
 
 // DeleteActivity deletes an activity and its associated gym sets
@@ -103,6 +454,10 @@ func (r *ActivityRepo) DeleteActivity(activityID uint) error {
 			return err
 		}
 
+		if err := clearActiveActivity(tx, activityID); err != nil {
+			return err
+		}
+
 		// Then delete the activity itself
 		if err := tx.Delete(&Activity{}, activityID).Error; err != nil {
 			return err
@@ -116,59 +471,226 @@ func (r *ActivityRepo) DeleteActivity(activityID uint) error {
 func (r *ActivityRepo) CreateDraftCopy(originalID uint) (uint, error) {
 	var originalActivity Activity
 	// Load the original activity with all its children
-	if err := r.DB.Preload("GymExercises.Sets").First(&originalActivity, originalID).Error; err != nil {
+	if err := r.DB.Preload("GymExercises", func(db *gorm.DB) *gorm.DB { return db.Order("sort_number ASC") }).
+		Preload("GymExercises.Sets", func(db *gorm.DB) *gorm.DB { return db.Order("set_number ASC") }).
+		Preload("GymExercises.ExerciseDefinition").
+		First(&originalActivity, originalID).Error; err != nil {
+		return 0, err
+	}
+	baseSnapshot, err := encodeSnapshot(SnapshotOf(&originalActivity))
+	if err != nil {
 		return 0, err
 	}
 
 	var draftID uint
-	err := r.DB.Transaction(func(tx *gorm.DB) error {
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
 		// Create the new draft activity
 		draftActivity := Activity{
 			UserID:             originalActivity.UserID,
 			Type:               originalActivity.Type,
-			ActivityTime:       time.Now(),
+			ActivityTime:       originalActivity.ActivityTime,
 			Name:               originalActivity.Name,
 			Status:             StatusDraft,
 			OriginalActivityID: &originalActivity.ID,
 			Notes:              originalActivity.Notes,
+			StartTime:          originalActivity.StartTime,
+			FinishTime:         originalActivity.FinishTime,
+			PausedSeconds:      originalActivity.PausedSeconds,
+			BaseVersion:        originalActivity.Version,
+			BaseSnapshot:       baseSnapshot,
 		}
 		if err := tx.Create(&draftActivity).Error; err != nil {
 			return err
 		}
 		draftID = draftActivity.ID // Store the new ID
 
-		// Copy each exercise and its sets
-		for _, originalExercise := range originalActivity.GymExercises {
-			draftExercise := GymExercise{
-				ActivityID:           draftID, // Link to the new draft activity
-				ExerciseDefinitionID: originalExercise.ExerciseDefinitionID,
-				SortNumber:           originalExercise.SortNumber,
-			}
-			if err := tx.Create(&draftExercise).Error; err != nil {
+		return copyExercises(tx, originalActivity.GymExercises, draftID, copyExactly, nil)
+	})
+	return draftID, err
+}
+
+// CreateRepeatCopy deep copies a finished activity into a fresh draft dated now, for doing the
+// same workout again. Unlike CreateDraftCopy the draft is not linked to the original.
+// weightsFor decides the weight of each copied set.
+func (r *ActivityRepo) CreateRepeatCopy(originalID uint, weightsFor func(sets []GymSet) []float64) (uint, error) {
+	var originalActivity Activity
+	if err := r.DB.Preload("GymExercises", func(db *gorm.DB) *gorm.DB { return db.Order("sort_number ASC") }).
+		Preload("GymExercises.Sets", func(db *gorm.DB) *gorm.DB { return db.Order("set_number ASC") }).
+		First(&originalActivity, originalID).Error; err != nil {
+		return 0, err
+	}
+
+	var draftID uint
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		draftActivity := Activity{
+			UserID:       originalActivity.UserID,
+			Type:         originalActivity.Type,
+			ActivityTime: now,
+			StartTime:    &now,
+			Name:         originalActivity.Name,
+			Status:       StatusDraft,
+		}
+		if err := tx.Create(&draftActivity).Error; err != nil {
+			return err
+		}
+		draftID = draftActivity.ID
+
+		return copyExercises(tx, originalActivity.GymExercises, draftID, copyToRepeat, weightsFor)
+	})
+	return draftID, err
+}
+
+// RebaseDraft replaces an edit draft's contents with a merged version and moves its base up to
+// the given version of the original workout, so it can then be saved over that version.
+func (r *ActivityRepo) RebaseDraft(draftID uint, baseVersion int, base WorkoutSnapshot, merged WorkoutSnapshot) error {
+	baseSnapshot, err := encodeSnapshot(base)
+	if err != nil {
+		return err
+	}
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := replaceExercises(tx, draftID, merged.Exercises); err != nil {
+			return err
+		}
+
+		return tx.Model(&Activity{}).Where("id = ?", draftID).Updates(map[string]interface{}{
+			"name":          merged.Name,
+			"notes":         merged.Notes,
+			"activity_time": merged.ActivityTime,
+			"base_version":  baseVersion,
+			"base_snapshot": baseSnapshot,
+		}).Error
+	})
+}
+
+// replaceExercises deletes an activity's exercises and sets and recreates them from a snapshot,
+// grouped into the same supersets.
+func replaceExercises(tx *gorm.DB, activityID uint, exercises []ExerciseSnapshot) error {
+	var exerciseIDs []uint
+	if err := tx.Model(&GymExercise{}).Where("activity_id = ?", activityID).Pluck("id", &exerciseIDs).Error; err != nil {
+		return err
+	}
+	if len(exerciseIDs) > 0 {
+		if err := tx.Where("gym_exercise_id IN ?", exerciseIDs).Delete(&GymSet{}).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("activity_id = ?", activityID).Delete(&GymExercise{}).Error; err != nil {
+		return err
+	}
+
+	restored, partners := restoreExercises(activityID, exercises)
+	for i := range restored {
+		sets := restored[i].Sets
+		restored[i].Sets = nil
+		if err := tx.Create(&restored[i]).Error; err != nil {
+			return err
+		}
+		for j := range sets {
+			sets[j].GymExerciseID = restored[i].ID
+			if err := tx.Create(&sets[j]).Error; err != nil {
 				return err
 			}
+		}
+	}
+
+	// Partners can only be pointed at once every exercise has its ID.
+	for i, partner := range partners {
+		if partner < 0 {
+			continue
+		}
+		if err := tx.Model(&GymExercise{}).Where("id = ?", restored[i].ID).
+			Update("superset_partner_id", restored[partner].ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyMode is how copyExercises copies sets.
+type copyMode int
+
+const (
+	// copyExactly copies sets as they are, including when they were completed and the rest
+	// after them, for editing a workout.
+	copyExactly copyMode = iota
+	// copyToRepeat copies sets as not done yet, with the weights from weightsFor, for doing a
+	// workout again.
+	copyToRepeat
+)
 
-			for _, originalSet := range originalExercise.Sets {
-				draftSet := GymSet{
-					GymExerciseID: draftExercise.ID, // Link to the new draft exercise
-					SetNumber:     originalSet.SetNumber,
-					Reps:          originalSet.Reps,
-					WeightKG:      originalSet.WeightKG,
-				}
-				if err := tx.Create(&draftSet).Error; err != nil {
-					return err
-				}
+// copyExercises copies exercises and their sets onto another activity. weightsFor is only used
+// by copyToRepeat, and returns the weight to use for each of an exercise's sets.
+func copyExercises(tx *gorm.DB, exercises []GymExercise, activityID uint, mode copyMode, weightsFor func(sets []GymSet) []float64) error {
+	copiedIDs := make(map[uint]uint, len(exercises))
+	for _, originalExercise := range exercises {
+		draftExercise := GymExercise{
+			ActivityID:           activityID, // Link to the new draft activity
+			ExerciseDefinitionID: originalExercise.ExerciseDefinitionID,
+			SortNumber:           originalExercise.SortNumber,
+			SupersetID:           originalExercise.SupersetID, // Supersets are looked up within an activity
+			SupersetOrder:        originalExercise.SupersetOrder,
+		}
+		if err := tx.Create(&draftExercise).Error; err != nil {
+			return err
+		}
+		copiedIDs[originalExercise.ID] = draftExercise.ID
+
+		var weights []float64
+		if mode == copyToRepeat {
+			weights = weightsFor(originalExercise.Sets)
+		}
+
+		for i, originalSet := range originalExercise.Sets {
+			draftSet := GymSet{
+				GymExerciseID: draftExercise.ID, // Link to the new draft exercise
+				SetNumber:     originalSet.SetNumber,
+				Reps:          originalSet.Reps,
+				WeightKG:      originalSet.WeightKG,
+				SetType:       originalSet.SetType,
+				Notes:         originalSet.Notes,
+			}
+			switch mode {
+			case copyExactly:
+				draftSet.CompletedAt = originalSet.CompletedAt
+				draftSet.RestSeconds = originalSet.RestSeconds
+			case copyToRepeat:
+				draftSet.WeightKG = weights[i]
+			}
+			if err := tx.Create(&draftSet).Error; err != nil {
+				return err
 			}
 		}
-		return nil
-	})
-	return draftID, err
+	}
+
+	// Partners can only be pointed at their copies once every exercise has been copied.
+	for _, originalExercise := range exercises {
+		if originalExercise.SupersetPartnerID == nil {
+			continue
+		}
+		partnerID, ok := copiedIDs[*originalExercise.SupersetPartnerID]
+		if !ok {
+			continue
+		}
+		if err := tx.Model(&GymExercise{}).Where("id = ?", copiedIDs[originalExercise.ID]).
+			Update("superset_partner_id", partnerID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // FinalizeDraft promotes a draft to 'active'.
 // If it's an edit of an existing workout, it updates the original and deletes the draft.
 // It returns the ID of the final, active workout.
 func (r *ActivityRepo) FinalizeDraft(draftID uint, notes string) (uint, error) {
+	return r.FinalizeDraftAt(draftID, notes, time.Now())
+}
+
+// FinalizeDraftAt is FinalizeDraft with the time a new workout finished given, for
+// finishing a workout some time after it was last worked on.
+func (r *ActivityRepo) FinalizeDraftAt(draftID uint, notes string, finishTime time.Time) (uint, error) {
 	var draftActivity Activity
 	// Preload the exercises from the draft so we can move them
 	if err := r.DB.Preload("GymExercises").First(&draftActivity, draftID).Error; err != nil {
@@ -179,6 +701,21 @@ func (r *ActivityRepo) FinalizeDraft(draftID uint, notes string) (uint, error) {
 	if draftActivity.OriginalActivityID != nil {
 		originalID := *draftActivity.OriginalActivityID
 		err := r.DB.Transaction(func(tx *gorm.DB) error {
+			// 0. Make sure nobody saved the original since this draft was copied from it.
+			// Drafts made before versions were tracked have no base version and aren't checked.
+			var original Activity
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "version").First(&original, originalID).Error; err != nil {
+				return err
+			}
+			if draftActivity.BaseVersion != 0 && original.Version != draftActivity.BaseVersion {
+				return ErrVersionConflict
+			}
+
+			// Keep the version being replaced so it can be looked back at or reverted to.
+			if err := saveRevision(tx, originalID); err != nil {
+				return err
+			}
+
 			// 1. Delete all old exercises and sets from the ORIGINAL workout
 			if err := tx.Where("activity_id = ?", originalID).Delete(&GymExercise{}).Error; err != nil {
 				return err
@@ -189,15 +726,20 @@ func (r *ActivityRepo) FinalizeDraft(draftID uint, notes string) (uint, error) {
 				return err
 			}
 
-			// 3. Update the original workout's name and notes from the draft
+			// 3. Update the original workout's name, notes and date from the draft
 			if err := tx.Model(&Activity{}).Where("id = ?", originalID).Updates(map[string]interface{}{
-				"name":  draftActivity.Name,
-				"notes": notes,
+				"name":          draftActivity.Name,
+				"notes":         notes,
+				"activity_time": draftActivity.ActivityTime,
+				"version":       gorm.Expr("version + 1"),
 			}).Error; err != nil {
 				return err
 			}
 
 			// 4. Delete the now-empty draft activity
+			if err := clearActiveActivity(tx, draftID); err != nil {
+				return err
+			}
 			if err := tx.Delete(&Activity{}, draftID).Error; err != nil {
 				return err
 			}
@@ -207,10 +749,26 @@ func (r *ActivityRepo) FinalizeDraft(draftID uint, notes string) (uint, error) {
 	}
 
 	// This is a new workout being finished for the first time
-	err := r.DB.Model(&draftActivity).Updates(map[string]interface{}{
-		"status": StatusActive,
-		"notes":  notes,
-	}).Error
+	updates := map[string]interface{}{
+		"status":      StatusActive,
+		"notes":       notes,
+		"finish_time": finishTime,
+		// Rest after the last set isn't rest between sets, so any running timer is dropped.
+		"rest_started_at":     nil,
+		"rest_target_seconds": 0,
+		"rest_gym_set_id":     nil,
+	}
+	// Finishing while paused ends the pause at the same moment.
+	if draftActivity.PausedAt != nil {
+		updates["paused_seconds"] = draftActivity.PausedSeconds + int(finishTime.Sub(*draftActivity.PausedAt).Seconds())
+		updates["paused_at"] = nil
+	}
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&draftActivity).Updates(updates).Error; err != nil {
+			return err
+		}
+		return clearActiveActivity(tx, draftActivity.ID)
+	})
 
 	return draftActivity.ID, err
 }
@@ -236,6 +794,23 @@ func (r *ActivityRepo) DeleteActivityAndChildren(activityID uint) error {
 			return err
 		}
 
+		// Records set in this activity no longer stand
+		if err := tx.Where("activity_id = ?", activityID).Delete(&PersonalRecord{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("activity_id = ?", activityID).Delete(&ActivityRevision{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("activity_id = ?", activityID).Delete(&ActivityStream{}).Error; err != nil {
+			return err
+		}
+
+		if err := clearActiveActivity(tx, activityID); err != nil {
+			return err
+		}
+
 		// Finally, delete the activity itself
 		return tx.Delete(&Activity{}, activityID).Error
 	})
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// CardioKind groups sport types by how their pace is best shown: runs in minutes per
+// kilometre, rides in kilometres per hour and swims in minutes per 100 metres.
+type CardioKind string
+
+const (
+	CardioRun   CardioKind = "run"
+	CardioRide  CardioKind = "ride"
+	CardioSwim  CardioKind = "swim"
+	CardioOther CardioKind = "other"
+)
+
+// CardioKindOf tells what kind of cardio a Strava sport type such as "TrailRun" is.
+func CardioKindOf(sportType string) CardioKind {
+	switch {
+	case sportType == "Swim":
+		return CardioSwim
+	case strings.HasSuffix(sportType, "Ride"), sportType == "Velomobile", sportType == "Handcycle":
+		return CardioRide
+	case strings.HasSuffix(sportType, "Run"), sportType == "Walk", sportType == "Hike":
+		return CardioRun
+	}
+	return CardioOther
+}
+
+// ActivityTypeOf turns a Strava sport type such as "TrailRun" into an activity type such as
+// "TRAIL_RUN", in the style of "GYM_WORKOUT".
+func ActivityTypeOf(sportType string) string {
+	if sportType == "" {
+		return "WORKOUT"
+	}
+	var b strings.Builder
+	for i, r := range sportType {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// Speed is a speed in metres per second, as Strava gives them.
+type Speed float64
+
+// KMH is the speed in kilometres per hour.
+func (s Speed) KMH() float64 {
+	return float64(s) * 3.6
+}
+
+// PerKM is how long a kilometre takes at this speed, or zero when not moving.
+func (s Speed) PerKM() time.Duration {
+	return s.timeFor(1000)
+}
+
+// Per100M is how long 100 metres takes at this speed, or zero when not moving.
+func (s Speed) Per100M() time.Duration {
+	return s.timeFor(100)
+}
+
+func (s Speed) timeFor(meters float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(meters / float64(s) * float64(time.Second)).Round(time.Second)
+}
+
+// CardioDetails is what an activity synced from Strava measured beyond its distance and time.
+// It is kept with the activity as JSON.
+type CardioDetails struct {
+	ElapsedSeconds       int     `json:"elapsed_seconds"`
+	AverageSpeed         Speed   `json:"average_speed"`
+	MaxSpeed             Speed   `json:"max_speed"`
+	AverageCadence       float64 `json:"average_cadence,omitempty"`
+	AverageWatts         float64 `json:"average_watts,omitempty"`
+	WeightedAverageWatts int     `json:"weighted_average_watts,omitempty"`
+	MaxWatts             int     `json:"max_watts,omitempty"`
+	Kilojoules           float64 `json:"kilojoules,omitempty"`
+	AverageHeartrate     float64 `json:"average_heartrate,omitempty"`
+	MaxHeartrate         float64 `json:"max_heartrate,omitempty"`
+	Calories             float64 `json:"calories,omitempty"`
+	Trainer              bool    `json:"trainer,omitempty"`
+
+	// Detailed is set once the full activity has been fetched. Strava's activity lists only
+	// give a summary, without splits, laps or calories.
+	Detailed bool    `json:"detailed"`
+	Splits   []Split `json:"splits,omitempty"`
+	Laps     []Lap   `json:"laps,omitempty"`
+}
+
+// Split is one kilometre of an activity. The last is usually shorter.
+type Split struct {
+	Split               int     `json:"split"`
+	DistanceMeters      float64 `json:"distance_meters"`
+	ElapsedSeconds      int     `json:"elapsed_seconds"`
+	MovingSeconds       int     `json:"moving_seconds"`
+	ElevationDifference float64 `json:"elevation_difference"`
+	AverageSpeed        Speed   `json:"average_speed"`
+	AverageHeartrate    float64 `json:"average_heartrate,omitempty"`
+	PaceZone            int     `json:"pace_zone,omitempty"`
+}
+
+// Lap is a lap taken on the device, or one Strava marked by itself.
+type Lap struct {
+	LapIndex            int       `json:"lap_index"`
+	Name                string    `json:"name"`
+	StartTime           time.Time `json:"start_time"`
+	DistanceMeters      float64   `json:"distance_meters"`
+	ElapsedSeconds      int       `json:"elapsed_seconds"`
+	MovingSeconds       int       `json:"moving_seconds"`
+	ElevationGainMeters float64   `json:"elevation_gain_meters"`
+	AverageSpeed        Speed     `json:"average_speed"`
+	MaxSpeed            Speed     `json:"max_speed"`
+	AverageCadence      float64   `json:"average_cadence,omitempty"`
+	AverageWatts        float64   `json:"average_watts,omitempty"`
+	AverageHeartrate    float64   `json:"average_heartrate,omitempty"`
+	MaxHeartrate        float64   `json:"max_heartrate,omitempty"`
+}
+
+// DistanceKM is how far the split went, in kilometres.
+func (s Split) DistanceKM() float64 {
+	return s.DistanceMeters / 1000
+}
+
+// MovingDuration is how long the split spent moving.
+func (s Split) MovingDuration() time.Duration {
+	return time.Duration(s.MovingSeconds) * time.Second
+}
+
+// DistanceKM is how far the lap went, in kilometres.
+func (l Lap) DistanceKM() float64 {
+	return l.DistanceMeters / 1000
+}
+
+// MovingDuration is how long the lap spent moving.
+func (l Lap) MovingDuration() time.Duration {
+	return time.Duration(l.MovingSeconds) * time.Second
+}
+
+// ElapsedDuration is how long the activity took from start to finish, stops included.
+func (c CardioDetails) ElapsedDuration() time.Duration {
+	return time.Duration(c.ElapsedSeconds) * time.Second
+}
+
+// Value stores the details as JSON.
+func (c CardioDetails) Value() (driver.Value, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan reads the details back from JSON.
+func (c *CardioDetails) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return errors.New("cardio details must be JSON")
+	}
+	return json.Unmarshal(b, c)
+}
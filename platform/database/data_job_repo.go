@@ -0,0 +1,117 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// dataJobColumns are the columns of a DataJob without its files, for listing jobs.
+var dataJobColumns = []string{"id", "created_at", "updated_at", "user_id", "kind", "format", "status",
+	"file_name", "weight_unit", "time_zone", "summary", "error", "started_at", "finished_at", "expires_at"}
+
+type DataJobRepo struct {
+	DB *gorm.DB
+}
+
+// NewDataJobRepo creates a new DataJobRepo
+func NewDataJobRepo(db *gorm.DB) *DataJobRepo {
+	return &DataJobRepo{DB: db}
+}
+
+// CreateJob queues a new export or import.
+func (r *DataJobRepo) CreateJob(job *DataJob) error {
+	return r.DB.Create(job).Error
+}
+
+// GetJobsByUserID returns a user's jobs, newest first, without their files.
+func (r *DataJobRepo) GetJobsByUserID(userID uint) ([]*DataJob, error) {
+	var jobs []*DataJob
+	err := r.DB.Select(dataJobColumns).Where("user_id = ?", userID).Order("created_at desc").Find(&jobs).Error
+	return jobs, err
+}
+
+// GetJobByID returns a job along with its files.
+func (r *DataJobRepo) GetJobByID(jobID uint) (*DataJob, error) {
+	var job DataJob
+	if err := r.DB.First(&job, jobID).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// QueueJob queues an import the user has checked. It reports false if the job wasn't waiting to
+// be checked, e.g. because it was already queued.
+func (r *DataJobRepo) QueueJob(jobID uint) (bool, error) {
+	result := r.DB.Model(&DataJob{}).Where("id = ? AND status = ?", jobID, DataJobPreview).
+		Updates(map[string]interface{}{"status": DataJobPending, "expires_at": nil})
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteJob removes a job and its files.
+func (r *DataJobRepo) DeleteJob(jobID uint) error {
+	return r.DB.Unscoped().Delete(&DataJob{}, jobID).Error
+}
+
+// ClaimNextJob marks the oldest pending job as running and returns it, or nil if there are none.
+func (r *DataJobRepo) ClaimNextJob(now time.Time) (*DataJob, error) {
+	var job DataJob
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", DataJobPending).
+			Order("created_at asc").
+			First(&job).Error
+		if err != nil {
+			return err
+		}
+		job.Status = DataJobRunning
+		job.StartedAt = &now
+		return tx.Model(&job).Updates(map[string]interface{}{"status": job.Status, "started_at": now}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ResetRunningJobs puts jobs left running, e.g. by a restart, back in the queue.
+func (r *DataJobRepo) ResetRunningJobs() error {
+	return r.DB.Model(&DataJob{}).Where("status = ?", DataJobRunning).
+		Updates(map[string]interface{}{"status": DataJobPending, "started_at": nil}).Error
+}
+
+// FinishJob records that a job succeeded. The uploaded file of an import is no longer needed.
+func (r *DataJobRepo) FinishJob(jobID uint, output []byte, fileName, summary string, now, expiresAt time.Time) error {
+	return r.DB.Model(&DataJob{}).Where("id = ?", jobID).Updates(map[string]interface{}{
+		"status":      DataJobDone,
+		"output":      output,
+		"file_name":   fileName,
+		"summary":     summary,
+		"input":       nil,
+		"finished_at": now,
+		"expires_at":  expiresAt,
+	}).Error
+}
+
+// FailJob records that a job failed and why.
+func (r *DataJobRepo) FailJob(jobID uint, reason string, now, expiresAt time.Time) error {
+	return r.DB.Model(&DataJob{}).Where("id = ?", jobID).Updates(map[string]interface{}{
+		"status":      DataJobFailed,
+		"error":       reason,
+		"input":       nil,
+		"finished_at": now,
+		"expires_at":  expiresAt,
+	}).Error
+}
+
+// DeleteExpiredJobs removes finished jobs, and imports that were never confirmed, once they have
+// expired.
+func (r *DataJobRepo) DeleteExpiredJobs(now time.Time) (int64, error) {
+	result := r.DB.Unscoped().Where("expires_at < ?", now).Delete(&DataJob{})
+	return result.RowsAffected, result.Error
+}
@@ -9,3 +9,96 @@ const (
 	StatusActive   ExerciseStatus = "active"
 	StatusArchived ExerciseStatus = "archived"
 )
+
+// DraftCleanup is what a user wants done with a new workout they started but abandoned.
+type DraftCleanup string
+
+const (
+	DraftCleanupFinish  DraftCleanup = "finish"  // Save it as it is
+	DraftCleanupDiscard DraftCleanup = "discard" // Delete it
+	DraftCleanupKeep    DraftCleanup = "keep"    // Leave it alone
+)
+
+// HeartRateZoneMethod is how a user's heart rate zones are worked out.
+type HeartRateZoneMethod string
+
+const (
+	ZonesFromMax       HeartRateZoneMethod = "max"       // Shares of max heart rate
+	ZonesFromReserve   HeartRateZoneMethod = "reserve"   // Shares of the reserve above resting heart rate, as Karvonen does
+	ZonesFromThreshold HeartRateZoneMethod = "threshold" // Shares of lactate threshold heart rate
+)
+
+// TokenScope is what a personal access token is allowed to do with the API.
+type TokenScope string
+
+const (
+	TokenScopeRead  TokenScope = "read"  // Only GET requests
+	TokenScopeWrite TokenScope = "write" // Anything the user can do
+)
+
+// WebhookEvent names something that happened which webhook endpoints can subscribe to.
+type WebhookEvent string
+
+const (
+	EventWorkoutFinished WebhookEvent = "workout.finished" // A new workout was saved
+	EventWorkoutUpdated  WebhookEvent = "workout.updated"  // A finished workout was edited or reverted
+	EventWorkoutDeleted  WebhookEvent = "workout.deleted"  // A finished workout was deleted
+	EventRecordAchieved  WebhookEvent = "record.achieved"  // A saved workout set new personal bests
+)
+
+// WebhookEvents lists every event, in the order they are offered to users.
+var WebhookEvents = []WebhookEvent{EventWorkoutFinished, EventWorkoutUpdated, EventWorkoutDeleted, EventRecordAchieved}
+
+// DeliveryStatus is where a webhook delivery has got to.
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"   // Waiting for its first or next attempt
+	DeliverySucceeded DeliveryStatus = "succeeded" // The endpoint answered with a 2xx
+	DeliveryFailed    DeliveryStatus = "failed"    // Every attempt failed, so it was given up on
+)
+
+// DataJobKind says whether a DataJob is getting data out or bringing it in.
+type DataJobKind string
+
+const (
+	DataJobExport DataJobKind = "export"
+	DataJobImport DataJobKind = "import"
+)
+
+// DataFormat is the file format a DataJob reads or writes.
+type DataFormat string
+
+const (
+	DataFormatCSV  DataFormat = "csv"  // A zip of CSV files, one each for activities, exercises and sets
+	DataFormatJSON DataFormat = "json" // A single structured document
+
+	// Imports from other apps. These are read-only: there is no exporting to them.
+	DataFormatStrong DataFormat = "strong" // The CSV export from the Strong app
+	DataFormatHevy   DataFormat = "hevy"   // The CSV export from the Hevy app
+
+	// Activities recorded on a watch or bike computer, one to a file.
+	DataFormatGPX DataFormat = "gpx"
+	DataFormatTCX DataFormat = "tcx"
+	DataFormatFIT DataFormat = "fit"
+)
+
+// DataJobStatus is where a DataJob has got to.
+type DataJobStatus string
+
+const (
+	DataJobPreview DataJobStatus = "preview" // An import from another app waiting for the user to check it
+	DataJobPending DataJobStatus = "pending"
+	DataJobRunning DataJobStatus = "running"
+	DataJobDone    DataJobStatus = "done"
+	DataJobFailed  DataJobStatus = "failed"
+)
+
+// StravaEventStatus is where an event pushed by Strava has got to.
+type StravaEventStatus string
+
+const (
+	StravaEventPending StravaEventStatus = "pending" // Waiting to be applied, or to be retried
+	StravaEventDone    StravaEventStatus = "done"    // Applied to the user's activities
+	StravaEventFailed  StravaEventStatus = "failed"  // Every attempt failed, so it was given up on
+)
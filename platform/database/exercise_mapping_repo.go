@@ -0,0 +1,37 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ExerciseMappingRepo struct {
+	DB *gorm.DB
+}
+
+// NewExerciseMappingRepo creates a new ExerciseMappingRepo
+func NewExerciseMappingRepo(db *gorm.DB) *ExerciseMappingRepo {
+	return &ExerciseMappingRepo{DB: db}
+}
+
+// GetMappings returns the exercises a user has matched up for an app, keyed by their lower-cased
+// name in that app.
+func (r *ExerciseMappingRepo) GetMappings(userID uint, source DataFormat) (map[string]*ExerciseMapping, error) {
+	var mappings []*ExerciseMapping
+	if err := r.DB.Where("user_id = ? AND source = ?", userID, source).Find(&mappings).Error; err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*ExerciseMapping, len(mappings))
+	for _, mapping := range mappings {
+		byName[mapping.ExternalName] = mapping
+	}
+	return byName, nil
+}
+
+// SaveMapping adds a mapping, or replaces the user's existing one for the same exercise.
+func (r *ExerciseMappingRepo) SaveMapping(mapping *ExerciseMapping) error {
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "source"}, {Name: "external_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"exercise_definition_id", "updated_at", "deleted_at"}),
+	}).Create(mapping).Error
+}
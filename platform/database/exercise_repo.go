@@ -29,6 +29,20 @@ func (r *ExerciseRepo) GetExerciseByID(exerciseID uint) (*ExerciseDefinition, er
 	return exercise, nil
 }
 
+// SetDefaultRestSeconds sets the rest timer length an exercise starts with, or clears it with nil.
+func (r *ExerciseRepo) SetDefaultRestSeconds(exerciseID uint, seconds *int) error {
+	return r.DB.Model(&ExerciseDefinition{}).Where("id = ?", exerciseID).Update("default_rest_seconds", seconds).Error
+}
+
+// GetExerciseByName returns the exercise with the given name, ignoring case.
+func (r *ExerciseRepo) GetExerciseByName(name string) (*ExerciseDefinition, error) {
+	var exercise ExerciseDefinition
+	if err := r.DB.Where("LOWER(name) = LOWER(?)", name).Order("id asc").First(&exercise).Error; err != nil {
+		return nil, err
+	}
+	return &exercise, nil
+}
+
 // GetExerciseList returns all exercises in the database
 func (r *ExerciseRepo) GetExerciseList() ([]*ExerciseDefinition, error) {
 	var exercises []*ExerciseDefinition
@@ -69,6 +83,57 @@ func (r *ExerciseRepo) SearchExercises(userID uint, search, muscleGroup string)
 	return exercises, err
 }
 
+// ListExercises returns one page of exercises sorted by name, optionally filtered by name
+// and muscle group, along with how many match in total.
+func (r *ExerciseRepo) ListExercises(search, muscleGroup string, offset, limit int) ([]*ExerciseDefinition, int64, error) {
+	query := r.DB.Model(&ExerciseDefinition{})
+	if search != "" {
+		query = query.Where("name ILIKE ?", "%"+search+"%")
+	}
+	if muscleGroup != "" {
+		query = query.Where("primary_muscle_group = ?", muscleGroup)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var exercises []*ExerciseDefinition
+	err := query.Order("name asc").Offset(offset).Limit(limit).Find(&exercises).Error
+	return exercises, total, err
+}
+
+// GetFavourites returns the exercises a user has favourited, sorted by name.
+func (r *ExerciseRepo) GetFavourites(userID uint) ([]*ExerciseDefinition, error) {
+	var exercises []*ExerciseDefinition
+	err := r.DB.
+		Joins("JOIN favourite_exercises ON favourite_exercises.exercise_definition_id = exercise_definitions.id").
+		Where("favourite_exercises.user_id = ? AND favourite_exercises.deleted_at IS NULL", userID).
+		Order("exercise_definitions.name asc").
+		Find(&exercises).Error
+	return exercises, err
+}
+
+// AddFavourite favourites an exercise for a user. Favouriting it again does nothing.
+func (r *ExerciseRepo) AddFavourite(userID, exerciseDefinitionID uint) error {
+	var count int64
+	err := r.DB.Model(&FavouriteExercises{}).
+		Where("user_id = ? AND exercise_definition_id = ?", userID, exerciseDefinitionID).
+		Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+	return r.DB.Create(&FavouriteExercises{UserID: userID, ExerciseDefinitionID: exerciseDefinitionID}).Error
+}
+
+// RemoveFavourite un-favourites an exercise for a user. The row is removed outright, as
+// SearchExercises joins on the table without checking for soft deletes.
+func (r *ExerciseRepo) RemoveFavourite(userID, exerciseDefinitionID uint) error {
+	return r.DB.Unscoped().Where("user_id = ? AND exercise_definition_id = ?", userID, exerciseDefinitionID).
+		Delete(&FavouriteExercises{}).Error
+}
+
 func (r *ExerciseRepo) GetUniqueMuscleGroups() ([]string, error) {
 	var muscleGroups []string
 
@@ -1,7 +1,11 @@
 package database
 
 //
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type GymExerciseRepo struct {
 	DB *gorm.DB
@@ -67,6 +71,25 @@ func (r *GymExerciseRepo) GetExercisesByActivityId(activityID uint) ([]*GymExerc
 	return gymExercise, result.Error
 }
 
+// GetPreviousExercise finds the most recent finished workout before the given time in which the
+// user did the same exercise, and returns that exercise with its sets and parent activity.
+func (r *GymExerciseRepo) GetPreviousExercise(userID, exerciseDefinitionID uint, before time.Time, excludeActivityID uint) (*GymExercise, error) {
+	var previous GymExercise
+	err := r.DB.
+		Joins("JOIN activities ON activities.id = gym_exercises.activity_id").
+		Where("activities.user_id = ? AND activities.status = ? AND activities.deleted_at IS NULL", userID, StatusActive).
+		Where("gym_exercises.exercise_definition_id = ?", exerciseDefinitionID).
+		Where("activities.activity_time < ? AND activities.id <> ?", before, excludeActivityID).
+		Order("activities.activity_time DESC").
+		Preload("Sets", func(db *gorm.DB) *gorm.DB { return db.Order("set_number ASC") }).
+		Preload("Activity").
+		First(&previous).Error
+	if err != nil {
+		return nil, err
+	}
+	return &previous, nil
+}
+
 // UpdateExercise updates a gym exercise in the database
 func (r *GymExerciseRepo) UpdateExercise(gymExercise *GymExercise) error {
 	result := r.DB.Model(&GymExercise{}).Updates(gymExercise)
@@ -1,7 +1,12 @@
 package database
 
 //
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
 
 type GymSetRepo struct {
 	DB *gorm.DB
@@ -31,6 +36,45 @@ func (r *GymSetRepo) UpdateSet(gymset *GymSet) error {
 	return result.Error
 }
 
+// UpdateSetValues updates the given columns of a set, including zero values, and returns the updated set.
+func (r *GymSetRepo) UpdateSetValues(setID uint, values map[string]interface{}) (*GymSet, error) {
+	var gymSet GymSet
+	err := r.DB.Model(&gymSet).
+		Clauses(clause.Returning{}).
+		Where("id = ?", setID).
+		Updates(values).Error
+	if err != nil {
+		return nil, err
+	}
+	if gymSet.ID == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &gymSet, nil
+}
+
+// SetCompletedAt marks a set as completed at the given time, or not completed if completedAt is nil.
+func (r *GymSetRepo) SetCompletedAt(setID uint, completedAt *time.Time) (*GymSet, error) {
+	var gymSet GymSet
+	err := r.DB.Model(&gymSet).
+		Clauses(clause.Returning{}).
+		Where("id = ?", setID).
+		Update("completed_at", completedAt).Error
+	if err != nil {
+		return nil, err
+	}
+	if gymSet.ID == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &gymSet, nil
+}
+
+// GetGymSetByID returns a single set by its ID
+func (r *GymSetRepo) GetGymSetByID(setID uint) (*GymSet, error) {
+	var gymSet GymSet
+	err := r.DB.First(&gymSet, setID).Error
+	return &gymSet, err
+}
+
 // CountByExerciseID counts how many sets exist for a specific exercise.
 func (r *GymSetRepo) CountByExerciseID(exerciseID uint64) (int64, error) {
 	var count int64
@@ -2,6 +2,7 @@ package database
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -29,6 +30,18 @@ END$$;
 		&GymSet{},
 		&GymExercise{},
 		&FavouriteExercises{},
+		&UserStreak{},
+		&PersonalRecord{},
+		&ExerciseRestSetting{},
+		&ActivityRevision{},
+		&PersonalAccessToken{},
+		&WebhookEndpoint{},
+		&WebhookDelivery{},
+		&DataJob{},
+		&ExerciseMapping{},
+		&StravaAccount{},
+		&StravaEvent{},
+		&ActivityStream{},
 	)
 	return err
 }
@@ -51,7 +64,39 @@ type User struct {
 	CurrentWeightKG    float64
 	UnitSystem         string               `gorm:"size:10"`
 	IsPT               bool                 `gorm:"default:false"`
+	IsAdmin            bool                 `gorm:"default:false"`
 	FavouriteExercises []ExerciseDefinition `gorm:"many2many:favourite_exercises;"`
+
+	// Streak settings. StreakRestDays is how many days in a row can be missed
+	// before the daily streak breaks, StreakWeeklyTarget is how many workouts
+	// a week counts towards the weekly streak.
+	StreakRestDays     int `gorm:"default:1"`
+	StreakWeeklyTarget int `gorm:"default:3"`
+
+	// Progression settings used to suggest the next weights for an exercise.
+	// When every set last time reached ProgressionTargetReps the suggested
+	// weight goes up by ProgressionIncrementKG.
+	ProgressionIncrementKG float64 `gorm:"default:2.5"`
+	ProgressionTargetReps  int     `gorm:"default:8"`
+
+	// DefaultRestSeconds is the rest timer length for exercises without their own default.
+	DefaultRestSeconds int `gorm:"default:90"`
+
+	// ActiveActivityID is the draft workout the user last worked on, so it can be
+	// picked up again from any device.
+	ActiveActivityID *uint `gorm:"index"`
+
+	// DraftCleanup is what happens to a new workout left unfinished for too long.
+	// Abandoned edits of finished workouts are always discarded.
+	DraftCleanup DraftCleanup `gorm:"size:20;default:'finish'"`
+
+	// Heart rate and power zone settings. A zero MaxHeartRate is estimated from Dob, and
+	// zones that need a setting that isn't there aren't shown.
+	HeartRateZoneMethod HeartRateZoneMethod `gorm:"size:20;default:'max'"`
+	MaxHeartRate        int
+	RestingHeartRate    int
+	ThresholdHeartRate  int
+	FTP                 int // Functional threshold power, in watts
 }
 
 type Activity struct {
@@ -61,14 +106,58 @@ type Activity struct {
 	Type               string         `gorm:"size:50;not null"`
 	ActivityTime       time.Time      `gorm:"not null"`
 	Name               string         `gorm:"size:255"`
-	Details            pq.StringArray `gorm:"type:jsonb"`
 	Status             ExerciseStatus `gorm:"type:exercise_status;default:'draft';not null"`
 	OriginalActivityID *uint          `gorm:"index"`
 	Notes              string         `gorm:"type:text"`
+	ShareToken         *string        `gorm:"uniqueIndex;size:64"`
+
+	// Timing for a live session. PausedSeconds is the total time spent paused
+	// so far and PausedAt is set while the session is paused.
+	StartTime     *time.Time
+	FinishTime    *time.Time
+	PausedAt      *time.Time
+	PausedSeconds int
+
+	// The running rest timer, if any. It is started when a set is completed and
+	// RestGymSetID is the set it follows.
+	RestStartedAt     *time.Time
+	RestTargetSeconds int
+	RestGymSetID      *uint
+
+	// Version goes up each time a finished workout is saved. An edit draft keeps the
+	// version it was copied from, and a snapshot of it, so that saving the draft can
+	// tell whether the workout was changed by someone else in the meantime.
+	Version      int     `gorm:"not null;default:1"`
+	BaseVersion  int
+	BaseSnapshot *string `gorm:"type:jsonb"`
+
+	// An activity synced from Strava, such as a run or a ride. StravaID is nil for workouts
+	// logged here, unless one was posted to Strava; then it is the activity made from it and
+	// StravaPostedVersion is the version last sent.
+	StravaID            *int64 `gorm:"uniqueIndex"`
+	StravaPostedVersion int
+	SportType           string `gorm:"size:50"` // Strava's sport type, e.g. "TrailRun"
+	DistanceMeters      float64
+	MovingSeconds       int
+	ElevationGainMeters float64
+	Polyline            string         `gorm:"type:text"`  // The route as an encoded polyline
+	Cardio              *CardioDetails `gorm:"type:jsonb"` // Speeds, heart rate and power, with splits and laps
 
 	GymExercises []GymExercise `gorm:"foreignKey:ActivityID"`
 }
 
+// ActivityStream holds the readings through a cardio activity, such as its heart rate second by
+// second. They run to thousands of points, so they are kept apart from the activity.
+type ActivityStream struct {
+	ActivityID uint     `gorm:"primaryKey;autoIncrement:false"`
+	Activity   Activity `gorm:"foreignKey:ActivityID"`
+	CreatedAt  time.Time
+	// Points is how many readings there are. A Strava activity without any, such as one entered
+	// by hand, is saved with none so that Strava isn't asked again.
+	Points  int
+	Streams Streams `gorm:"type:bytea"`
+}
+
 type ExerciseDefinition struct {
 	gorm.Model
 	Name               string
@@ -80,6 +169,7 @@ type ExerciseDefinition struct {
 	BodyPart           string         `gorm:"size:100"`
 	Equipment          string         `gorm:"size:100"`
 	SecondaryMuscles   pq.StringArray `gorm:"type:text[]"`
+	DefaultRestSeconds *int           // nil falls back to the user's default
 }
 
 type GymExercise struct {
@@ -116,4 +206,264 @@ type GymSet struct {
 	WeightKG      float64      `gorm:"not null" json:"weight"`
 	SetType       string       `gorm:"size:50" json:"set_type"`
 	Notes         string       `gorm:"type:text" json:"notes"`
+	CompletedAt   *time.Time   `json:"completed_at"`
+	RestSeconds   *int         `json:"rest_seconds"` // Rest actually taken after this set
+}
+
+// ActivityRevision is an earlier version of a finished workout, kept when the workout is
+// edited or reverted. Revisions are never changed once written.
+type ActivityRevision struct {
+	gorm.Model
+	ActivityID uint   `gorm:"uniqueIndex:idx_activity_revision"`
+	Version    int    `gorm:"uniqueIndex:idx_activity_revision"`
+	Snapshot   string `gorm:"type:jsonb;not null"`
+
+	Activity Activity `gorm:"foreignKey:ActivityID"`
+}
+
+// ExerciseRestSetting is a user's own rest timer length for an exercise, which
+// takes priority over the exercise's and the user's defaults.
+type ExerciseRestSetting struct {
+	gorm.Model
+	UserID               uint `gorm:"uniqueIndex:idx_user_exercise_rest"`
+	ExerciseDefinitionID uint `gorm:"uniqueIndex:idx_user_exercise_rest"`
+	RestSeconds          int  `gorm:"not null"`
+
+	User               User               `gorm:"foreignKey:UserID"`
+	ExerciseDefinition ExerciseDefinition `gorm:"foreignKey:ExerciseDefinitionID"`
+}
+
+// PersonalAccessToken lets scripts and apps use the API as a user without a browser session.
+// Only a hash of the token is stored; the token itself is shown once when it is created.
+// Revoking a token soft deletes it.
+type PersonalAccessToken struct {
+	gorm.Model
+	UserID     uint       `gorm:"index;not null"`
+	Name       string     `gorm:"size:100;not null"`
+	TokenHash  string     `gorm:"size:64;uniqueIndex;not null"`
+	Prefix     string     `gorm:"size:12"` // The start of the token, so users can tell them apart
+	Scope      TokenScope `gorm:"size:10;not null"`
+	LastUsedAt *time.Time
+
+	User User `gorm:"foreignKey:UserID"`
+}
+
+// WebhookEndpoint is a URL that is sent the events it subscribes to. An endpoint belongs to the
+// user who registered it and hears about their workouts, except for endpoints registered by an
+// admin without a user, which hear about everyone's.
+type WebhookEndpoint struct {
+	gorm.Model
+	UserID      *uint          `gorm:"index"`
+	URL         string         `gorm:"size:2048;not null"`
+	Description string         `gorm:"size:255"`
+	Secret      string         `gorm:"size:64;not null"` // Signs each payload so the receiver can check it came from us
+	Events      pq.StringArray `gorm:"type:text[];not null"`
+	Active      bool           `gorm:"not null;default:true"`
+
+	User       *User             `gorm:"foreignKey:UserID"`
+	Deliveries []WebhookDelivery `gorm:"foreignKey:EndpointID"`
+}
+
+// WebhookDelivery is one event queued for, or sent to, an endpoint. Deliveries double as the
+// queue the dispatcher works through and the log shown to the endpoint's owner.
+type WebhookDelivery struct {
+	gorm.Model
+	EndpointID     uint           `gorm:"index;not null"`
+	Event          WebhookEvent   `gorm:"size:50;not null"`
+	Payload        string         `gorm:"type:jsonb;not null"`
+	Status         DeliveryStatus `gorm:"size:20;not null;default:'pending'"`
+	Attempts       int            `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time      `gorm:"index"`
+	LastAttemptAt  *time.Time
+	ResponseStatus int
+	ResponseBody   string `gorm:"size:1024"` // The start of the last response, to help debugging
+	LastError      string `gorm:"size:1024"`
+	ReplayOfID     *uint  // The delivery this one was replayed from, if any
+
+	Endpoint WebhookEndpoint `gorm:"foreignKey:EndpointID"`
+}
+
+// DataJob is an export or import of a user's workouts, run in the background. The uploaded
+// file of an import is kept in Input and the file an export produces in Output, until the
+// job expires.
+type DataJob struct {
+	gorm.Model
+	UserID     uint          `gorm:"index;not null"`
+	Kind       DataJobKind   `gorm:"size:10;not null"`
+	Format     DataFormat    `gorm:"size:20;not null"`
+	Status     DataJobStatus `gorm:"size:10;not null;default:'pending'"`
+	FileName   string        `gorm:"size:255"`
+	WeightUnit string        `gorm:"size:3"` // kg or lbs, for imports from apps whose files don't say
+	TimeZone   string        `gorm:"size:64"` // The uploader's time zone, for imports from apps whose files give local times
+	Input      []byte        `gorm:"type:bytea"`
+	Output     []byte        `gorm:"type:bytea"`
+	Summary    string        // What the job did, e.g. how many workouts were imported
+	Error      string
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+	ExpiresAt  *time.Time `gorm:"index"`
+
+	User User `gorm:"foreignKey:UserID"`
+}
+
+// ExerciseMapping remembers which library exercise a user's exercise from another app is, so
+// the next import from that app doesn't have to ask. A nil ExerciseDefinitionID means the
+// user chose to leave that exercise out.
+type ExerciseMapping struct {
+	gorm.Model
+	UserID               uint       `gorm:"uniqueIndex:idx_exercise_mapping;not null"`
+	Source               DataFormat `gorm:"uniqueIndex:idx_exercise_mapping;size:20;not null"`
+	ExternalName         string     `gorm:"uniqueIndex:idx_exercise_mapping;size:255;not null"` // Lower-cased
+	ExerciseDefinitionID *uint
+
+	User               User                `gorm:"foreignKey:UserID"`
+	ExerciseDefinition *ExerciseDefinition `gorm:"foreignKey:ExerciseDefinitionID"`
+}
+
+// StravaAccount links a user to their Strava athlete, with the tokens to act for them.
+// SyncedThrough is the start of the newest activity synced so far, which the next sync carries
+// on from.
+type StravaAccount struct {
+	gorm.Model
+	UserID    uint  `gorm:"uniqueIndex;not null"`
+	AthleteID int64 `gorm:"uniqueIndex;not null"`
+
+	// The athlete's OAuth tokens, encrypted with the key in STRAVA_TOKEN_KEY
+	AccessToken    []byte `gorm:"type:bytea"`
+	RefreshToken   []byte `gorm:"type:bytea"`
+	TokenExpiresAt time.Time
+	Scope          string `gorm:"size:255"` // What the athlete allowed, e.g. "read,activity:read_all"
+
+	SyncedThrough *time.Time
+	LastSyncedAt  *time.Time
+	LastSyncError string
+
+	// Set while the user has chosen to post the workouts they finish to Strava. Workouts
+	// finished before then aren't posted.
+	PostWorkoutsSince *time.Time
+	LastPostError     string
+
+	User User `gorm:"foreignKey:UserID"`
+}
+
+// CanPostWorkouts reports whether the athlete allowed workouts to be posted to their account.
+func (a StravaAccount) CanPostWorkouts() bool {
+	return strings.Contains(a.Scope, "activity:write")
+}
+
+// StravaEvent is a change to an athlete or one of their activities, pushed by Strava's webhook
+// and queued to be applied in the background.
+type StravaEvent struct {
+	gorm.Model
+	ObjectType    string `gorm:"size:20;not null"` // "activity" or "athlete"
+	ObjectID      int64  `gorm:"not null"`
+	AspectType    string `gorm:"size:20;not null"` // "create", "update" or "delete"
+	OwnerID       int64  `gorm:"index;not null"`   // The athlete
+	Updates       string `gorm:"type:jsonb;not null;default:'{}'"`
+	EventTime     time.Time
+	Status        StravaEventStatus `gorm:"size:10;not null;default:'pending';index:idx_strava_event_due"`
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index:idx_strava_event_due"`
+	LastError     string
+	ProcessedAt   *time.Time
+}
+
+// UserStreak caches the streak figures for a user. It is rebuilt from the
+// user's finished activities whenever one is finalized, re-dated or deleted.
+type UserStreak struct {
+	gorm.Model
+	UserID uint `gorm:"uniqueIndex"`
+	User   User `gorm:"foreignKey:UserID"`
+
+	CurrentDaily     int
+	LongestDaily     int
+	CurrentWeekly    int
+	LongestWeekly    int
+	LastActivityDate *time.Time
+}
+
+// PersonalRecord is a best effort achieved in a workout. A new row is added each
+// time a record is beaten, so the current record is the highest value for its type.
+type PersonalRecord struct {
+	gorm.Model
+	UserID               uint `gorm:"index"`
+	ExerciseDefinitionID uint `gorm:"index"`
+	ActivityID           uint `gorm:"index"`
+
+	RecordType string  `gorm:"size:50;not null"` // e.g. "TOTAL_VOLUME", "1_REP_MAX", "5_REP_MAX"
+	Value      float64 // The record value (volume in kg, or weight in kg)
+
+	User               User               `gorm:"foreignKey:UserID"`
+	ExerciseDefinition ExerciseDefinition `gorm:"foreignKey:ExerciseDefinitionID"`
+}
+
+// Label describes the record type for display, e.g. "5 rep max" or "Total volume".
+func (p PersonalRecord) Label() string {
+	if p.RecordType == "TOTAL_VOLUME" {
+		return "Total volume"
+	}
+	return strings.ToLower(strings.ReplaceAll(p.RecordType, "_", " "))
+}
+
+// ActiveDuration is how long the session has run so far, or ran in total once finished,
+// not counting time spent paused. It is zero if the start time wasn't recorded.
+func (a Activity) ActiveDuration(now time.Time) time.Duration {
+	if a.StartTime == nil {
+		return 0
+	}
+	end := now
+	if a.FinishTime != nil {
+		end = *a.FinishTime
+	}
+	if a.PausedAt != nil && a.PausedAt.Before(end) {
+		end = *a.PausedAt
+	}
+	duration := end.Sub(*a.StartTime) - time.Duration(a.PausedSeconds)*time.Second
+	if duration < 0 {
+		return 0
+	}
+	return duration
+}
+
+// FromStrava reports whether the activity was synced from Strava rather than logged here.
+func (a Activity) FromStrava() bool {
+	return a.StravaID != nil && a.StravaPostedVersion == 0
+}
+
+// DistanceKM is how far a synced activity went, in kilometres.
+func (a Activity) DistanceKM() float64 {
+	return a.DistanceMeters / 1000
+}
+
+// IsCardio reports whether the activity is a run, ride or other session with cardio details,
+// whether synced from Strava or imported from a file, rather than a gym workout.
+func (a Activity) IsCardio() bool {
+	return a.Cardio != nil || a.FromStrava()
+}
+
+// CardioKind tells how a synced activity's pace is best shown.
+func (a Activity) CardioKind() CardioKind {
+	return CardioKindOf(a.SportType)
+}
+
+// MovingDuration is how long a synced activity spent moving.
+func (a Activity) MovingDuration() time.Duration {
+	return time.Duration(a.MovingSeconds) * time.Second
+}
+
+// RestRemaining is how long is left on the rest timer, which goes negative once
+// the target has passed. It is zero when no timer is running.
+func (a Activity) RestRemaining(now time.Time) time.Duration {
+	if a.RestStartedAt == nil {
+		return 0
+	}
+	return time.Duration(a.RestTargetSeconds)*time.Second - now.Sub(*a.RestStartedAt)
+}
+
+// RestDuration is the rest recorded after the set, or zero if none was.
+func (s GymSet) RestDuration() time.Duration {
+	if s.RestSeconds == nil {
+		return 0
+	}
+	return time.Duration(*s.RestSeconds) * time.Second
 }
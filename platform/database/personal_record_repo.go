@@ -0,0 +1,89 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PersonalRecordRepo struct {
+	DB *gorm.DB
+}
+
+// NewPersonalRecordRepo creates a new PersonalRecordRepo
+func NewPersonalRecordRepo(db *gorm.DB) *PersonalRecordRepo {
+	return &PersonalRecordRepo{DB: db}
+}
+
+// CreateRecord adds a newly achieved record to the database
+func (r *PersonalRecordRepo) CreateRecord(record *PersonalRecord) error {
+	return r.DB.Create(record).Error
+}
+
+// GetBestValue returns the user's current record value of a type for an exercise,
+// ignoring any records set by the excluded activity. It returns 0 if there is no record yet.
+func (r *PersonalRecordRepo) GetBestValue(userID, exerciseDefinitionID uint, recordType string, excludeActivityID uint) (float64, error) {
+	var best float64
+	err := r.DB.Model(&PersonalRecord{}).
+		Where("user_id = ? AND exercise_definition_id = ? AND record_type = ?", userID, exerciseDefinitionID, recordType).
+		Where("activity_id <> ?", excludeActivityID).
+		Select("COALESCE(MAX(value), 0)").
+		Row().
+		Scan(&best)
+	return best, err
+}
+
+// finishedSetsOf selects the user's sets of an exercise from finished workouts before a time,
+// leaving out the excluded activity and any set without reps or weight.
+func (r *PersonalRecordRepo) finishedSetsOf(userID, exerciseDefinitionID uint, before time.Time, excludeActivityID uint) *gorm.DB {
+	return r.DB.Model(&GymSet{}).
+		Joins("JOIN gym_exercises ON gym_exercises.id = gym_sets.gym_exercise_id AND gym_exercises.deleted_at IS NULL").
+		Joins("JOIN activities ON activities.id = gym_exercises.activity_id AND activities.deleted_at IS NULL").
+		Where("activities.user_id = ? AND activities.status = ?", userID, StatusActive).
+		Where("gym_exercises.exercise_definition_id = ?", exerciseDefinitionID).
+		Where("activities.activity_time < ? AND activities.id <> ?", before, excludeActivityID).
+		Where("gym_sets.reps > 0 AND gym_sets.weight_kg > 0")
+}
+
+// GetHeaviestFromSets returns the heaviest weight the user lifted for a number of reps in an
+// exercise, going by the sets of their finished workouts before a time rather than their records.
+// Records are only kept from when a workout is analysed, so this covers the workouts before that.
+func (r *PersonalRecordRepo) GetHeaviestFromSets(userID, exerciseDefinitionID uint, reps int, before time.Time, excludeActivityID uint) (float64, error) {
+	var best float64
+	err := r.finishedSetsOf(userID, exerciseDefinitionID, before, excludeActivityID).
+		Where("gym_sets.reps = ?", reps).
+		Select("COALESCE(MAX(gym_sets.weight_kg), 0)").
+		Row().
+		Scan(&best)
+	return best, err
+}
+
+// GetBestVolumeFromSets returns the most total volume the user lifted of an exercise in one
+// workout, going by the sets of their finished workouts before a time as GetHeaviestFromSets does.
+func (r *PersonalRecordRepo) GetBestVolumeFromSets(userID, exerciseDefinitionID uint, before time.Time, excludeActivityID uint) (float64, error) {
+	var best float64
+	volumes := r.finishedSetsOf(userID, exerciseDefinitionID, before, excludeActivityID).
+		Select("SUM(gym_sets.reps * gym_sets.weight_kg) AS volume").
+		Group("gym_exercises.activity_id")
+	err := r.DB.Table("(?) AS volumes", volumes).
+		Select("COALESCE(MAX(volume), 0)").
+		Row().
+		Scan(&best)
+	return best, err
+}
+
+// GetRecordsByActivityID returns the records that were set during an activity.
+func (r *PersonalRecordRepo) GetRecordsByActivityID(activityID uint) ([]*PersonalRecord, error) {
+	var records []*PersonalRecord
+	err := r.DB.
+		Where("activity_id = ?", activityID).
+		Preload("ExerciseDefinition").
+		Order("exercise_definition_id, record_type").
+		Find(&records).Error
+	return records, err
+}
+
+// DeleteRecordsByActivityID removes the records set by an activity so it can be re-analysed.
+func (r *PersonalRecordRepo) DeleteRecordsByActivityID(activityID uint) error {
+	return r.DB.Where("activity_id = ?", activityID).Delete(&PersonalRecord{}).Error
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RestRepo struct {
+	DB *gorm.DB
+
+	// watchers are the channels told about changes to each activity's rest timer
+	mu       sync.Mutex
+	watchers map[uint]map[chan struct{}]bool
+}
+
+// NewRestRepo creates a new RestRepo
+func NewRestRepo(db *gorm.DB) *RestRepo {
+	return &RestRepo{DB: db}
+}
+
+// GetRestSeconds works out how long the rest timer should run after a set of an exercise.
+// The user's own setting for the exercise wins, then the exercise's default, then the user's default.
+func (r *RestRepo) GetRestSeconds(userID uint, exerciseDefinitionID uint) (int, error) {
+	var setting ExerciseRestSetting
+	err := r.DB.Where("user_id = ? AND exercise_definition_id = ?", userID, exerciseDefinitionID).Limit(1).Find(&setting).Error
+	if err != nil {
+		return 0, err
+	}
+	if setting.ID != 0 {
+		return setting.RestSeconds, nil
+	}
+
+	var definition ExerciseDefinition
+	if err := r.DB.First(&definition, exerciseDefinitionID).Error; err != nil {
+		return 0, err
+	}
+	if definition.DefaultRestSeconds != nil {
+		return *definition.DefaultRestSeconds, nil
+	}
+
+	var user User
+	if err := r.DB.First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+	return user.DefaultRestSeconds, nil
+}
+
+// SetUserRestSeconds saves a user's own rest timer length for an exercise.
+func (r *RestRepo) SetUserRestSeconds(userID uint, exerciseDefinitionID uint, seconds int) error {
+	setting := ExerciseRestSetting{
+		UserID:               userID,
+		ExerciseDefinitionID: exerciseDefinitionID,
+		RestSeconds:          seconds,
+	}
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "exercise_definition_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rest_seconds", "updated_at"}),
+	}).Create(&setting).Error
+}
+
+// StartRest starts the rest timer on an activity after the given set. A timer that
+// is already running for another set is stopped first and its rest recorded.
+func (r *RestRepo) StartRest(activityID uint, gymSetID uint, targetSeconds int) error {
+	return r.changed(activityID, r.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := endRest(tx, activityID, now, true); err != nil {
+			return err
+		}
+		return tx.Model(&Activity{}).Where("id = ?", activityID).Updates(map[string]interface{}{
+			"rest_started_at":     now,
+			"rest_target_seconds": targetSeconds,
+			"rest_gym_set_id":     gymSetID,
+		}).Error
+	}))
+}
+
+// StopRest stops the rest timer on an activity, recording how long the rest was
+// against the set it followed.
+func (r *RestRepo) StopRest(activityID uint) error {
+	return r.changed(activityID, r.DB.Transaction(func(tx *gorm.DB) error {
+		return endRest(tx, activityID, time.Now(), true)
+	}))
+}
+
+// CancelRest clears the rest timer on an activity without recording anything,
+// for when the set it followed is no longer complete.
+func (r *RestRepo) CancelRest(activityID uint) error {
+	return r.changed(activityID, r.DB.Transaction(func(tx *gorm.DB) error {
+		return endRest(tx, activityID, time.Now(), false)
+	}))
+}
+
+// ExtendRest adds (or with a negative value, takes) seconds from the running rest timer.
+func (r *RestRepo) ExtendRest(activityID uint, seconds int) error {
+	return r.changed(activityID, r.DB.Model(&Activity{}).
+		Where("id = ? AND rest_started_at IS NOT NULL", activityID).
+		Update("rest_target_seconds", gorm.Expr("GREATEST(rest_target_seconds + ?, 0)", seconds)).Error)
+}
+
+// endRest clears the rest timer on an activity, if one is running, and optionally
+// stores the rest taken so far on the set it followed.
+func endRest(tx *gorm.DB, activityID uint, now time.Time, record bool) error {
+	var activity Activity
+	if err := tx.Select("id", "rest_started_at", "rest_gym_set_id").First(&activity, activityID).Error; err != nil {
+		return err
+	}
+	if activity.RestStartedAt == nil {
+		return nil
+	}
+
+	if record && activity.RestGymSetID != nil {
+		restSeconds := int(now.Sub(*activity.RestStartedAt).Seconds())
+		if err := tx.Model(&GymSet{}).Where("id = ?", *activity.RestGymSetID).Update("rest_seconds", restSeconds).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(&Activity{}).Where("id = ?", activityID).Updates(map[string]interface{}{
+		"rest_started_at":     nil,
+		"rest_target_seconds": 0,
+		"rest_gym_set_id":     nil,
+	}).Error
+}
+
+// GetRestTimer loads just the owner, status and rest timer of an activity, for checking on it often.
+func (r *RestRepo) GetRestTimer(activityID uint) (*Activity, error) {
+	var activity Activity
+	err := r.DB.Select("id", "user_id", "status", "finish_time", "rest_started_at", "rest_target_seconds", "rest_gym_set_id").First(&activity, activityID).Error
+	return &activity, err
+}
+
+// Watch returns a channel that is sent to whenever the rest timer of an activity is changed
+// through this repo, and a function to call when done watching. Sends are dropped rather than
+// queued while the last one hasn't been received yet.
+func (r *RestRepo) Watch(activityID uint) (<-chan struct{}, func()) {
+	changes := make(chan struct{}, 1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.watchers == nil {
+		r.watchers = make(map[uint]map[chan struct{}]bool)
+	}
+	if r.watchers[activityID] == nil {
+		r.watchers[activityID] = make(map[chan struct{}]bool)
+	}
+	r.watchers[activityID][changes] = true
+
+	return changes, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.watchers[activityID], changes)
+		if len(r.watchers[activityID]) == 0 {
+			delete(r.watchers, activityID)
+		}
+	}
+}
+
+// changed tells the activity's watchers that its rest timer changed, unless changing it failed.
+// It returns the error it was given.
+func (r *RestRepo) changed(activityID uint, err error) error {
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for changes := range r.watchers[activityID] {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RevisionRepo struct {
+	DB *gorm.DB
+}
+
+// NewRevisionRepo creates a new RevisionRepo
+func NewRevisionRepo(db *gorm.DB) *RevisionRepo {
+	return &RevisionRepo{DB: db}
+}
+
+// GetRevisionsByActivityID returns the earlier versions of a workout, newest first.
+func (r *RevisionRepo) GetRevisionsByActivityID(activityID uint) ([]*ActivityRevision, error) {
+	var revisions []*ActivityRevision
+	err := r.DB.Where("activity_id = ?", activityID).Order("version desc").Find(&revisions).Error
+	return revisions, err
+}
+
+// RevertToRevision puts a workout back the way it was at an earlier version. The version
+// being replaced is kept as a revision first, so a revert can itself be undone.
+func (r *RevisionRepo) RevertToRevision(activityID uint, version int) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var activity Activity
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "version").First(&activity, activityID).Error; err != nil {
+			return err
+		}
+
+		var revision ActivityRevision
+		if err := tx.Where("activity_id = ? AND version = ?", activityID, version).First(&revision).Error; err != nil {
+			return err
+		}
+		snapshot, err := DecodeSnapshot(revision.Snapshot)
+		if err != nil {
+			return err
+		}
+
+		if err := saveRevision(tx, activityID); err != nil {
+			return err
+		}
+		if err := replaceExercises(tx, activityID, snapshot.Exercises); err != nil {
+			return err
+		}
+		return tx.Model(&Activity{}).Where("id = ?", activityID).Updates(map[string]interface{}{
+			"name":          snapshot.Name,
+			"notes":         snapshot.Notes,
+			"activity_time": snapshot.ActivityTime,
+			"version":       gorm.Expr("version + 1"),
+		}).Error
+	})
+}
+
+// saveRevision stores the current contents of a workout as a revision of its current version.
+func saveRevision(tx *gorm.DB, activityID uint) error {
+	var activity Activity
+	if err := tx.Preload("GymExercises.Sets").
+		Preload("GymExercises.ExerciseDefinition").
+		First(&activity, activityID).Error; err != nil {
+		return err
+	}
+	snapshot, err := encodeSnapshot(SnapshotOf(&activity))
+	if err != nil {
+		return err
+	}
+
+	// A version is only ever saved once, so if it is already there it is left as it was.
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ActivityRevision{
+		ActivityID: activityID,
+		Version:    activity.Version,
+		Snapshot:   *snapshot,
+	}).Error
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// WorkoutSnapshot is a plain copy of what a workout contained at one point in time.
+// Edit drafts keep one of the workout they were copied from, so changes made to the
+// workout in the meantime can be told apart from the draft's own.
+type WorkoutSnapshot struct {
+	Name         string             `json:"name"`
+	Notes        string             `json:"notes"`
+	ActivityTime time.Time          `json:"activity_time"`
+	Exercises    []ExerciseSnapshot `json:"exercises"`
+}
+
+type ExerciseSnapshot struct {
+	ExerciseDefinitionID uint    `json:"exercise_definition_id"`
+	Name                 string  `json:"name"`
+	SupersetID           *string `json:"superset_id,omitempty"`
+	SupersetOrder        int     `json:"superset_order,omitempty"`
+	// SupersetPartner is the position in the workout of the exercise this one is paired with, as
+	// exercises are given new IDs whenever they are put back from a snapshot.
+	SupersetPartner *int          `json:"superset_partner,omitempty"`
+	Sets            []SetSnapshot `json:"sets"`
+}
+
+type SetSnapshot struct {
+	Reps        int        `json:"reps"`
+	WeightKG    float64    `json:"weight_kg"`
+	SetType     string     `json:"set_type,omitempty"`
+	Notes       string     `json:"notes,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	RestSeconds *int       `json:"rest_seconds,omitempty"`
+}
+
+// SnapshotOf copies an activity's contents, with its exercises and sets in order.
+// The exercises' definitions should be preloaded for their names to be kept.
+func SnapshotOf(activity *Activity) WorkoutSnapshot {
+	exercises := make([]GymExercise, len(activity.GymExercises))
+	copy(exercises, activity.GymExercises)
+	sort.SliceStable(exercises, func(i, j int) bool { return exercises[i].SortNumber < exercises[j].SortNumber })
+
+	snapshot := WorkoutSnapshot{
+		Name:         activity.Name,
+		Notes:        activity.Notes,
+		ActivityTime: activity.ActivityTime,
+	}
+	positions := make(map[uint]int, len(exercises))
+	for i, exercise := range exercises {
+		positions[exercise.ID] = i
+	}
+	for _, exercise := range exercises {
+		sets := make([]GymSet, len(exercise.Sets))
+		copy(sets, exercise.Sets)
+		sort.SliceStable(sets, func(i, j int) bool { return sets[i].SetNumber < sets[j].SetNumber })
+
+		exerciseSnapshot := ExerciseSnapshot{
+			ExerciseDefinitionID: exercise.ExerciseDefinitionID,
+			Name:                 exercise.ExerciseDefinition.Name,
+			SupersetID:           exercise.SupersetID,
+			SupersetOrder:        exercise.SupersetOrder,
+		}
+		if exercise.SupersetPartnerID != nil {
+			if position, ok := positions[*exercise.SupersetPartnerID]; ok {
+				exerciseSnapshot.SupersetPartner = &position
+			}
+		}
+		for _, set := range sets {
+			exerciseSnapshot.Sets = append(exerciseSnapshot.Sets, SetSnapshot{
+				Reps:        set.Reps,
+				WeightKG:    set.WeightKG,
+				SetType:     set.SetType,
+				Notes:       set.Notes,
+				CompletedAt: set.CompletedAt,
+				RestSeconds: set.RestSeconds,
+			})
+		}
+		snapshot.Exercises = append(snapshot.Exercises, exerciseSnapshot)
+	}
+	return snapshot
+}
+
+// restoreExercises turns a snapshot's exercises back into an activity's, in order and with their
+// sets. The exercises have no IDs yet, so partners gives the position of each one's superset
+// partner instead, or -1 if it has none.
+func restoreExercises(activityID uint, exercises []ExerciseSnapshot) (restored []GymExercise, partners []int) {
+	restored = make([]GymExercise, len(exercises))
+	partners = make([]int, len(exercises))
+	for i, exercise := range exercises {
+		restored[i] = GymExercise{
+			ActivityID:           activityID,
+			ExerciseDefinitionID: exercise.ExerciseDefinitionID,
+			SortNumber:           i,
+			SupersetID:           exercise.SupersetID,
+			SupersetOrder:        exercise.SupersetOrder,
+		}
+		for j, set := range exercise.Sets {
+			restored[i].Sets = append(restored[i].Sets, GymSet{
+				SetNumber:   j + 1,
+				Reps:        set.Reps,
+				WeightKG:    set.WeightKG,
+				SetType:     set.SetType,
+				Notes:       set.Notes,
+				CompletedAt: set.CompletedAt,
+				RestSeconds: set.RestSeconds,
+			})
+		}
+		partners[i] = -1
+		if partner := exercise.SupersetPartner; partner != nil && *partner >= 0 && *partner < len(exercises) && *partner != i {
+			partners[i] = *partner
+		}
+	}
+	return restored, partners
+}
+
+// SameSets reports whether two exercises have the same sets. Only what was lifted is
+// compared, not when the sets were done.
+func (e ExerciseSnapshot) SameSets(other ExerciseSnapshot) bool {
+	if e.ExerciseDefinitionID != other.ExerciseDefinitionID || len(e.Sets) != len(other.Sets) {
+		return false
+	}
+	for i, set := range e.Sets {
+		otherSet := other.Sets[i]
+		if set.Reps != otherSet.Reps || set.WeightKG != otherSet.WeightKG ||
+			set.SetType != otherSet.SetType || set.Notes != otherSet.Notes {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeSnapshot turns a snapshot into JSON for storing in a jsonb column.
+func encodeSnapshot(snapshot WorkoutSnapshot) (*string, error) {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	encoded := string(data)
+	return &encoded, nil
+}
+
+// DecodeSnapshot reads a snapshot stored by the repos.
+func DecodeSnapshot(data string) (WorkoutSnapshot, error) {
+	var snapshot WorkoutSnapshot
+	err := json.Unmarshal([]byte(data), &snapshot)
+	return snapshot, err
+}
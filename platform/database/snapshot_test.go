@@ -0,0 +1,74 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestRevertKeepsSupersets(t *testing.T) {
+	completed := time.Date(2026, 10, 19, 10, 5, 0, 0, time.UTC)
+	rest := 90
+	supersetID := "a1"
+	partnerOf := func(id uint) *uint { return &id }
+	activity := &Activity{
+		Name:         "Push",
+		ActivityTime: time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC),
+		GymExercises: []GymExercise{
+			// Out of order and with IDs that won't survive being put back.
+			{Model: gorm.Model{ID: 33}, ExerciseDefinitionID: 3, SortNumber: 2, SupersetID: &supersetID, SupersetOrder: 1, SupersetPartnerID: partnerOf(32),
+				ExerciseDefinition: ExerciseDefinition{Name: "Push Up"},
+				Sets:               []GymSet{{SetNumber: 1, Reps: 20}}},
+			{Model: gorm.Model{ID: 31}, ExerciseDefinitionID: 1, SortNumber: 0,
+				ExerciseDefinition: ExerciseDefinition{Name: "Squat (Barbell)"},
+				Sets:               []GymSet{{SetNumber: 2, Reps: 5, WeightKG: 100}, {SetNumber: 1, Reps: 5, WeightKG: 80, SetType: "warmup"}}},
+			{Model: gorm.Model{ID: 32}, ExerciseDefinitionID: 2, SortNumber: 1, SupersetID: &supersetID, SupersetPartnerID: partnerOf(33),
+				ExerciseDefinition: ExerciseDefinition{Name: "Bench Press (Barbell)"},
+				Sets:               []GymSet{{SetNumber: 1, Reps: 8, WeightKG: 60, CompletedAt: &completed, RestSeconds: &rest}}},
+		},
+	}
+
+	// Saved as a revision, then read back and put in place of the workout's exercises.
+	encoded, err := encodeSnapshot(SnapshotOf(activity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	revision, err := DecodeSnapshot(*encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if partner := revision.Exercises[1].SupersetPartner; partner == nil || *partner != 2 {
+		t.Fatalf("bench press partner saved as %v, want position 2", partner)
+	}
+
+	restored, partners := restoreExercises(7, revision.Exercises)
+	for i := range restored {
+		restored[i].ID = uint(100 + i)
+		restored[i].ExerciseDefinition.Name = revision.Exercises[i].Name
+	}
+	for i, partner := range partners {
+		if partner >= 0 {
+			restored[i].SupersetPartnerID = &restored[partner].ID
+		}
+	}
+	if restored[1].ActivityID != 7 || restored[1].SortNumber != 1 {
+		t.Errorf("restored bench press in activity %d at %d, want 7 at 1", restored[1].ActivityID, restored[1].SortNumber)
+	}
+	if got, want := SnapshotOf(&Activity{Name: activity.Name, ActivityTime: activity.ActivityTime, GymExercises: restored}), SnapshotOf(activity); !reflect.DeepEqual(got, want) {
+		t.Errorf("reverted to\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestRestoreExercisesDropsMissingPartners(t *testing.T) {
+	outside, self, first := 5, 1, 0
+	_, partners := restoreExercises(7, []ExerciseSnapshot{
+		{ExerciseDefinitionID: 1, SupersetPartner: &outside},
+		{ExerciseDefinitionID: 2, SupersetPartner: &self},
+		{ExerciseDefinitionID: 3, SupersetPartner: &first},
+	})
+	if want := []int{-1, -1, 0}; !reflect.DeepEqual(partners, want) {
+		t.Errorf("partners = %v, want %v", partners, want)
+	}
+}
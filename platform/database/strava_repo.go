@@ -0,0 +1,308 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StravaRepo struct {
+	DB *gorm.DB
+}
+
+// NewStravaRepo creates a new StravaRepo
+func NewStravaRepo(db *gorm.DB) *StravaRepo {
+	return &StravaRepo{DB: db}
+}
+
+// GetAccountByUserID returns the Strava account a user has linked, or nil if they haven't.
+func (r *StravaRepo) GetAccountByUserID(userID uint) (*StravaAccount, error) {
+	var account StravaAccount
+	err := r.DB.Where("user_id = ?", userID).First(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// GetAccounts returns every linked Strava account.
+func (r *StravaRepo) GetAccounts() ([]*StravaAccount, error) {
+	var accounts []*StravaAccount
+	err := r.DB.Order("id").Find(&accounts).Error
+	return accounts, err
+}
+
+// GetAccountByAthleteID returns the account linked to a Strava athlete, or nil if there isn't one.
+func (r *StravaRepo) GetAccountByAthleteID(athleteID int64) (*StravaAccount, error) {
+	var account StravaAccount
+	err := r.DB.Where("athlete_id = ?", athleteID).First(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// SaveAccount links a user to a Strava athlete, or replaces the athlete and tokens if the user
+// has linked one before.
+func (r *StravaRepo) SaveAccount(account *StravaAccount) error {
+	return r.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"athlete_id", "access_token", "refresh_token", "token_expires_at", "scope", "synced_through", "last_sync_error", "updated_at",
+		}),
+	}).Create(account).Error
+}
+
+// UpdateTokens saves an account's tokens after they are refreshed.
+func (r *StravaRepo) UpdateTokens(accountID uint, accessToken, refreshToken []byte, expiresAt time.Time) error {
+	return r.DB.Model(&StravaAccount{}).Where("id = ?", accountID).Updates(map[string]interface{}{
+		"access_token":     accessToken,
+		"refresh_token":    refreshToken,
+		"token_expires_at": expiresAt,
+	}).Error
+}
+
+// DeleteAccount unlinks a Strava athlete, forgetting their tokens.
+func (r *StravaRepo) DeleteAccount(accountID uint) error {
+	return r.DB.Unscoped().Delete(&StravaAccount{}, accountID).Error
+}
+
+// DeleteStravaActivities removes every activity synced from Strava for a user for good, so they
+// come back if the user links Strava again. Workouts posted to Strava from here are kept.
+func (r *StravaRepo) DeleteStravaActivities(userID uint) (int64, error) {
+	return r.deleteSyncedActivities("user_id = ? AND strava_id IS NOT NULL AND strava_posted_version = 0", userID)
+}
+
+// deleteSyncedActivities removes the activities matching a condition for good, with their streams.
+func (r *StravaRepo) deleteSyncedActivities(query string, args ...interface{}) (int64, error) {
+	var deleted int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		synced := tx.Unscoped().Model(&Activity{}).Select("id").Where(query, args...)
+		if err := tx.Where("activity_id IN (?)", synced).Delete(&ActivityStream{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where(query, args...).Delete(&Activity{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
+}
+
+// RecordSync records how a sync of an account went. through is left alone if nil.
+func (r *StravaRepo) RecordSync(accountID uint, through *time.Time, now time.Time, syncErr error) error {
+	updates := map[string]interface{}{"last_synced_at": now, "last_sync_error": ""}
+	if through != nil {
+		updates["synced_through"] = *through
+	}
+	if syncErr != nil {
+		updates["last_sync_error"] = syncErr.Error()
+	}
+	return r.DB.Model(&StravaAccount{}).Where("id = ?", accountID).Updates(updates).Error
+}
+
+// SaveStravaActivity adds an activity synced from Strava, or updates the one already synced with
+// the same Strava ID. It reports whether the activity was new.
+func (r *StravaRepo) SaveStravaActivity(activity *Activity) (bool, error) {
+	created := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var existing Activity
+		err := tx.Unscoped().Where("strava_id = ?", activity.StravaID).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			activity.Status = StatusActive
+			created = true
+			return tx.Omit("User").Create(activity).Error
+		}
+		if err != nil {
+			return err
+		}
+		if existing.DeletedAt.Valid || existing.StravaPostedVersion > 0 {
+			// The user deleted it here, so it stays deleted, or it is a workout posted from here
+			// and Strava's copy has less in it
+			activity.ID = existing.ID
+			return nil
+		}
+
+		activity.ID = existing.ID
+		cardio, polyline := activity.Cardio, activity.Polyline
+		if cardio != nil && !cardio.Detailed && existing.Cardio != nil && existing.Cardio.Detailed {
+			// A summary from a list would lose the splits, laps and full route already saved
+			merged := *cardio
+			merged.Detailed = true
+			merged.Splits, merged.Laps, merged.Calories = existing.Cardio.Splits, existing.Cardio.Laps, existing.Cardio.Calories
+			cardio, polyline = &merged, existing.Polyline
+		}
+		updates := map[string]interface{}{
+			"type":                  activity.Type,
+			"sport_type":            activity.SportType,
+			"name":                  activity.Name,
+			"activity_time":         activity.ActivityTime,
+			"start_time":            activity.StartTime,
+			"finish_time":           activity.FinishTime,
+			"distance_meters":       activity.DistanceMeters,
+			"moving_seconds":        activity.MovingSeconds,
+			"elevation_gain_meters": activity.ElevationGainMeters,
+			"polyline":              polyline,
+			"cardio":                cardio,
+		}
+		if activity.Notes != "" {
+			// Strava only gives the description with the full activity, not in lists
+			updates["notes"] = activity.Notes
+		}
+		return tx.Model(&existing).Updates(updates).Error
+	})
+	return created, err
+}
+
+// EnqueueEvent queues an event pushed by Strava to be applied straight away.
+func (r *StravaRepo) EnqueueEvent(event *StravaEvent) error {
+	if event.Updates == "" {
+		event.Updates = "{}"
+	}
+	event.Status = StravaEventPending
+	return r.DB.Create(event).Error
+}
+
+// ClaimDueEvents takes up to limit pending events that are due, oldest first. Each is pushed
+// back by lease first, so another processor won't take it as well, and so it is retried if this
+// one stops before recording the outcome.
+func (r *StravaRepo) ClaimDueEvents(now time.Time, lease time.Duration, limit int) ([]*StravaEvent, error) {
+	var events []*StravaEvent
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", StravaEventPending, now).
+			Order("event_time asc, id asc").
+			Limit(limit).
+			Find(&events).Error
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		ids := make([]uint, 0, len(events))
+		for _, event := range events {
+			ids = append(ids, event.ID)
+		}
+		return tx.Model(&StravaEvent{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	return events, err
+}
+
+// RecordEventAttempt saves the outcome of an attempt to apply an event. A pending status with a
+// NextAttemptAt queues it to be tried again.
+func (r *StravaRepo) RecordEventAttempt(event *StravaEvent) error {
+	return r.DB.Model(&StravaEvent{}).Where("id = ?", event.ID).Updates(map[string]interface{}{
+		"status":          event.Status,
+		"attempts":        event.Attempts,
+		"next_attempt_at": event.NextAttemptAt,
+		"last_error":      event.LastError,
+		"processed_at":    event.ProcessedAt,
+	}).Error
+}
+
+// DeleteEventsBefore removes events that were settled before the given time.
+func (r *StravaRepo) DeleteEventsBefore(before time.Time) (int64, error) {
+	result := r.DB.Unscoped().Where("status <> ? AND updated_at < ?", StravaEventPending, before).Delete(&StravaEvent{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteStravaActivity removes one of a user's activities that was deleted on Strava, reporting
+// whether it had been synced. A workout posted from here stays, as only Strava's copy went.
+func (r *StravaRepo) DeleteStravaActivity(userID uint, stravaID int64) (bool, error) {
+	deleted, err := r.deleteSyncedActivities("user_id = ? AND strava_id = ? AND strava_posted_version = 0", userID, stravaID)
+	return deleted > 0, err
+}
+
+// SetPostWorkouts turns posting finished workouts to Strava on from the given time, or off if
+// since is nil.
+func (r *StravaRepo) SetPostWorkouts(accountID uint, since *time.Time) error {
+	return r.DB.Model(&StravaAccount{}).Where("id = ?", accountID).Updates(map[string]interface{}{
+		"post_workouts_since": since,
+		"last_post_error":     "",
+	}).Error
+}
+
+// GetPostingAccounts returns the accounts whose users post their workouts to Strava.
+func (r *StravaRepo) GetPostingAccounts() ([]*StravaAccount, error) {
+	var accounts []*StravaAccount
+	err := r.DB.Where("post_workouts_since IS NOT NULL").Order("id").Find(&accounts).Error
+	return accounts, err
+}
+
+// GetWorkoutsToPost returns up to limit of an account's workouts, oldest first, that haven't been
+// posted to Strava since they were finished or last edited, with their exercises and sets.
+func (r *StravaRepo) GetWorkoutsToPost(account *StravaAccount, limit int) ([]*Activity, error) {
+	var activities []*Activity
+	if account.PostWorkoutsSince == nil {
+		return activities, nil
+	}
+	err := r.DB.
+		Preload("GymExercises", func(db *gorm.DB) *gorm.DB { return db.Order("sort_number asc, id asc") }).
+		Preload("GymExercises.ExerciseDefinition").
+		Preload("GymExercises.Sets", func(db *gorm.DB) *gorm.DB { return db.Order("set_number asc, id asc") }).
+		Where("user_id = ? AND status = ? AND type = ?", account.UserID, StatusActive, "GYM_WORKOUT").
+		Where("finish_time >= ?", *account.PostWorkoutsSince).
+		Where("strava_posted_version < version").
+		Where("strava_id IS NULL OR strava_posted_version > 0").
+		Order("finish_time asc, id asc").
+		Limit(limit).
+		Find(&activities).Error
+	return activities, err
+}
+
+// MarkPosted records that a version of a workout has been posted to Strava, as the given
+// activity. A nil stravaID leaves the activity it was posted as before, if any.
+func (r *StravaRepo) MarkPosted(activityID uint, stravaID *int64, version int) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"strava_posted_version": version}
+		if stravaID != nil {
+			updates["strava_id"] = *stravaID
+			// A sync or push event may have brought Strava's copy in before now
+			err := tx.Unscoped().Where("strava_id = ? AND strava_posted_version = 0 AND id <> ?", *stravaID, activityID).Delete(&Activity{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&Activity{}).Where("id = ?", activityID).Updates(updates).Error
+	})
+}
+
+// RecordPost records how posting an account's workouts went.
+func (r *StravaRepo) RecordPost(accountID uint, postErr error) error {
+	message := ""
+	if postErr != nil {
+		message = postErr.Error()
+	}
+	return r.DB.Model(&StravaAccount{}).Where("id = ?", accountID).Update("last_post_error", message).Error
+}
+
+// GetActivitiesWithoutStreams returns up to limit of a user's activities synced from Strava since
+// the given time whose readings haven't been fetched yet, newest first.
+func (r *StravaRepo) GetActivitiesWithoutStreams(userID uint, since time.Time, limit int) ([]*Activity, error) {
+	var activities []*Activity
+	err := r.DB.Scopes(withoutStreams).
+		Where("user_id = ? AND activity_time >= ?", userID, since).
+		Order("activity_time desc, id desc").
+		Limit(limit).
+		Find(&activities).Error
+	return activities, err
+}
+
+// SaveStreams saves the readings through a synced activity, replacing any it had.
+func (r *StravaRepo) SaveStreams(activityID uint, streams Streams) error {
+	_, err := saveStreams(r.DB, activityID, streams)
+	return err
+}
+
+// withoutStreams limits a query to finished activities synced from Strava with no readings saved,
+// not even the empty ones saved for an activity that has none.
+func withoutStreams(db *gorm.DB) *gorm.DB {
+	return db.Where("activities.status = ? AND activities.strava_id IS NOT NULL AND activities.strava_posted_version = 0", StatusActive).
+		Where("NOT EXISTS (SELECT 1 FROM activity_streams WHERE activity_streams.activity_id = activities.id)")
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"fitness/platform/streak"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StreakRepo struct {
+	DB *gorm.DB
+}
+
+// NewStreakRepo creates a new StreakRepo
+func NewStreakRepo(db *gorm.DB) *StreakRepo {
+	return &StreakRepo{DB: db}
+}
+
+// GetStreakByUserID returns the stored streak for a user, or an empty one if none has been calculated yet.
+func (r *StreakRepo) GetStreakByUserID(userID uint) (*UserStreak, error) {
+	var userStreak UserStreak
+	err := r.DB.Where("user_id = ?", userID).Limit(1).Find(&userStreak).Error
+	if err != nil {
+		return nil, err
+	}
+	userStreak.UserID = userID
+	return &userStreak, nil
+}
+
+// RecalculateStreak rebuilds a user's streak from their finished activities and saves it.
+func (r *StreakRepo) RecalculateStreak(userID uint) (*UserStreak, error) {
+	var user User
+	if err := r.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var activityTimes []time.Time
+	err := r.DB.Model(&Activity{}).
+		Where("user_id = ? AND status = ?", userID, StatusActive).
+		Pluck("activity_time", &activityTimes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := streak.Calculate(activityTimes, time.Now(), user.StreakRestDays, user.StreakWeeklyTarget)
+	userStreak := &UserStreak{
+		UserID:           userID,
+		CurrentDaily:     result.CurrentDaily,
+		LongestDaily:     result.LongestDaily,
+		CurrentWeekly:    result.CurrentWeekly,
+		LongestWeekly:    result.LongestWeekly,
+		LastActivityDate: result.LastActivityDate,
+	}
+
+	// Upsert on user_id so there is only ever one streak row per user.
+	err = r.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"current_daily", "longest_daily", "current_weekly", "longest_weekly", "last_activity_date", "updated_at",
+		}),
+	}).Create(userStreak).Error
+	return userStreak, err
+}
+
+// GetDailyActivityCounts returns the number of finished activities per day for a user since the given time.
+// The map is keyed by the date in "2006-01-02" format, on the days streaks count them on.
+func (r *StreakRepo) GetDailyActivityCounts(userID uint, since time.Time) (map[string]int, error) {
+	var activityTimes []time.Time
+	err := r.DB.Model(&Activity{}).
+		Where("user_id = ? AND status = ? AND activity_time >= ?", userID, StatusActive, since).
+		Pluck("activity_time", &activityTimes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, t := range activityTimes {
+		counts[streak.Day(t).Format("2006-01-02")]++
+	}
+	return counts, nil
+}
@@ -0,0 +1,206 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// StreamKind is one of the readings recorded through a cardio activity, named as Strava names
+// its streams.
+type StreamKind string
+
+const (
+	StreamTime      StreamKind = "time"            // Seconds from the start
+	StreamDistance  StreamKind = "distance"        // Metres
+	StreamAltitude  StreamKind = "altitude"        // Metres
+	StreamSpeed     StreamKind = "velocity_smooth" // Metres a second
+	StreamHeartRate StreamKind = "heartrate"       // Beats a minute
+	StreamCadence   StreamKind = "cadence"         // Steps or revolutions a minute
+	StreamWatts     StreamKind = "watts"
+)
+
+// StreamKinds are the streams that are kept, in the order they are stored. New kinds go on the
+// end, as their place in the list is what is stored.
+var StreamKinds = []StreamKind{
+	StreamTime,
+	StreamDistance,
+	StreamAltitude,
+	StreamSpeed,
+	StreamHeartRate,
+	StreamCadence,
+	StreamWatts,
+}
+
+// streamScales is how many stored units make one of each stream's, so that readings can be kept
+// as whole numbers: distance and altitude to the decimetre, and speed to the centimetre.
+var streamScales = map[StreamKind]float64{
+	StreamDistance: 10,
+	StreamAltitude: 10,
+	StreamSpeed:    100,
+}
+
+// streamsVersion starts the stored form of streams, in case it has to change.
+const streamsVersion = 1
+
+// Streams are the readings through an activity. Each is as long as the time stream, with a zero
+// for a reading the device didn't take.
+type Streams map[StreamKind][]float64
+
+// Len is how many readings there are of each stream.
+func (s Streams) Len() int {
+	return len(s[StreamTime])
+}
+
+// Value stores the streams compactly. Each is rounded to its scale and written as the varint
+// differences from one reading to the next, which are mostly a byte or two.
+func (s Streams) Value() (driver.Value, error) {
+	if s.Len() == 0 {
+		return nil, nil
+	}
+	b := []byte{streamsVersion}
+	for i, kind := range StreamKinds {
+		values, ok := s[kind]
+		if !ok {
+			continue
+		}
+		if len(values) != s.Len() {
+			return nil, fmt.Errorf("the %s stream has %d readings, not %d", kind, len(values), s.Len())
+		}
+		scale := streamScale(kind)
+		b = append(b, byte(i))
+		b = binary.AppendUvarint(b, uint64(len(values)))
+		var previous int64
+		for _, value := range values {
+			scaled := int64(math.Round(value * scale))
+			b = binary.AppendVarint(b, scaled-previous)
+			previous = scaled
+		}
+	}
+	return b, nil
+}
+
+// Scan reads streams back from how Value stored them.
+func (s *Streams) Scan(value interface{}) error {
+	*s = nil
+	if value == nil {
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("streams must be bytes")
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	if b[0] != streamsVersion {
+		return fmt.Errorf("streams are stored in an unknown version %d", b[0])
+	}
+
+	streams := Streams{}
+	for pos := 1; pos < len(b); {
+		index := int(b[pos])
+		pos++
+		if index >= len(StreamKinds) {
+			return fmt.Errorf("streams hold an unknown kind %d", index)
+		}
+		count, n := binary.Uvarint(b[pos:])
+		if n <= 0 || count > uint64(len(b)) {
+			return errors.New("streams are cut short")
+		}
+		pos += n
+
+		kind := StreamKinds[index]
+		scale := streamScale(kind)
+		values := make([]float64, count)
+		var previous int64
+		for i := range values {
+			delta, n := binary.Varint(b[pos:])
+			if n <= 0 {
+				return errors.New("streams are cut short")
+			}
+			pos += n
+			previous += delta
+			values[i] = float64(previous) / scale
+		}
+		streams[kind] = values
+	}
+	*s = streams
+	return nil
+}
+
+func streamScale(kind StreamKind) float64 {
+	if scale, ok := streamScales[kind]; ok {
+		return scale
+	}
+	return 1
+}
+
+// Downsample returns the streams with no more than points readings, each the average of the
+// readings over an equal stretch of time. A long ride can have tens of thousands of readings,
+// far more than a chart can show. The streams are returned as they are if they are short enough.
+// Heart rate and cadence are averaged over only the readings that were taken, as a zero there is a
+// gap rather than a reading.
+func (s Streams) Downsample(points int) Streams {
+	total := s.Len()
+	if points < 2 || total <= points {
+		return s
+	}
+	times := s[StreamTime]
+	start, span := times[0], times[total-1]-times[0]
+	if span <= 0 {
+		return s
+	}
+	bucketOf := func(t float64) int {
+		return min(int(float64(points)*(t-start)/span), points-1)
+	}
+
+	downsampled := Streams{}
+	for kind := range s {
+		downsampled[kind] = make([]float64, 0, points)
+	}
+	for from := 0; from < total; {
+		// Readings are in time order, so each bucket runs on until one falls in the next
+		bucket := bucketOf(times[from])
+		to := from + 1
+		for to < total && bucketOf(times[to]) <= bucket {
+			to++
+		}
+		for kind, values := range s {
+			var sum, count float64
+			for _, value := range values[from:to] {
+				if value == 0 && zeroIsGap(kind) {
+					continue
+				}
+				sum += value
+				count++
+			}
+			average := 0.0
+			if count > 0 {
+				average = sum / count
+			}
+			downsampled[kind] = append(downsampled[kind], average)
+		}
+		from = to
+	}
+	return downsampled
+}
+
+// zeroIsGap tells whether a zero in a stream of the given kind means the device took no reading.
+// A zero speed or altitude is a real one, and so is zero power, from freewheeling.
+func zeroIsGap(kind StreamKind) bool {
+	return kind == StreamHeartRate || kind == StreamCadence
+}
+
+// Only returns the time stream and those of the given kinds that there are.
+func (s Streams) Only(kinds ...StreamKind) Streams {
+	only := Streams{StreamTime: s[StreamTime]}
+	for _, kind := range kinds {
+		if values, ok := s[kind]; ok {
+			only[kind] = values
+		}
+	}
+	return only
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStreamsValueScan(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		streams Streams
+		want    Streams // What is read back, if not the same
+	}{
+		{
+			name: "every kind",
+			streams: Streams{
+				StreamTime:      {0, 1, 2, 4, 5},
+				StreamDistance:  {0, 2.5, 5.1, 9.9, 12.3},
+				StreamAltitude:  {10.2, 8.7, -0.4, -3.1, 4},
+				StreamSpeed:     {0, 2.5, 2.61, 2.4, 2.45},
+				StreamHeartRate: {0, 120, 131, 0, 129},
+				StreamCadence:   {0, 82, 85, 85, 0},
+				StreamWatts:     {0, 250, 180, 310, 0},
+			},
+		},
+		{
+			name: "readings finer than they are kept",
+			streams: Streams{
+				StreamTime:     {0, 1},
+				StreamDistance: {0.04, 3.06},
+				StreamSpeed:    {3.14159, -0.004},
+			},
+			want: Streams{
+				StreamTime:     {0, 1},
+				StreamDistance: {0, 3.1},
+				StreamSpeed:    {3.14, 0},
+			},
+		},
+		{
+			name:    "big jumps either way",
+			streams: Streams{StreamTime: {0, 1e6, 1}, StreamAltitude: {8848, -430.5, 8848}},
+		},
+	} {
+		value, err := test.streams.Value()
+		if err != nil {
+			t.Errorf("%s: Value = %v", test.name, err)
+			continue
+		}
+		var got Streams
+		if err := got.Scan(value); err != nil {
+			t.Errorf("%s: Scan = %v", test.name, err)
+			continue
+		}
+		want := test.want
+		if want == nil {
+			want = test.streams
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: read back %v, want %v", test.name, got, want)
+		}
+	}
+}
+
+func TestStreamsValueErrors(t *testing.T) {
+	if value, err := (Streams{}).Value(); value != nil || err != nil {
+		t.Errorf("no streams: Value = %v, %v, want nil", value, err)
+	}
+	if _, err := (Streams{StreamTime: {0, 1, 2}, StreamWatts: {100, 200}}).Value(); err == nil {
+		t.Error("streams of different lengths: Value didn't fail")
+	}
+}
+
+func TestStreamsScanErrors(t *testing.T) {
+	valid, err := Streams{StreamTime: {0, 1, 2}, StreamHeartRate: {100, 150, 200}}.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := valid.([]byte)
+
+	for _, test := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"cut short in a reading", stored[:len(stored)-1]},
+		{"cut short before the readings", stored[:len(stored)-3]},
+		{"cut short in the count", []byte{streamsVersion, 0}},
+		{"an unknown version", append([]byte{streamsVersion + 1}, stored[1:]...)},
+		{"an unknown kind", []byte{streamsVersion, byte(len(StreamKinds)), 1, 0}},
+		{"a count longer than the data", []byte{streamsVersion, 0, 200, 1, 0}},
+		{"not bytes", "streams"},
+	} {
+		streams := Streams{StreamTime: {1}}
+		if err := streams.Scan(test.value); err == nil {
+			t.Errorf("%s: Scan didn't fail, read %v", test.name, streams)
+		}
+	}
+
+	for _, value := range []interface{}{nil, []byte{}} {
+		streams := Streams{StreamTime: {1}}
+		if err := streams.Scan(value); err != nil || streams != nil {
+			t.Errorf("Scan(%v) = %v, %v, want no streams", value, streams, err)
+		}
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	streams := Streams{
+		StreamTime:      {0, 1, 2, 3, 4, 5, 6, 7},
+		StreamAltitude:  {2, 0, 0, 2, 4, 4, 6, 6},
+		StreamHeartRate: {0, 120, 0, 130, 0, 0, 150, 160},
+		StreamWatts:     {200, 0, 0, 100, 0, 0, 0, 0},
+	}
+	got := streams.Downsample(4)
+	want := Streams{
+		StreamTime:      {0.5, 2.5, 4.5, 6.5},
+		StreamAltitude:  {1, 1, 4, 6},
+		StreamHeartRate: {120, 130, 0, 155},
+		StreamWatts:     {100, 50, 0, 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Downsample(4) = %v, want %v", got, want)
+	}
+
+	if got := streams.Downsample(8); !reflect.DeepEqual(got, streams) {
+		t.Errorf("Downsample(8) = %v, want the streams as they are", got)
+	}
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// tokenTouchInterval is how stale LastUsedAt may get, so a busy script doesn't write on every request.
+const tokenTouchInterval = time.Minute
+
+type TokenRepo struct {
+	DB *gorm.DB
+}
+
+// NewTokenRepo creates a new TokenRepo
+func NewTokenRepo(db *gorm.DB) *TokenRepo {
+	return &TokenRepo{DB: db}
+}
+
+// HashToken returns the hash a personal access token is stored and looked up by.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateToken stores a new personal access token. The token's hash must already be set.
+func (r *TokenRepo) CreateToken(token *PersonalAccessToken) error {
+	return r.DB.Create(token).Error
+}
+
+// GetTokensByUserID returns a user's tokens that haven't been revoked, newest first.
+func (r *TokenRepo) GetTokensByUserID(userID uint) ([]*PersonalAccessToken, error) {
+	var tokens []*PersonalAccessToken
+	err := r.DB.Where("user_id = ?", userID).Order("created_at desc").Find(&tokens).Error
+	return tokens, err
+}
+
+// GetTokenByValue finds the unrevoked token matching the one presented by a client.
+func (r *TokenRepo) GetTokenByValue(value string) (*PersonalAccessToken, error) {
+	var token PersonalAccessToken
+	if err := r.DB.Where("token_hash = ?", HashToken(value)).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// TouchToken records that a token was just used.
+func (r *TokenRepo) TouchToken(tokenID uint, now time.Time) error {
+	return r.DB.Model(&PersonalAccessToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", tokenID, now.Add(-tokenTouchInterval)).
+		Update("last_used_at", now).Error
+}
+
+// RevokeToken revokes one of a user's tokens so it can no longer be used.
+func (r *TokenRepo) RevokeToken(userID, tokenID uint) error {
+	result := r.DB.Where("id = ? AND user_id = ?", tokenID, userID).Delete(&PersonalAccessToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -36,7 +36,28 @@ func (r *UserRepo) GetUserById(id uint64) (*User, error) {
 	return &user, nil
 }
 
+// SetActiveActivity records the draft workout a user is working on, or clears it if activityID is nil.
+func (r *UserRepo) SetActiveActivity(userID uint, activityID *uint) error {
+	return r.DB.Model(&User{}).Where("id = ?", userID).Update("active_activity_id", activityID).Error
+}
+
 func (r *UserRepo) UpdateUser(user *User) error {
 	result := r.DB.Updates(user)
 	return result.Error
 }
+
+// UpdateTrainingSettings saves a user's streak, progression, rest timer and zone settings, including zero values.
+func (r *UserRepo) UpdateTrainingSettings(user *User) error {
+	return r.DB.Model(&User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"streak_rest_days":         user.StreakRestDays,
+		"streak_weekly_target":     user.StreakWeeklyTarget,
+		"progression_increment_kg": user.ProgressionIncrementKG,
+		"default_rest_seconds":     user.DefaultRestSeconds,
+		"draft_cleanup":            user.DraftCleanup,
+		"heart_rate_zone_method":   user.HeartRateZoneMethod,
+		"max_heart_rate":           user.MaxHeartRate,
+		"resting_heart_rate":       user.RestingHeartRate,
+		"threshold_heart_rate":     user.ThresholdHeartRate,
+		"ftp":                      user.FTP,
+	}).Error
+}
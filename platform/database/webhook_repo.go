@@ -0,0 +1,165 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookRepo struct {
+	DB *gorm.DB
+}
+
+// NewWebhookRepo creates a new WebhookRepo
+func NewWebhookRepo(db *gorm.DB) *WebhookRepo {
+	return &WebhookRepo{DB: db}
+}
+
+// CreateEndpoint registers a new webhook endpoint.
+func (r *WebhookRepo) CreateEndpoint(endpoint *WebhookEndpoint) error {
+	return r.DB.Create(endpoint).Error
+}
+
+// GetEndpointByID returns a webhook endpoint by its ID.
+func (r *WebhookRepo) GetEndpointByID(endpointID uint) (*WebhookEndpoint, error) {
+	var endpoint WebhookEndpoint
+	if err := r.DB.First(&endpoint, endpointID).Error; err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+// GetEndpointsForUser returns the endpoints a user can manage: their own and, for admins, the
+// ones that hear about every user.
+func (r *WebhookRepo) GetEndpointsForUser(userID uint, isAdmin bool) ([]*WebhookEndpoint, error) {
+	query := r.DB.Where("user_id = ?", userID)
+	if isAdmin {
+		query = r.DB.Where("user_id = ? OR user_id IS NULL", userID)
+	}
+	var endpoints []*WebhookEndpoint
+	err := query.Order("created_at desc").Find(&endpoints).Error
+	return endpoints, err
+}
+
+// SetEndpointActive turns delivery to an endpoint on or off.
+func (r *WebhookRepo) SetEndpointActive(endpointID uint, active bool) error {
+	return r.DB.Model(&WebhookEndpoint{}).Where("id = ?", endpointID).Update("active", active).Error
+}
+
+// DeleteEndpoint removes an endpoint. Deliveries still waiting to be sent to it are dropped.
+func (r *WebhookRepo) DeleteEndpoint(endpointID uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("endpoint_id = ? AND status = ?", endpointID, DeliveryPending).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&WebhookEndpoint{}, endpointID).Error
+	})
+}
+
+// Enqueue queues an event for every active endpoint subscribed to it that should hear about
+// the given user, returning how many deliveries were queued.
+func (r *WebhookRepo) Enqueue(event WebhookEvent, userID uint, payload string, now time.Time) (int, error) {
+	var endpoints []*WebhookEndpoint
+	err := r.DB.
+		Where("active AND (user_id = ? OR user_id IS NULL) AND ? = ANY(events)", userID, string(event)).
+		Find(&endpoints).Error
+	if err != nil || len(endpoints) == 0 {
+		return 0, err
+	}
+
+	deliveries := make([]WebhookDelivery, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		deliveries = append(deliveries, WebhookDelivery{
+			EndpointID:    endpoint.ID,
+			Event:         event,
+			Payload:       payload,
+			Status:        DeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	return len(deliveries), r.DB.Create(&deliveries).Error
+}
+
+// ClaimDueDeliveries takes up to limit pending deliveries that are due, along with their
+// endpoints. Each is pushed back by lease first, so another dispatcher won't take it as well,
+// and so it is retried if this one stops before recording the attempt.
+func (r *WebhookRepo) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+			Order("next_attempt_at asc").
+			Limit(limit).
+			Find(&deliveries).Error
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		ids := make([]uint, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.ID)
+		}
+		return tx.Model(&WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+
+	// Endpoints are loaded separately so a deleted endpoint still leaves its delivery to be settled.
+	// Their owners are loaded too, as admins' endpoints are allowed to reach private addresses.
+	for _, delivery := range deliveries {
+		if err := r.DB.Unscoped().Preload("User").First(&delivery.Endpoint, delivery.EndpointID).Error; err != nil {
+			return nil, err
+		}
+	}
+	return deliveries, nil
+}
+
+// RecordAttempt saves the outcome of an attempt at a delivery. A pending status with a
+// nextAttemptAt queues it to be tried again.
+func (r *WebhookRepo) RecordAttempt(delivery *WebhookDelivery) error {
+	return r.DB.Model(&WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"last_attempt_at": delivery.LastAttemptAt,
+		"response_status": delivery.ResponseStatus,
+		"response_body":   delivery.ResponseBody,
+		"last_error":      delivery.LastError,
+	}).Error
+}
+
+// GetDeliveriesByEndpointID returns the latest deliveries to an endpoint, newest first.
+func (r *WebhookRepo) GetDeliveriesByEndpointID(endpointID uint, limit int) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	err := r.DB.Where("endpoint_id = ?", endpointID).Order("created_at desc").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// GetDeliveryByID returns a single delivery.
+func (r *WebhookRepo) GetDeliveryByID(deliveryID uint) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	if err := r.DB.First(&delivery, deliveryID).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// ReplayDelivery queues a delivery to be sent again straight away. It is queued as a new
+// delivery with the same payload, so the log keeps the original attempt.
+func (r *WebhookRepo) ReplayDelivery(deliveryID uint, now time.Time) (*WebhookDelivery, error) {
+	original, err := r.GetDeliveryByID(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	replay := &WebhookDelivery{
+		EndpointID:    original.EndpointID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        DeliveryPending,
+		NextAttemptAt: now,
+		ReplayOfID:    &original.ID,
+	}
+	return replay, r.DB.Create(replay).Error
+}
@@ -0,0 +1,267 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fitness/platform/database"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Weight units the other apps record weights in.
+const (
+	UnitKG  = "kg"
+	UnitLBS = "lbs"
+)
+
+const kgPerLB = 0.45359237
+
+// Set types used for sets that aren't ordinary working sets.
+const (
+	setTypeWarmup  = "warmup"
+	setTypeDropset = "dropset"
+	setTypeFailure = "failure"
+)
+
+// DetectApp tells which app a CSV export came from by its header.
+func DetectApp(data []byte) (database.DataFormat, error) {
+	header, _, err := readAppCSV(data)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case hasColumns(header, "exercise_title", "start_time"):
+		return database.DataFormatHevy, nil
+	case hasColumns(header, "Exercise Name", "Set Order", "Date"):
+		return database.DataFormatStrong, nil
+	}
+	return "", errors.New("the CSV isn't an export from Strong or Hevy")
+}
+
+// ReadApp reads a CSV export from another app. Weights are taken to be in unit when the file
+// doesn't say which unit it uses, and times to be in location, as the apps write them in the
+// phone's time zone.
+func ReadApp(data []byte, format database.DataFormat, unit string, location *time.Location) (*Document, error) {
+	header, rows, err := readAppCSV(data)
+	if err != nil {
+		return nil, err
+	}
+	var doc *Document
+	switch format {
+	case database.DataFormatStrong:
+		doc, err = readStrong(header, rows, unit, location)
+	case database.DataFormatHevy:
+		doc, err = readHevy(header, rows, location)
+	default:
+		return nil, fmt.Errorf("%q isn't an app that can be imported from", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Activities) == 0 {
+		return nil, errors.New("the file has no workouts in it")
+	}
+	return doc, nil
+}
+
+// ReadFile reads an uploaded file in the given format: an export from here, or one from another
+// app with its weights taken to be in unit when the file doesn't say and its times in location.
+func ReadFile(data []byte, format database.DataFormat, unit string, location *time.Location) (*Document, error) {
+	switch format {
+	case database.DataFormatCSV, database.DataFormatJSON:
+		doc, _, err := Read(data)
+		return doc, err
+	}
+	return ReadApp(data, format, unit, location)
+}
+
+// Location returns the time zone with the given IANA name, such as the one a browser reports,
+// or UTC if there's no name or it isn't known.
+func Location(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// ExerciseNames returns the names of the exercises in a document, each once, in the order they
+// first appear.
+func (d *Document) ExerciseNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, activity := range d.Activities {
+		for _, exercise := range activity.Exercises {
+			key := MappingKey(exercise.Name)
+			if !seen[key] {
+				seen[key] = true
+				names = append(names, strings.TrimSpace(exercise.Name))
+			}
+		}
+	}
+	return names
+}
+
+// MappingKey is how an exercise name from another app is stored in an ExerciseMapping.
+func MappingKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// readAppCSV reads a CSV file into its header and rows keyed by column name. The apps write
+// files with a byte order mark, and with semicolons in locales that use decimal commas.
+func readAppCSV(data []byte) ([]string, []map[string]string, error) {
+	if len(data) > maxFileSize {
+		return nil, nil, errors.New("the file is too big to import")
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("the CSV can't be read: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("the CSV is empty")
+	}
+
+	header := make([]string, len(records[0]))
+	for i, column := range records[0] {
+		header[i] = strings.TrimSpace(column)
+	}
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for i, column := range header {
+			if i < len(record) {
+				row[column] = strings.TrimSpace(record[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+	return header, rows, nil
+}
+
+func hasColumns(header []string, columns ...string) bool {
+	for _, column := range columns {
+		found := false
+		for _, name := range header {
+			if name == column {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDecimal reads a number that may use a decimal comma. Blank is zero.
+func parseDecimal(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", value)
+	}
+	return n, nil
+}
+
+// parseCount reads a whole number that the apps sometimes write with a decimal point, e.g. "8.0".
+func parseCount(value string) (int, error) {
+	n, err := parseDecimal(value)
+	if err != nil || n != math.Trunc(n) {
+		return 0, fmt.Errorf("%q is not a whole number", value)
+	}
+	return int(n), nil
+}
+
+// toKG converts a weight to kilograms, rounded to the nearest gram.
+func toKG(weight float64, unit string) float64 {
+	if strings.HasPrefix(strings.ToLower(unit), "lb") {
+		weight *= kgPerLB
+	}
+	return math.Round(weight*1000) / 1000
+}
+
+// appWorkouts collects the rows of an export into workouts, and each workout's rows into
+// exercises, keeping the order of the file. Rows of the same exercise next to each other
+// belong to one exercise.
+type appWorkouts struct {
+	doc   *Document
+	index map[string]int
+}
+
+func newAppWorkouts() *appWorkouts {
+	return &appWorkouts{doc: &Document{Version: DocumentVersion, Activities: []Activity{}}, index: map[string]int{}}
+}
+
+// workout returns the workout with the given key, adding it with create if it isn't there yet.
+func (w *appWorkouts) workout(key string, create func() Activity) *Activity {
+	i, ok := w.index[key]
+	if !ok {
+		i = len(w.doc.Activities)
+		w.index[key] = i
+		activity := create()
+		if activity.Name == "" {
+			activity.Name = "Gym Workout"
+		}
+		activity.Exercises = []Exercise{}
+		w.doc.Activities = append(w.doc.Activities, activity)
+	}
+	return &w.doc.Activities[i]
+}
+
+// exercise returns the exercise the next set of a workout belongs to.
+func (w *appWorkouts) exercise(activity *Activity, name string, supersetID *string) *Exercise {
+	if n := len(activity.Exercises); n > 0 && activity.Exercises[n-1].Name == name {
+		return &activity.Exercises[n-1]
+	}
+	activity.Exercises = append(activity.Exercises, Exercise{Name: name, SupersetID: supersetID, Sets: []Set{}})
+	return &activity.Exercises[len(activity.Exercises)-1]
+}
+
+// setNotes joins a set's notes with the details the app records that sets here don't have.
+func setNotes(notes string, details ...string) string {
+	parts := []string{}
+	if notes != "" {
+		parts = append(parts, notes)
+	}
+	for _, detail := range details {
+		if detail != "" {
+			parts = append(parts, detail)
+		}
+	}
+	return strings.Join(parts, " · ")
+}
+
+// nonZero formats a detail for setNotes, or returns "" if its value is blank or zero.
+func nonZero(format, value string) string {
+	if n, err := parseDecimal(value); err != nil || n == 0 {
+		return ""
+	}
+	return fmt.Sprintf(format, value)
+}
+
+// finishTime is when a workout that started at start and lasted the given time ended.
+func finishTime(start time.Time, duration time.Duration) *time.Time {
+	if duration <= 0 {
+		return nil
+	}
+	finish := start.Add(duration)
+	return &finish
+}
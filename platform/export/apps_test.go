@@ -0,0 +1,247 @@
+package export
+
+import (
+	"fitness/platform/database"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Exports from Strong, in its older layout with the weight unit left to the app's settings and
+// its newer one with semicolons and decimal commas, and from Hevy.
+const (
+	strongExport = `Date,Workout Name,Duration,Exercise Name,Set Order,Weight,Reps,Distance,Seconds,Notes,Workout Notes,RPE
+2024-03-10 07:45:12,Morning,1h 5m,Squat (Barbell),W,45,10,0,0,,Knees fine,
+2024-03-10 07:45:12,Morning,1h 5m,Squat (Barbell),1,225,5,0,0,Belt,Knees fine,8
+2024-03-10 07:45:12,Morning,1h 5m,Squat (Barbell),Rest Timer,0,0,0,90,,Knees fine,
+2024-03-10 07:45:12,Morning,1h 5m,Plank,1,0,0,0,60,,Knees fine,
+2024-03-11 18:00:00,Evening,45m,Bench Press (Barbell),1,135,8.0,0,0,,,
+`
+	strongSemicolonExport = "\xef\xbb\xbfWorkout #;Date;Workout Name;Duration (sec);Exercise Name;Set Order;Weight (kg);Reps;RPE;Distance (meters);Seconds;Notes;Workout Notes\n" +
+		"1;2024-03-10 07:45:12;Morning;3900;Deadlift (Barbell);1;142,5;3;;;;;\n" +
+		"1;2024-03-10 07:45:12;Morning;3900;Deadlift (Barbell);D;100;8;;;;;\n"
+	hevyExport = `"title","start_time","end_time","description","exercise_title","superset_id","exercise_notes","set_index","set_type","weight_lbs","reps","distance_miles","duration_seconds","rpe"
+"Push","10 Mar 2024, 07:45","10 Mar 2024, 08:50","Short one","Bench Press (Barbell)","0","Pause reps","0","warmup","95","10","","",""
+"Push","10 Mar 2024, 07:45","10 Mar 2024, 08:50","Short one","Bench Press (Barbell)","0","Pause reps","1","normal","185","5","","","9"
+"Push","10 Mar 2024, 07:45","10 Mar 2024, 08:50","Short one","Triceps Pushdown","0","","0","dropset","50","12","","",""
+"Run","11 Mar 2024, 18:00","11 Mar 2024, 18:40","","Running","","","0","normal","","","1.5","600",""
+`
+)
+
+func TestReadApp(t *testing.T) {
+	berlin := Location("Europe/Berlin")
+	at := func(day, hour, minute, second int) *time.Time {
+		t := time.Date(2024, 3, day, hour, minute, second, 0, berlin)
+		return &t
+	}
+	superset := "0"
+
+	for _, test := range []struct {
+		name   string
+		data   string
+		format database.DataFormat
+		unit   string
+		want   []Activity
+		err    string
+	}{
+		{
+			name:   "Strong with weights in the unit chosen",
+			data:   strongExport,
+			format: database.DataFormatStrong,
+			unit:   UnitLBS,
+			want: []Activity{
+				{
+					Type: "GYM_WORKOUT", Name: "Morning", Notes: "Knees fine",
+					ActivityTime: *at(10, 7, 45, 12), StartTime: at(10, 7, 45, 12), FinishTime: at(10, 8, 50, 12),
+					Exercises: []Exercise{
+						{Name: "Squat (Barbell)", Sets: []Set{
+							{Reps: 10, WeightKG: 20.412, SetType: setTypeWarmup},
+							{Reps: 5, WeightKG: 102.058, Notes: "Belt · RPE 8"},
+						}},
+						{Name: "Plank", Sets: []Set{{Notes: "60 s"}}},
+					},
+				},
+				{
+					Type: "GYM_WORKOUT", Name: "Evening",
+					ActivityTime: *at(11, 18, 0, 0), StartTime: at(11, 18, 0, 0), FinishTime: at(11, 18, 45, 0),
+					Exercises: []Exercise{
+						{Name: "Bench Press (Barbell)", Sets: []Set{{Reps: 8, WeightKG: 61.235}}},
+					},
+				},
+			},
+		},
+		{
+			name:   "Strong with semicolons and the unit in the column name",
+			data:   strongSemicolonExport,
+			format: database.DataFormatStrong,
+			unit:   UnitLBS,
+			want: []Activity{
+				{
+					Type: "GYM_WORKOUT", Name: "Morning",
+					ActivityTime: *at(10, 7, 45, 12), StartTime: at(10, 7, 45, 12), FinishTime: at(10, 8, 50, 12),
+					Exercises: []Exercise{
+						{Name: "Deadlift (Barbell)", Sets: []Set{
+							{Reps: 3, WeightKG: 142.5},
+							{Reps: 8, WeightKG: 100, SetType: setTypeDropset},
+						}},
+					},
+				},
+			},
+		},
+		{
+			name:   "Hevy",
+			data:   hevyExport,
+			format: database.DataFormatHevy,
+			unit:   UnitKG,
+			want: []Activity{
+				{
+					Type: "GYM_WORKOUT", Name: "Push", Notes: "Short one",
+					ActivityTime: *at(10, 7, 45, 0), StartTime: at(10, 7, 45, 0), FinishTime: at(10, 8, 50, 0),
+					Exercises: []Exercise{
+						{Name: "Bench Press (Barbell)", SupersetID: &superset, Sets: []Set{
+							{Reps: 10, WeightKG: 43.091, SetType: setTypeWarmup, Notes: "Pause reps"},
+							{Reps: 5, WeightKG: 83.915, Notes: "RPE 9"},
+						}},
+						{Name: "Triceps Pushdown", SupersetID: &superset, Sets: []Set{
+							{Reps: 12, WeightKG: 22.68, SetType: setTypeDropset},
+						}},
+					},
+				},
+				{
+					Type: "GYM_WORKOUT", Name: "Run",
+					ActivityTime: *at(11, 18, 0, 0), StartTime: at(11, 18, 0, 0), FinishTime: at(11, 18, 40, 0),
+					Exercises: []Exercise{
+						{Name: "Running", Sets: []Set{{Notes: "1.5 mi · 600 s"}}},
+					},
+				},
+			},
+		},
+		{
+			name:   "Strong with a bad date",
+			data:   strings.Replace(strongExport, "2024-03-11 18:00:00", "11/03/2024", 1),
+			format: database.DataFormatStrong,
+			err:    `line 6: "11/03/2024" is not a date and time`,
+		},
+		{
+			name:   "Hevy with a bad weight",
+			data:   strings.Replace(hevyExport, `"185"`, `"heavy"`, 1),
+			format: database.DataFormatHevy,
+			err:    `line 3: weight_lbs: "heavy" is not a number`,
+		},
+		{
+			name:   "Strong with only rest timers",
+			data:   "Date,Workout Name,Exercise Name,Set Order,Weight,Reps\n2024-03-10 07:45:12,Morning,Squat (Barbell),Rest Timer,0,0\n",
+			format: database.DataFormatStrong,
+			err:    "the file has no workouts in it",
+		},
+	} {
+		doc, err := ReadApp([]byte(test.data), test.format, test.unit, berlin)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: ReadApp = %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ReadApp = %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(doc.Activities, test.want) {
+			t.Errorf("%s: read\n%+v\nwant\n%+v", test.name, doc.Activities, test.want)
+		}
+	}
+}
+
+func TestReadAppTimeZone(t *testing.T) {
+	// The same local time is a different instant depending on where the phone was.
+	for _, test := range []struct {
+		zone string
+		want time.Time
+	}{
+		{"Europe/Berlin", time.Date(2024, 3, 11, 17, 0, 0, 0, time.UTC)},
+		{"America/New_York", time.Date(2024, 3, 11, 22, 0, 0, 0, time.UTC)},
+		{"", time.Date(2024, 3, 11, 18, 0, 0, 0, time.UTC)},
+		{"Not/A_Zone", time.Date(2024, 3, 11, 18, 0, 0, 0, time.UTC)},
+	} {
+		for _, format := range []database.DataFormat{database.DataFormatStrong, database.DataFormatHevy} {
+			data := strongExport
+			if format == database.DataFormatHevy {
+				data = hevyExport
+			}
+			doc, err := ReadApp([]byte(data), format, UnitKG, Location(test.zone))
+			if err != nil {
+				t.Fatalf("%s in %q: ReadApp = %v", format, test.zone, err)
+			}
+			if got := doc.Activities[1].ActivityTime; !got.Equal(test.want) {
+				t.Errorf("%s in %q: activity time %v, want %v", format, test.zone, got.UTC(), test.want)
+			}
+		}
+	}
+}
+
+func TestDetectApp(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		data string
+		want database.DataFormat
+	}{
+		{"Strong", strongExport, database.DataFormatStrong},
+		{"Strong with semicolons and a byte order mark", strongSemicolonExport, database.DataFormatStrong},
+		{"Hevy", hevyExport, database.DataFormatHevy},
+		{"another CSV", "date,distance,time\n2024-03-10,5,25:00\n", ""},
+		{"nothing", "", ""},
+	} {
+		got, err := DetectApp([]byte(test.data))
+		if got != test.want || (err == nil) != (test.want != "") {
+			t.Errorf("%s: DetectApp = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestMatcherTop(t *testing.T) {
+	var definitions []*database.ExerciseDefinition
+	for _, name := range []string{
+		"Bench Press (Barbell)",
+		"Bench Press (Dumbbell)",
+		"Incline Bench Press (Barbell)",
+		"Squat (Barbell)",
+		"Pull Up",
+		"Romanian Deadlift (Barbell)",
+		"Overhead Press (Barbell)",
+	} {
+		definitions = append(definitions, &database.ExerciseDefinition{Name: name})
+	}
+	matcher := NewMatcher(definitions)
+
+	for _, test := range []struct {
+		name string
+		want []string
+	}{
+		{"Bench Press (Barbell)", []string{"Bench Press (Barbell)", "Incline Bench Press (Barbell)", "Bench Press (Dumbbell)"}},
+		{"Barbell Bench Press", []string{"Bench Press (Barbell)", "Incline Bench Press (Barbell)", "Bench Press (Dumbbell)"}},
+		{"DB Bench Press", []string{"Bench Press (Dumbbell)", "Bench Press (Barbell)", "Incline Bench Press (Barbell)"}},
+		{"Pullups", []string{"Pull Up"}},
+		{"RDL", []string{"Romanian Deadlift (Barbell)"}},
+		{"OHP (Barbell)", []string{"Overhead Press (Barbell)"}},
+		{"Squats", []string{"Squat (Barbell)"}},
+	} {
+		var got []string
+		for _, match := range matcher.Top(test.name, 3) {
+			got = append(got, match.Definition.Name)
+		}
+		if len(got) > len(test.want) {
+			got = got[:len(test.want)]
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Top(%q) = %q, want %q first", test.name, got, test.want)
+		}
+	}
+
+	if best := matcher.Best("Barbell Squat"); best == nil || best.Definition.Name != "Squat (Barbell)" || best.Score < SuggestThreshold {
+		t.Errorf("Best(Barbell Squat) = %+v, want Squat (Barbell) worth suggesting", best)
+	}
+	if best := matcher.Best("Zumba"); best != nil && best.Score >= SuggestThreshold {
+		t.Errorf("Best(Zumba) = %+v, want nothing worth suggesting", best)
+	}
+}
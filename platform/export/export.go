@@ -0,0 +1,290 @@
+// Package export turns a user's workouts into files they can keep, and reads those files back in.
+// Workouts, and runs, rides and other cardio activities with their readings, can be written as a
+// single JSON document or as a zip of CSV files for spreadsheets, and either can be imported again. Workout history exported from Strong and Hevy can be read
+// in too.
+package export
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fitness/platform/database"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DocumentVersion is the version of the file layout written by this package. Version 2 added
+// cardio activities; files from version 1 can still be read.
+const DocumentVersion = 2
+
+// The files in a CSV export, and their columns.
+const (
+	activitiesFile = "activities.csv"
+	exercisesFile  = "exercises.csv"
+	setsFile       = "sets.csv"
+	streamsFile    = "streams.csv"
+)
+
+var (
+	activityColumns = []string{"activity_id", "type", "name", "activity_time", "start_time", "finish_time", "paused_seconds", "notes"}
+	// cardioColumns follow activityColumns. They were added in version 2, so files without them are still read.
+	cardioColumns   = []string{"sport_type", "distance_meters", "moving_seconds", "elevation_gain_meters", "polyline", "cardio"}
+	exerciseColumns = []string{"activity_id", "exercise_number", "exercise_name", "primary_muscle_group", "secondary_muscles", "body_part", "equipment", "superset_id"}
+	setColumns      = []string{"activity_id", "exercise_number", "set_number", "exercise_name", "reps", "weight_kg", "set_type", "notes", "completed_at", "rest_seconds"}
+	// streamColumns have one row for each reading through an activity, with a column for each
+	// kind of stream. A kind the activity has no readings of is left blank.
+	streamColumns = func() []string {
+		columns := []string{"activity_id"}
+		for _, kind := range database.StreamKinds {
+			columns = append(columns, string(kind))
+		}
+		return columns
+	}()
+)
+
+// Document is everything in an export.
+type Document struct {
+	Version    int        `json:"version"`
+	ExportedAt time.Time  `json:"exported_at"`
+	Activities []Activity `json:"activities"`
+}
+
+// Activity is a finished workout, or a run, ride or other cardio activity. ID only links the
+// rows of a CSV export together and isn't kept when importing. Nor is the link to Strava, so an
+// imported activity isn't updated when Strava's copy changes.
+type Activity struct {
+	ID            uint       `json:"id"`
+	Type          string     `json:"type"`
+	Name          string     `json:"name"`
+	ActivityTime  time.Time  `json:"activity_time"`
+	StartTime     *time.Time `json:"start_time,omitempty"`
+	FinishTime    *time.Time `json:"finish_time,omitempty"`
+	PausedSeconds int        `json:"paused_seconds,omitempty"`
+	Notes         string     `json:"notes,omitempty"`
+	Exercises     []Exercise `json:"exercises"`
+
+	SportType           string                  `json:"sport_type,omitempty"`
+	DistanceMeters      float64                 `json:"distance_meters,omitempty"`
+	MovingSeconds       int                     `json:"moving_seconds,omitempty"`
+	ElevationGainMeters float64                 `json:"elevation_gain_meters,omitempty"`
+	Polyline            string                  `json:"polyline,omitempty"`
+	Cardio              *database.CardioDetails `json:"cardio,omitempty"`
+	Streams             database.Streams        `json:"streams,omitempty"` // The readings through it, if they were fetched
+}
+
+// Exercise is one exercise in a workout. Exercises are matched to the exercise library by name
+// when importing.
+type Exercise struct {
+	Name               string   `json:"name"`
+	PrimaryMuscleGroup string   `json:"primary_muscle_group,omitempty"`
+	SecondaryMuscles   []string `json:"secondary_muscles,omitempty"`
+	BodyPart           string   `json:"body_part,omitempty"`
+	Equipment          string   `json:"equipment,omitempty"`
+	SupersetID         *string  `json:"superset_id,omitempty"`
+	Sets               []Set    `json:"sets"`
+}
+
+// Set is one set of an exercise.
+type Set struct {
+	Reps        int        `json:"reps"`
+	WeightKG    float64    `json:"weight_kg"`
+	SetType     string     `json:"set_type,omitempty"`
+	Notes       string     `json:"notes,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	RestSeconds *int       `json:"rest_seconds,omitempty"`
+}
+
+// Build makes a document from activities loaded with their exercises, definitions and sets in
+// order, and the readings through them keyed by activity ID.
+func Build(activities []*database.Activity, streams map[uint]database.Streams, now time.Time) *Document {
+	doc := &Document{Version: DocumentVersion, ExportedAt: now.UTC(), Activities: []Activity{}}
+	for _, activity := range activities {
+		exported := Activity{
+			ID:                  activity.ID,
+			Type:                activity.Type,
+			Name:                activity.Name,
+			ActivityTime:        activity.ActivityTime,
+			StartTime:           activity.StartTime,
+			FinishTime:          activity.FinishTime,
+			PausedSeconds:       activity.PausedSeconds,
+			Notes:               activity.Notes,
+			Exercises:           []Exercise{},
+			SportType:           activity.SportType,
+			DistanceMeters:      activity.DistanceMeters,
+			MovingSeconds:       activity.MovingSeconds,
+			ElevationGainMeters: activity.ElevationGainMeters,
+			Polyline:            activity.Polyline,
+			Cardio:              activity.Cardio,
+			Streams:             streams[activity.ID],
+		}
+		for _, gymExercise := range activity.GymExercises {
+			definition := gymExercise.ExerciseDefinition
+			exercise := Exercise{
+				Name:               definition.Name,
+				PrimaryMuscleGroup: definition.PrimaryMuscleGroup,
+				SecondaryMuscles:   definition.SecondaryMuscles,
+				BodyPart:           definition.BodyPart,
+				Equipment:          definition.Equipment,
+				SupersetID:         gymExercise.SupersetID,
+				Sets:               []Set{},
+			}
+			for _, set := range gymExercise.Sets {
+				exercise.Sets = append(exercise.Sets, Set{
+					Reps:        set.Reps,
+					WeightKG:    set.WeightKG,
+					SetType:     set.SetType,
+					Notes:       set.Notes,
+					CompletedAt: set.CompletedAt,
+					RestSeconds: set.RestSeconds,
+				})
+			}
+			exported.Exercises = append(exported.Exercises, exercise)
+		}
+		doc.Activities = append(doc.Activities, exported)
+	}
+	return doc
+}
+
+// FileName is what to call an export in the given format made at the given time.
+func FileName(format database.DataFormat, now time.Time) string {
+	extension := "json"
+	if format == database.DataFormatCSV {
+		extension = "zip"
+	}
+	return fmt.Sprintf("fitness-export-%s.%s", now.Format("2006-01-02"), extension)
+}
+
+// ContentType is the MIME type of an export in the given format.
+func ContentType(format database.DataFormat) string {
+	if format == database.DataFormatCSV {
+		return "application/zip"
+	}
+	return "application/json"
+}
+
+// Write writes a document in the given format.
+func Write(w io.Writer, doc *Document, format database.DataFormat) error {
+	switch format {
+	case database.DataFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(doc)
+	case database.DataFormatCSV:
+		return writeCSVZip(w, doc)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// writeCSVZip writes a zip of four CSV files, linked by activity_id and exercise_number.
+func writeCSVZip(w io.Writer, doc *Document) error {
+	archive := zip.NewWriter(w)
+
+	activityRows := [][]string{append(append([]string{}, activityColumns...), cardioColumns...)}
+	exerciseRows := [][]string{exerciseColumns}
+	setRows := [][]string{setColumns}
+	streamRows := [][]string{streamColumns}
+	for _, activity := range doc.Activities {
+		activityID := strconv.FormatUint(uint64(activity.ID), 10)
+		cardio := ""
+		if activity.Cardio != nil {
+			encoded, err := json.Marshal(activity.Cardio)
+			if err != nil {
+				return err
+			}
+			cardio = string(encoded)
+		}
+		activityRows = append(activityRows, []string{
+			activityID,
+			activity.Type,
+			activity.Name,
+			formatTime(&activity.ActivityTime),
+			formatTime(activity.StartTime),
+			formatTime(activity.FinishTime),
+			strconv.Itoa(activity.PausedSeconds),
+			activity.Notes,
+			activity.SportType,
+			strconv.FormatFloat(activity.DistanceMeters, 'f', -1, 64),
+			strconv.Itoa(activity.MovingSeconds),
+			strconv.FormatFloat(activity.ElevationGainMeters, 'f', -1, 64),
+			activity.Polyline,
+			cardio,
+		})
+		for i := 0; i < activity.Streams.Len(); i++ {
+			row := []string{activityID}
+			for _, kind := range database.StreamKinds {
+				value := ""
+				if values, ok := activity.Streams[kind]; ok && i < len(values) {
+					value = strconv.FormatFloat(values[i], 'f', -1, 64)
+				}
+				row = append(row, value)
+			}
+			streamRows = append(streamRows, row)
+		}
+		for i, exercise := range activity.Exercises {
+			exerciseNumber := strconv.Itoa(i + 1)
+			supersetID := ""
+			if exercise.SupersetID != nil {
+				supersetID = *exercise.SupersetID
+			}
+			exerciseRows = append(exerciseRows, []string{
+				activityID,
+				exerciseNumber,
+				exercise.Name,
+				exercise.PrimaryMuscleGroup,
+				strings.Join(exercise.SecondaryMuscles, ";"),
+				exercise.BodyPart,
+				exercise.Equipment,
+				supersetID,
+			})
+			for j, set := range exercise.Sets {
+				restSeconds := ""
+				if set.RestSeconds != nil {
+					restSeconds = strconv.Itoa(*set.RestSeconds)
+				}
+				setRows = append(setRows, []string{
+					activityID,
+					exerciseNumber,
+					strconv.Itoa(j + 1),
+					exercise.Name,
+					strconv.Itoa(set.Reps),
+					strconv.FormatFloat(set.WeightKG, 'f', -1, 64),
+					set.SetType,
+					set.Notes,
+					formatTime(set.CompletedAt),
+					restSeconds,
+				})
+			}
+		}
+	}
+
+	for _, file := range []struct {
+		name string
+		rows [][]string
+	}{
+		{activitiesFile, activityRows},
+		{exercisesFile, exerciseRows},
+		{setsFile, setRows},
+		{streamsFile, streamRows},
+	} {
+		entry, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		writer := csv.NewWriter(entry)
+		if err := writer.WriteAll(file.rows); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
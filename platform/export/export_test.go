@@ -0,0 +1,215 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"fitness/platform/database"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fullDocument returns a document with every field set on a workout and on a run, and a second
+// workout with only what's required.
+func fullDocument() *Document {
+	at := func(minute int) *time.Time {
+		t := time.Date(2026, 10, 19, 10, minute, 30, 123456789, time.UTC)
+		return &t
+	}
+	supersetID := "a1"
+	restSeconds := 90
+	return &Document{
+		Version:    DocumentVersion,
+		ExportedAt: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+		Activities: []Activity{
+			{
+				ID:            41,
+				Type:          "GYM_WORKOUT",
+				Name:          "Push, \"heavy\"",
+				ActivityTime:  *at(0),
+				StartTime:     at(1),
+				FinishTime:    at(59),
+				PausedSeconds: 120,
+				Notes:         "Felt good\non the second line",
+				Exercises: []Exercise{
+					{
+						Name:               "Bench Press (Barbell)",
+						PrimaryMuscleGroup: "Chest",
+						SecondaryMuscles:   []string{"Triceps", "Shoulders"},
+						BodyPart:           "Upper body",
+						Equipment:          "Barbell",
+						SupersetID:         &supersetID,
+						Sets: []Set{
+							{Reps: 5, WeightKG: 82.5, SetType: "warmup", Notes: "Easy", CompletedAt: at(10), RestSeconds: &restSeconds},
+							{Reps: 3, WeightKG: 100.25, SetType: "normal", Notes: "Paused, one rep", CompletedAt: at(14), RestSeconds: &restSeconds},
+						},
+					},
+					{
+						Name:               "Push Up",
+						PrimaryMuscleGroup: "Chest",
+						SecondaryMuscles:   []string{"Triceps"},
+						BodyPart:           "Upper body",
+						Equipment:          "Bodyweight",
+						SupersetID:         &supersetID,
+						Sets:               []Set{{Reps: 20, SetType: "failure", Notes: "To failure", CompletedAt: at(16), RestSeconds: &restSeconds}},
+					},
+				},
+			},
+			{
+				ID:           42,
+				ActivityTime: time.Date(2026, 10, 18, 18, 0, 0, 0, time.UTC),
+				Exercises:    []Exercise{{Name: "Plank", Sets: []Set{{Reps: 1}}}},
+			},
+			{
+				ID:                  43,
+				Type:                "TRAIL_RUN",
+				Name:                "Hills",
+				ActivityTime:        *at(30),
+				StartTime:           at(30),
+				FinishTime:          at(45),
+				Notes:               "Muddy",
+				Exercises:           []Exercise{},
+				SportType:           "TrailRun",
+				DistanceMeters:      2504.7,
+				MovingSeconds:       840,
+				ElevationGainMeters: 61.2,
+				Polyline:            "_p~iF~ps|U_ulLnnqC_mqNvxq`@",
+				Cardio: &database.CardioDetails{
+					ElapsedSeconds:   900,
+					AverageSpeed:     2.98,
+					MaxSpeed:         4.1,
+					AverageCadence:   84.5,
+					AverageHeartrate: 151.3,
+					MaxHeartrate:     178,
+					Calories:         240,
+					Detailed:         true,
+					Splits:           []database.Split{{Split: 1, DistanceMeters: 1000, ElapsedSeconds: 350, MovingSeconds: 340, ElevationDifference: -3.4, AverageSpeed: 2.94, PaceZone: 2}},
+					Laps:             []database.Lap{{LapIndex: 1, Name: "Lap 1", StartTime: *at(30), DistanceMeters: 2504.7, ElapsedSeconds: 900, MovingSeconds: 840, MaxSpeed: 4.1}},
+				},
+				Streams: database.Streams{
+					database.StreamTime:      {0, 1, 2, 5},
+					database.StreamDistance:  {0, 3.1, 6.3, 14.9},
+					database.StreamAltitude:  {102.4, 102.3, -1.5, 0},
+					database.StreamHeartRate: {0, 121, 122, 125},
+				},
+			},
+		},
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	for _, format := range []database.DataFormat{database.DataFormatJSON, database.DataFormatCSV} {
+		want := fullDocument()
+		var buffer bytes.Buffer
+		if err := Write(&buffer, want, format); err != nil {
+			t.Fatalf("%s: Write: %v", format, err)
+		}
+		got, readFormat, err := Read(buffer.Bytes())
+		if err != nil {
+			t.Fatalf("%s: Read: %v", format, err)
+		}
+		if readFormat != format {
+			t.Errorf("%s: read as %s", format, readFormat)
+		}
+		if format == database.DataFormatCSV {
+			// The CSV files don't say when they were exported.
+			want.ExportedAt = time.Time{}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: read back\n%+v\nwant\n%+v", format, got, want)
+		}
+	}
+}
+
+func TestReadVersion1CSV(t *testing.T) {
+	// Exports from before cardio activities were added have no cardio columns or streams.
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for name, content := range map[string]string{
+		activitiesFile: strings.Join(activityColumns, ",") + "\n1,GYM_WORKOUT,Push,2026-10-19T10:00:00Z,,,0,\n",
+		exercisesFile:  strings.Join(exerciseColumns, ",") + "\n1,1,Push Up,,,,,\n",
+		setsFile:       strings.Join(setColumns, ",") + "\n1,1,1,Push Up,20,0,,,,\n",
+	} {
+		entry, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Write([]byte(content))
+	}
+	archive.Close()
+
+	doc, _, err := Read(buffer.Bytes())
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	want := []Activity{{
+		ID: 1, Type: "GYM_WORKOUT", Name: "Push", ActivityTime: time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC),
+		Exercises: []Exercise{{Name: "Push Up", Sets: []Set{{Reps: 20}}}},
+	}}
+	if !reflect.DeepEqual(doc.Activities, want) {
+		t.Errorf("read\n%+v\nwant\n%+v", doc.Activities, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		change func(doc *Document)
+		err    string
+	}{
+		{"a full document", func(doc *Document) {}, ""},
+		{"no workouts", func(doc *Document) { doc.Activities = nil }, ""},
+		{"no activity time", func(doc *Document) { doc.Activities[1].ActivityTime = time.Time{} }, "workout 2 has no activity_time"},
+		{"dated in the future", func(doc *Document) {
+			doc.Activities[0].ActivityTime = time.Now().Add(48 * time.Hour)
+		}, "workout 1 is dated in the future"},
+		{"an exercise without a name", func(doc *Document) { doc.Activities[0].Exercises[1].Name = " " }, "exercise 2 of workout 1 has no name"},
+		{"negative reps", func(doc *Document) { doc.Activities[0].Exercises[0].Sets[1].Reps = -1 }, "set 2 of Bench Press (Barbell) in workout 1"},
+		{"negative weight", func(doc *Document) { doc.Activities[1].Exercises[0].Sets[0].WeightKG = -5 }, "set 1 of Plank in workout 2"},
+		{"streams that don't line up", func(doc *Document) {
+			doc.Activities[2].Streams[database.StreamHeartRate] = []float64{120}
+		}, "workout 3 has 1 heartrate readings but 4 time readings"},
+	} {
+		doc := fullDocument()
+		test.change(doc)
+		err := validate(doc)
+		if test.err == "" && err != nil {
+			t.Errorf("%s: validate = %v", test.name, err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: validate = %v, want an error containing %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	doc := fullDocument()
+	first, second := doc.Activities[0], doc.Activities[1]
+
+	// Saved workouts are keyed the same as the ones in the file they were imported from, though the
+	// database only keeps times to the microsecond and fills in a missing type and name.
+	saved := &database.Activity{Type: "GYM_WORKOUT", Name: first.Name, ActivityTime: first.ActivityTime.Truncate(time.Microsecond)}
+	if Key(saved) != first.Key() {
+		t.Errorf("saved key %q, want %q", Key(saved), first.Key())
+	}
+	saved = &database.Activity{Type: "GYM_WORKOUT", Name: "Gym Workout", ActivityTime: second.ActivityTime}
+	if Key(saved) != second.Key() {
+		t.Errorf("saved key without a name %q, want %q", Key(saved), second.Key())
+	}
+
+	for _, test := range []struct {
+		name   string
+		change func(activity *Activity)
+	}{
+		{"renamed", func(activity *Activity) { activity.Name = "Pull" }},
+		{"another type", func(activity *Activity) { activity.Type = "Run" }},
+		{"a microsecond later", func(activity *Activity) { activity.ActivityTime = activity.ActivityTime.Add(time.Microsecond) }},
+	} {
+		other := first
+		test.change(&other)
+		if other.Key() == first.Key() {
+			t.Errorf("%s: has the same key %q", test.name, other.Key())
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package export
+
+import (
+	"fmt"
+	"time"
+)
+
+// hevyTimeLayouts are the ways Hevy has written when a workout started and ended, in the phone's
+// time zone.
+var hevyTimeLayouts = []string{"2 Jan 2006, 15:04", "Jan 2, 2006, 15:04", "2006-01-02 15:04:05", time.RFC3339}
+
+// readHevy reads Hevy's export: one row per set, with the workout's title and times repeated on
+// each. Weights are in whichever unit the column name says.
+func readHevy(header []string, rows []map[string]string, location *time.Location) (*Document, error) {
+	weightColumn, unit := "weight_kg", UnitKG
+	if hasColumns(header, "weight_lbs") {
+		weightColumn, unit = "weight_lbs", UnitLBS
+	}
+
+	workouts := newAppWorkouts()
+	for i, row := range rows {
+		line := fmt.Sprintf("line %d", i+2)
+		name := row["exercise_title"]
+		if name == "" {
+			continue
+		}
+
+		started, err := parseHevyTime(row["start_time"], location)
+		if err != nil {
+			return nil, fmt.Errorf("%s: start_time: %w", line, err)
+		}
+		var finished *time.Time
+		if row["end_time"] != "" {
+			ended, err := parseHevyTime(row["end_time"], location)
+			if err != nil {
+				return nil, fmt.Errorf("%s: end_time: %w", line, err)
+			}
+			finished = finishTime(started, ended.Sub(started))
+		}
+		activity := workouts.workout(row["start_time"]+"|"+row["title"], func() Activity {
+			return Activity{
+				Type:         "GYM_WORKOUT",
+				Name:         row["title"],
+				ActivityTime: started,
+				StartTime:    &started,
+				FinishTime:   finished,
+				Notes:        row["description"],
+			}
+		})
+
+		weight, err := parseDecimal(row[weightColumn])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", line, weightColumn, err)
+		}
+		reps, err := parseCount(row["reps"])
+		if err != nil {
+			return nil, fmt.Errorf("%s: reps: %w", line, err)
+		}
+		var supersetID *string
+		if id := row["superset_id"]; id != "" {
+			supersetID = &id
+		}
+
+		exercise := workouts.exercise(activity, name, supersetID)
+		notes := ""
+		if len(exercise.Sets) == 0 {
+			// Exercises have no notes of their own here, so Hevy's are kept with the first set
+			notes = row["exercise_notes"]
+		}
+		exercise.Sets = append(exercise.Sets, Set{
+			Reps:     reps,
+			WeightKG: toKG(weight, unit),
+			SetType:  hevySetType(row["set_type"]),
+			Notes: setNotes(notes,
+				nonZero("RPE %s", row["rpe"]),
+				nonZero("%s km", row["distance_km"]),
+				nonZero("%s mi", row["distance_miles"]),
+				nonZero("%s s", row["duration_seconds"])),
+		})
+	}
+	return workouts.doc, nil
+}
+
+func parseHevyTime(value string, location *time.Location) (time.Time, error) {
+	for _, layout := range hevyTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date and time", value)
+}
+
+// hevySetType maps Hevy's set types onto the ones used here, where a normal set has none.
+func hevySetType(setType string) string {
+	switch setType {
+	case "warmup":
+		return setTypeWarmup
+	case "dropset":
+		return setTypeDropset
+	case "failure":
+		return setTypeFailure
+	}
+	return ""
+}
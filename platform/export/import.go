@@ -0,0 +1,455 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fitness/platform/database"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxFileSize is the largest file that will be imported, or read out of a zip.
+const maxFileSize = 50 << 20
+
+// Read parses an export in either format, telling them apart by whether the file is a zip.
+func Read(data []byte) (*Document, database.DataFormat, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		doc, err := readCSVZip(data)
+		return doc, database.DataFormatCSV, err
+	}
+
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, database.DataFormatJSON, fmt.Errorf("the file is neither a zip of CSV files nor a JSON export: %w", err)
+	}
+	if doc.Version > DocumentVersion {
+		return nil, database.DataFormatJSON, fmt.Errorf("the file is from a newer version (%d) than this one understands", doc.Version)
+	}
+	return &doc, database.DataFormatJSON, nil
+}
+
+// readCSVZip reads a zip written by writeCSVZip back into a document.
+func readCSVZip(data []byte) (*Document, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("the zip can't be opened: %w", err)
+	}
+
+	activityRows, err := readCSVFile(archive, activitiesFile, activityColumns)
+	if err != nil {
+		return nil, err
+	}
+	exerciseRows, err := readCSVFile(archive, exercisesFile, exerciseColumns)
+	if err != nil {
+		return nil, err
+	}
+	setRows, err := readCSVFile(archive, setsFile, setColumns)
+	if err != nil {
+		return nil, err
+	}
+	// Exports from before version 2 have no cardio activities, so no streams
+	var streamRows []map[string]string
+	if _, err := fs.Stat(archive, streamsFile); err == nil {
+		if streamRows, err = readCSVFile(archive, streamsFile, streamColumns); err != nil {
+			return nil, err
+		}
+	}
+
+	doc := &Document{Version: DocumentVersion, Activities: []Activity{}}
+	activityIndex := map[string]int{}
+	for i, row := range activityRows {
+		line := fmt.Sprintf("%s line %d", activitiesFile, i+2)
+		activityTime, err := parseTime(row["activity_time"])
+		if err != nil || activityTime == nil {
+			return nil, fmt.Errorf("%s: activity_time must be an RFC 3339 time", line)
+		}
+		startTime, err := parseTime(row["start_time"])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", line, err)
+		}
+		finishTime, err := parseTime(row["finish_time"])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", line, err)
+		}
+		pausedSeconds, err := parseInt(row["paused_seconds"])
+		if err != nil {
+			return nil, fmt.Errorf("%s: paused_seconds: %w", line, err)
+		}
+		distance, err := parseDecimal(row["distance_meters"])
+		if err != nil {
+			return nil, fmt.Errorf("%s: distance_meters: %w", line, err)
+		}
+		movingSeconds, err := parseInt(row["moving_seconds"])
+		if err != nil {
+			return nil, fmt.Errorf("%s: moving_seconds: %w", line, err)
+		}
+		elevationGain, err := parseDecimal(row["elevation_gain_meters"])
+		if err != nil {
+			return nil, fmt.Errorf("%s: elevation_gain_meters: %w", line, err)
+		}
+		var cardio *database.CardioDetails
+		if row["cardio"] != "" {
+			if err := json.Unmarshal([]byte(row["cardio"]), &cardio); err != nil {
+				return nil, fmt.Errorf("%s: cardio can't be read: %w", line, err)
+			}
+		}
+		id, _ := strconv.ParseUint(row["activity_id"], 10, 64)
+
+		activityIndex[row["activity_id"]] = len(doc.Activities)
+		doc.Activities = append(doc.Activities, Activity{
+			ID:                  uint(id),
+			Type:                row["type"],
+			Name:                row["name"],
+			ActivityTime:        *activityTime,
+			StartTime:           startTime,
+			FinishTime:          finishTime,
+			PausedSeconds:       pausedSeconds,
+			Notes:               row["notes"],
+			Exercises:           []Exercise{},
+			SportType:           row["sport_type"],
+			DistanceMeters:      distance,
+			MovingSeconds:       movingSeconds,
+			ElevationGainMeters: elevationGain,
+			Polyline:            row["polyline"],
+			Cardio:              cardio,
+		})
+	}
+
+	type exerciseRef struct{ activity, exercise int }
+	exerciseIndex := map[string]exerciseRef{}
+	for i, row := range exerciseRows {
+		line := fmt.Sprintf("%s line %d", exercisesFile, i+2)
+		activity, ok := activityIndex[row["activity_id"]]
+		if !ok {
+			return nil, fmt.Errorf("%s: activity_id %q isn't in %s", line, row["activity_id"], activitiesFile)
+		}
+		exercise := Exercise{
+			Name:               row["exercise_name"],
+			PrimaryMuscleGroup: row["primary_muscle_group"],
+			BodyPart:           row["body_part"],
+			Equipment:          row["equipment"],
+			Sets:               []Set{},
+		}
+		if secondary := row["secondary_muscles"]; secondary != "" {
+			exercise.SecondaryMuscles = strings.Split(secondary, ";")
+		}
+		if supersetID := row["superset_id"]; supersetID != "" {
+			exercise.SupersetID = &supersetID
+		}
+
+		exercises := &doc.Activities[activity].Exercises
+		exerciseIndex[row["activity_id"]+"/"+row["exercise_number"]] = exerciseRef{activity, len(*exercises)}
+		*exercises = append(*exercises, exercise)
+	}
+
+	for i, row := range setRows {
+		line := fmt.Sprintf("%s line %d", setsFile, i+2)
+		ref, ok := exerciseIndex[row["activity_id"]+"/"+row["exercise_number"]]
+		if !ok {
+			return nil, fmt.Errorf("%s: exercise %s of activity %s isn't in %s", line, row["exercise_number"], row["activity_id"], exercisesFile)
+		}
+		reps, err := parseInt(row["reps"])
+		if err != nil {
+			return nil, fmt.Errorf("%s: reps: %w", line, err)
+		}
+		weight := 0.0
+		if row["weight_kg"] != "" {
+			if weight, err = strconv.ParseFloat(row["weight_kg"], 64); err != nil {
+				return nil, fmt.Errorf("%s: weight_kg must be a number", line)
+			}
+		}
+		completedAt, err := parseTime(row["completed_at"])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", line, err)
+		}
+		set := Set{Reps: reps, WeightKG: weight, SetType: row["set_type"], Notes: row["notes"], CompletedAt: completedAt}
+		if row["rest_seconds"] != "" {
+			restSeconds, err := parseInt(row["rest_seconds"])
+			if err != nil {
+				return nil, fmt.Errorf("%s: rest_seconds: %w", line, err)
+			}
+			set.RestSeconds = &restSeconds
+		}
+
+		exercise := &doc.Activities[ref.activity].Exercises[ref.exercise]
+		exercise.Sets = append(exercise.Sets, set)
+	}
+
+	for i, row := range streamRows {
+		line := fmt.Sprintf("%s line %d", streamsFile, i+2)
+		index, ok := activityIndex[row["activity_id"]]
+		if !ok {
+			return nil, fmt.Errorf("%s: activity_id %q isn't in %s", line, row["activity_id"], activitiesFile)
+		}
+		activity := &doc.Activities[index]
+		if activity.Streams == nil {
+			activity.Streams = database.Streams{}
+		}
+		for _, kind := range database.StreamKinds {
+			if row[string(kind)] == "" {
+				continue
+			}
+			value, err := strconv.ParseFloat(row[string(kind)], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s must be a number", line, kind)
+			}
+			activity.Streams[kind] = append(activity.Streams[kind], value)
+		}
+	}
+	return doc, nil
+}
+
+// readCSVFile reads a CSV file from a zip into rows keyed by column name, checking the header
+// has every expected column.
+func readCSVFile(archive *zip.Reader, name string, columns []string) ([]map[string]string, error) {
+	file, err := archive.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("the zip has no %s", name)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(io.LimitReader(file, maxFileSize))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s can't be read: %w", name, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s is empty", name)
+	}
+
+	header := map[string]int{}
+	for i, column := range records[0] {
+		header[strings.TrimSpace(column)] = i
+	}
+	for _, column := range columns {
+		if _, ok := header[column]; !ok {
+			return nil, fmt.Errorf("%s has no %s column", name, column)
+		}
+	}
+
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for column, i := range header {
+			if i < len(record) {
+				row[column] = record[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not an RFC 3339 time", value)
+	}
+	return &t, nil
+}
+
+func parseInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a whole number", value)
+	}
+	return n, nil
+}
+
+// Result is what an import did.
+type Result struct {
+	Imported    int
+	Skipped     int    // Workouts the user already had
+	ActivityIDs []uint // The workouts that were imported
+}
+
+// Summary describes the result for the user.
+func (r *Result) Summary() string {
+	summary := fmt.Sprintf("Imported %d workout(s)", r.Imported)
+	if r.Skipped > 0 {
+		summary += fmt.Sprintf(", skipped %d you already had", r.Skipped)
+	}
+	return summary + "."
+}
+
+// Importer saves the workouts in a document for a user.
+type Importer struct {
+	ActivityRepo *database.ActivityRepo
+	ExerciseRepo *database.ExerciseRepo
+	// Mappings, if set, says which library exercise each exercise is, keyed by MappingKey. A
+	// nil ID leaves the exercise out. Exercises without a mapping are matched by name.
+	Mappings map[string]*uint
+
+	exerciseIDs map[string]uint
+}
+
+// Import saves every workout in the document that the user doesn't already have. Exercises are
+// matched to the library by name unless they are mapped. The library is shared by every user, so
+// nothing is added to it: if any exercise isn't in it, nothing is imported and the error lists
+// them, for the user to map them to library exercises or leave them out.
+func (i *Importer) Import(userID uint, doc *Document) (*Result, error) {
+	if err := validate(doc); err != nil {
+		return nil, err
+	}
+	if err := i.resolveExercises(doc); err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for _, imported := range doc.Activities {
+		activity := imported.saved(userID)
+		for _, exercise := range imported.Exercises {
+			definitionID := i.exerciseIDs[MappingKey(exercise.Name)]
+			if definitionID == 0 {
+				continue
+			}
+			gymExercise := database.GymExercise{
+				ExerciseDefinitionID: definitionID,
+				SortNumber:           len(activity.GymExercises) + 1,
+				SupersetID:           exercise.SupersetID,
+			}
+			for setNumber, set := range exercise.Sets {
+				gymExercise.Sets = append(gymExercise.Sets, database.GymSet{
+					SetNumber:   setNumber + 1,
+					Reps:        set.Reps,
+					WeightKG:    set.WeightKG,
+					SetType:     set.SetType,
+					Notes:       set.Notes,
+					CompletedAt: set.CompletedAt,
+					RestSeconds: set.RestSeconds,
+				})
+			}
+			activity.GymExercises = append(activity.GymExercises, gymExercise)
+		}
+
+		created, err := i.ActivityRepo.ImportActivity(activity, imported.Streams)
+		if err != nil {
+			return nil, fmt.Errorf("saving %q from %s: %w", activity.Name, activity.ActivityTime.Format("2006-01-02"), err)
+		}
+		if created {
+			result.Imported++
+			result.ActivityIDs = append(result.ActivityIDs, activity.ID)
+		} else {
+			result.Skipped++
+		}
+	}
+	return result, nil
+}
+
+// saved is the workout as it is saved for a user, without its exercises. The activity time is
+// kept to the microsecond, as finely as the database keeps it, so that it matches when the same
+// file is imported again.
+func (a *Activity) saved(userID uint) *database.Activity {
+	activity := &database.Activity{
+		UserID:        userID,
+		Type:          a.Type,
+		Name:          a.Name,
+		ActivityTime:  a.ActivityTime.Truncate(time.Microsecond),
+		StartTime:     a.StartTime,
+		FinishTime:    a.FinishTime,
+		PausedSeconds: a.PausedSeconds,
+		Notes:         a.Notes,
+
+		SportType:           a.SportType,
+		DistanceMeters:      a.DistanceMeters,
+		MovingSeconds:       a.MovingSeconds,
+		ElevationGainMeters: a.ElevationGainMeters,
+		Polyline:            a.Polyline,
+		Cardio:              a.Cardio,
+	}
+	if activity.Type == "" {
+		activity.Type = "GYM_WORKOUT"
+	}
+	if activity.Name == "" {
+		activity.Name = "Gym Workout"
+	}
+	return activity
+}
+
+// Key identifies a workout the way importing does when skipping the ones a user already has.
+func Key(activity *database.Activity) string {
+	return activity.Type + "|" + activity.Name + "|" + strconv.FormatInt(activity.ActivityTime.UnixMicro(), 10)
+}
+
+// Key is the key the workout will have once it is imported.
+func (a *Activity) Key() string {
+	return Key(a.saved(0))
+}
+
+// resolveExercises finds the library exercise for every exercise in the document, returning an
+// error that lists any that aren't mapped and aren't in the library. A mapping to nil leaves the
+// exercise out, which is recorded as 0.
+func (i *Importer) resolveExercises(doc *Document) error {
+	i.exerciseIDs = map[string]uint{}
+	var unknown []string
+	for _, name := range doc.ExerciseNames() {
+		key := MappingKey(name)
+		if id, ok := i.Mappings[key]; ok {
+			if id != nil {
+				i.exerciseIDs[key] = *id
+			}
+			continue
+		}
+
+		definition, err := i.ExerciseRepo.GetExerciseByName(name)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			unknown = append(unknown, name)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("looking up exercise %q: %w", name, err)
+		}
+		i.exerciseIDs[key] = definition.ID
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("%d exercise(s) aren't in the exercise library: %s. Import the file again to choose what to import them as",
+			len(unknown), strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// validate checks a document before anything is saved, so a bad file imports nothing.
+func validate(doc *Document) error {
+	for a, activity := range doc.Activities {
+		where := fmt.Sprintf("workout %d", a+1)
+		if activity.ActivityTime.IsZero() {
+			return fmt.Errorf("%s has no activity_time", where)
+		}
+		if activity.ActivityTime.After(time.Now().Add(24 * time.Hour)) {
+			return fmt.Errorf("%s is dated in the future", where)
+		}
+		for kind, values := range activity.Streams {
+			if len(values) != activity.Streams.Len() {
+				return fmt.Errorf("%s has %d %s readings but %d time readings", where, len(values), kind, activity.Streams.Len())
+			}
+		}
+		for e, exercise := range activity.Exercises {
+			if strings.TrimSpace(exercise.Name) == "" {
+				return fmt.Errorf("exercise %d of %s has no name", e+1, where)
+			}
+			for s, set := range exercise.Sets {
+				if set.Reps < 0 || set.WeightKG < 0 {
+					return fmt.Errorf("set %d of %s in %s has negative reps or weight", s+1, exercise.Name, where)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package export
+
+import (
+	"fitness/platform/database"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SuggestThreshold is the lowest match score worth suggesting to the user.
+const SuggestThreshold = 0.6
+
+// Matcher finds the library exercise most like a name used by another app, e.g. "Bench Press
+// (Barbell)" for "Barbell Bench Press". Names are compared on their words, in any order, and on
+// their letter pairs, so small spelling differences still match.
+type Matcher struct {
+	definitions []*database.ExerciseDefinition
+	words       [][]string
+	pairs       []map[string]int
+}
+
+// Match is a library exercise suggested for a name, with how alike they are from 0 to 1.
+type Match struct {
+	Definition *database.ExerciseDefinition
+	Score      float64
+}
+
+// NewMatcher prepares to match names against the given exercises.
+func NewMatcher(definitions []*database.ExerciseDefinition) *Matcher {
+	m := &Matcher{definitions: definitions}
+	for _, definition := range definitions {
+		words := normalizeWords(definition.Name)
+		m.words = append(m.words, words)
+		m.pairs = append(m.pairs, letterPairs(strings.Join(words, " ")))
+	}
+	return m
+}
+
+// Best returns the closest library exercise to name, or nil if there is none.
+func (m *Matcher) Best(name string) *Match {
+	matches := m.Top(name, 1)
+	if len(matches) == 0 {
+		return nil
+	}
+	return &matches[0]
+}
+
+// Top returns up to n library exercises closest to name, best first.
+func (m *Matcher) Top(name string, n int) []Match {
+	words := normalizeWords(name)
+	pairs := letterPairs(strings.Join(words, " "))
+
+	var matches []Match
+	for i, definition := range m.definitions {
+		score := 0.6*wordScore(words, m.words[i]) + 0.4*dice(pairs, m.pairs[i])
+		if score > 0 {
+			matches = append(matches, Match{Definition: definition, Score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > n {
+		matches = matches[:n]
+	}
+	return matches
+}
+
+// wordAliases maps words other apps use onto the ones the library uses.
+var wordAliases = map[string]string{
+	"bb":        "barbell",
+	"db":        "dumbbell",
+	"dumbbells": "dumbbell",
+	"kb":        "kettlebell",
+	"pullup":    "pull",
+	"pullups":   "pull",
+	"chinup":    "chin",
+	"chinups":   "chin",
+	"pushup":    "push",
+	"pushups":   "push",
+	"ohp":       "overhead",
+	"rdl":       "romanian",
+}
+
+// normalizeWords lower-cases a name and splits it into sorted words, ignoring punctuation,
+// brackets and plurals.
+func normalizeWords(name string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	words := make([]string, 0, len(fields))
+	for _, word := range fields {
+		if alias, ok := wordAliases[word]; ok {
+			word = alias
+		}
+		if len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") {
+			word = strings.TrimSuffix(word, "s")
+		}
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// wordScore is the share of words the two names have in common.
+func wordScore(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	set := map[string]bool{}
+	for _, word := range b {
+		set[word] = true
+	}
+	common := 0
+	for _, word := range a {
+		if set[word] {
+			common++
+			delete(set, word)
+		}
+	}
+	return 2 * float64(common) / float64(len(a)+len(b))
+}
+
+func letterPairs(s string) map[string]int {
+	pairs := map[string]int{}
+	runes := []rune(s)
+	for i := 0; i+1 < len(runes); i++ {
+		if runes[i] == ' ' || runes[i+1] == ' ' {
+			continue
+		}
+		pairs[string(runes[i:i+2])]++
+	}
+	return pairs
+}
+
+// dice is the Sørensen–Dice coefficient of two sets of letter pairs.
+func dice(a, b map[string]int) float64 {
+	total := 0
+	for _, count := range a {
+		total += count
+	}
+	for _, count := range b {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	common := 0
+	for pair, count := range a {
+		if other := b[pair]; other < count {
+			common += other
+		} else {
+			common += count
+		}
+	}
+	return 2 * float64(common) / float64(total)
+}
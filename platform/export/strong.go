@@ -0,0 +1,128 @@
+package export
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// strongTimeLayout is how Strong writes when a workout started, in the phone's time zone.
+const strongTimeLayout = "2006-01-02 15:04:05"
+
+// readStrong reads Strong's export: one row per set, with the workout's date, name and length
+// repeated on each. Older exports give the length as "1h 5m" and leave the weight unit to the
+// app's settings; newer ones give seconds and put the unit in the column name.
+func readStrong(header []string, rows []map[string]string, unit string, location *time.Location) (*Document, error) {
+	weightColumn := "Weight"
+	for _, column := range header {
+		switch column {
+		case "Weight (kg)":
+			weightColumn, unit = column, UnitKG
+		case "Weight (lbs)":
+			weightColumn, unit = column, UnitLBS
+		}
+	}
+
+	workouts := newAppWorkouts()
+	for i, row := range rows {
+		line := fmt.Sprintf("line %d", i+2)
+		name := row["Exercise Name"]
+		setType, ok := strongSetType(row["Set Order"])
+		if name == "" || !ok {
+			// Rest timers and notes get rows of their own
+			continue
+		}
+
+		started, err := time.ParseInLocation(strongTimeLayout, row["Date"], location)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not a date and time", line, row["Date"])
+		}
+		duration, err := strongDuration(row)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", line, err)
+		}
+		activity := workouts.workout(row["Date"]+"|"+row["Workout Name"], func() Activity {
+			return Activity{
+				Type:         "GYM_WORKOUT",
+				Name:         row["Workout Name"],
+				ActivityTime: started,
+				StartTime:    &started,
+				FinishTime:   finishTime(started, duration),
+				Notes:        row["Workout Notes"],
+			}
+		})
+
+		weight, err := parseDecimal(row[weightColumn])
+		if err != nil {
+			return nil, fmt.Errorf("%s: weight: %w", line, err)
+		}
+		reps, err := parseCount(row["Reps"])
+		if err != nil {
+			return nil, fmt.Errorf("%s: reps: %w", line, err)
+		}
+		setUnit := unit
+		if row["Weight Unit"] != "" {
+			setUnit = row["Weight Unit"]
+		}
+
+		exercise := workouts.exercise(activity, name, nil)
+		exercise.Sets = append(exercise.Sets, Set{
+			Reps:     reps,
+			WeightKG: toKG(weight, setUnit),
+			SetType:  setType,
+			Notes: setNotes(row["Notes"],
+				nonZero("RPE %s", row["RPE"]),
+				nonZero("%s m", firstOf(row, "Distance (meters)", "Distance")),
+				nonZero("%s s", row["Seconds"])),
+		})
+	}
+	return workouts.doc, nil
+}
+
+// strongSetType reads Strong's set order column, which numbers working sets and marks the rest
+// with a letter. It reports false for rows that aren't sets.
+func strongSetType(order string) (string, bool) {
+	switch strings.ToUpper(order) {
+	case "W":
+		return setTypeWarmup, true
+	case "D":
+		return setTypeDropset, true
+	case "F":
+		return setTypeFailure, true
+	}
+	if _, err := strconv.Atoi(order); err != nil {
+		return "", false
+	}
+	return "", true
+}
+
+// strongDuration reads how long a workout lasted from whichever column the export has.
+func strongDuration(row map[string]string) (time.Duration, error) {
+	if seconds := row["Duration (sec)"]; seconds != "" {
+		n, err := parseCount(seconds)
+		if err != nil {
+			return 0, fmt.Errorf("duration: %w", err)
+		}
+		return time.Duration(n) * time.Second, nil
+	}
+	value := strings.ReplaceAll(firstOf(row, "Duration", "Workout Duration"), " ", "")
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("duration: %q is not a length of time", value)
+	}
+	return duration, nil
+}
+
+// firstOf returns the first of the columns that has a value.
+func firstOf(row map[string]string, columns ...string) string {
+	for _, column := range columns {
+		if row[column] != "" {
+			return row[column]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package geo
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// The example from Google's description of the polyline format.
+const examplePolyline = "_p~iF~ps|U_ulLnnqC_mqNvxq`@"
+
+var examplePoints = []Point{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}
+
+func TestDecodePolyline(t *testing.T) {
+	points, err := DecodePolyline(examplePolyline)
+	if err != nil {
+		t.Fatalf("DecodePolyline: %v", err)
+	}
+	if len(points) != len(examplePoints) {
+		t.Fatalf("got %d points, want %d", len(points), len(examplePoints))
+	}
+	for i, point := range points {
+		if math.Abs(point.Lat-examplePoints[i].Lat) > 1e-9 || math.Abs(point.Lng-examplePoints[i].Lng) > 1e-9 {
+			t.Errorf("point %d = %+v, want %+v", i, point, examplePoints[i])
+		}
+	}
+}
+
+func TestDecodePolylineRejectsTruncated(t *testing.T) {
+	if _, err := DecodePolyline(examplePolyline[:len(examplePolyline)-2]); err != ErrInvalidPolyline {
+		t.Errorf("err = %v, want ErrInvalidPolyline", err)
+	}
+}
+
+func TestEncodePolyline(t *testing.T) {
+	if encoded := EncodePolyline(examplePoints); encoded != examplePolyline {
+		t.Errorf("encoded = %q, want %q", encoded, examplePolyline)
+	}
+}
+
+func TestRouteFeature(t *testing.T) {
+	feature := RouteFeature(examplePoints, map[string]interface{}{"name": "Long Ride"})
+	b, err := json.Marshal(feature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"Feature","bbox":[-126.453,38.5,-120.2,43.252],` +
+		`"geometry":{"type":"LineString","coordinates":[[-120.2,38.5],[-120.95,40.7],[-126.453,43.252]]},` +
+		`"properties":{"end":[-126.453,43.252],"name":"Long Ride","start":[-120.2,38.5]}}`
+	if string(b) != want {
+		t.Errorf("feature =\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestHeatmapCountsEachRouteOncePerCell(t *testing.T) {
+	out := []Point{{0.0001, 0.0001}, {0.0001, 0.0031}}
+	loop := []Point{{0.0001, 0.0001}, {0.0001, 0.0011}, {0.0001, 0.0001}}
+
+	heat := Heatmap([][]Point{out, loop}, 0.001)
+	if len(heat) != 4 {
+		t.Fatalf("got %d cells, want 4: %+v", len(heat), heat)
+	}
+	// Both routes pass through the first two cells; the loop doing so twice doesn't count.
+	for i, want := range []float64{1, 1, 0.5, 0.5} {
+		if heat[i].Intensity != want {
+			t.Errorf("cell %d intensity = %v, want %v", i, heat[i].Intensity, want)
+		}
+	}
+	if b, _ := json.Marshal(heat[0]); string(b) != "[0.0005,0.0005,1]" {
+		t.Errorf("point = %s", b)
+	}
+}
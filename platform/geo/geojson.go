@@ -0,0 +1,57 @@
+package geo
+
+// Feature is a GeoJSON feature. Coordinates are written longitude first, as GeoJSON has them.
+type Feature struct {
+	Type       string                 `json:"type"`
+	BBox       []float64              `json:"bbox,omitempty"`
+	Geometry   Geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Geometry is the shape of a GeoJSON feature.
+type Geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// FeatureCollection is a set of GeoJSON features.
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// NewFeatureCollection gathers features into a collection.
+func NewFeatureCollection(features []Feature) FeatureCollection {
+	if features == nil {
+		features = []Feature{}
+	}
+	return FeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+// RouteFeature turns a route into a GeoJSON line. Its bounding box is set, and its start and
+// end points are added to properties as "start" and "end".
+func RouteFeature(points []Point, properties map[string]interface{}) Feature {
+	if properties == nil {
+		properties = map[string]interface{}{}
+	}
+	coordinates := make([][]float64, 0, len(points))
+	for _, point := range points {
+		coordinates = append(coordinates, position(point))
+	}
+
+	feature := Feature{
+		Type:       "Feature",
+		Geometry:   Geometry{Type: "LineString", Coordinates: coordinates},
+		Properties: properties,
+	}
+	if bounds, ok := BoundsOf(points); ok {
+		feature.BBox = []float64{bounds.MinLng, bounds.MinLat, bounds.MaxLng, bounds.MaxLat}
+		properties["start"] = position(points[0])
+		properties["end"] = position(points[len(points)-1])
+	}
+	return feature
+}
+
+func position(point Point) []float64 {
+	return []float64{point.Lng, point.Lat}
+}
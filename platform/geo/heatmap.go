@@ -0,0 +1,78 @@
+package geo
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+// DefaultHeatCell is the size of a heatmap cell in degrees, about 50 metres north to south.
+const DefaultHeatCell = 0.0005
+
+// HeatPoint is one cell of a heatmap: its centre, and how many routes pass through it compared
+// with the busiest cell, from 0 to 1.
+type HeatPoint struct {
+	Lat       float64
+	Lng       float64
+	Intensity float64
+}
+
+// MarshalJSON writes the point as [lat, lng, intensity], the form Leaflet.heat reads.
+func (p HeatPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal([3]float64{p.Lat, p.Lng, p.Intensity})
+}
+
+type heatCell struct {
+	lat, lng int
+}
+
+// Heatmap counts how many routes pass through each cell of a grid cellDegrees across. A route
+// counts once in each cell it passes through, however often it loops back, and the gaps between
+// its points are filled in so sparse routes still draw a continuous line.
+func Heatmap(routes [][]Point, cellDegrees float64) []HeatPoint {
+	counts := map[heatCell]int{}
+	for _, route := range routes {
+		visited := map[heatCell]bool{}
+		visit := func(point Point) {
+			cell := heatCell{lat: int(math.Floor(point.Lat / cellDegrees)), lng: int(math.Floor(point.Lng / cellDegrees))}
+			if !visited[cell] {
+				visited[cell] = true
+				counts[cell]++
+			}
+		}
+		for i, point := range route {
+			if i > 0 {
+				previous := route[i-1]
+				steps := int(math.Max(math.Abs(point.Lat-previous.Lat), math.Abs(point.Lng-previous.Lng)) / cellDegrees)
+				for step := 1; step < steps; step++ {
+					fraction := float64(step) / float64(steps)
+					visit(Point{
+						Lat: previous.Lat + (point.Lat-previous.Lat)*fraction,
+						Lng: previous.Lng + (point.Lng-previous.Lng)*fraction,
+					})
+				}
+			}
+			visit(point)
+		}
+	}
+
+	busiest := 0
+	for _, count := range counts {
+		busiest = max(busiest, count)
+	}
+	heat := make([]HeatPoint, 0, len(counts))
+	for cell, count := range counts {
+		heat = append(heat, HeatPoint{
+			Lat:       (float64(cell.lat) + 0.5) * cellDegrees,
+			Lng:       (float64(cell.lng) + 0.5) * cellDegrees,
+			Intensity: float64(count) / float64(busiest),
+		})
+	}
+	sort.Slice(heat, func(i, j int) bool {
+		if heat[i].Lat != heat[j].Lat {
+			return heat[i].Lat < heat[j].Lat
+		}
+		return heat[i].Lng < heat[j].Lng
+	})
+	return heat
+}
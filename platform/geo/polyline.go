@@ -0,0 +1,130 @@
+// Package geo works with the routes of runs, rides and other activities recorded with GPS.
+package geo
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// polylinePrecision is the factor coordinates are scaled by in an encoded polyline, five
+// decimal places as Strava and Google use.
+const polylinePrecision = 1e5
+
+// ErrInvalidPolyline is returned for a polyline that ends part way through a coordinate.
+var ErrInvalidPolyline = errors.New("invalid encoded polyline")
+
+// Point is a position in degrees.
+type Point struct {
+	Lat float64
+	Lng float64
+}
+
+// DecodePolyline turns an encoded polyline, as Strava gives routes, into its points.
+func DecodePolyline(encoded string) ([]Point, error) {
+	var (
+		points   []Point
+		lat, lng int
+	)
+	for i := 0; i < len(encoded); {
+		var dLat, dLng int
+		var err error
+		if dLat, i, err = decodeValue(encoded, i); err != nil {
+			return nil, err
+		}
+		if dLng, i, err = decodeValue(encoded, i); err != nil {
+			return nil, err
+		}
+		lat += dLat
+		lng += dLng
+		points = append(points, Point{Lat: float64(lat) / polylinePrecision, Lng: float64(lng) / polylinePrecision})
+	}
+	return points, nil
+}
+
+// decodeValue reads one signed value starting at i, returning it and where the next begins.
+func decodeValue(encoded string, i int) (int, int, error) {
+	var result, shift int
+	for {
+		if i >= len(encoded) {
+			return 0, i, ErrInvalidPolyline
+		}
+		b := int(encoded[i]) - 63
+		i++
+		if b < 0 || b > 0x3f || shift > 30 {
+			return 0, i, ErrInvalidPolyline
+		}
+		result |= (b & 0x1f) << shift
+		shift += 5
+		if b < 0x20 {
+			break
+		}
+	}
+	if result&1 != 0 {
+		return ^(result >> 1), i, nil
+	}
+	return result >> 1, i, nil
+}
+
+// EncodePolyline turns points into an encoded polyline, the reverse of DecodePolyline.
+func EncodePolyline(points []Point) string {
+	var (
+		b        strings.Builder
+		lat, lng int
+	)
+	for _, point := range points {
+		nextLat := int(math.Round(point.Lat * polylinePrecision))
+		nextLng := int(math.Round(point.Lng * polylinePrecision))
+		encodeValue(&b, nextLat-lat)
+		encodeValue(&b, nextLng-lng)
+		lat, lng = nextLat, nextLng
+	}
+	return b.String()
+}
+
+func encodeValue(b *strings.Builder, value int) {
+	shifted := value << 1
+	if value < 0 {
+		shifted = ^shifted
+	}
+	for shifted >= 0x20 {
+		b.WriteByte(byte((0x20 | (shifted & 0x1f)) + 63))
+		shifted >>= 5
+	}
+	b.WriteByte(byte(shifted + 63))
+}
+
+// earthRadius is the Earth's mean radius in metres.
+const earthRadius = 6371000
+
+// Distance is how far apart two points are in metres, along the Earth's surface.
+func Distance(a, b Point) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// Bounds is the smallest box around a route.
+type Bounds struct {
+	MinLat float64
+	MinLng float64
+	MaxLat float64
+	MaxLng float64
+}
+
+// BoundsOf returns the box around points, and false if there are none.
+func BoundsOf(points []Point) (Bounds, bool) {
+	if len(points) == 0 {
+		return Bounds{}, false
+	}
+	bounds := Bounds{MinLat: points[0].Lat, MinLng: points[0].Lng, MaxLat: points[0].Lat, MaxLng: points[0].Lng}
+	for _, point := range points[1:] {
+		bounds.MinLat = math.Min(bounds.MinLat, point.Lat)
+		bounds.MinLng = math.Min(bounds.MinLng, point.Lng)
+		bounds.MaxLat = math.Max(bounds.MaxLat, point.Lat)
+		bounds.MaxLng = math.Max(bounds.MaxLng, point.Lng)
+	}
+	return bounds, true
+}
@@ -0,0 +1,141 @@
+package janitor
+
+import (
+	"context"
+	"fitness/platform/database"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// StaleAfter is how long a draft can go untouched before the user is warned about it.
+const StaleAfter = 24 * time.Hour
+
+const (
+	defaultDraftMaxAgeDays = 7
+	defaultInterval        = time.Hour
+)
+
+// Janitor periodically cleans up draft workouts that have been abandoned. Edits of finished
+// workouts are discarded, and new workouts are finished or discarded as their user prefers.
+type Janitor struct {
+	ActivityRepo *database.ActivityRepo
+	StreakRepo   *database.StreakRepo
+
+	// DraftMaxAge is how long a draft can go untouched before it is cleaned up.
+	DraftMaxAge time.Duration
+	// Interval is how often to look for abandoned drafts.
+	Interval time.Duration
+	// OnFinalized, if set, is called with the ID of each workout the janitor finishes.
+	OnFinalized func(activityID uint)
+}
+
+// New creates a Janitor. The number of days a draft is kept for can be set with DRAFT_MAX_AGE_DAYS.
+func New(activityRepo *database.ActivityRepo, streakRepo *database.StreakRepo) *Janitor {
+	maxAgeDays := defaultDraftMaxAgeDays
+	if value := os.Getenv("DRAFT_MAX_AGE_DAYS"); value != "" {
+		if days, err := strconv.Atoi(value); err == nil && days > 0 {
+			maxAgeDays = days
+		} else {
+			log.Printf("Ignoring invalid DRAFT_MAX_AGE_DAYS %q", value)
+		}
+	}
+
+	return &Janitor{
+		ActivityRepo: activityRepo,
+		StreakRepo:   streakRepo,
+		DraftMaxAge:  time.Duration(maxAgeDays) * 24 * time.Hour,
+		Interval:     defaultInterval,
+	}
+}
+
+// Start runs the janitor in the background until the context is cancelled.
+func (j *Janitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(j.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := j.RunOnce(time.Now()); err != nil {
+				log.Printf("Janitor: failed to clean up drafts: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce cleans up every draft that has been untouched for longer than DraftMaxAge.
+func (j *Janitor) RunOnce(now time.Time) error {
+	drafts, err := j.ActivityRepo.GetStaleDrafts(0, now.Add(-j.DraftMaxAge))
+	if err != nil {
+		return err
+	}
+
+	for _, draft := range drafts {
+		if err := j.clean(draft); err != nil {
+			log.Printf("Janitor: failed to clean up draft %d: %v", draft.Activity.ID, err)
+		}
+	}
+	return nil
+}
+
+// CleanupFor says what will happen to a draft once it has been abandoned for too long.
+func CleanupFor(draft *database.Activity) database.DraftCleanup {
+	if draft.OriginalActivityID != nil || !hasSets(draft) {
+		return database.DraftCleanupDiscard
+	}
+	switch draft.User.DraftCleanup {
+	case database.DraftCleanupDiscard, database.DraftCleanupKeep:
+		return draft.User.DraftCleanup
+	default:
+		return database.DraftCleanupFinish
+	}
+}
+
+func (j *Janitor) clean(draft database.StaleDraft) error {
+	activity := draft.Activity
+
+	switch CleanupFor(activity) {
+	case database.DraftCleanupKeep:
+		return nil
+
+	case database.DraftCleanupDiscard:
+		if err := j.ActivityRepo.DeleteActivityAndChildren(activity.ID); err != nil {
+			return err
+		}
+		log.Printf("Janitor: discarded draft %d %q of user %d, untouched since %s",
+			activity.ID, activity.Name, activity.UserID, draft.LastTouchedAt.Format(time.RFC3339))
+		return nil
+
+	default:
+		// The workout is taken to have ended when it was last worked on.
+		finalID, err := j.ActivityRepo.FinalizeDraftAt(activity.ID, activity.Notes, draft.LastTouchedAt)
+		if err != nil {
+			return err
+		}
+		log.Printf("Janitor: finished draft %d %q of user %d, untouched since %s",
+			activity.ID, activity.Name, activity.UserID, draft.LastTouchedAt.Format(time.RFC3339))
+
+		if _, err := j.StreakRepo.RecalculateStreak(activity.UserID); err != nil {
+			log.Printf("Janitor: failed to recalculate streak for user %d: %v", activity.UserID, err)
+		}
+		if j.OnFinalized != nil {
+			j.OnFinalized(finalID)
+		}
+		return nil
+	}
+}
+
+func hasSets(activity *database.Activity) bool {
+	for _, gymExercise := range activity.GymExercises {
+		if len(gymExercise.Sets) > 0 {
+			return true
+		}
+	}
+	return false
+}
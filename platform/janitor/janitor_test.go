@@ -0,0 +1,43 @@
+package janitor
+
+import (
+	"fitness/platform/database"
+	"testing"
+)
+
+func TestCleanupFor(t *testing.T) {
+	originalID := uint(7)
+	withSets := []database.GymExercise{{}, {Sets: []database.GymSet{{Reps: 5}}}}
+	withoutSets := []database.GymExercise{{}, {}}
+
+	for _, test := range []struct {
+		name  string
+		draft database.Activity
+		want  database.DraftCleanup
+	}{
+		{"finished by default", database.Activity{GymExercises: withSets}, database.DraftCleanupFinish},
+		{"the user's choice to finish", database.Activity{
+			GymExercises: withSets, User: database.User{DraftCleanup: database.DraftCleanupFinish},
+		}, database.DraftCleanupFinish},
+		{"the user's choice to discard", database.Activity{
+			GymExercises: withSets, User: database.User{DraftCleanup: database.DraftCleanupDiscard},
+		}, database.DraftCleanupDiscard},
+		{"the user's choice to keep", database.Activity{
+			GymExercises: withSets, User: database.User{DraftCleanup: database.DraftCleanupKeep},
+		}, database.DraftCleanupKeep},
+		{"an unknown choice finishes", database.Activity{
+			GymExercises: withSets, User: database.User{DraftCleanup: "archive"},
+		}, database.DraftCleanupFinish},
+		{"exercises without sets are discarded", database.Activity{
+			GymExercises: withoutSets, User: database.User{DraftCleanup: database.DraftCleanupKeep},
+		}, database.DraftCleanupDiscard},
+		{"no exercises are discarded", database.Activity{}, database.DraftCleanupDiscard},
+		{"edit drafts are always discarded", database.Activity{
+			OriginalActivityID: &originalID, GymExercises: withSets, User: database.User{DraftCleanup: database.DraftCleanupKeep},
+		}, database.DraftCleanupDiscard},
+	} {
+		if got := CleanupFor(&test.draft); got != test.want {
+			t.Errorf("%s: CleanupFor = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
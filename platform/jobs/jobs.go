@@ -0,0 +1,232 @@
+// Package jobs runs users' exports and imports in the background, so a large one doesn't tie up
+// a request. Jobs are queued in the database and their files kept there until they expire.
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"fitness/platform/database"
+	"fitness/platform/export"
+	"fitness/platform/track"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	defaultInterval  = time.Minute
+	defaultRetention = 7 * 24 * time.Hour
+
+	// duplicateWindow is how close together two sessions have to start to be taken as the same
+	// one recorded twice, as devices and Strava can disagree on the start by a few seconds.
+	duplicateWindow = 2 * time.Minute
+)
+
+// Runner works through queued export and import jobs.
+type Runner struct {
+	JobRepo      *database.DataJobRepo
+	ActivityRepo *database.ActivityRepo
+	ExerciseRepo *database.ExerciseRepo
+	StreakRepo   *database.StreakRepo
+	MappingRepo  *database.ExerciseMappingRepo
+
+	// Interval is how often to look for queued jobs. Queuing a job also wakes the runner.
+	Interval time.Duration
+	// Retention is how long a finished job, and its file, is kept for.
+	Retention time.Duration
+	// OnImported, if set, is called with the workouts each import saved.
+	OnImported func(userID uint, activityIDs []uint)
+
+	wake chan struct{}
+}
+
+// New creates a Runner.
+func New(jobRepo *database.DataJobRepo, activityRepo *database.ActivityRepo, exerciseRepo *database.ExerciseRepo, streakRepo *database.StreakRepo, mappingRepo *database.ExerciseMappingRepo) *Runner {
+	return &Runner{
+		JobRepo:      jobRepo,
+		ActivityRepo: activityRepo,
+		ExerciseRepo: exerciseRepo,
+		StreakRepo:   streakRepo,
+		MappingRepo:  mappingRepo,
+		Interval:     defaultInterval,
+		Retention:    defaultRetention,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Wake makes the runner look for queued jobs now rather than at its next interval.
+func (r *Runner) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs queued jobs in the background until the context is cancelled. Jobs left running
+// when the server last stopped are run again.
+func (r *Runner) Start(ctx context.Context) {
+	if err := r.JobRepo.ResetRunningJobs(); err != nil {
+		log.Printf("Jobs: failed to requeue interrupted jobs: %v", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := r.RunOnce(time.Now()); err != nil {
+				log.Printf("Jobs: failed to run jobs: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-r.wake:
+			}
+		}
+	}()
+}
+
+// RunOnce runs every queued job and removes expired ones.
+func (r *Runner) RunOnce(now time.Time) error {
+	if deleted, err := r.JobRepo.DeleteExpiredJobs(now); err != nil {
+		return err
+	} else if deleted > 0 {
+		log.Printf("Jobs: removed %d expired job(s)", deleted)
+	}
+
+	for {
+		job, err := r.JobRepo.ClaimNextJob(time.Now())
+		if err != nil || job == nil {
+			return err
+		}
+		r.run(job)
+	}
+}
+
+// run runs a single job and records how it went.
+func (r *Runner) run(job *database.DataJob) {
+	var (
+		output   []byte
+		fileName string
+		summary  string
+		err      error
+	)
+	switch job.Kind {
+	case database.DataJobExport:
+		output, fileName, summary, err = r.export(job)
+	case database.DataJobImport:
+		summary, err = r.importFile(job)
+		fileName = job.FileName
+	default:
+		err = fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+
+	now := time.Now()
+	if err != nil {
+		log.Printf("Jobs: %s %d for user %d failed: %v", job.Kind, job.ID, job.UserID, err)
+		if err := r.JobRepo.FailJob(job.ID, err.Error(), now, now.Add(r.Retention)); err != nil {
+			log.Printf("Jobs: failed to record failure of job %d: %v", job.ID, err)
+		}
+		return
+	}
+	if err := r.JobRepo.FinishJob(job.ID, output, fileName, summary, now, now.Add(r.Retention)); err != nil {
+		log.Printf("Jobs: failed to record completion of job %d: %v", job.ID, err)
+	}
+}
+
+// export writes all of the user's finished workouts to a file.
+func (r *Runner) export(job *database.DataJob) ([]byte, string, string, error) {
+	now := time.Now()
+	output, count, err := Export(r.ActivityRepo, job.UserID, job.Format, now)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return output, export.FileName(job.Format, now), fmt.Sprintf("Exported %d activities.", count), nil
+}
+
+// importFile saves the workouts in an uploaded file, using the exercises the user matched up if
+// they checked the import first.
+func (r *Runner) importFile(job *database.DataJob) (string, error) {
+	switch job.Format {
+	case database.DataFormatGPX, database.DataFormatTCX, database.DataFormatFIT:
+		return r.importTrack(job)
+	}
+
+	doc, err := export.ReadFile(job.Input, job.Format, job.WeightUnit, export.Location(job.TimeZone))
+	if err != nil {
+		return "", err
+	}
+	mappings, err := r.MappingRepo.GetMappings(job.UserID, job.Format)
+	if err != nil {
+		return "", fmt.Errorf("loading exercise mappings: %w", err)
+	}
+	importer := &export.Importer{ActivityRepo: r.ActivityRepo, ExerciseRepo: r.ExerciseRepo, Mappings: map[string]*uint{}}
+	for name, mapping := range mappings {
+		importer.Mappings[name] = mapping.ExerciseDefinitionID
+	}
+
+	result, err := importer.Import(job.UserID, doc)
+	if err != nil {
+		return "", err
+	}
+
+	if result.Imported > 0 {
+		if _, err := r.StreakRepo.RecalculateStreak(job.UserID); err != nil {
+			log.Printf("Jobs: failed to recalculate streak for user %d: %v", job.UserID, err)
+		}
+		if r.OnImported != nil {
+			r.OnImported(job.UserID, result.ActivityIDs)
+		}
+	}
+	return result.Summary(), nil
+}
+
+// importTrack saves the run, ride or other session recorded in a GPX, TCX or FIT file. It is
+// skipped if the user already has one that started at the same time, most often because it was
+// synced from Strava too.
+func (r *Runner) importTrack(job *database.DataJob) (string, error) {
+	t, err := track.Parse(job.Input, job.Format)
+	if err != nil {
+		return "", err
+	}
+	activity := t.ToActivity(job.UserID)
+	duplicate, err := r.ActivityRepo.ImportTrack(activity, t.Streams(), duplicateWindow)
+	if err != nil {
+		return "", err
+	}
+	if duplicate != nil {
+		if duplicate.FromStrava() {
+			return fmt.Sprintf("Skipped %s: it is already here as %q, synced from Strava.", job.FileName, duplicate.Name), nil
+		}
+		return fmt.Sprintf("Skipped %s: it is already here as %q.", job.FileName, duplicate.Name), nil
+	}
+
+	if _, err := r.StreakRepo.RecalculateStreak(job.UserID); err != nil {
+		log.Printf("Jobs: failed to recalculate streak for user %d: %v", job.UserID, err)
+	}
+	return fmt.Sprintf("Imported %q, %.2f km.", activity.Name, activity.DistanceKM()), nil
+}
+
+// Export writes all of a user's finished workouts and cardio activities in the given format,
+// returning the file and how many activities it holds. It is used directly for small exports that needn't be queued.
+func Export(activityRepo *database.ActivityRepo, userID uint, format database.DataFormat, now time.Time) ([]byte, int, error) {
+	activities, err := activityRepo.GetFinishedActivitiesWithSets(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	saved, err := activityRepo.GetStreamsByUserID(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	streams := make(map[uint]database.Streams, len(saved))
+	for _, stream := range saved {
+		streams[stream.ActivityID] = stream.Streams
+	}
+
+	var buf bytes.Buffer
+	if err := export.Write(&buf, export.Build(activities, streams, now), format); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), len(activities), nil
+}
@@ -1,18 +1,26 @@
 package middleware
 
 import (
+	"fitness/platform/database"
+	"log"
+
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
-func CheckActiveWorkout(ctx *gin.Context) {
-	session := sessions.Default(ctx)
-
-	activeID := session.Get("active_workout_id")
+// CheckActiveWorkout looks up the signed in user's draft workout, if they have one,
+// and makes its ID available to handlers as "ActiveWorkoutID".
+func CheckActiveWorkout(activityRepo *database.ActivityRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if userID, ok := sessions.Default(ctx).Get("user").(uint); ok {
+			active, err := activityRepo.GetActiveDraft(userID)
+			if err != nil {
+				log.Printf("Failed to load active workout for user %d: %v", userID, err)
+			} else if active != nil {
+				ctx.Set("ActiveWorkoutID", active.ID)
+			}
+		}
 
-	if activeID != nil {
-		ctx.Set("ActiveWorkoutID", activeID)
+		ctx.Next()
 	}
-
-	ctx.Next()
 }
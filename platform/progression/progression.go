@@ -0,0 +1,52 @@
+package progression
+
+import "fitness/platform/database"
+
+// Rule decides how weights should move on from the last session of an exercise.
+// If every working set last time reached TargetReps, each weight goes up by IncrementKG.
+type Rule struct {
+	IncrementKG float64
+	TargetReps  int
+}
+
+// RuleForUser returns the progression rule from a user's settings.
+func RuleForUser(user *database.User) Rule {
+	return Rule{
+		IncrementKG: user.ProgressionIncrementKG,
+		TargetReps:  user.ProgressionTargetReps,
+	}
+}
+
+// Enabled reports whether the rule would ever suggest a change.
+func (r Rule) Enabled() bool {
+	return r.IncrementKG > 0 && r.TargetReps > 0
+}
+
+// TargetsHit reports whether every working set reached the target reps.
+func (r Rule) TargetsHit(sets []database.GymSet) bool {
+	working := 0
+	for _, set := range sets {
+		if set.WeightKG <= 0 {
+			continue
+		}
+		working++
+		if set.Reps < r.TargetReps {
+			return false
+		}
+	}
+	return working > 0
+}
+
+// SuggestWeights returns the suggested weight for each of the previous sets, in order.
+func (r Rule) SuggestWeights(previous []database.GymSet) []float64 {
+	increase := r.Enabled() && r.TargetsHit(previous)
+
+	suggested := make([]float64, len(previous))
+	for i, set := range previous {
+		suggested[i] = set.WeightKG
+		if increase && set.WeightKG > 0 {
+			suggested[i] += r.IncrementKG
+		}
+	}
+	return suggested
+}
@@ -0,0 +1,47 @@
+package progression
+
+import (
+	"fitness/platform/database"
+	"slices"
+	"testing"
+)
+
+func sets(repsAndWeights ...float64) []database.GymSet {
+	var sets []database.GymSet
+	for i := 0; i+1 < len(repsAndWeights); i += 2 {
+		sets = append(sets, database.GymSet{Reps: int(repsAndWeights[i]), WeightKG: repsAndWeights[i+1]})
+	}
+	return sets
+}
+
+func TestSuggestWeights(t *testing.T) {
+	rule := Rule{IncrementKG: 2.5, TargetReps: 5}
+	for _, test := range []struct {
+		name     string
+		rule     Rule
+		previous []database.GymSet
+		want     []float64
+	}{
+		{"every set hit the target", rule, sets(5, 100, 6, 100, 5, 90), []float64{102.5, 102.5, 92.5}},
+		{"one set fell short", rule, sets(5, 100, 4, 100), []float64{100, 100}},
+		{"warm-ups without weight don't count and aren't raised", rule, sets(3, 0, 5, 60), []float64{0, 62.5}},
+		{"only bodyweight sets", rule, sets(10, 0, 10, 0), []float64{0, 0}},
+		{"no increment set", Rule{TargetReps: 5}, sets(5, 100), []float64{100}},
+		{"no target set", Rule{IncrementKG: 2.5}, sets(5, 100), []float64{100}},
+		{"no previous sets", rule, nil, []float64{}},
+	} {
+		if got := test.rule.SuggestWeights(test.previous); !slices.Equal(got, test.want) {
+			t.Errorf("%s: SuggestWeights = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRuleForUser(t *testing.T) {
+	rule := RuleForUser(&database.User{ProgressionIncrementKG: 5, ProgressionTargetReps: 8})
+	if rule != (Rule{IncrementKG: 5, TargetReps: 8}) || !rule.Enabled() {
+		t.Errorf("rule = %+v", rule)
+	}
+	if RuleForUser(&database.User{}).Enabled() {
+		t.Error("a user without progression settings has a rule enabled")
+	}
+}
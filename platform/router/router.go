@@ -1,17 +1,31 @@
 package router
 
 import (
+	"context"
 	"encoding/gob"
 	"encoding/json"
 	"errors"
 	"fitness/platform/database"
+	"fitness/platform/janitor"
+	"fitness/platform/jobs"
 	"fitness/platform/middleware"
+	"fitness/platform/strava"
+	"fitness/platform/webhook"
+	"fitness/web/app/api"
 	"fitness/web/app/login"
 	"fitness/web/app/logout"
+	"fitness/web/app/stravapush"
 	"fitness/web/app/user"
+	"fitness/web/app/webhooks"
 	"fitness/web/app/workout"
+	"fmt"
 	"html/template"
+	"log"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
@@ -19,6 +33,7 @@ import (
 
 	"fitness/platform/authenticator"
 	"fitness/web/app/callback"
+	"fitness/web/app/data"
 	"fitness/web/app/home"
 )
 
@@ -29,6 +44,23 @@ type Handler struct {
 	GymSetRepo      *database.GymSetRepo
 	ExerciseRepo    *database.ExerciseRepo
 	GymExerciseRepo *database.GymExerciseRepo
+	StreakRepo      *database.StreakRepo
+	RecordRepo      *database.PersonalRecordRepo
+	RestRepo        *database.RestRepo
+	RevisionRepo    *database.RevisionRepo
+	TokenRepo       *database.TokenRepo
+	WebhookRepo     *database.WebhookRepo
+	DataJobRepo     *database.DataJobRepo
+	MappingRepo     *database.ExerciseMappingRepo
+	StravaRepo      *database.StravaRepo
+	Janitor         *janitor.Janitor
+	Webhooks        *webhook.Dispatcher
+	Jobs            *jobs.Runner
+	StravaAuth      *strava.Auth
+	Strava          *strava.Syncer
+	StravaEvents    *strava.EventProcessor
+	StravaPoster    *strava.Poster
+	StravaStreams   *strava.StreamFetcher
 }
 
 // New creates the master handler with all dependencies.
@@ -54,13 +86,95 @@ func New(auth *authenticator.Authenticator) (*Handler, error) {
 		GymSetRepo:      database.NewGymSetRepo(db),
 		ExerciseRepo:    database.NewExerciseRepo(db),
 		GymExerciseRepo: database.NewGymExerciseRepo(db),
+		StreakRepo:      database.NewStreakRepo(db),
+		RecordRepo:      database.NewPersonalRecordRepo(db),
+		RestRepo:        database.NewRestRepo(db),
+		RevisionRepo:    database.NewRevisionRepo(db),
+		TokenRepo:       database.NewTokenRepo(db),
+		WebhookRepo:     database.NewWebhookRepo(db),
+		DataJobRepo:     database.NewDataJobRepo(db),
+		MappingRepo:     database.NewExerciseMappingRepo(db),
+		StravaRepo:      database.NewStravaRepo(db),
 	}
 
+	// Send webhook events in the background.
+	handler.Webhooks = webhook.New(handler.WebhookRepo)
+	handler.Webhooks.Start(context.Background())
+
+	// Run exports and imports in the background. Imported workouts are checked for PBs, oldest
+	// first, but aren't announced to webhooks as they weren't just done.
+	handler.Jobs = jobs.New(handler.DataJobRepo, handler.ActivityRepo, handler.ExerciseRepo, handler.StreakRepo, handler.MappingRepo)
+	handler.Jobs.OnImported = func(userID uint, activityIDs []uint) {
+		for _, activityID := range activityIDs {
+			activity, err := handler.ActivityRepo.GetActivityByID(activityID)
+			if err == nil {
+				_, err = workout.AnalyzeWorkoutForPBs(activity, handler.RecordRepo)
+			}
+			if err != nil {
+				log.Printf("Failed to analyze workout %d for PBs: %v", activityID, err)
+			}
+		}
+	}
+	handler.Jobs.Start(context.Background())
+
+	// Sync connected Strava accounts in the background, each with its athlete's own tokens.
+	handler.StravaAuth, err = strava.NewAuthFromEnv(handler.StravaRepo)
+	if err != nil {
+		log.Printf("Strava is off: %v", err)
+	}
+
+	// Fetch the readings through new activities, so their time in each zone counts before anyone
+	// opens them. Syncs and push events wake it when there are new ones.
+	handler.StravaStreams = strava.NewStreamFetcher(handler.StravaRepo, handler.StravaAuth.ClientFor)
+	handler.StravaStreams.Start(context.Background())
+
+	// Each sync wakes the fetcher for the activities it added.
+	handler.Strava = strava.NewSyncer(handler.StravaRepo, handler.StreakRepo, handler.StravaAuth.ClientFor)
+	handler.Strava.OnAdded = func(userID uint) {
+		handler.StravaStreams.Wake()
+	}
+	handler.Strava.Start(context.Background())
+
+	// Apply the changes Strava pushes to the webhook as they come in, rather than an hour later.
+	handler.StravaEvents = strava.NewEventProcessor(handler.StravaRepo, handler.StravaAuth.ClientFor)
+	handler.StravaEvents.OnChanged = func(userID uint) {
+		if _, err := handler.StreakRepo.RecalculateStreak(userID); err != nil {
+			log.Printf("Strava: failed to recalculate streak for user %d: %v", userID, err)
+		}
+		handler.StravaStreams.Wake()
+	}
+	handler.StravaEvents.Start(context.Background())
+
+	// Post finished workouts to Strava for users who chose to.
+	handler.StravaPoster = strava.NewPoster(handler.StravaRepo, handler.StravaAuth.ClientFor)
+	handler.StravaPoster.Start(context.Background())
+
+	// Clean up abandoned drafts in the background. Workouts it finishes are checked for PBs,
+	// announced and posted to Strava just like ones finished by hand, so it starts after the poster.
+	handler.Janitor = janitor.New(handler.ActivityRepo, handler.StreakRepo)
+	handler.Janitor.OnFinalized = func(activityID uint) {
+		activity, err := handler.ActivityRepo.GetActivityByID(activityID)
+		if err != nil {
+			log.Printf("Failed to load finished workout %d: %v", activityID, err)
+			return
+		}
+		workout.AfterSave(activity, database.EventWorkoutFinished, handler.RecordRepo, handler.Webhooks, handler.StravaPoster)
+	}
+	handler.Janitor.Start(context.Background())
+
 	engine.SetFuncMap(template.FuncMap{
 		"toJSON": func(v interface{}) template.JS {
 			a, _ := json.Marshal(v)
 			return template.JS(a)
 		},
+		// This function formats a duration as m:ss, or h:mm:ss once it passes an hour
+		"formatDuration": func(d time.Duration) string {
+			d = d.Round(time.Second)
+			if d >= time.Hour {
+				return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+			}
+			return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+		},
 		// This function creates a map from a list of key-value pairs
 		"dict": func(values ...interface{}) (map[string]interface{}, error) {
 			if len(values)%2 != 0 {
@@ -110,9 +224,39 @@ func (h *Handler) registerRoutes(auth *authenticator.Authenticator) {
 
 	h.Router.GET("/callback", callback.Handler(auth, h.UserRepo))
 
-	h.Router.GET("/profile", middleware.IsAuthenticated, user.ProfileHandler(h.UserRepo))
+	h.Router.GET("/profile", middleware.IsAuthenticated, user.ProfileHandler(h.UserRepo, h.StreakRepo))
 	h.Router.GET("/profile/edit", middleware.IsAuthenticated, user.EditProfileGetHandler(h.UserRepo))
-	h.Router.POST("/profile/edit", middleware.IsAuthenticated, user.EditProfilePostHandler(h.UserRepo))
+	h.Router.POST("/profile/edit", middleware.IsAuthenticated, user.EditProfilePostHandler(h.UserRepo, h.StreakRepo))
+	h.Router.GET("/profile/tokens", middleware.IsAuthenticated, user.AccessTokensHandler(h.TokenRepo))
+	h.Router.POST("/profile/tokens", middleware.IsAuthenticated, user.CreateAccessTokenHandler(h.TokenRepo))
+	h.Router.DELETE("/profile/tokens/:id", middleware.IsAuthenticated, user.RevokeAccessTokenHandler(h.TokenRepo))
+	h.Router.GET("/profile/strava", middleware.IsAuthenticated, user.StravaHandler(h.StravaRepo, h.StravaAuth))
+	h.Router.POST("/profile/strava/sync", middleware.IsAuthenticated, user.SyncStravaHandler(h.StravaRepo, h.StravaAuth, h.Strava))
+	h.Router.POST("/profile/strava/post", middleware.IsAuthenticated, user.PostToStravaHandler(h.StravaRepo, h.StravaAuth))
+	h.Router.POST("/profile/strava/disconnect", middleware.IsAuthenticated, user.DisconnectStravaHandler(h.StravaRepo, h.StravaAuth))
+	h.Router.GET("/strava/connect", middleware.IsAuthenticated, user.ConnectStravaHandler(h.StravaAuth))
+	h.Router.GET("/strava/callback", middleware.IsAuthenticated, user.StravaCallbackHandler(h.StravaAuth, h.Strava))
+
+	// Strava's webhook subscription. STRAVA_SUBSCRIPTION_ID, once known, drops events for any other.
+	subscriptionID, _ := strconv.ParseInt(os.Getenv("STRAVA_SUBSCRIPTION_ID"), 10, 64)
+	h.Router.GET("/strava/webhook", stravapush.ChallengeHandler(os.Getenv("STRAVA_WEBHOOK_VERIFY_TOKEN")))
+	h.Router.POST("/strava/webhook", stravapush.EventHandler(h.StravaRepo, h.StravaEvents, subscriptionID))
+
+	h.Router.GET("/data", middleware.IsAuthenticated, data.PageHandler(h.DataJobRepo, h.UserRepo))
+	h.Router.GET("/ui/data-jobs", middleware.IsAuthenticated, data.JobsHandler(h.DataJobRepo))
+	h.Router.POST("/data/export", middleware.IsAuthenticated, data.ExportHandler(h.DataJobRepo, h.ActivityRepo, h.Jobs))
+	h.Router.POST("/data/import", middleware.IsAuthenticated, data.ImportHandler(h.DataJobRepo, h.ExerciseRepo, h.Jobs))
+	h.Router.GET("/data/import/:id", middleware.IsAuthenticated, data.PreviewHandler(h.DataJobRepo, h.UserRepo, h.ActivityRepo, h.ExerciseRepo, h.MappingRepo))
+	h.Router.POST("/data/import/:id/confirm", middleware.IsAuthenticated, data.ConfirmHandler(h.DataJobRepo, h.ExerciseRepo, h.MappingRepo, h.Jobs))
+	h.Router.POST("/data/import/:id/cancel", middleware.IsAuthenticated, data.CancelHandler(h.DataJobRepo))
+	h.Router.GET("/data/jobs/:id/download", middleware.IsAuthenticated, data.DownloadHandler(h.DataJobRepo))
+
+	h.Router.GET("/webhooks", middleware.IsAuthenticated, webhooks.ListHandler(h.WebhookRepo, h.UserRepo))
+	h.Router.POST("/webhooks", middleware.IsAuthenticated, webhooks.CreateHandler(h.WebhookRepo, h.UserRepo))
+	h.Router.GET("/webhooks/:id", middleware.IsAuthenticated, webhooks.ViewHandler(h.WebhookRepo, h.UserRepo))
+	h.Router.POST("/webhooks/:id/active", middleware.IsAuthenticated, webhooks.SetActiveHandler(h.WebhookRepo, h.UserRepo))
+	h.Router.DELETE("/webhooks/:id", middleware.IsAuthenticated, webhooks.DeleteHandler(h.WebhookRepo, h.UserRepo))
+	h.Router.POST("/webhooks/:id/deliveries/:deliveryId/replay", middleware.IsAuthenticated, webhooks.ReplayHandler(h.WebhookRepo, h.UserRepo, h.Webhooks))
 
 	//h.Router.POST("/add-exercise-to-form/:id", middleware.IsAuthenticated, workout.AddExerciseToFormHandler(h.ActivityRepo, h.GymSetRepo, h.ExerciseRepo))
 	//h.Router.POST("/delete-exercise/:id", middleware.IsAuthenticated, workout.DeleteExerciseHandler(h.ActivityRepo, h.GymSetRepo, h.ExerciseRepo))
@@ -125,44 +269,118 @@ func (h *Handler) registerRoutes(auth *authenticator.Authenticator) {
 	// --- Main Page Routes ---
 
 	// Home/dashboard page
-	h.Router.GET("/user", middleware.IsAuthenticated, middleware.CheckActiveWorkout, user.UserHandler(h.ActivityRepo, h.UserRepo))
+	h.Router.GET("/user", middleware.IsAuthenticated, middleware.CheckActiveWorkout(h.ActivityRepo), user.UserHandler(h.ActivityRepo, h.UserRepo, h.Janitor.DraftMaxAge))
 
 	// Creates a new blank workout and redirects to the edit page
 	h.Router.POST("/workouts/new", middleware.IsAuthenticated, workout.CreateHandler(h.ActivityRepo, h.UserRepo))
 
 	// Loads the full workout editor page
-	h.Router.GET("/workouts/:id/edit", middleware.IsAuthenticated, workout.EditHandler(h.ActivityRepo, h.GymSetRepo, h.ExerciseRepo, h.UserRepo))
+	h.Router.GET("/workouts/drafts", middleware.IsAuthenticated, workout.DraftsHandler(h.ActivityRepo, h.UserRepo))
+	h.Router.GET("/ui/active-workout-banner", middleware.IsAuthenticated, workout.ActiveWorkoutBannerHandler(h.ActivityRepo))
+	h.Router.GET("/workouts/:id/edit", middleware.IsAuthenticated, workout.EditHandler(h.ActivityRepo, h.GymSetRepo, h.ExerciseRepo, h.UserRepo, h.GymExerciseRepo, h.RestRepo))
+
+	// Lists the finished workouts for a single day, linked from the profile calendar
+	h.Router.GET("/workouts/day/:date", middleware.IsAuthenticated, workout.DayHandler(h.ActivityRepo, h.UserRepo))
+
+	// Shows the post-workout summary once a workout is finished
+	h.Router.GET("/workouts/:id/summary", middleware.IsAuthenticated, workout.SummaryHandler(h.ActivityRepo, h.GymExerciseRepo, h.RecordRepo, h.UserRepo))
+
+	// Creates or revokes the public link to a finished workout
+	h.Router.POST("/workouts/:id/share", middleware.IsAuthenticated, workout.ShareWorkoutHandler(h.ActivityRepo))
+	h.Router.DELETE("/workouts/:id/share", middleware.IsAuthenticated, workout.UnshareWorkoutHandler(h.ActivityRepo))
+
+	// Public read-only view of a workout shared by link
+	h.Router.GET("/shared/:token", workout.SharedWorkoutHandler(h.ActivityRepo, h.GymExerciseRepo))
 
 	// Loads the read-only view of a completed workout
-	h.Router.GET("/workouts/:id", middleware.IsAuthenticated, workout.ViewHandler(h.ActivityRepo, h.GymSetRepo, h.ExerciseRepo, h.UserRepo))
+	h.Router.GET("/workouts/:id", middleware.IsAuthenticated, workout.ViewHandler(h.ActivityRepo, h.GymSetRepo, h.ExerciseRepo, h.UserRepo, h.RevisionRepo))
+	h.Router.GET("/activities/:id", middleware.IsAuthenticated, workout.CardioHandler(h.ActivityRepo, h.StravaRepo, h.UserRepo, h.Strava))
+	h.Router.GET("/activities/:id/route", middleware.IsAuthenticated, workout.RouteHandler(h.ActivityRepo))
+	h.Router.GET("/activities/:id/streams", middleware.IsAuthenticated, workout.StreamsHandler(h.ActivityRepo, h.StravaRepo, h.Strava))
+	h.Router.GET("/heatmap", middleware.IsAuthenticated, workout.HeatmapHandler(h.UserRepo))
+	h.Router.GET("/heatmap/data", middleware.IsAuthenticated, workout.HeatmapDataHandler(h.ActivityRepo))
+	h.Router.POST("/workouts/:id/revisions/:version/revert", middleware.IsAuthenticated, workout.RevertRevisionHandler(h.ActivityRepo, h.RevisionRepo, h.StreakRepo, h.RecordRepo, h.Webhooks, h.StravaPoster))
 
 	// --- Component-Based HTMX Routes ---
 
 	// --- Create Routes ---
 	h.Router.POST("/activity/:id/add-exercise", middleware.IsAuthenticated, workout.AddExerciseToActivityHandler(h.GymExerciseRepo, h.GymSetRepo, h.ExerciseRepo))
-	h.Router.POST("/gym-exercise/:id/add-set", middleware.IsAuthenticated, workout.AddSetToExerciseHandler(h.GymSetRepo))
+	h.Router.POST("/gym-exercise/:id/add-set", middleware.IsAuthenticated, workout.AddSetToExerciseHandler(h.GymSetRepo, h.GymExerciseRepo, h.ActivityRepo, h.UserRepo))
 
 	// --- Update Routes ---
 	h.Router.PUT("/gym-set/:id", middleware.IsAuthenticated, workout.UpdateSetHandler(h.GymSetRepo))
+	h.Router.POST("/gym-set/:id/complete", middleware.IsAuthenticated, workout.CompleteSetHandler(h.GymSetRepo, h.GymExerciseRepo, h.RestRepo))
+	h.Router.POST("/exercise-definition/:id/rest", middleware.IsAuthenticated, workout.UpdateExerciseRestHandler(h.RestRepo))
+	h.Router.POST("/exercise-definition/:id/default-rest", middleware.IsAuthenticated, workout.UpdateExerciseDefaultRestHandler(h.ExerciseRepo, h.UserRepo))
 	h.Router.PUT("/gym-exercise/:id", middleware.IsAuthenticated, workout.UpdateExerciseHandler(h.GymExerciseRepo))
 
 	// --- Inline Editing Routes (New) ---
 	h.Router.GET("/ui/activity-name/:id", middleware.IsAuthenticated, workout.GetActivityNameHandler(h.ActivityRepo))
 	h.Router.POST("/activity/:id/name", middleware.IsAuthenticated, workout.UpdateActivityNameHandler(h.ActivityRepo))
+	h.Router.POST("/activity/:id/time", middleware.IsAuthenticated, workout.UpdateActivityTimeHandler(h.ActivityRepo, h.StreakRepo))
 
 	// --- Delete Routes ---
 	h.Router.DELETE("/gym-set/:id", middleware.IsAuthenticated, workout.DeleteSetHandler(h.GymSetRepo))
 	h.Router.DELETE("/gym-exercise/:id", middleware.IsAuthenticated, workout.DeleteExerciseHandler(h.GymExerciseRepo))
-	h.Router.DELETE("/activity/:id", middleware.IsAuthenticated, workout.DeleteActivityHandler(h.ActivityRepo))
+	h.Router.DELETE("/activity/:id", middleware.IsAuthenticated, workout.DeleteActivityHandler(h.ActivityRepo, h.StreakRepo, h.Webhooks))
 
 	// --- Main Workout Action Routes ---
-	h.Router.POST("/activity/:id/finish", middleware.IsAuthenticated, workout.FinishWorkoutHandler(h.ActivityRepo))
+	h.Router.GET("/workouts/:id/conflict", middleware.IsAuthenticated, workout.ConflictHandler(h.ActivityRepo, h.UserRepo))
+	h.Router.POST("/workouts/:id/conflict", middleware.IsAuthenticated, workout.ResolveConflictHandler(h.ActivityRepo, h.StreakRepo, h.RecordRepo, h.Webhooks, h.StravaPoster))
+	h.Router.POST("/activity/:id/finish", middleware.IsAuthenticated, workout.FinishWorkoutHandler(h.ActivityRepo, h.StreakRepo, h.RecordRepo, h.Webhooks, h.StravaPoster))
 	h.Router.POST("/activity/:id/discard", middleware.IsAuthenticated, workout.DiscardWorkoutHandler(h.ActivityRepo))
-	h.Router.POST("/workouts/:id/create-edit-draft", middleware.IsAuthenticated, workout.CreateEditDraftHandler(h.ActivityRepo))
+	h.Router.POST("/activity/:id/pause", middleware.IsAuthenticated, workout.PauseWorkoutHandler(h.ActivityRepo))
+	h.Router.POST("/activity/:id/resume", middleware.IsAuthenticated, workout.ResumeWorkoutHandler(h.ActivityRepo))
+	h.Router.GET("/activity/:id/rest", middleware.IsAuthenticated, workout.RestTimerHandler(h.RestRepo))
+	h.Router.GET("/activity/:id/rest/stream", middleware.IsAuthenticated, workout.RestStreamHandler(h.RestRepo))
+	h.Router.POST("/activity/:id/rest/stop", middleware.IsAuthenticated, workout.StopRestHandler(h.RestRepo))
+	h.Router.POST("/activity/:id/rest/extend", middleware.IsAuthenticated, workout.ExtendRestHandler(h.RestRepo))
+	h.Router.POST("/workouts/:id/create-edit-draft", middleware.IsAuthenticated, workout.CreateEditDraftHandler(h.ActivityRepo, h.UserRepo))
+	h.Router.POST("/workouts/:id/repeat", middleware.IsAuthenticated, workout.RepeatWorkoutHandler(h.ActivityRepo, h.UserRepo))
 
 	// --- UI Fragment Routes ---
 	h.Router.GET("/ui/add-exercise-modal/:id", middleware.IsAuthenticated, workout.AddExerciseModalHandler(h.ExerciseRepo))
 	h.Router.GET("/ui/exercise-list/:id", middleware.IsAuthenticated, workout.ExerciseListHandler(h.ExerciseRepo, h.UserRepo))
 	h.Router.GET("/exercise-info/:exerciseID", middleware.IsAuthenticated, workout.ExerciseInfoHandler(h.ExerciseRepo, h.GymSetRepo, h.UserRepo, h.ActivityRepo))
-	h.Router.POST("/add-exercise-to-form/:id", middleware.IsAuthenticated, workout.AddExerciseToFormHandler(h.GymExerciseRepo, h.GymSetRepo, h.ExerciseRepo))
+	h.Router.POST("/add-exercise-to-form/:id", middleware.IsAuthenticated, workout.AddExerciseToFormHandler(h.GymExerciseRepo, h.GymSetRepo, h.ExerciseRepo, h.ActivityRepo, h.UserRepo, h.RestRepo))
+
+	h.registerAPIRoutes()
+}
+
+// registerAPIRoutes sets up the versioned JSON API.
+func (h *Handler) registerAPIRoutes() {
+	v1 := h.Router.Group("/api/v1", api.Authenticate(h.TokenRepo))
+
+	v1.GET("/activities", api.ListActivitiesHandler(h.ActivityRepo))
+	v1.POST("/activities", api.CreateActivityHandler(h.ActivityRepo, h.UserRepo))
+	v1.GET("/activities/:id", api.GetActivityHandler(h.ActivityRepo))
+	v1.PATCH("/activities/:id", api.UpdateActivityHandler(h.ActivityRepo))
+	v1.DELETE("/activities/:id", api.DeleteActivityHandler(h.ActivityRepo, h.StreakRepo, h.Webhooks))
+	v1.POST("/activities/:id/edit-draft", api.CreateEditDraftHandler(h.ActivityRepo, h.UserRepo))
+	v1.POST("/activities/:id/finalize", api.FinalizeActivityHandler(h.ActivityRepo, h.StreakRepo, h.RecordRepo, h.Webhooks, h.StravaPoster))
+	v1.POST("/activities/:id/exercises", api.AddExerciseHandler(h.ActivityRepo, h.GymExerciseRepo, h.GymSetRepo, h.ExerciseRepo))
+
+	v1.PATCH("/exercises/:id", api.UpdateExerciseHandler(h.ActivityRepo, h.GymExerciseRepo, h.ExerciseRepo))
+	v1.DELETE("/exercises/:id", api.DeleteExerciseHandler(h.ActivityRepo, h.GymExerciseRepo))
+	v1.POST("/exercises/:id/sets", api.AddSetHandler(h.ActivityRepo, h.GymExerciseRepo, h.GymSetRepo))
+	v1.PATCH("/sets/:id", api.UpdateSetHandler(h.ActivityRepo, h.GymExerciseRepo, h.GymSetRepo))
+	v1.DELETE("/sets/:id", api.DeleteSetHandler(h.ActivityRepo, h.GymExerciseRepo, h.GymSetRepo))
+
+	v1.GET("/exercise-definitions", api.ListExerciseDefinitionsHandler(h.ExerciseRepo))
+	v1.GET("/exercise-definitions/:id", api.GetExerciseDefinitionHandler(h.ExerciseRepo))
+	v1.GET("/favourites", api.ListFavouritesHandler(h.ExerciseRepo))
+	v1.PUT("/favourites/:definitionId", api.AddFavouriteHandler(h.ExerciseRepo))
+	v1.DELETE("/favourites/:definitionId", api.RemoveFavouriteHandler(h.ExerciseRepo))
+
+	v1.GET("/profile", api.GetProfileHandler(h.UserRepo))
+	v1.PATCH("/profile", api.UpdateProfileHandler(h.UserRepo, h.StreakRepo))
+
+	// Unknown API paths get a JSON error rather than the HTML 404 page.
+	h.Router.NoRoute(func(ctx *gin.Context) {
+		if strings.HasPrefix(ctx.Request.URL.Path, "/api/") {
+			ctx.JSON(http.StatusNotFound, api.ErrorBody{Error: api.ErrorDetail{Code: "not_found", Message: "No such API endpoint"}})
+			return
+		}
+		ctx.Status(http.StatusNotFound)
+	})
 }
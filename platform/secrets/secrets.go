@@ -0,0 +1,73 @@
+// Package secrets encrypts values, such as third-party access tokens, before they are stored.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// KeySize is the length of a key in bytes, for AES-256.
+const KeySize = 32
+
+// Box encrypts and decrypts values with AES-GCM. Each value gets its own random nonce, which is
+// kept at the front of the sealed value.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New creates a Box with a KeySize key.
+func New(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secrets: the key must be %d bytes, not %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// FromEnv creates a Box with the base64 key in the named environment variable. A key can be
+// made with `openssl rand -base64 32`.
+func FromEnv(name string) (*Box, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, fmt.Errorf("secrets: %s must be set", name)
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: %s must be base64: %w", name, err)
+	}
+	return New(key)
+}
+
+// Seal encrypts a value.
+func (b *Box) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return b.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open decrypts a value made by Seal, failing if it was made with another key or tampered with.
+func (b *Box) Open(sealed []byte) ([]byte, error) {
+	size := b.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, errors.New("secrets: the value is too short")
+	}
+	plaintext, err := b.aead.Open(nil, sealed[:size], sealed[size:], nil)
+	if err != nil {
+		return nil, errors.New("secrets: the value can't be decrypted")
+	}
+	return plaintext, nil
+}
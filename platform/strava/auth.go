@@ -0,0 +1,270 @@
+package strava
+
+import (
+	"context"
+	"errors"
+	"fitness/platform/database"
+	"fitness/platform/secrets"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// DefaultOAuthURL is where Strava's OAuth endpoints live.
+const DefaultOAuthURL = "https://www.strava.com/oauth"
+
+// Scopes are what users are asked to allow: their profile, all of their activities including
+// private ones, and adding activities for workouts they choose to post.
+const Scopes = "read,activity:read_all,activity:write"
+
+// ErrNotConfigured is returned when the server has no Strava app set up.
+var ErrNotConfigured = errors.New("strava isn't configured")
+
+// Auth connects users' Strava accounts and makes clients that act for them. Tokens are stored
+// encrypted, and refreshed ones are saved as soon as they are issued.
+type Auth struct {
+	Config     *oauth2.Config
+	StravaRepo *database.StravaRepo
+	Box        *secrets.Box
+
+	// APIURL and OAuthURL are where Strava lives, which tests point at a fake server.
+	APIURL   string
+	OAuthURL string
+	// HTTPClient, if set, makes every request to Strava.
+	HTTPClient *http.Client
+	// Limits tracks the app's rate limits for every client made here.
+	Limits *RateLimits
+}
+
+// NewAuth creates an Auth for the Strava app with the given credentials.
+func NewAuth(clientID, clientSecret, redirectURL string, stravaRepo *database.StravaRepo, box *secrets.Box) *Auth {
+	a := &Auth{
+		Config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{Scopes},
+		},
+		StravaRepo: stravaRepo,
+		Box:        box,
+		APIURL:     DefaultBaseURL,
+		Limits:     NewRateLimits(),
+	}
+	a.SetOAuthURL(DefaultOAuthURL)
+	return a
+}
+
+// NewAuthFromEnv creates an Auth from STRAVA_CLIENT_ID, STRAVA_CLIENT_SECRET,
+// STRAVA_REDIRECT_URL and STRAVA_TOKEN_KEY, returning ErrNotConfigured if they aren't set.
+func NewAuthFromEnv(stravaRepo *database.StravaRepo) (*Auth, error) {
+	clientID := os.Getenv("STRAVA_CLIENT_ID")
+	clientSecret := os.Getenv("STRAVA_CLIENT_SECRET")
+	redirectURL := os.Getenv("STRAVA_REDIRECT_URL")
+	if clientID == "" || clientSecret == "" || redirectURL == "" {
+		return nil, ErrNotConfigured
+	}
+	box, err := secrets.FromEnv("STRAVA_TOKEN_KEY")
+	if err != nil {
+		return nil, err
+	}
+	return NewAuth(clientID, clientSecret, redirectURL, stravaRepo, box), nil
+}
+
+// SetOAuthURL points the OAuth endpoints somewhere else.
+func (a *Auth) SetOAuthURL(oauthURL string) {
+	a.OAuthURL = strings.TrimSuffix(oauthURL, "/")
+	a.Config.Endpoint = oauth2.Endpoint{
+		AuthURL:   a.OAuthURL + "/authorize",
+		TokenURL:  a.OAuthURL + "/token",
+		AuthStyle: oauth2.AuthStyleInParams,
+	}
+}
+
+// AuthCodeURL is where to send a user to allow access, carrying state back to the callback.
+func (a *Auth) AuthCodeURL(state string) string {
+	return a.Config.AuthCodeURL(state, oauth2.SetAuthURLParam("approval_prompt", "auto"))
+}
+
+// Connect swaps the code from Strava's callback for tokens, and links the athlete they belong to
+// to the user. scope is what the athlete allowed, which Strava gives in the callback.
+func (a *Auth) Connect(ctx context.Context, userID uint, code, scope string) (*database.StravaAccount, error) {
+	if !strings.Contains(scope, "activity:read") {
+		return nil, errors.New("access to activities wasn't allowed")
+	}
+	token, err := a.Config.Exchange(a.context(ctx), code)
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+
+	athleteID, err := tokenAthleteID(token)
+	if err != nil {
+		athlete, getErr := a.client(a.Config.Client(a.context(ctx), token)).GetAthlete(ctx)
+		if getErr != nil {
+			return nil, fmt.Errorf("loading athlete: %w", getErr)
+		}
+		athleteID = int64(athlete.Id)
+	}
+
+	if other, err := a.StravaRepo.GetAccountByAthleteID(athleteID); err != nil {
+		return nil, err
+	} else if other != nil && other.UserID != userID {
+		return nil, errors.New("that Strava athlete is connected to another account")
+	}
+
+	account := &database.StravaAccount{UserID: userID, AthleteID: athleteID, Scope: scope}
+	if existing, err := a.StravaRepo.GetAccountByUserID(userID); err != nil {
+		return nil, err
+	} else if existing != nil && existing.AthleteID == athleteID {
+		// Reconnecting the same athlete carries on syncing where it left off
+		account.SyncedThrough = existing.SyncedThrough
+	}
+	if err := a.sealToken(account, token); err != nil {
+		return nil, err
+	}
+	if err := a.StravaRepo.SaveAccount(account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// ClientFor returns a client that acts for a connected athlete, refreshing their token when it
+// runs out. It returns ErrNotConfigured on a nil Auth.
+func (a *Auth) ClientFor(account *database.StravaAccount) (*Client, error) {
+	if a == nil {
+		return nil, ErrNotConfigured
+	}
+	token, err := a.openToken(account)
+	if err != nil {
+		return nil, err
+	}
+	source := &savingTokenSource{
+		auth:      a,
+		accountID: account.ID,
+		base:      a.Config.TokenSource(a.context(context.Background()), token),
+		last:      token.AccessToken,
+	}
+	return a.client(oauth2.NewClient(a.context(context.Background()), source)), nil
+}
+
+// Disconnect revokes the app's access to an athlete's account and forgets their tokens. Strava
+// is told first, but the account is unlinked here even if that fails.
+func (a *Auth) Disconnect(ctx context.Context, account *database.StravaAccount) error {
+	if err := a.deauthorize(ctx, account); err != nil {
+		log.Printf("Strava: failed to deauthorize athlete %d: %v", account.AthleteID, err)
+	}
+	return a.StravaRepo.DeleteAccount(account.ID)
+}
+
+// deauthorize asks Strava to revoke the app's access to an athlete's account.
+func (a *Auth) deauthorize(ctx context.Context, account *database.StravaAccount) error {
+	client, err := a.ClientFor(account)
+	if err != nil {
+		return err
+	}
+	_, err = client.do(ctx, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPost, a.OAuthURL+"/deauthorize", nil)
+	}, false)
+	return err
+}
+
+func (a *Auth) client(httpClient *http.Client) *Client {
+	client := NewClientWith(httpClient, a.APIURL)
+	if a.Limits != nil {
+		client.Limits = a.Limits
+	}
+	return client
+}
+
+// context carries HTTPClient, if set, to the oauth2 package.
+func (a *Auth) context(ctx context.Context) context.Context {
+	if a.HTTPClient == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, a.HTTPClient)
+}
+
+// sealToken encrypts a token into an account.
+func (a *Auth) sealToken(account *database.StravaAccount, token *oauth2.Token) error {
+	accessToken, err := a.Box.Seal([]byte(token.AccessToken))
+	if err != nil {
+		return err
+	}
+	refreshToken, err := a.Box.Seal([]byte(token.RefreshToken))
+	if err != nil {
+		return err
+	}
+	account.AccessToken = accessToken
+	account.RefreshToken = refreshToken
+	account.TokenExpiresAt = token.Expiry
+	return nil
+}
+
+// openToken decrypts an account's token.
+func (a *Auth) openToken(account *database.StravaAccount) (*oauth2.Token, error) {
+	accessToken, err := a.Box.Open(account.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("access token: %w", err)
+	}
+	refreshToken, err := a.Box.Open(account.RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("refresh token: %w", err)
+	}
+	return &oauth2.Token{
+		AccessToken:  string(accessToken),
+		RefreshToken: string(refreshToken),
+		TokenType:    "Bearer",
+		Expiry:       account.TokenExpiresAt,
+	}, nil
+}
+
+// tokenAthleteID reads the athlete Strava includes with the tokens it issues.
+func tokenAthleteID(token *oauth2.Token) (int64, error) {
+	athlete, ok := token.Extra("athlete").(map[string]interface{})
+	if !ok {
+		return 0, errors.New("no athlete with the token")
+	}
+	id, ok := athlete["id"].(float64)
+	if !ok || id <= 0 {
+		return 0, errors.New("no athlete ID with the token")
+	}
+	return int64(id), nil
+}
+
+// savingTokenSource saves an account's token each time it is refreshed, since Strava may issue
+// a new refresh token with it and the old one then stops working.
+type savingTokenSource struct {
+	auth      *Auth
+	accountID uint
+	base      oauth2.TokenSource
+
+	mu   sync.Mutex
+	last string
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token.AccessToken == s.last {
+		return token, nil
+	}
+	s.last = token.AccessToken
+
+	account := &database.StravaAccount{}
+	if err := s.auth.sealToken(account, token); err != nil {
+		return nil, err
+	}
+	if err := s.auth.StravaRepo.UpdateTokens(s.accountID, account.AccessToken, account.RefreshToken, token.Expiry); err != nil {
+		log.Printf("Strava: failed to save refreshed token for account %d: %v", s.accountID, err)
+	}
+	return token, nil
+}
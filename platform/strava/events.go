@@ -0,0 +1,307 @@
+package strava
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fitness/platform/database"
+	"fmt"
+	"log"
+	"time"
+)
+
+// What push events are about, and what happened to it.
+const (
+	ObjectActivity = "activity"
+	ObjectAthlete  = "athlete"
+
+	AspectCreate = "create"
+	AspectUpdate = "update"
+	AspectDelete = "delete"
+)
+
+const (
+	defaultEventInterval    = time.Minute
+	defaultEventMaxAttempts = 5
+	firstEventRetryDelay    = time.Minute
+	maxEventRetryDelay      = 2 * time.Hour
+	eventClaimLease         = 5 * time.Minute
+	eventClaimBatchSize     = 20
+	eventRetention          = 7 * 24 * time.Hour
+	eventErrorLimit         = 1024
+)
+
+// Event is what Strava posts to a webhook subscription's callback when an athlete's activity is
+// created, changed or deleted, or when an athlete revokes the app's access.
+type Event struct {
+	AspectType     string          `json:"aspect_type"`
+	EventTime      int64           `json:"event_time"`
+	ObjectID       int64           `json:"object_id"`
+	ObjectType     string          `json:"object_type"`
+	OwnerID        int64           `json:"owner_id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	Updates        json.RawMessage `json:"updates"`
+}
+
+// Valid reports whether the event is about something the app knows how to handle.
+func (e Event) Valid() bool {
+	if e.ObjectID <= 0 || e.OwnerID <= 0 {
+		return false
+	}
+	switch e.ObjectType {
+	case ObjectActivity:
+		return e.AspectType == AspectCreate || e.AspectType == AspectUpdate || e.AspectType == AspectDelete
+	case ObjectAthlete:
+		return e.AspectType == AspectUpdate
+	}
+	return false
+}
+
+// ToStravaEvent turns a pushed event into one to be queued.
+func (e Event) ToStravaEvent() *database.StravaEvent {
+	updates := string(e.Updates)
+	if updates == "" || updates == "null" {
+		updates = "{}"
+	}
+	return &database.StravaEvent{
+		ObjectType:    e.ObjectType,
+		ObjectID:      e.ObjectID,
+		AspectType:    e.AspectType,
+		OwnerID:       e.OwnerID,
+		Updates:       updates,
+		EventTime:     time.Unix(e.EventTime, 0),
+		NextAttemptAt: time.Now(),
+	}
+}
+
+// EventStore is where events are queued and applied. It is satisfied by *database.StravaRepo.
+type EventStore interface {
+	ClaimDueEvents(now time.Time, lease time.Duration, limit int) ([]*database.StravaEvent, error)
+	RecordEventAttempt(event *database.StravaEvent) error
+	DeleteEventsBefore(before time.Time) (int64, error)
+	GetAccountByAthleteID(athleteID int64) (*database.StravaAccount, error)
+	SaveStravaActivity(activity *database.Activity) (bool, error)
+	DeleteStravaActivity(userID uint, stravaID int64) (bool, error)
+	DeleteStravaActivities(userID uint) (int64, error)
+	DeleteAccount(accountID uint) error
+}
+
+// EventProcessor applies queued push events to users' activity timelines in the background,
+// fetching each changed activity from Strava. An event that fails is retried a few times
+// before it is given up on; the hourly sync still picks up new activities it missed.
+type EventProcessor struct {
+	Store EventStore
+	// ClientFor returns a client for the athlete of a linked account.
+	ClientFor func(account *database.StravaAccount) (*Client, error)
+	// OnChanged, if set, is called after a user's activities have been changed by an event.
+	OnChanged func(userID uint)
+
+	// Interval is how often to look for events that are due. Queuing an event should also
+	// wake the processor, so this mostly matters for retries.
+	Interval time.Duration
+	// MaxAttempts is how many times an event is tried before it is given up on.
+	MaxAttempts int
+
+	wake chan struct{}
+}
+
+// NewEventProcessor creates an EventProcessor.
+func NewEventProcessor(store EventStore, clientFor func(account *database.StravaAccount) (*Client, error)) *EventProcessor {
+	return &EventProcessor{
+		Store:       store,
+		ClientFor:   clientFor,
+		Interval:    defaultEventInterval,
+		MaxAttempts: defaultEventMaxAttempts,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// EventRetryDelay is how long to wait after the given number of failed attempts at an event,
+// doubling each time up to a limit.
+func EventRetryDelay(attempts int) time.Duration {
+	delay := firstEventRetryDelay
+	for i := 1; i < attempts && delay < maxEventRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxEventRetryDelay {
+		delay = maxEventRetryDelay
+	}
+	return delay
+}
+
+// Wake makes the processor look for due events now rather than at its next interval.
+func (p *EventProcessor) Wake() {
+	if p == nil {
+		return
+	}
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start applies queued events in the background until the context is cancelled.
+func (p *EventProcessor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := p.RunOnce(ctx, time.Now()); err != nil {
+				log.Printf("Strava: failed to process events: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-p.wake:
+			}
+		}
+	}()
+}
+
+// RunOnce applies every event that is due, then clears out old settled ones.
+func (p *EventProcessor) RunOnce(ctx context.Context, now time.Time) error {
+	for {
+		events, err := p.Store.ClaimDueEvents(now, eventClaimLease, eventClaimBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			p.attempt(ctx, event)
+			if err := p.Store.RecordEventAttempt(event); err != nil {
+				log.Printf("Strava: failed to record attempt at event %d: %v", event.ID, err)
+			}
+		}
+		if len(events) < eventClaimBatchSize || ctx.Err() != nil {
+			break
+		}
+	}
+
+	if _, err := p.Store.DeleteEventsBefore(now.Add(-eventRetention)); err != nil {
+		return fmt.Errorf("clearing old events: %w", err)
+	}
+	return nil
+}
+
+// attempt applies an event once and updates it with the outcome.
+func (p *EventProcessor) attempt(ctx context.Context, event *database.StravaEvent) {
+	now := time.Now()
+	event.Attempts++
+	event.LastError = ""
+
+	err := p.Process(ctx, event)
+	if err == nil {
+		event.Status = database.StravaEventDone
+		event.ProcessedAt = &now
+		return
+	}
+
+	event.LastError = err.Error()
+	if len(event.LastError) > eventErrorLimit {
+		event.LastError = event.LastError[:eventErrorLimit]
+	}
+	var limitErr *RateLimitError
+	if errors.As(err, &limitErr) {
+		// Waiting for the limit to reset doesn't count against the event.
+		event.Attempts--
+		event.Status = database.StravaEventPending
+		event.NextAttemptAt = limitErr.Until
+		return
+	}
+	if event.Attempts >= p.MaxAttempts {
+		event.Status = database.StravaEventFailed
+		event.ProcessedAt = &now
+		log.Printf("Strava: giving up on event %d (%s %d %s) after %d attempts: %v",
+			event.ID, event.ObjectType, event.ObjectID, event.AspectType, event.Attempts, err)
+		return
+	}
+	event.Status = database.StravaEventPending
+	event.NextAttemptAt = now.Add(EventRetryDelay(event.Attempts))
+}
+
+// Process applies one event. Events for athletes who aren't connected are ignored, as they may
+// arrive after the athlete has disconnected.
+func (p *EventProcessor) Process(ctx context.Context, event *database.StravaEvent) error {
+	account, err := p.Store.GetAccountByAthleteID(event.OwnerID)
+	if err != nil {
+		return err
+	}
+	if account == nil {
+		return nil
+	}
+
+	switch event.ObjectType {
+	case ObjectActivity:
+		return p.processActivity(ctx, account, event)
+	case ObjectAthlete:
+		return p.processAthlete(account, event)
+	}
+	return nil
+}
+
+// processActivity fetches a created or changed activity and saves it, or removes a deleted one.
+func (p *EventProcessor) processActivity(ctx context.Context, account *database.StravaAccount, event *database.StravaEvent) error {
+	if event.AspectType == AspectDelete {
+		return p.deleteActivity(account, event.ObjectID)
+	}
+
+	client, err := p.ClientFor(account)
+	if err != nil {
+		return err
+	}
+	activity, err := client.GetActivity(ctx, event.ObjectID)
+	if IsNotFound(err) {
+		// It was deleted, or made hidden from the app, before the event got here.
+		return p.deleteActivity(account, event.ObjectID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.Store.SaveStravaActivity(activity.ToActivity(account.UserID)); err != nil {
+		return fmt.Errorf("saving activity %d: %w", activity.Id, err)
+	}
+	p.changed(account.UserID)
+	return nil
+}
+
+func (p *EventProcessor) deleteActivity(account *database.StravaAccount, stravaID int64) error {
+	deleted, err := p.Store.DeleteStravaActivity(account.UserID, stravaID)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		p.changed(account.UserID)
+	}
+	return nil
+}
+
+// processAthlete unlinks an athlete who revoked the app's access on Strava, removing the
+// activities that came from there as Strava's terms ask.
+func (p *EventProcessor) processAthlete(account *database.StravaAccount, event *database.StravaEvent) error {
+	var updates map[string]interface{}
+	if err := json.Unmarshal([]byte(event.Updates), &updates); err != nil {
+		return fmt.Errorf("decoding updates: %w", err)
+	}
+	if authorized, _ := updates["authorized"].(string); authorized != "false" {
+		return nil
+	}
+
+	removed, err := p.Store.DeleteStravaActivities(account.UserID)
+	if err != nil {
+		return err
+	}
+	if err := p.Store.DeleteAccount(account.ID); err != nil {
+		return err
+	}
+	log.Printf("Strava: athlete %d revoked access, unlinked user %d and removed %d activities", account.AthleteID, account.UserID, removed)
+	p.changed(account.UserID)
+	return nil
+}
+
+func (p *EventProcessor) changed(userID uint) {
+	if p.OnChanged != nil {
+		p.OnChanged(userID)
+	}
+}
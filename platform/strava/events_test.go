@@ -0,0 +1,329 @@
+package strava
+
+import (
+	"context"
+	"encoding/json"
+	"fitness/platform/database"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testAthleteID = 1234
+
+// fakeStrava serves activities by ID, as the Strava API would to the athlete who owns them.
+type fakeStrava struct {
+	mu         sync.Mutex
+	activities map[int64]Activity
+	status     int // Answer every request with this status when set
+	requests   int
+}
+
+func (f *fakeStrava) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"message": http.StatusText(f.status)})
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/activities/"), 10, 64)
+	activity, ok := f.activities[id]
+	if r.Method != http.MethodGet || err != nil || !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]string{"message": "Record Not Found"})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(activity)
+}
+
+// fakeStore keeps events, the linked account and synced activities in memory.
+type fakeStore struct {
+	account    *database.StravaAccount
+	events     []*database.StravaEvent
+	activities map[int64]*database.Activity
+}
+
+func (s *fakeStore) ClaimDueEvents(now time.Time, lease time.Duration, limit int) ([]*database.StravaEvent, error) {
+	var due []*database.StravaEvent
+	for _, event := range s.events {
+		if event.Status == database.StravaEventPending && !event.NextAttemptAt.After(now) && len(due) < limit {
+			event.NextAttemptAt = now.Add(lease)
+			copied := *event
+			due = append(due, &copied)
+		}
+	}
+	return due, nil
+}
+
+func (s *fakeStore) RecordEventAttempt(event *database.StravaEvent) error {
+	for i, stored := range s.events {
+		if stored.ID == event.ID {
+			copied := *event
+			s.events[i] = &copied
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) DeleteEventsBefore(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) GetAccountByAthleteID(athleteID int64) (*database.StravaAccount, error) {
+	if s.account == nil || s.account.AthleteID != athleteID {
+		return nil, nil
+	}
+	return s.account, nil
+}
+
+func (s *fakeStore) SaveStravaActivity(activity *database.Activity) (bool, error) {
+	_, exists := s.activities[*activity.StravaID]
+	s.activities[*activity.StravaID] = activity
+	return !exists, nil
+}
+
+func (s *fakeStore) DeleteStravaActivity(userID uint, stravaID int64) (bool, error) {
+	activity, ok := s.activities[stravaID]
+	if !ok || activity.UserID != userID {
+		return false, nil
+	}
+	delete(s.activities, stravaID)
+	return true, nil
+}
+
+func (s *fakeStore) DeleteStravaActivities(userID uint) (int64, error) {
+	var removed int64
+	for id, activity := range s.activities {
+		if activity.UserID == userID {
+			delete(s.activities, id)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (s *fakeStore) DeleteAccount(accountID uint) error {
+	if s.account != nil && s.account.ID == accountID {
+		s.account = nil
+	}
+	return nil
+}
+
+// newTestProcessor returns a processor for an athlete linked to user 7, talking to a fake Strava
+// server, and a record of the users it reported changes for.
+func newTestProcessor(t *testing.T, api *fakeStrava) (*EventProcessor, *fakeStore, *[]uint) {
+	t.Helper()
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	store := &fakeStore{
+		account:    &database.StravaAccount{UserID: 7, AthleteID: testAthleteID},
+		activities: map[int64]*database.Activity{},
+	}
+	store.account.ID = 3
+
+	processor := NewEventProcessor(store, func(account *database.StravaAccount) (*Client, error) {
+		return newTestClient(server), nil
+	})
+	var changed []uint
+	processor.OnChanged = func(userID uint) {
+		changed = append(changed, userID)
+	}
+	return processor, store, &changed
+}
+
+// newTestClient returns a client for a fake server that retries without waiting around.
+func newTestClient(server *httptest.Server) *Client {
+	client := NewClientWith(server.Client(), server.URL)
+	client.RetryDelay = time.Millisecond
+	return client
+}
+
+func testActivity(id int64, name string) Activity {
+	activity := Activity{Id: id, Name: name, SportType: "TrailRun", Distance: 12345, MovingTime: 3600, ElapsedTime: 3900}
+	activity.StartDate = time.Date(2026, 10, 1, 7, 30, 0, 0, time.UTC)
+	return activity
+}
+
+func activityEvent(aspect string, id int64) *database.StravaEvent {
+	return &database.StravaEvent{ObjectType: ObjectActivity, AspectType: aspect, ObjectID: id, OwnerID: testAthleteID, Updates: "{}"}
+}
+
+func TestProcessCreateFetchesActivity(t *testing.T) {
+	api := &fakeStrava{activities: map[int64]Activity{42: testActivity(42, "Morning Trail Run")}}
+	processor, store, changed := newTestProcessor(t, api)
+
+	if err := processor.Process(context.Background(), activityEvent(AspectCreate, 42)); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	saved, ok := store.activities[42]
+	if !ok {
+		t.Fatal("activity was not saved")
+	}
+	if saved.UserID != 7 || saved.Name != "Morning Trail Run" || saved.Type != "TRAIL_RUN" || saved.DistanceMeters != 12345 {
+		t.Errorf("saved activity = %+v", saved)
+	}
+	if len(*changed) != 1 || (*changed)[0] != 7 {
+		t.Errorf("changed users = %v, want [7]", *changed)
+	}
+}
+
+func TestProcessUpdateReplacesActivity(t *testing.T) {
+	api := &fakeStrava{activities: map[int64]Activity{42: testActivity(42, "Renamed Run")}}
+	processor, store, _ := newTestProcessor(t, api)
+	stravaID := int64(42)
+	store.activities[42] = &database.Activity{UserID: 7, Name: "Morning Run", StravaID: &stravaID}
+
+	event := activityEvent(AspectUpdate, 42)
+	event.Updates = `{"title":"Renamed Run"}`
+	if err := processor.Process(context.Background(), event); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if got := store.activities[42].Name; got != "Renamed Run" {
+		t.Errorf("name = %q, want %q", got, "Renamed Run")
+	}
+}
+
+func TestProcessDeleteRemovesActivity(t *testing.T) {
+	api := &fakeStrava{}
+	processor, store, changed := newTestProcessor(t, api)
+	stravaID := int64(42)
+	store.activities[42] = &database.Activity{UserID: 7, StravaID: &stravaID}
+
+	if err := processor.Process(context.Background(), activityEvent(AspectDelete, 42)); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if _, ok := store.activities[42]; ok {
+		t.Error("activity was not deleted")
+	}
+	if api.requests != 0 {
+		t.Errorf("made %d requests to Strava for a delete, want 0", api.requests)
+	}
+	if len(*changed) != 1 {
+		t.Errorf("changed users = %v, want [7]", *changed)
+	}
+}
+
+func TestProcessMissingActivityIsDeleted(t *testing.T) {
+	api := &fakeStrava{activities: map[int64]Activity{}}
+	processor, store, _ := newTestProcessor(t, api)
+	stravaID := int64(42)
+	store.activities[42] = &database.Activity{UserID: 7, StravaID: &stravaID}
+
+	if err := processor.Process(context.Background(), activityEvent(AspectUpdate, 42)); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if _, ok := store.activities[42]; ok {
+		t.Error("activity Strava no longer has was kept")
+	}
+}
+
+func TestProcessIgnoresUnknownAthlete(t *testing.T) {
+	api := &fakeStrava{activities: map[int64]Activity{42: testActivity(42, "Run")}}
+	processor, store, _ := newTestProcessor(t, api)
+
+	event := activityEvent(AspectCreate, 42)
+	event.OwnerID = 999
+	if err := processor.Process(context.Background(), event); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if len(store.activities) != 0 || api.requests != 0 {
+		t.Errorf("event for an unknown athlete was applied")
+	}
+}
+
+func TestProcessDeauthorizationUnlinksAthlete(t *testing.T) {
+	api := &fakeStrava{}
+	processor, store, _ := newTestProcessor(t, api)
+	stravaID := int64(42)
+	store.activities[42] = &database.Activity{UserID: 7, StravaID: &stravaID}
+
+	event := &database.StravaEvent{ObjectType: ObjectAthlete, AspectType: AspectUpdate, ObjectID: testAthleteID, OwnerID: testAthleteID, Updates: `{"authorized":"false"}`}
+	if err := processor.Process(context.Background(), event); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if store.account != nil {
+		t.Error("account was not unlinked")
+	}
+	if len(store.activities) != 0 {
+		t.Error("Strava activities were not removed")
+	}
+}
+
+func TestRunOnceRetriesThenGivesUp(t *testing.T) {
+	api := &fakeStrava{status: http.StatusInternalServerError}
+	processor, store, _ := newTestProcessor(t, api)
+	processor.MaxAttempts = 2
+
+	event := activityEvent(AspectCreate, 42)
+	event.ID = 1
+	event.Status = database.StravaEventPending
+	store.events = []*database.StravaEvent{event}
+
+	now := time.Now()
+	if err := processor.RunOnce(context.Background(), now); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	retried := store.events[0]
+	if retried.Status != database.StravaEventPending || retried.Attempts != 1 || retried.LastError == "" {
+		t.Fatalf("after first attempt: status %s, attempts %d, error %q", retried.Status, retried.Attempts, retried.LastError)
+	}
+	if !retried.NextAttemptAt.After(now) {
+		t.Errorf("retry is due at %v, want after %v", retried.NextAttemptAt, now)
+	}
+
+	if err := processor.RunOnce(context.Background(), retried.NextAttemptAt); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if failed := store.events[0]; failed.Status != database.StravaEventFailed || failed.Attempts != 2 {
+		t.Errorf("after last attempt: status %s, attempts %d", failed.Status, failed.Attempts)
+	}
+}
+
+func TestEventValid(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  bool
+	}{
+		{Event{ObjectType: ObjectActivity, AspectType: AspectCreate, ObjectID: 1, OwnerID: 2}, true},
+		{Event{ObjectType: ObjectActivity, AspectType: AspectDelete, ObjectID: 1, OwnerID: 2}, true},
+		{Event{ObjectType: ObjectAthlete, AspectType: AspectUpdate, ObjectID: 2, OwnerID: 2}, true},
+		{Event{ObjectType: ObjectAthlete, AspectType: AspectCreate, ObjectID: 2, OwnerID: 2}, false},
+		{Event{ObjectType: "route", AspectType: AspectCreate, ObjectID: 1, OwnerID: 2}, false},
+		{Event{ObjectType: ObjectActivity, AspectType: AspectCreate, OwnerID: 2}, false},
+	}
+	for _, test := range tests {
+		if got := test.event.Valid(); got != test.want {
+			t.Errorf("%+v.Valid() = %v, want %v", test.event, got, test.want)
+		}
+	}
+}
+
+func TestRunOnceWaitsOutRateLimit(t *testing.T) {
+	api := &fakeStrava{status: http.StatusTooManyRequests}
+	processor, store, _ := newTestProcessor(t, api)
+
+	event := activityEvent(AspectCreate, 42)
+	event.ID = 1
+	event.Status = database.StravaEventPending
+	store.events = []*database.StravaEvent{event}
+
+	now := time.Now()
+	if err := processor.RunOnce(context.Background(), now); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	waiting := store.events[0]
+	if waiting.Status != database.StravaEventPending || waiting.Attempts != 0 {
+		t.Errorf("status %s, attempts %d; want pending with no attempts used", waiting.Status, waiting.Attempts)
+	}
+	if !waiting.NextAttemptAt.After(now) || waiting.NextAttemptAt.After(now.Add(shortWindow)) {
+		t.Errorf("next attempt at %v, want by the next window", waiting.NextAttemptAt)
+	}
+}
@@ -0,0 +1,238 @@
+package strava
+
+import (
+	"context"
+	"errors"
+	"fitness/platform/database"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPostInterval = 10 * time.Minute
+	postBatchSize       = 20
+	weightTrainingSport = "WeightTraining"
+)
+
+// Poster posts the workouts users finish here to their Strava accounts, for users who have
+// chosen to. Each is posted once it is finished, and edits made afterwards update the same
+// Strava activity.
+type Poster struct {
+	StravaRepo *database.StravaRepo
+	// ClientFor returns a client for the athlete of a linked account.
+	ClientFor func(account *database.StravaAccount) (*Client, error)
+
+	// Interval is how often to look for workouts to post. Finishing a workout should also wake
+	// the poster, so this mostly matters for retries.
+	Interval time.Duration
+
+	wake chan struct{}
+}
+
+// NewPoster creates a Poster.
+func NewPoster(stravaRepo *database.StravaRepo, clientFor func(account *database.StravaAccount) (*Client, error)) *Poster {
+	return &Poster{
+		StravaRepo: stravaRepo,
+		ClientFor:  clientFor,
+		Interval:   defaultPostInterval,
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// Wake makes the poster look for workouts to post now rather than at its next interval.
+func (p *Poster) Wake() {
+	if p == nil {
+		return
+	}
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start posts workouts in the background until the context is cancelled.
+func (p *Poster) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := p.RunOnce(ctx); err != nil {
+				log.Printf("Strava: failed to post workouts: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-p.wake:
+			}
+		}
+	}()
+}
+
+// RunOnce posts the workouts of every user who has chosen to. A failure with one account is
+// recorded against it and doesn't stop the others, but running out of rate limit leaves the
+// rest for later.
+func (p *Poster) RunOnce(ctx context.Context) error {
+	accounts, err := p.StravaRepo.GetPostingAccounts()
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		posted, err := p.PostAccount(ctx, account)
+		var limitErr *RateLimitError
+		if errors.As(err, &limitErr) || ctx.Err() != nil {
+			return err
+		}
+		if err != nil {
+			log.Printf("Strava: failed to post workouts of user %d: %v", account.UserID, err)
+		} else if posted > 0 {
+			log.Printf("Strava: posted %d workouts for user %d", posted, account.UserID)
+		}
+	}
+	return nil
+}
+
+// PostAccount posts an account's workouts that are new or changed, returning how many were
+// posted. A workout Strava turns down is skipped until it is edited again, so one bad workout
+// doesn't hold up the rest.
+func (p *Poster) PostAccount(ctx context.Context, account *database.StravaAccount) (int, error) {
+	posted, err := p.postAccount(ctx, account)
+	var limitErr *RateLimitError
+	if !errors.As(err, &limitErr) {
+		if recordErr := p.StravaRepo.RecordPost(account.ID, err); recordErr != nil {
+			log.Printf("Strava: failed to record posting for account %d: %v", account.ID, recordErr)
+		}
+	}
+	return posted, err
+}
+
+func (p *Poster) postAccount(ctx context.Context, account *database.StravaAccount) (int, error) {
+	if !account.CanPostWorkouts() {
+		return 0, errors.New("strava wasn't allowed to add activities; reconnect it to allow posting")
+	}
+	client, err := p.ClientFor(account)
+	if err != nil {
+		return 0, err
+	}
+	workouts, err := p.StravaRepo.GetWorkoutsToPost(account, postBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		posted  int
+		lastErr error
+	)
+	for _, workout := range workouts {
+		stravaID, err := p.post(ctx, client, workout)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 &&
+			apiErr.StatusCode != http.StatusUnauthorized && apiErr.StatusCode != http.StatusForbidden {
+			// Trying again won't help, so it waits for the workout to change
+			lastErr = fmt.Errorf("posting %q: %w", workout.Name, err)
+		} else if err != nil {
+			return posted, err
+		} else {
+			posted++
+		}
+		var postedAs *int64
+		if stravaID != 0 {
+			postedAs = &stravaID
+		}
+		if err := p.StravaRepo.MarkPosted(workout.ID, postedAs, workout.Version); err != nil {
+			return posted, err
+		}
+	}
+	return posted, lastErr
+}
+
+// post creates the Strava activity for a workout, or updates it if the workout was posted
+// before, returning its Strava ID. A posted activity that has since been deleted on Strava
+// isn't made again.
+func (p *Poster) post(ctx context.Context, client *Client, workout *database.Activity) (int64, error) {
+	description := WorkoutDescription(workout)
+	if workout.StravaID != nil {
+		_, err := client.UpdateActivity(ctx, *workout.StravaID, UpdatableActivity{
+			Name:        workout.Name,
+			SportType:   weightTrainingSport,
+			Description: description,
+		})
+		if IsNotFound(err) {
+			return *workout.StravaID, nil
+		}
+		return *workout.StravaID, err
+	}
+
+	start := workout.ActivityTime
+	if workout.StartTime != nil {
+		start = *workout.StartTime
+	}
+	// Strava needs a duration, and workouts logged after the fact may not have one
+	elapsed := workout.ActiveDuration(time.Now())
+	if elapsed < time.Minute {
+		elapsed = time.Minute
+	}
+	created, err := client.CreateActivity(ctx, NewActivity{
+		Name:        workout.Name,
+		SportType:   weightTrainingSport,
+		StartDate:   start,
+		ElapsedTime: int(elapsed.Seconds()),
+		Description: description,
+		Trainer:     true,
+	})
+	return created.Id, err
+}
+
+// WorkoutDescription describes a workout for its Strava activity: its notes, then a line for
+// each exercise with how many sets were done and the top set.
+func WorkoutDescription(workout *database.Activity) string {
+	var lines []string
+	if notes := strings.TrimSpace(workout.Notes); notes != "" {
+		lines = append(lines, notes, "")
+	}
+	for _, exercise := range workout.GymExercises {
+		if line := exerciseLine(exercise); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// exerciseLine sums up one exercise, such as "Bench Press: 3 sets, top set 80 kg × 5". Warm-up
+// sets are left out unless they are all there is.
+func exerciseLine(exercise database.GymExercise) string {
+	var working []database.GymSet
+	for _, set := range exercise.Sets {
+		if set.SetType != "warmup" {
+			working = append(working, set)
+		}
+	}
+	if len(working) == 0 {
+		working = exercise.Sets
+	}
+	if len(working) == 0 {
+		return ""
+	}
+
+	top := working[0]
+	for _, set := range working[1:] {
+		if set.WeightKG > top.WeightKG || (set.WeightKG == top.WeightKG && set.Reps > top.Reps) {
+			top = set
+		}
+	}
+
+	sets := "1 set"
+	if len(working) > 1 {
+		sets = strconv.Itoa(len(working)) + " sets"
+	}
+	best := fmt.Sprintf("best %d reps", top.Reps)
+	if top.WeightKG > 0 {
+		best = fmt.Sprintf("top set %s kg × %d", strconv.FormatFloat(top.WeightKG, 'f', -1, 64), top.Reps)
+	}
+	return fmt.Sprintf("%s: %s, %s", exercise.ExerciseDefinition.Name, sets, best)
+}
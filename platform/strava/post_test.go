@@ -0,0 +1,108 @@
+package strava
+
+import (
+	"context"
+	"encoding/json"
+	"fitness/platform/database"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestWorkoutDescription(t *testing.T) {
+	workout := &database.Activity{
+		Notes: "Felt strong today.",
+		GymExercises: []database.GymExercise{
+			{
+				ExerciseDefinition: database.ExerciseDefinition{Name: "Bench Press"},
+				Sets: []database.GymSet{
+					{Reps: 10, WeightKG: 40, SetType: "warmup"},
+					{Reps: 5, WeightKG: 80},
+					{Reps: 6, WeightKG: 80},
+					{Reps: 8, WeightKG: 72.5},
+				},
+			},
+			{
+				ExerciseDefinition: database.ExerciseDefinition{Name: "Pull Up"},
+				Sets:               []database.GymSet{{Reps: 12}},
+			},
+			{ExerciseDefinition: database.ExerciseDefinition{Name: "Skipped"}},
+		},
+	}
+
+	want := "Felt strong today.\n\nBench Press: 3 sets, top set 80 kg × 6\nPull Up: 1 set, best 12 reps"
+	if got := WorkoutDescription(workout); got != want {
+		t.Errorf("description =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCreateActivity(t *testing.T) {
+	start := time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)
+	server, requests := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+		if r.Method != http.MethodPost || r.URL.Path != "/activities" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		if form.Get("name") != "Push Day" || form.Get("sport_type") != "WeightTraining" ||
+			form.Get("elapsed_time") != "3600" || form.Get("start_date_local") != "2026-10-18T07:00:00Z" || form.Get("trainer") != "1" {
+			t.Errorf("form = %v", form)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":987,"name":"Push Day"}`))
+	})
+
+	created, err := newTestClient(server).CreateActivity(context.Background(), NewActivity{
+		Name:        "Push Day",
+		SportType:   "WeightTraining",
+		StartDate:   start,
+		ElapsedTime: 3600,
+		Description: "Bench Press: 3 sets",
+		Trainer:     true,
+	})
+	if err != nil {
+		t.Fatalf("CreateActivity: %v", err)
+	}
+	if created.Id != 987 {
+		t.Errorf("id = %d, want 987", created.Id)
+	}
+	if *requests != 1 {
+		t.Errorf("made %d requests, want 1", *requests)
+	}
+}
+
+func TestCreateActivityIsNotRetried(t *testing.T) {
+	server, requests := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	if _, err := newTestClient(server).CreateActivity(context.Background(), NewActivity{Name: "Push Day"}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if *requests != 1 {
+		t.Errorf("made %d requests, want 1", *requests)
+	}
+}
+
+func TestUpdateActivity(t *testing.T) {
+	server, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var update UpdatableActivity
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			t.Errorf("decoding body: %v", err)
+		}
+		if r.Method != http.MethodPut || r.URL.Path != "/activities/987" || update.Name != "Pull Day" {
+			t.Errorf("request = %s %s %+v", r.Method, r.URL.Path, update)
+		}
+		_, _ = w.Write([]byte(`{"id":987,"name":"Pull Day"}`))
+	})
+
+	updated, err := newTestClient(server).UpdateActivity(context.Background(), 987, UpdatableActivity{Name: "Pull Day", SportType: "WeightTraining"})
+	if err != nil {
+		t.Fatalf("UpdateActivity: %v", err)
+	}
+	if updated.Name != "Pull Day" {
+		t.Errorf("name = %q", updated.Name)
+	}
+}
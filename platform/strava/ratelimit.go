@@ -0,0 +1,205 @@
+package strava
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shortWindow is Strava's shorter rate limit window. Windows start on the quarter hour, and the
+// daily one at midnight UTC.
+const shortWindow = 15 * time.Minute
+
+// RateLimitError is returned once the app has used up one of its Strava rate limits, either
+// because Strava answered 429 or because an earlier response said nothing was left. No more
+// requests are made until Until.
+type RateLimitError struct {
+	Until time.Time
+	Daily bool
+}
+
+func (e *RateLimitError) Error() string {
+	window := "15-minute"
+	if e.Daily {
+		window = "daily"
+	}
+	return fmt.Sprintf("strava: %s rate limit reached, next request at %s", window, e.Until.Format(time.RFC3339))
+}
+
+// Usage is how much of a pair of limits had been used when Strava last said.
+type Usage struct {
+	ShortLimit int
+	ShortUsage int
+	DailyLimit int
+	DailyUsage int
+	ObservedAt time.Time
+}
+
+// blockedUntil returns when requests may be made again if either limit is used up, or the zero
+// time if they may be made now.
+func (u Usage) blockedUntil(now time.Time) (time.Time, bool) {
+	if u.ObservedAt.IsZero() {
+		return time.Time{}, false
+	}
+	if u.DailyLimit > 0 && u.DailyUsage >= u.DailyLimit {
+		if reset := nextDay(u.ObservedAt); now.Before(reset) {
+			return reset, true
+		}
+	}
+	if u.ShortLimit > 0 && u.ShortUsage >= u.ShortLimit {
+		if reset := u.ObservedAt.UTC().Truncate(shortWindow).Add(shortWindow); now.Before(reset) {
+			return reset, false
+		}
+	}
+	return time.Time{}, false
+}
+
+// left returns how many requests the limits allow before one of them is reached, counting a
+// window that has reset since Strava last said as unused. It reports false if Strava hasn't said.
+func (u Usage) left(now time.Time) (int, bool) {
+	if u.ObservedAt.IsZero() {
+		return 0, false
+	}
+	left := -1
+	if u.ShortLimit > 0 {
+		short := u.ShortLimit - u.ShortUsage
+		if !now.Before(u.ObservedAt.UTC().Truncate(shortWindow).Add(shortWindow)) {
+			short = u.ShortLimit
+		}
+		left = short
+	}
+	if u.DailyLimit > 0 {
+		daily := u.DailyLimit - u.DailyUsage
+		if !now.Before(nextDay(u.ObservedAt)) {
+			daily = u.DailyLimit
+		}
+		if left < 0 || daily < left {
+			left = daily
+		}
+	}
+	if left < 0 {
+		return 0, false
+	}
+	return max(left, 0), true
+}
+
+// RateLimits tracks the app's Strava rate limits from the headers on each response. Strava
+// counts requests from every athlete's token against the one app, so every client shares it.
+// Reads have their own, lower, limits on top of the overall ones.
+type RateLimits struct {
+	mu      sync.Mutex
+	overall Usage
+	read    Usage
+}
+
+// NewRateLimits creates a RateLimits that knows nothing about the usage yet.
+func NewRateLimits() *RateLimits {
+	return &RateLimits{}
+}
+
+// Update records the usage reported by a response.
+func (r *RateLimits) Update(header http.Header, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if usage, ok := parseUsage(header, "X-RateLimit", now); ok {
+		r.overall = usage
+	}
+	if usage, ok := parseUsage(header, "X-ReadRateLimit", now); ok {
+		r.read = usage
+	}
+}
+
+// Check returns a RateLimitError if a request can't be made yet. read says whether the request
+// only reads.
+func (r *RateLimits) Check(read bool, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if until, daily := r.overall.blockedUntil(now); !until.IsZero() {
+		return &RateLimitError{Until: until, Daily: daily}
+	}
+	if read {
+		if until, daily := r.read.blockedUntil(now); !until.IsZero() {
+			return &RateLimitError{Until: until, Daily: daily}
+		}
+	}
+	return nil
+}
+
+// ReadsLeft returns how many more reads can be made before any limit is reached, or -1 if Strava
+// hasn't said how much has been used yet.
+func (r *RateLimits) ReadsLeft(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	overall, known := r.overall.left(now)
+	read, readKnown := r.read.left(now)
+	switch {
+	case known && readKnown:
+		return min(overall, read)
+	case known:
+		return overall
+	case readKnown:
+		return read
+	}
+	return -1
+}
+
+// Usage returns the overall and read usage last reported.
+func (r *RateLimits) Usage() (overall, read Usage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.overall, r.read
+}
+
+// exceeded returns the error for a 429 answer, which should have come with headers saying which
+// limit was hit. Without them, it waits for the next short window.
+func (r *RateLimits) exceeded(read bool, now time.Time) *RateLimitError {
+	if err, ok := r.Check(read, now).(*RateLimitError); ok {
+		return err
+	}
+	return &RateLimitError{Until: now.UTC().Truncate(shortWindow).Add(shortWindow)}
+}
+
+// parseUsage reads a "<prefix>-Limit" and "<prefix>-Usage" header pair, each of which is the
+// short and daily figures separated by a comma, such as "200,2000".
+func parseUsage(header http.Header, prefix string, now time.Time) (Usage, bool) {
+	shortLimit, dailyLimit, ok := parsePair(header.Get(prefix + "-Limit"))
+	if !ok {
+		return Usage{}, false
+	}
+	shortUsage, dailyUsage, ok := parsePair(header.Get(prefix + "-Usage"))
+	if !ok {
+		return Usage{}, false
+	}
+	return Usage{
+		ShortLimit: shortLimit,
+		ShortUsage: shortUsage,
+		DailyLimit: dailyLimit,
+		DailyUsage: dailyUsage,
+		ObservedAt: now,
+	}, true
+}
+
+func parsePair(value string) (int, int, bool) {
+	short, daily, found := strings.Cut(value, ",")
+	if !found {
+		return 0, 0, false
+	}
+	a, err := strconv.Atoi(strings.TrimSpace(short))
+	if err != nil {
+		return 0, 0, false
+	}
+	b, err := strconv.Atoi(strings.TrimSpace(daily))
+	if err != nil {
+		return 0, 0, false
+	}
+	return a, b, true
+}
+
+// nextDay returns the midnight UTC after t, when the daily limit resets.
+func nextDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+}
@@ -1,200 +1,301 @@
+// Package strava talks to the Strava API on behalf of users who have connected their Strava
+// accounts, and keeps their Strava activities in step with their activity timeline here.
 package strava
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
-
-	"golang.org/x/oauth2"
 )
 
-const tokenFile = "strava_token.json"
+// maxResponseSize is the most of a response that is read. Full activities with many segment
+// efforts can be large.
+const maxResponseSize = 20 << 20
 
-// TokenManager holds the configuration and token for interacting with the Strava API.
-type TokenManager struct {
-	Config *oauth2.Config
-	Token  *oauth2.Token
-}
+// DefaultBaseURL is where the Strava API lives.
+const DefaultBaseURL = "https://www.strava.com/api/v3"
 
+const (
+	defaultMaxRetries = 2
+	defaultRetryDelay = time.Second
+)
+
+// Client calls the Strava API for one athlete. Requests that fail with a network error or a 5xx
+// are retried a couple of times, backing off in between, and none are made while the app's rate
+// limit is used up.
 type Client struct {
 	httpClient *http.Client
 	baseURL    string
+
+	// Limits tracks the app's rate limits, and should be shared by every client.
+	Limits *RateLimits
+	// MaxRetries is how many more times a failed request is tried.
+	MaxRetries int
+	// RetryDelay is how long to wait before the first retry, doubling for each one after.
+	RetryDelay time.Duration
 }
 
-func NewClient() *Client {
-	stravaManager, err := NewTokenManager()
-	if err != nil {
-		log.Fatalf("Failed to create token manager: %v", err)
-	}
+// APIError is an error response from Strava.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Errors says which fields were wrong, for a 4xx.
+	Errors []FieldError
+}
 
-	if stravaManager.Token == nil || stravaManager.Token.AccessToken == "" {
-		stravaManager.StartLoginWebServer()
-	}
+// FieldError is one of the problems Strava lists with a request.
+type FieldError struct {
+	Resource string `json:"resource"`
+	Field    string `json:"field"`
+	Code     string `json:"code"`
+}
 
-	client, err := stravaManager.GetClient()
-	if err != nil {
-		log.Fatalf("Failed to get authenticated client: %v", err)
+func (e *APIError) Error() string {
+	if len(e.Errors) > 0 {
+		first := e.Errors[0]
+		return fmt.Sprintf("strava: %d %s (%s %s %s)", e.StatusCode, e.Message, first.Resource, first.Field, first.Code)
 	}
+	return fmt.Sprintf("strava: %d %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is Strava saying there is no such thing, or that the athlete
+// can't see it.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
 
+// NewClientWith creates a client that makes requests with an HTTP client that already adds the
+// athlete's token, against the API at baseURL. It tracks rate limits on its own until given
+// shared Limits.
+func NewClientWith(httpClient *http.Client, baseURL string) *Client {
 	return &Client{
-		client,
-		"https://www.strava.com/api/v3",
+		httpClient: httpClient,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		Limits:     NewRateLimits(),
+		MaxRetries: defaultMaxRetries,
+		RetryDelay: defaultRetryDelay,
 	}
+}
 
+// GetAthlete returns the athlete the client's token belongs to.
+func (c *Client) GetAthlete(ctx context.Context) (Athlete, error) {
+	var athlete Athlete
+	err := c.get(ctx, "/athlete", nil, &athlete)
+	return athlete, err
 }
 
-func (c Client) GetAthlete() Athlete {
-	resp, err := c.httpClient.Get(c.baseURL + "/athlete")
+// GetActivity returns one of the athlete's activities in full.
+func (c *Client) GetActivity(ctx context.Context, activityId int64) (Activity, error) {
+	var activity Activity
+	err := c.get(ctx, "/activities/"+strconv.FormatInt(activityId, 10), nil, &activity)
+	return activity, err
+}
 
-	if err != nil {
-		log.Fatalf("API call failed: %v", err)
-	}
-	defer resp.Body.Close()
+// Stream is one of the readings through an activity, such as its heart rate. Strava may
+// resample a long activity's streams, in which case OriginalSize is how many readings it had.
+type Stream struct {
+	Data         []float64 `json:"data"`
+	SeriesType   string    `json:"series_type"`
+	OriginalSize int       `json:"original_size"`
+	Resolution   string    `json:"resolution"`
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatalf("Failed to read response body: %v", err)
-	}
+// GetActivityStreams returns the streams of the given types that an activity has, keyed by type.
+// Only streams of numbers can be asked for, not latlng or moving.
+func (c *Client) GetActivityStreams(ctx context.Context, activityId int64, types []string) (map[string]Stream, error) {
+	query := url.Values{}
+	query.Set("keys", strings.Join(types, ","))
+	query.Set("key_by_type", "true")
 
-	fmt.Printf("\nAPI Response:\n%s\n", string(body))
+	var streams map[string]Stream
+	err := c.get(ctx, "/activities/"+strconv.FormatInt(activityId, 10)+"/streams", query, &streams)
+	return streams, err
+}
 
-	var athlete Athlete
-	err = json.Unmarshal(body, &athlete)
-	if err != nil {
-		log.Fatalf("Failed to unmarshal response body: %v", err)
-	}
-	return athlete
+// ListActivities returns a page of the athlete's activities that started after the given time,
+// oldest first. Pages start at 1, and Strava allows up to 200 activities a page. The activities
+// are summaries, without a description, laps or the full-detail route.
+func (c *Client) ListActivities(ctx context.Context, after time.Time, page, perPage int) ([]Activity, error) {
+	query := url.Values{}
+	query.Set("after", strconv.FormatInt(after.Unix(), 10))
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(perPage))
+
+	var activities []Activity
+	err := c.get(ctx, "/athlete/activities", query, &activities)
+	return activities, err
 }
 
-func (c Client) GetActivity(activityId int64) Activity {
-	resp, err := c.httpClient.Get(c.baseURL + "/activities/" + strconv.FormatInt(activityId, 10))
-	if err != nil {
-		log.Fatalf("API call failed: %v", err)
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatalf("Failed to read response body: %v", err)
-	}
-	var activity Activity
-	err = json.Unmarshal(body, &activity)
-	if err != nil {
-		log.Fatalf("Failed to unmarshal response body: %v", err)
-	}
-	return activity
+// NewActivity is an activity to create on Strava by hand, without a file.
+type NewActivity struct {
+	Name        string
+	SportType   string
+	StartDate   time.Time
+	ElapsedTime int // Seconds
+	Description string
+	Distance    float64 // Metres
+	Trainer     bool
 }
 
-// NewTokenManager creates a manager, gets credentials from env vars, and loads a token if it exists.
-func NewTokenManager() (*TokenManager, error) {
-	clientID := os.Getenv("STRAVA_CLIENT_ID")
-	clientSecret := os.Getenv("STRAVA_CLIENT_SECRET")
-	if clientID == "" || clientSecret == "" {
-		return nil, fmt.Errorf("STRAVA_CLIENT_ID and STRAVA_CLIENT_SECRET must be set")
-	}
+// UpdatableActivity is what can be changed about an activity after it is created. Strava
+// doesn't allow its start or duration to be changed.
+type UpdatableActivity struct {
+	Name        string `json:"name"`
+	SportType   string `json:"sport_type"`
+	Description string `json:"description"`
+	Trainer     bool   `json:"trainer"`
+}
 
-	tm := &TokenManager{
-		Config: &oauth2.Config{
-			ClientID:     clientID,
-			ClientSecret: clientSecret,
-			RedirectURL:  "http://localhost:8080/callback",
-			Scopes:       []string{"read_all,activity:read_all,profile:read_all"},
-			Endpoint: oauth2.Endpoint{
-				AuthURL:  "https://www.strava.com/oauth/authorize",
-				TokenURL: "https://www.strava.com/oauth/token",
-			},
-		},
+// CreateActivity adds an activity to the athlete's Strava account, which needs the
+// activity:write scope. It isn't retried, as a retry after a lost answer would add it twice.
+func (c *Client) CreateActivity(ctx context.Context, activity NewActivity) (Activity, error) {
+	form := url.Values{}
+	form.Set("name", activity.Name)
+	form.Set("sport_type", activity.SportType)
+	form.Set("start_date_local", activity.StartDate.Format(time.RFC3339))
+	form.Set("elapsed_time", strconv.Itoa(activity.ElapsedTime))
+	form.Set("description", activity.Description)
+	if activity.Distance > 0 {
+		form.Set("distance", strconv.FormatFloat(activity.Distance, 'f', 1, 64))
 	}
-
-	// Try to load a token from the file.
-	if err := tm.loadToken(); err != nil {
-		log.Printf("Token file not found or invalid: %v. Ready for new login.", err)
+	if activity.Trainer {
+		form.Set("trainer", "1")
 	}
-	return tm, nil
+
+	var created Activity
+	err := c.send(ctx, http.MethodPost, "/activities", nil, []byte(form.Encode()), "application/x-www-form-urlencoded", false, &created)
+	return created, err
 }
 
-// saveToken persists the token to the local file.
-func (tm *TokenManager) saveToken() error {
-	file, err := json.MarshalIndent(tm.Token, "", "  ")
+// UpdateActivity changes one of the athlete's activities, which needs the activity:write scope.
+func (c *Client) UpdateActivity(ctx context.Context, activityId int64, update UpdatableActivity) (Activity, error) {
+	body, err := json.Marshal(update)
 	if err != nil {
-		return err
+		return Activity{}, err
 	}
-	return os.WriteFile(tokenFile, file, 0600)
+	var updated Activity
+	err = c.send(ctx, http.MethodPut, "/activities/"+strconv.FormatInt(activityId, 10), nil, body, "application/json", true, &updated)
+	return updated, err
 }
 
-// loadToken retrieves the token from the local file.
-func (tm *TokenManager) loadToken() error {
-	file, err := os.ReadFile(tokenFile)
+// get makes a GET request and decodes the JSON response into v.
+func (c *Client) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	return c.send(ctx, http.MethodGet, path, query, nil, "", true, v)
+}
+
+// send makes a request with an optional body and decodes the JSON response into v. retry says
+// whether the request is safe to make again if it fails.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body []byte, contentType string, retry bool, v interface{}) error {
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	resp, err := c.do(ctx, func() (*http.Request, error) {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+		if err == nil && contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		return req, err
+	}, retry)
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(file, &tm.Token)
+	if err := json.Unmarshal(resp, v); err != nil {
+		return fmt.Errorf("strava: decoding %s: %w", path, err)
+	}
+	return nil
 }
 
-// GetClient ensures the token is valid (refreshing if needed) and returns an http.Client.
-func (tm *TokenManager) GetClient() (*http.Client, error) {
-	if tm.Token == nil || tm.Token.AccessToken == "" {
-		return nil, fmt.Errorf("no token available, please login first")
-	}
+// do sends the request newRequest makes, retrying network errors and 5xx answers if retry is
+// set, and returns the body of a 2xx answer.
+func (c *Client) do(ctx context.Context, newRequest func() (*http.Request, error), retry bool) ([]byte, error) {
+	delay := c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		body, err := c.attempt(req)
+		if !retry || attempt >= c.MaxRetries || !retryable(err) {
+			return body, err
+		}
 
-	tokenSource := tm.Config.TokenSource(context.Background(), tm.Token)
-	newToken, err := tokenSource.Token()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get or refresh token: %w", err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("strava: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
 	}
+}
 
-	// If the token was refreshed, save the new one.
-	if newToken.AccessToken != tm.Token.AccessToken {
-		log.Println("Token was refreshed.")
-		tm.Token = newToken
-		if err := tm.saveToken(); err != nil {
-			log.Printf("Warning: failed to save refreshed token: %v", err)
-		}
+// attempt makes one request, once the rate limits allow it.
+func (c *Client) attempt(req *http.Request) ([]byte, error) {
+	read := req.Method == http.MethodGet
+	if err := c.Limits.Check(read, time.Now()); err != nil {
+		return nil, err
 	}
 
-	return tm.Config.Client(context.Background(), tm.Token), nil
-}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("strava: %w", err)
+	}
+	defer resp.Body.Close()
+	c.Limits.Update(resp.Header, time.Now())
 
-// StartLoginWebServer handles the initial OAuth flow if no token exists.
-func (tm *TokenManager) StartLoginWebServer() {
-	// A simple state string for CSRF protection.
-	oauthStateString := "pseudo-random"
-
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		url := tm.Config.AuthCodeURL(oauthStateString)
-		html := fmt.Sprintf(`<html><body><a href="%s">Login with Strava</a></body></html>`, url)
-		fmt.Fprint(w, html)
-	})
-
-	http.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
-		if r.FormValue("state") != oauthStateString {
-			http.Error(w, "Invalid state", http.StatusBadRequest)
-			return
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("strava: reading response: %w", err)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, c.Limits.exceeded(read, time.Now())
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		failure := &APIError{StatusCode: resp.StatusCode}
+		var detail struct {
+			Message string       `json:"message"`
+			Errors  []FieldError `json:"errors"`
 		}
-
-		code := r.FormValue("code")
-		token, err := tm.Config.Exchange(context.Background(), code)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Code exchange failed: %s", err), http.StatusInternalServerError)
-			return
+		if json.Unmarshal(body, &detail) == nil {
+			failure.Message = detail.Message
+			failure.Errors = detail.Errors
 		}
-
-		tm.Token = token
-		if err := tm.saveToken(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to save token: %s", err), http.StatusInternalServerError)
-			return
+		if failure.Message == "" {
+			failure.Message = http.StatusText(resp.StatusCode)
 		}
+		return nil, failure
+	}
+	return body, nil
+}
 
-		fmt.Fprint(w, "<h1>Login Successful!</h1><p>Token saved. You can now close this window and restart the application.</p>")
-	})
-
-	fmt.Println("No token found. Please open http://localhost:8080 to authorize.")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// retryable reports whether a request that failed with err might work if tried again soon.
+// Running out of rate limit isn't, as that lasts until the window resets.
+func retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var limitErr *RateLimitError
+	if errors.As(err, &limitErr) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	return true
 }
 
 type Athlete struct {
@@ -325,6 +426,8 @@ type Activity struct {
 	Kilojoules           float64     `json:"kilojoules"`
 	DeviceWatts          bool        `json:"device_watts"`
 	HasHeartrate         bool        `json:"has_heartrate"`
+	AverageHeartrate     float64     `json:"average_heartrate"`
+	MaxHeartrate         float64     `json:"max_heartrate"`
 	MaxWatts             int         `json:"max_watts"`
 	ElevHigh             float64     `json:"elev_high"`
 	ElevLow              float64     `json:"elev_low"`
@@ -389,6 +492,7 @@ type Activity struct {
 		MovingTime          int     `json:"moving_time"`
 		Split               int     `json:"split"`
 		AverageSpeed        float64 `json:"average_speed"`
+		AverageHeartrate    float64 `json:"average_heartrate"`
 		PaceZone            int     `json:"pace_zone"`
 	} `json:"splits_metric"`
 	Laps []struct {
@@ -416,6 +520,8 @@ type Activity struct {
 		AverageCadence     float64   `json:"average_cadence"`
 		DeviceWatts        bool      `json:"device_watts"`
 		AverageWatts       float64   `json:"average_watts"`
+		AverageHeartrate   float64   `json:"average_heartrate"`
+		MaxHeartrate       float64   `json:"max_heartrate"`
 		LapIndex           int       `json:"lap_index"`
 		Split              float64   `json:"split"`
 	} `json:"laps"`
@@ -0,0 +1,241 @@
+package strava
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingServer answers every request with handler, counting them.
+func countingServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	var calls int32
+	server, requests := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			http.Error(w, `{"message":"Service Unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":42,"name":"Lunch Ride"}`))
+	})
+
+	activity, err := newTestClient(server).GetActivity(context.Background(), 42)
+	if err != nil {
+		t.Fatalf("GetActivity: %v", err)
+	}
+	if activity.Name != "Lunch Ride" {
+		t.Errorf("name = %q, want %q", activity.Name, "Lunch Ride")
+	}
+	if *requests != 3 {
+		t.Errorf("made %d requests, want 3", *requests)
+	}
+}
+
+func TestClientGivesUpOnServerErrors(t *testing.T) {
+	server, requests := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	_, err := newTestClient(server).GetAthlete(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("err = %v, want a 502 APIError", err)
+	}
+	if *requests != 1+defaultMaxRetries {
+		t.Errorf("made %d requests, want %d", *requests, 1+defaultMaxRetries)
+	}
+}
+
+func TestClientDoesNotRetryClientErrors(t *testing.T) {
+	server, requests := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"Resource Not Found","errors":[{"resource":"Activity","field":"id","code":"invalid"}]}`))
+	})
+
+	_, err := newTestClient(server).GetActivity(context.Background(), 42)
+	if !IsNotFound(err) {
+		t.Fatalf("err = %v, want not found", err)
+	}
+	var apiErr *APIError
+	errors.As(err, &apiErr)
+	if len(apiErr.Errors) != 1 || apiErr.Errors[0].Resource != "Activity" {
+		t.Errorf("field errors = %+v", apiErr.Errors)
+	}
+	if *requests != 1 {
+		t.Errorf("made %d requests, want 1", *requests)
+	}
+}
+
+func TestClientStopsAtRateLimit(t *testing.T) {
+	server, requests := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "100,1000")
+		w.Header().Set("X-RateLimit-Usage", "101,250")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	client := newTestClient(server)
+
+	_, err := client.ListActivities(context.Background(), time.Unix(0, 0), 1, 30)
+	var limitErr *RateLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("err = %v, want a RateLimitError", err)
+	}
+	if limitErr.Daily {
+		t.Error("the 15-minute limit was reported as the daily one")
+	}
+	if wait := time.Until(limitErr.Until); wait <= 0 || wait > shortWindow {
+		t.Errorf("told to wait %v, want up to %v", wait, shortWindow)
+	}
+
+	// The limit is remembered, so the next request isn't even sent.
+	if _, err := client.GetAthlete(context.Background()); !errors.As(err, &limitErr) {
+		t.Fatalf("second request: err = %v, want a RateLimitError", err)
+	}
+	if *requests != 1 {
+		t.Errorf("made %d requests, want 1", *requests)
+	}
+}
+
+func TestClientTracksUsageFromSuccessfulResponses(t *testing.T) {
+	server, requests := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "200,2000")
+		w.Header().Set("X-RateLimit-Usage", "20,300")
+		w.Header().Set("X-ReadRateLimit-Limit", "100,1000")
+		w.Header().Set("X-ReadRateLimit-Usage", "10,1000")
+		_, _ = w.Write([]byte(`{"id":7}`))
+	})
+	client := newTestClient(server)
+
+	if _, err := client.GetAthlete(context.Background()); err != nil {
+		t.Fatalf("GetAthlete: %v", err)
+	}
+	overall, read := client.Limits.Usage()
+	if overall.ShortUsage != 20 || overall.DailyLimit != 2000 || read.DailyUsage != 1000 {
+		t.Errorf("usage = %+v, read usage = %+v", overall, read)
+	}
+
+	_, err := client.GetAthlete(context.Background())
+	var limitErr *RateLimitError
+	if !errors.As(err, &limitErr) || !limitErr.Daily {
+		t.Fatalf("err = %v, want the daily RateLimitError", err)
+	}
+	if want := nextDay(time.Now()); !limitErr.Until.Equal(want) {
+		t.Errorf("until = %v, want %v", limitErr.Until, want)
+	}
+	if *requests != 1 {
+		t.Errorf("made %d requests, want 1", *requests)
+	}
+
+	// Only reads are over their limit, so writes may still be made.
+	if err := client.Limits.Check(false, time.Now()); err != nil {
+		t.Errorf("writes were blocked: %v", err)
+	}
+}
+
+func TestRateLimitsResetWithTheWindow(t *testing.T) {
+	limits := NewRateLimits()
+	observed := time.Date(2026, 10, 18, 9, 20, 0, 0, time.UTC)
+	header := http.Header{}
+	header.Set("X-RateLimit-Limit", "100,1000")
+	header.Set("X-RateLimit-Usage", "100,400")
+	limits.Update(header, observed)
+
+	err := limits.Check(true, observed.Add(time.Minute))
+	var limitErr *RateLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("err = %v, want a RateLimitError", err)
+	}
+	if want := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC); !limitErr.Until.Equal(want) {
+		t.Errorf("until = %v, want %v", limitErr.Until, want)
+	}
+	if err := limits.Check(true, observed.Add(10*time.Minute)); err != nil {
+		t.Errorf("still blocked in the next window: %v", err)
+	}
+}
+
+func TestRateLimitsReadsLeft(t *testing.T) {
+	limits := NewRateLimits()
+	observed := time.Date(2026, 10, 18, 9, 20, 0, 0, time.UTC)
+	if left := limits.ReadsLeft(observed); left != -1 {
+		t.Errorf("before any response: %d left, want -1", left)
+	}
+
+	header := http.Header{}
+	header.Set("X-RateLimit-Limit", "200,2000")
+	header.Set("X-RateLimit-Usage", "150,400")
+	header.Set("X-ReadRateLimit-Limit", "100,1000")
+	header.Set("X-ReadRateLimit-Usage", "30,980")
+	limits.Update(header, observed)
+
+	for _, test := range []struct {
+		name string
+		now  time.Time
+		want int
+	}{
+		{"in the same window", observed.Add(time.Minute), 20},
+		{"in the next window", observed.Add(10 * time.Minute), 20},
+		{"the next day", time.Date(2026, 10, 19, 0, 5, 0, 0, time.UTC), 100},
+	} {
+		if left := limits.ReadsLeft(test.now); left != test.want {
+			t.Errorf("%s: %d left, want %d", test.name, left, test.want)
+		}
+	}
+
+	header.Set("X-RateLimit-Usage", "190,400")
+	header.Set("X-ReadRateLimit-Usage", "30,500")
+	limits.Update(header, observed)
+	if left := limits.ReadsLeft(observed.Add(time.Minute)); left != 10 {
+		t.Errorf("near the overall limit: %d left, want 10", left)
+	}
+}
+
+func TestClientRetryStopsWithContext(t *testing.T) {
+	server, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	client := newTestClient(server)
+	client.RetryDelay = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.GetAthlete(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the context's error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %v to give up", elapsed)
+	}
+}
+
+func TestListActivitiesQuery(t *testing.T) {
+	after := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	server, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/athlete/activities" || query.Get("page") != "2" || query.Get("per_page") != "50" ||
+			query.Get("after") != "1788220800" {
+			t.Errorf("request = %s", r.URL)
+		}
+		_, _ = w.Write([]byte(`[{"id":1},{"id":2}]`))
+	})
+
+	activities, err := newTestClient(server).ListActivities(context.Background(), after, 2, 50)
+	if err != nil {
+		t.Fatalf("ListActivities: %v", err)
+	}
+	if len(activities) != 2 {
+		t.Errorf("got %d activities, want 2", len(activities))
+	}
+}
@@ -0,0 +1,154 @@
+package strava
+
+import (
+	"context"
+	"errors"
+	"fitness/platform/database"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	defaultStreamInterval = 15 * time.Minute
+	streamBatchSize       = 20
+	// streamMaxAge is how far back streams are fetched in the background. Older activities'
+	// streams are fetched when they are opened, so a first sync of years of activities doesn't
+	// use up the day's reads.
+	streamMaxAge = 28 * 24 * time.Hour
+	// defaultStreamReadReserve is how many reads are left for users opening activities, which
+	// fetch what they need straight away, before fetching in the background stops for the window.
+	defaultStreamReadReserve = 25
+)
+
+// errStreamReserve stops fetching streams in the background once the reads left are reserved.
+var errStreamReserve = errors.New("strava: reads left are kept for users")
+
+// StreamStore is where activities without streams are found and their streams saved. It is
+// satisfied by *database.StravaRepo.
+type StreamStore interface {
+	GetAccounts() ([]*database.StravaAccount, error)
+	GetActivitiesWithoutStreams(userID uint, since time.Time, limit int) ([]*database.Activity, error)
+	SaveStreams(activityID uint, streams database.Streams) error
+}
+
+// StreamFetcher fetches the readings through recently synced activities in the background, newest
+// first, so that activities nobody has opened still count towards their week's zones. Lists and push
+// events only give an activity's summary, and its streams take another request each, so the
+// fetcher stops short of the rate limits and picks up where it left off when they reset.
+type StreamFetcher struct {
+	Store StreamStore
+	// ClientFor returns a client for the athlete of a linked account.
+	ClientFor func(account *database.StravaAccount) (*Client, error)
+
+	// Interval is how often to look for activities without streams. Syncing new activities
+	// should also wake the fetcher, so this mostly matters once the rate limits reset.
+	Interval time.Duration
+	// ReadReserve is how many reads to leave for users' own requests.
+	ReadReserve int
+
+	wake chan struct{}
+}
+
+// NewStreamFetcher creates a StreamFetcher.
+func NewStreamFetcher(store StreamStore, clientFor func(account *database.StravaAccount) (*Client, error)) *StreamFetcher {
+	return &StreamFetcher{
+		Store:       store,
+		ClientFor:   clientFor,
+		Interval:    defaultStreamInterval,
+		ReadReserve: defaultStreamReadReserve,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Wake makes the fetcher look for activities without streams now rather than at its next interval.
+func (f *StreamFetcher) Wake() {
+	if f == nil {
+		return
+	}
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start fetches streams in the background until the context is cancelled.
+func (f *StreamFetcher) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(f.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := f.RunOnce(ctx, time.Now()); err != nil {
+				log.Printf("Strava: failed to fetch streams: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-f.wake:
+			}
+		}
+	}()
+}
+
+// RunOnce fetches the streams of every account's recent activities that don't have them, a batch
+// from each account at a time so that one with many doesn't hold up the rest. A failure with one
+// account doesn't stop the others, but nearing the rate limits leaves the rest for later.
+func (f *StreamFetcher) RunOnce(ctx context.Context, now time.Time) error {
+	accounts, err := f.Store.GetAccounts()
+	if err != nil {
+		return err
+	}
+	for more := true; more; {
+		more = false
+		for _, account := range accounts {
+			fetched, err := f.FetchAccount(ctx, account, now)
+			if fetched > 0 {
+				log.Printf("Strava: fetched the streams of %d activities for user %d", fetched, account.UserID)
+			}
+			if errors.Is(err, errStreamReserve) {
+				return nil
+			}
+			var limitErr *RateLimitError
+			if errors.As(err, &limitErr) || ctx.Err() != nil {
+				return err
+			}
+			if err != nil {
+				log.Printf("Strava: failed to fetch streams for user %d: %v", account.UserID, err)
+			} else if fetched == streamBatchSize {
+				more = true
+			}
+		}
+	}
+	return nil
+}
+
+// FetchAccount fetches the streams of a batch of an account's recent activities that don't have
+// them, returning how many were fetched.
+func (f *StreamFetcher) FetchAccount(ctx context.Context, account *database.StravaAccount, now time.Time) (int, error) {
+	activities, err := f.Store.GetActivitiesWithoutStreams(account.UserID, now.Add(-streamMaxAge), streamBatchSize)
+	if err != nil || len(activities) == 0 {
+		return 0, err
+	}
+	client, err := f.ClientFor(account)
+	if err != nil {
+		return 0, err
+	}
+
+	fetched := 0
+	for _, activity := range activities {
+		if left := client.Limits.ReadsLeft(time.Now()); left >= 0 && left <= f.ReadReserve {
+			return fetched, errStreamReserve
+		}
+		streams, err := fetchStreams(ctx, client, *activity.StravaID)
+		if err != nil {
+			return fetched, err
+		}
+		if err := f.Store.SaveStreams(activity.ID, streams); err != nil {
+			return fetched, fmt.Errorf("saving the streams of activity %d: %w", activity.ID, err)
+		}
+		fetched++
+	}
+	return fetched, nil
+}
@@ -0,0 +1,130 @@
+package strava
+
+import (
+	"context"
+	"errors"
+	"fitness/platform/database"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeStreamStore keeps one account's activities without streams in memory, newest first.
+type fakeStreamStore struct {
+	account *database.StravaAccount
+	missing []*database.Activity
+	saved   map[uint]database.Streams
+}
+
+func (s *fakeStreamStore) GetAccounts() ([]*database.StravaAccount, error) {
+	return []*database.StravaAccount{s.account}, nil
+}
+
+func (s *fakeStreamStore) GetActivitiesWithoutStreams(userID uint, since time.Time, limit int) ([]*database.Activity, error) {
+	var activities []*database.Activity
+	for _, activity := range s.missing {
+		if _, ok := s.saved[activity.ID]; !ok && !activity.ActivityTime.Before(since) && len(activities) < limit {
+			activities = append(activities, activity)
+		}
+	}
+	return activities, nil
+}
+
+func (s *fakeStreamStore) SaveStreams(activityID uint, streams database.Streams) error {
+	s.saved[activityID] = streams
+	return nil
+}
+
+// newTestStreamFetcher returns a fetcher for count recent activities without streams, and one
+// from before it fetches in the background, all served by handler.
+func newTestStreamFetcher(t *testing.T, count int, handler http.HandlerFunc) (*StreamFetcher, *fakeStreamStore, *int32, time.Time) {
+	t.Helper()
+	server, requests := countingServer(t, handler)
+	client := newTestClient(server)
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	store := &fakeStreamStore{account: &database.StravaAccount{UserID: 7}, saved: map[uint]database.Streams{}}
+	for i := 1; i <= count+1; i++ {
+		stravaID := int64(100 + i)
+		activity := &database.Activity{UserID: 7, StravaID: &stravaID, ActivityTime: now.Add(-time.Duration(i) * 24 * time.Hour)}
+		if i > count {
+			activity.ActivityTime = now.Add(-streamMaxAge - time.Hour)
+		}
+		activity.ID = uint(i)
+		store.missing = append(store.missing, activity)
+	}
+
+	fetcher := NewStreamFetcher(store, func(account *database.StravaAccount) (*Client, error) {
+		return client, nil
+	})
+	return fetcher, store, requests, now
+}
+
+func TestStreamFetcherSavesStreams(t *testing.T) {
+	fetcher, store, requests, now := newTestStreamFetcher(t, streamBatchSize+2, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"time":{"data":[0,1,2]},"heartrate":{"data":[120,0,131]},"cadence":{"data":[80]}}`))
+	})
+
+	if err := fetcher.RunOnce(context.Background(), now); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	// Every recent activity is fetched, over more than one batch, but not the older one.
+	if len(store.saved) != streamBatchSize+2 || *requests != streamBatchSize+2 {
+		t.Fatalf("saved %d streams with %d requests, want %d", len(store.saved), *requests, streamBatchSize+2)
+	}
+	want := database.Streams{database.StreamTime: {0, 1, 2}, database.StreamHeartRate: {120, 0, 131}}
+	if got := store.saved[1]; !reflect.DeepEqual(got, want) {
+		t.Errorf("saved %v, want %v", got, want)
+	}
+}
+
+func TestStreamFetcherSavesActivitiesWithoutReadings(t *testing.T) {
+	fetcher, store, _, now := newTestStreamFetcher(t, 1, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"Record Not Found"}`))
+	})
+
+	if err := fetcher.RunOnce(context.Background(), now); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	// Saving empty streams keeps the activity from being asked for again.
+	if streams, ok := store.saved[1]; !ok || len(streams) != 0 {
+		t.Errorf("saved %v, %v; want empty streams", streams, ok)
+	}
+}
+
+func TestStreamFetcherKeepsReadsInReserve(t *testing.T) {
+	var used int
+	fetcher, store, requests, now := newTestStreamFetcher(t, 10, func(w http.ResponseWriter, r *http.Request) {
+		used++
+		w.Header().Set("X-ReadRateLimit-Limit", "30,1000")
+		w.Header().Set("X-ReadRateLimit-Usage", strconv.Itoa(20+used)+",500")
+		_, _ = w.Write([]byte(`{"time":{"data":[0]}}`))
+	})
+	fetcher.ReadReserve = 5
+
+	if err := fetcher.RunOnce(context.Background(), now); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	// After the fifth read, only the five kept for users are left in this window.
+	if len(store.saved) != 5 || *requests != 5 {
+		t.Errorf("saved %d streams with %d requests, want 5", len(store.saved), *requests)
+	}
+}
+
+func TestStreamFetcherStopsAtRateLimit(t *testing.T) {
+	fetcher, store, requests, now := newTestStreamFetcher(t, 3, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	err := fetcher.RunOnce(context.Background(), now)
+	var limitErr *RateLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("err = %v, want a RateLimitError", err)
+	}
+	if len(store.saved) != 0 || *requests != 1 {
+		t.Errorf("saved %d streams with %d requests, want none with 1", len(store.saved), *requests)
+	}
+}
@@ -0,0 +1,300 @@
+package strava
+
+import (
+	"context"
+	"errors"
+	"fitness/platform/database"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	defaultSyncInterval = time.Hour
+	defaultPerPage      = 100
+
+	// detailedResource is the resource state of an activity fetched in full.
+	detailedResource = 3
+)
+
+// Syncer copies users' Strava activities into their activity timeline. Each sync lists only the
+// activities that started after the newest one synced before, and activities already synced are
+// updated rather than added again.
+type Syncer struct {
+	StravaRepo *database.StravaRepo
+	StreakRepo *database.StreakRepo
+	// ClientFor returns a client for the athlete of a linked account.
+	ClientFor func(account *database.StravaAccount) (*Client, error)
+	// OnAdded, if set, is called after a sync adds activities for a user.
+	OnAdded func(userID uint)
+
+	// Interval is how often every account is synced. Wake syncs them straight away.
+	Interval time.Duration
+	// PerPage is how many activities are asked for at a time.
+	PerPage int
+
+	wake chan struct{}
+}
+
+// NewSyncer creates a Syncer.
+func NewSyncer(stravaRepo *database.StravaRepo, streakRepo *database.StreakRepo, clientFor func(account *database.StravaAccount) (*Client, error)) *Syncer {
+	return &Syncer{
+		StravaRepo: stravaRepo,
+		StreakRepo: streakRepo,
+		ClientFor:  clientFor,
+		Interval:   defaultSyncInterval,
+		PerPage:    defaultPerPage,
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// Wake makes the syncer sync every account now rather than at its next interval.
+func (s *Syncer) Wake() {
+	if s == nil {
+		return
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start syncs accounts in the background until the context is cancelled.
+func (s *Syncer) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.RunOnce(ctx, time.Now()); err != nil {
+				log.Printf("Strava: failed to sync: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.wake:
+			}
+		}
+	}()
+}
+
+// RunOnce syncs every linked account. A failure with one account is recorded against it and
+// doesn't stop the others, but running out of rate limit leaves the rest for the next sync.
+func (s *Syncer) RunOnce(ctx context.Context, now time.Time) error {
+	accounts, err := s.StravaRepo.GetAccounts()
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		added, err := s.SyncAccount(ctx, account, now)
+		var limitErr *RateLimitError
+		if errors.As(err, &limitErr) || ctx.Err() != nil {
+			return err
+		}
+		if err != nil {
+			log.Printf("Strava: failed to sync athlete %d for user %d: %v", account.AthleteID, account.UserID, err)
+		} else if added > 0 {
+			log.Printf("Strava: synced %d new activities for user %d", added, account.UserID)
+		}
+	}
+	return nil
+}
+
+// SyncAccount fetches an account's activities since its last sync, returning how many were new.
+func (s *Syncer) SyncAccount(ctx context.Context, account *database.StravaAccount, now time.Time) (int, error) {
+	added, through, err := s.syncAccount(ctx, account)
+	if recordErr := s.StravaRepo.RecordSync(account.ID, through, now, err); recordErr != nil {
+		log.Printf("Strava: failed to record sync of account %d: %v", account.ID, recordErr)
+	}
+	if added > 0 {
+		if _, err := s.StreakRepo.RecalculateStreak(account.UserID); err != nil {
+			log.Printf("Strava: failed to recalculate streak for user %d: %v", account.UserID, err)
+		}
+		if s.OnAdded != nil {
+			s.OnAdded(account.UserID)
+		}
+	}
+	return added, err
+}
+
+// syncAccount pages through an account's new activities. It returns the start of the newest
+// one saved, so a sync that fails part way still keeps what it got.
+func (s *Syncer) syncAccount(ctx context.Context, account *database.StravaAccount) (int, *time.Time, error) {
+	client, err := s.ClientFor(account)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	after := time.Unix(0, 0)
+	if account.SyncedThrough != nil {
+		after = *account.SyncedThrough
+	}
+
+	var (
+		added   int
+		through *time.Time
+	)
+	for page := 1; ; page++ {
+		activities, err := client.ListActivities(ctx, after, page, s.PerPage)
+		if err != nil {
+			return added, through, err
+		}
+		for _, summary := range activities {
+			created, err := s.StravaRepo.SaveStravaActivity(summary.ToActivity(account.UserID))
+			if err != nil {
+				return added, through, fmt.Errorf("saving activity %d: %w", summary.Id, err)
+			}
+			if created {
+				added++
+			}
+			if through == nil || summary.StartDate.After(*through) {
+				start := summary.StartDate
+				through = &start
+			}
+		}
+		if len(activities) < s.PerPage {
+			return added, through, nil
+		}
+	}
+}
+
+// SyncActivity fetches one of an account's activities in full, with its splits and laps, and
+// saves it. Lists only give a summary of each activity, so this fills in the rest on demand.
+func (s *Syncer) SyncActivity(ctx context.Context, account *database.StravaAccount, stravaID int64) error {
+	client, err := s.ClientFor(account)
+	if err != nil {
+		return err
+	}
+	activity, err := client.GetActivity(ctx, stravaID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.StravaRepo.SaveStravaActivity(activity.ToActivity(account.UserID)); err != nil {
+		return fmt.Errorf("saving activity %d: %w", stravaID, err)
+	}
+	return nil
+}
+
+// FetchStreams fetches the readings through one of an account's activities. An activity
+// without any, such as one entered by hand, has empty streams.
+func (s *Syncer) FetchStreams(ctx context.Context, account *database.StravaAccount, stravaID int64) (database.Streams, error) {
+	client, err := s.ClientFor(account)
+	if err != nil {
+		return nil, err
+	}
+	return fetchStreams(ctx, client, stravaID)
+}
+
+func fetchStreams(ctx context.Context, client *Client, stravaID int64) (database.Streams, error) {
+	types := make([]string, len(database.StreamKinds))
+	for i, kind := range database.StreamKinds {
+		types[i] = string(kind)
+	}
+	streams, err := client.GetActivityStreams(ctx, stravaID, types)
+	if IsNotFound(err) {
+		return database.Streams{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ToStreams(streams), nil
+}
+
+// ToStreams keeps the streams that have a reading for each time. Without a time stream there is
+// nothing to chart the others against, so none are kept.
+func ToStreams(streams map[string]Stream) database.Streams {
+	times, ok := streams[string(database.StreamTime)]
+	if !ok {
+		return database.Streams{}
+	}
+	kept := database.Streams{}
+	for _, kind := range database.StreamKinds {
+		if stream, ok := streams[string(kind)]; ok && len(stream.Data) == len(times.Data) {
+			kept[kind] = stream.Data
+		}
+	}
+	return kept
+}
+
+// ToActivity turns a Strava activity into one for the user's timeline.
+func (a Activity) ToActivity(userID uint) *database.Activity {
+	stravaID := a.Id
+	start := a.StartDate
+	finish := start.Add(time.Duration(a.ElapsedTime) * time.Second)
+	sportType := a.SportType
+	if sportType == "" {
+		sportType = a.Type
+	}
+	polyline := a.Map.Polyline
+	if polyline == "" {
+		polyline = a.Map.SummaryPolyline
+	}
+
+	return &database.Activity{
+		UserID:              userID,
+		Type:                database.ActivityTypeOf(sportType),
+		SportType:           sportType,
+		Name:                a.Name,
+		Notes:               a.Description,
+		ActivityTime:        start,
+		StartTime:           &start,
+		FinishTime:          &finish,
+		StravaID:            &stravaID,
+		DistanceMeters:      a.Distance,
+		MovingSeconds:       a.MovingTime,
+		ElevationGainMeters: a.TotalElevationGain,
+		Polyline:            polyline,
+		Cardio:              a.cardioDetails(),
+	}
+}
+
+// cardioDetails copies the figures Strava measured. Splits and laps are only in the full
+// activity, which Strava marks with resource state 3.
+func (a Activity) cardioDetails() *database.CardioDetails {
+	details := &database.CardioDetails{
+		ElapsedSeconds:       a.ElapsedTime,
+		AverageSpeed:         database.Speed(a.AverageSpeed),
+		MaxSpeed:             database.Speed(a.MaxSpeed),
+		AverageCadence:       a.AverageCadence,
+		AverageWatts:         a.AverageWatts,
+		WeightedAverageWatts: a.WeightedAverageWatts,
+		MaxWatts:             a.MaxWatts,
+		Kilojoules:           a.Kilojoules,
+		AverageHeartrate:     a.AverageHeartrate,
+		MaxHeartrate:         a.MaxHeartrate,
+		Calories:             a.Calories,
+		Trainer:              a.Trainer,
+		Detailed:             a.ResourceState >= detailedResource,
+	}
+	for _, split := range a.SplitsMetric {
+		details.Splits = append(details.Splits, database.Split{
+			Split:               split.Split,
+			DistanceMeters:      split.Distance,
+			ElapsedSeconds:      split.ElapsedTime,
+			MovingSeconds:       split.MovingTime,
+			ElevationDifference: split.ElevationDifference,
+			AverageSpeed:        database.Speed(split.AverageSpeed),
+			AverageHeartrate:    split.AverageHeartrate,
+			PaceZone:            split.PaceZone,
+		})
+	}
+	for _, lap := range a.Laps {
+		details.Laps = append(details.Laps, database.Lap{
+			LapIndex:            lap.LapIndex,
+			Name:                lap.Name,
+			StartTime:           lap.StartDate,
+			DistanceMeters:      lap.Distance,
+			ElapsedSeconds:      lap.ElapsedTime,
+			MovingSeconds:       lap.MovingTime,
+			ElevationGainMeters: lap.TotalElevationGain,
+			AverageSpeed:        database.Speed(lap.AverageSpeed),
+			MaxSpeed:            database.Speed(lap.MaxSpeed),
+			AverageCadence:      lap.AverageCadence,
+			AverageWatts:        lap.AverageWatts,
+			AverageHeartrate:    lap.AverageHeartrate,
+			MaxHeartrate:        lap.MaxHeartrate,
+		})
+	}
+	return details
+}
@@ -0,0 +1,81 @@
+package strava
+
+import (
+	"context"
+	"encoding/json"
+	"fitness/platform/database"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestToActivityKeepsCardioDetails(t *testing.T) {
+	var full Activity
+	err := json.Unmarshal([]byte(`{"id":12,"resource_state":3,"sport_type":"Run","distance":5400,"moving_time":1620,
+		"elapsed_time":1700,"average_speed":3.333,"average_heartrate":151.2,"calories":410,
+		"splits_metric":[{"split":1,"distance":1000,"moving_time":300,"average_speed":3.333},{"split":6,"distance":400,"moving_time":110,"average_speed":3.6}],
+		"laps":[{"lap_index":1,"name":"Lap 1","distance":5400,"moving_time":1620,"average_heartrate":151.2}]}`), &full)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	activity := full.ToActivity(1)
+	cardio := activity.Cardio
+	if cardio == nil || !cardio.Detailed {
+		t.Fatalf("cardio = %+v, want the full details", cardio)
+	}
+	if len(cardio.Splits) != 2 || len(cardio.Laps) != 1 || cardio.Laps[0].AverageHeartrate != 151.2 {
+		t.Errorf("splits = %+v, laps = %+v", cardio.Splits, cardio.Laps)
+	}
+	if pace := cardio.Splits[0].AverageSpeed.PerKM(); pace != 5*time.Minute {
+		t.Errorf("pace of the first split = %v, want 5m0s", pace)
+	}
+	if activity.CardioKind() != database.CardioRun {
+		t.Errorf("kind = %q, want %q", activity.CardioKind(), database.CardioRun)
+	}
+
+	summary := Activity{Id: 12, ResourceState: 2, SportType: "GravelRide", AverageSpeed: 7.5}
+	activity = summary.ToActivity(1)
+	if activity.Cardio.Detailed || activity.CardioKind() != database.CardioRide {
+		t.Errorf("summary came out detailed = %v, kind %q", activity.Cardio.Detailed, activity.CardioKind())
+	}
+	if kmh := activity.Cardio.AverageSpeed.KMH(); kmh != 27 {
+		t.Errorf("speed = %v km/h, want 27", kmh)
+	}
+}
+
+func TestFetchStreams(t *testing.T) {
+	server, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/activities/12/streams" || r.URL.Query().Get("key_by_type") != "true" {
+			t.Errorf("asked for %s", r.URL)
+		}
+		_, _ = w.Write([]byte(`{
+			"time":{"data":[0,1,2],"series_type":"distance","original_size":3,"resolution":"high"},
+			"distance":{"data":[0,3.1,6.4]},
+			"heartrate":{"data":[120,121]}}`))
+	})
+	syncer := NewSyncer(nil, nil, func(*database.StravaAccount) (*Client, error) { return newTestClient(server), nil })
+
+	streams, err := syncer.FetchStreams(context.Background(), &database.StravaAccount{}, 12)
+	if err != nil {
+		t.Fatalf("FetchStreams: %v", err)
+	}
+	if streams.Len() != 3 || len(streams[database.StreamDistance]) != 3 || streams[database.StreamDistance][2] != 6.4 {
+		t.Errorf("streams = %v", streams)
+	}
+	if _, ok := streams[database.StreamHeartRate]; ok {
+		t.Error("kept a heart rate stream that doesn't line up with the times")
+	}
+}
+
+func TestFetchStreamsOfActivityWithout(t *testing.T) {
+	server, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Record Not Found"}`, http.StatusNotFound)
+	})
+	syncer := NewSyncer(nil, nil, func(*database.StravaAccount) (*Client, error) { return newTestClient(server), nil })
+
+	streams, err := syncer.FetchStreams(context.Background(), &database.StravaAccount{}, 12)
+	if err != nil || streams == nil || streams.Len() != 0 {
+		t.Errorf("streams = %v, %v; want empty streams", streams, err)
+	}
+}
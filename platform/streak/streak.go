@@ -0,0 +1,123 @@
+package streak
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Location is the time zone calendar days are counted in, for streaks and the workout calendar
+// alike. Workout times are entered in the server's local time, so their days are taken from it too.
+var Location = time.Local
+
+// Result holds the streak figures worked out from a user's workout days.
+type Result struct {
+	CurrentDaily     int
+	LongestDaily     int
+	CurrentWeekly    int
+	LongestWeekly    int
+	LastActivityDate *time.Time
+}
+
+// Calculate works out the daily and weekly streaks for a set of workout times.
+//
+// A daily streak survives up to restDays missed days in a row and its length is
+// the number of calendar days from the first workout to the last. A weekly streak
+// is the number of consecutive Monday-based weeks with at least weeklyTarget
+// workouts; the week containing today never breaks the streak while it is still
+// in progress.
+func Calculate(activityTimes []time.Time, today time.Time, restDays, weeklyTarget int) Result {
+	var result Result
+	if len(activityTimes) == 0 {
+		return result
+	}
+	if restDays < 0 {
+		restDays = 0
+	}
+	if weeklyTarget < 1 {
+		weeklyTarget = 1
+	}
+
+	// Collapse the workouts down to one entry per calendar day, counting
+	// workouts per week as we go.
+	seen := make(map[time.Time]bool)
+	weekCounts := make(map[time.Time]int)
+	var days []time.Time
+	for _, t := range activityTimes {
+		day := Day(t)
+		weekCounts[WeekStart(day)]++
+		if !seen[day] {
+			seen[day] = true
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	last := days[len(days)-1]
+	result.LastActivityDate = &last
+
+	// Daily streak
+	runStart := days[0]
+	for i := 1; i < len(days); i++ {
+		if daysBetween(days[i-1], days[i])-1 > restDays {
+			runStart = days[i]
+		}
+		if length := daysBetween(runStart, days[i]) + 1; length > result.LongestDaily {
+			result.LongestDaily = length
+		}
+	}
+	if result.LongestDaily == 0 {
+		result.LongestDaily = 1
+	}
+	if daysBetween(last, Day(today))-1 <= restDays {
+		result.CurrentDaily = daysBetween(runStart, last) + 1
+	}
+
+	// Weekly streak
+	var weeks []time.Time
+	for week, count := range weekCounts {
+		if count >= weeklyTarget {
+			weeks = append(weeks, week)
+		}
+	}
+	sort.Slice(weeks, func(i, j int) bool { return weeks[i].Before(weeks[j]) })
+
+	run := 0
+	for i, week := range weeks {
+		if i > 0 && daysBetween(weeks[i-1], week) == 7 {
+			run++
+		} else {
+			run = 1
+		}
+		if run > result.LongestWeekly {
+			result.LongestWeekly = run
+		}
+	}
+	if len(weeks) > 0 {
+		thisWeek := WeekStart(Day(today))
+		lastWeek := weeks[len(weeks)-1]
+		if gap := daysBetween(lastWeek, thisWeek); gap == 0 || gap == 7 {
+			result.CurrentWeekly = run
+		}
+	}
+
+	return result
+}
+
+// Day truncates a time to midnight at the start of its calendar day in Location.
+func Day(t time.Time) time.Time {
+	y, m, d := t.In(Location).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, Location)
+}
+
+// WeekStart returns the Monday of the week that day falls in.
+func WeekStart(day time.Time) time.Time {
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// daysBetween counts the days from one midnight to another. Days aren't all 24 hours long where
+// the clocks change, so it rounds to the nearest day.
+func daysBetween(from, to time.Time) int {
+	return int(math.Round(to.Sub(from).Hours() / 24))
+}
@@ -0,0 +1,111 @@
+package streak
+
+import (
+	"testing"
+	"time"
+)
+
+// day returns noon on a day in October 2026, which starts on a Thursday. Mondays are the 5th,
+// 12th, 19th and 26th.
+func day(d int) time.Time {
+	return time.Date(2026, 10, d, 12, 0, 0, 0, time.UTC)
+}
+
+func days(ds ...int) []time.Time {
+	times := make([]time.Time, len(ds))
+	for i, d := range ds {
+		times[i] = day(d)
+	}
+	return times
+}
+
+func TestCalculateDaily(t *testing.T) {
+	for _, test := range []struct {
+		name             string
+		workouts         []time.Time
+		today            time.Time
+		restDays         int
+		current, longest int
+	}{
+		{"none", nil, day(10), 1, 0, 0},
+		{"one today", days(10), day(10), 0, 1, 1},
+		{"one yesterday", days(9), day(10), 0, 1, 1},
+		{"run of three", days(8, 9, 10), day(10), 0, 3, 3},
+		{"two a day count once", days(9, 9, 10), day(10), 0, 2, 2},
+		{"a missed day breaks it without rest days", days(6, 7, 9, 10), day(10), 0, 2, 2},
+		{"a rest day keeps it going", days(6, 7, 9, 10), day(10), 1, 5, 5},
+		{"two rest days in a row break it with one allowed", days(1, 2, 5, 6), day(6), 1, 2, 2},
+		{"it lasts through the allowed rest", days(1, 2, 3), day(5), 1, 3, 3},
+		{"and no further", days(1, 2, 3), day(6), 1, 0, 3},
+		{"the longest run was earlier", days(1, 2, 3, 4, 10), day(10), 0, 1, 4},
+		{"negative rest days count as none", days(8, 10), day(10), -2, 1, 1},
+	} {
+		result := Calculate(test.workouts, test.today, test.restDays, 1)
+		if result.CurrentDaily != test.current || result.LongestDaily != test.longest {
+			t.Errorf("%s: daily = %d current, %d longest; want %d, %d",
+				test.name, result.CurrentDaily, result.LongestDaily, test.current, test.longest)
+		}
+	}
+}
+
+func TestCalculateWeekly(t *testing.T) {
+	for _, test := range []struct {
+		name             string
+		workouts         []time.Time
+		today            time.Time
+		target           int
+		current, longest int
+	}{
+		{"one week met", days(5, 7), day(9), 2, 1, 1},
+		{"this week not met yet doesn't break it", days(5, 7, 12), day(13), 2, 1, 1},
+		{"last week missed breaks it", days(5, 7), day(20), 2, 0, 1},
+		{"consecutive weeks", days(5, 7, 12, 14, 19, 20), day(21), 2, 3, 3},
+		{"Sunday and Monday are different weeks", days(11, 12), day(12), 2, 0, 0},
+		{"Sunday belongs to the week before", days(5, 11), day(12), 2, 1, 1},
+		{"a gap week splits the runs", days(1, 2, 12, 19), day(20), 1, 2, 2},
+		{"a target below one counts as one", days(12), day(12), 0, 1, 1},
+	} {
+		result := Calculate(test.workouts, test.today, 1, test.target)
+		if result.CurrentWeekly != test.current || result.LongestWeekly != test.longest {
+			t.Errorf("%s: weekly = %d current, %d longest; want %d, %d",
+				test.name, result.CurrentWeekly, result.LongestWeekly, test.current, test.longest)
+		}
+	}
+}
+
+func TestWeekStart(t *testing.T) {
+	for _, d := range []int{12, 14, 18} {
+		if got := WeekStart(Day(day(d))); !got.Equal(Day(day(12))) {
+			t.Errorf("WeekStart(Oct %d) = %v, want Monday Oct 12", d, got)
+		}
+	}
+}
+
+func TestDayInLocation(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer func(location *time.Location) { Location = location }(Location)
+	Location = newYork
+
+	// A late-evening workout in New York is on the next day in UTC, but counts on the day it was done.
+	evening := time.Date(2026, 10, 13, 3, 30, 0, 0, time.UTC)
+	if got, want := Day(evening), time.Date(2026, 10, 12, 0, 0, 0, 0, newYork); !got.Equal(want) || got.Format("2006-01-02") != "2026-10-12" {
+		t.Errorf("Day(%v) = %v, want %v", evening, got, want)
+	}
+	result := Calculate([]time.Time{evening, time.Date(2026, 10, 12, 16, 0, 0, 0, time.UTC)}, evening, 0, 1)
+	if result.CurrentDaily != 1 || !result.LastActivityDate.Equal(Day(evening)) {
+		t.Errorf("two workouts on the 12th: current %d, last on %v", result.CurrentDaily, result.LastActivityDate)
+	}
+
+	// The clocks go forward on March 8th, making it 23 hours long, which is still one day.
+	dates := []time.Time{
+		time.Date(2026, 3, 7, 9, 0, 0, 0, newYork),
+		time.Date(2026, 3, 8, 9, 0, 0, 0, newYork),
+		time.Date(2026, 3, 9, 9, 0, 0, 0, newYork),
+	}
+	if result := Calculate(dates, dates[2], 0, 1); result.CurrentDaily != 3 || result.LongestDaily != 3 {
+		t.Errorf("across the clocks changing: daily = %d current, %d longest; want 3, 3", result.CurrentDaily, result.LongestDaily)
+	}
+}
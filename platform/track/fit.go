@@ -0,0 +1,263 @@
+package track
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// FIT message and field numbers from the FIT SDK's profile, for the few that are read.
+const (
+	fitMessageSport   = 12
+	fitMessageSession = 18
+	fitMessageRecord  = 20
+
+	fitFieldTimestamp = 253
+
+	fitSportSport   = 0
+	fitSessionSport = 5
+
+	fitRecordLat              = 0
+	fitRecordLng              = 1
+	fitRecordAltitude         = 2
+	fitRecordHeartRate        = 3
+	fitRecordCadence          = 4
+	fitRecordDistance         = 5
+	fitRecordPower            = 7
+	fitRecordEnhancedAltitude = 78
+)
+
+// fitEpoch is when FIT timestamps count from.
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// fitSports are the FIT sports that have a Strava sport type.
+var fitSports = map[uint64]string{
+	1:  "Run",
+	2:  "Ride",
+	5:  "Swim",
+	11: "Walk",
+	15: "Rowing",
+	17: "Hike",
+}
+
+var errFITTruncated = errors.New("the FIT file ends part way through a message")
+
+// fitField is one field of a FIT message definition.
+type fitField struct {
+	number   byte
+	size     int
+	baseType byte
+}
+
+// fitDefinition says how the data messages of one local message type are laid out.
+type fitDefinition struct {
+	global    uint16
+	order     binary.ByteOrder
+	fields    []fitField
+	extraSize int // The size of developer fields, which are skipped
+}
+
+// fitReader reads through the data records of a FIT file.
+type fitReader struct {
+	data        []byte
+	pos         int
+	definitions [16]*fitDefinition
+	timestamp   uint32
+}
+
+func parseFIT(data []byte) (*Track, error) {
+	if len(data) < 12 || string(data[8:12]) != ".FIT" {
+		return nil, errors.New("the file isn't a FIT file")
+	}
+	headerSize := int(data[0])
+	dataSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	if headerSize < 12 || headerSize+dataSize > len(data) {
+		return nil, errFITTruncated
+	}
+
+	r := &fitReader{data: data[:headerSize+dataSize], pos: headerSize}
+	t := &Track{}
+	for {
+		global, values, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if values == nil {
+			return t, nil
+		}
+		switch global {
+		case fitMessageRecord:
+			t.Points = append(t.Points, fitPoint(values, r.timestamp))
+		case fitMessageSession:
+			if sport, ok := fitSports[values[fitSessionSport]]; ok {
+				t.SportType = sport
+			}
+		case fitMessageSport:
+			if sport, ok := fitSports[values[fitSportSport]]; ok && t.SportType == "" {
+				t.SportType = sport
+			}
+		}
+	}
+}
+
+// fitPoint makes a point of a record message's values, scaled as the FIT profile says.
+func fitPoint(values map[byte]uint64, timestamp uint32) Point {
+	point := Point{Time: fitEpoch.Add(time.Duration(timestamp) * time.Second)}
+	lat, hasLat := values[fitRecordLat]
+	lng, hasLng := values[fitRecordLng]
+	if hasLat && hasLng {
+		// Positions are in semicircles, where 2^31 is 180 degrees
+		point.HasPosition = true
+		point.Lat = float64(int32(lat)) * 180 / (1 << 31)
+		point.Lng = float64(int32(lng)) * 180 / (1 << 31)
+	}
+	altitude, ok := values[fitRecordEnhancedAltitude]
+	if !ok {
+		altitude, ok = values[fitRecordAltitude]
+	}
+	if ok {
+		meters := float64(altitude)/5 - 500
+		point.Altitude = &meters
+	}
+	if distance, ok := values[fitRecordDistance]; ok {
+		meters := float64(distance) / 100
+		point.Distance = &meters
+	}
+	point.HeartRate = int(values[fitRecordHeartRate])
+	point.Cadence = int(values[fitRecordCadence])
+	point.Power = int(values[fitRecordPower])
+	return point
+}
+
+// next reads the next data message, taking in any definitions before it. It returns the
+// message's global number and its valid fields, or nil fields at the end of the file.
+func (r *fitReader) next() (uint16, map[byte]uint64, error) {
+	for r.pos < len(r.data) {
+		header := r.data[r.pos]
+		r.pos++
+
+		if header&0x80 != 0 {
+			// A compressed timestamp header gives the time as an offset from the last full one
+			offset := uint32(header & 0x1f)
+			timestamp := r.timestamp&^0x1f | offset
+			if offset < r.timestamp&0x1f {
+				timestamp += 0x20
+			}
+			r.timestamp = timestamp
+			return r.readData(int(header>>5) & 0x3)
+		}
+		local := int(header & 0x0f)
+		if header&0x40 == 0 {
+			return r.readData(local)
+		}
+		if err := r.define(local, header&0x20 != 0); err != nil {
+			return 0, nil, err
+		}
+	}
+	return 0, nil, nil
+}
+
+// define reads a definition message for a local message type.
+func (r *fitReader) define(local int, developer bool) error {
+	if r.pos+5 > len(r.data) {
+		return errFITTruncated
+	}
+	definition := &fitDefinition{order: binary.LittleEndian}
+	if r.data[r.pos+1] == 1 {
+		definition.order = binary.BigEndian
+	}
+	definition.global = definition.order.Uint16(r.data[r.pos+2:])
+	count := int(r.data[r.pos+4])
+	r.pos += 5
+	if r.pos+3*count > len(r.data) {
+		return errFITTruncated
+	}
+	for i := 0; i < count; i++ {
+		definition.fields = append(definition.fields, fitField{
+			number:   r.data[r.pos],
+			size:     int(r.data[r.pos+1]),
+			baseType: r.data[r.pos+2],
+		})
+		r.pos += 3
+	}
+	if developer {
+		if r.pos >= len(r.data) {
+			return errFITTruncated
+		}
+		count := int(r.data[r.pos])
+		r.pos++
+		if r.pos+3*count > len(r.data) {
+			return errFITTruncated
+		}
+		for i := 0; i < count; i++ {
+			definition.extraSize += int(r.data[r.pos+1])
+			r.pos += 3
+		}
+	}
+	r.definitions[local] = definition
+	return nil
+}
+
+// readData reads a data message laid out by a local message type's definition.
+func (r *fitReader) readData(local int) (uint16, map[byte]uint64, error) {
+	definition := r.definitions[local]
+	if definition == nil {
+		return 0, nil, fmt.Errorf("the FIT file uses message type %d before defining it", local)
+	}
+
+	values := map[byte]uint64{}
+	for _, field := range definition.fields {
+		if r.pos+field.size > len(r.data) {
+			return 0, nil, errFITTruncated
+		}
+		raw := r.data[r.pos : r.pos+field.size]
+		r.pos += field.size
+
+		var value uint64
+		switch field.size {
+		case 1:
+			value = uint64(raw[0])
+		case 2:
+			value = uint64(definition.order.Uint16(raw))
+		case 4:
+			value = uint64(definition.order.Uint32(raw))
+		case 8:
+			value = definition.order.Uint64(raw)
+		default:
+			// Strings and arrays aren't needed
+			continue
+		}
+		if !fitValid(value, field) {
+			continue
+		}
+		values[field.number] = value
+		if field.number == fitFieldTimestamp {
+			r.timestamp = uint32(value)
+		}
+	}
+	if r.pos+definition.extraSize > len(r.data) {
+		return 0, nil, errFITTruncated
+	}
+	r.pos += definition.extraSize
+	return definition.global, values, nil
+}
+
+// fitValid reports whether a value was recorded. FIT marks a missing value with the largest
+// value of its type, or zero for the types whose names end in z.
+func fitValid(value uint64, field fitField) bool {
+	bits := uint(field.size * 8)
+	switch field.baseType & 0x1f {
+	case 1, 3, 5, 14: // sint8, sint16, sint32, sint64
+		return value != 1<<(bits-1)-1
+	case 10, 11, 12, 16: // uint8z, uint16z, uint32z, uint64z
+		return value != 0
+	case 8, 9: // float32 and float64, which none of the fields read are
+		return false
+	}
+	if bits == 64 {
+		return value != math.MaxUint64
+	}
+	return value != 1<<bits-1
+}
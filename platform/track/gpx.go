@@ -0,0 +1,82 @@
+package track
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// gpxFile is the part of a GPX file a track is read from. Heart rate and cadence come from
+// Garmin's track point extension, which Strava and most devices write.
+type gpxFile struct {
+	Name   string `xml:"metadata>name"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Type     string `xml:"type"`
+		Desc     string `xml:"desc"`
+		Segments []struct {
+			Points []struct {
+				Lat       float64  `xml:"lat,attr"`
+				Lon       float64  `xml:"lon,attr"`
+				Elevation *float64 `xml:"ele"`
+				Time      string   `xml:"time"`
+				HeartRate int      `xml:"extensions>TrackPointExtension>hr"`
+				Cadence   int      `xml:"extensions>TrackPointExtension>cad"`
+				Power     int      `xml:"extensions>power"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+func parseGPX(data []byte) (*Track, error) {
+	var file gpxFile
+	if err := decodeXML(data, &file); err != nil {
+		return nil, fmt.Errorf("the GPX file can't be read: %w", err)
+	}
+
+	t := &Track{Name: file.Name}
+	for _, trk := range file.Tracks {
+		if trk.Name != "" {
+			t.Name = trk.Name
+		}
+		if sport := sportTypeOf(trk.Type); sport != "" {
+			t.SportType = sport
+		}
+		if desc := strings.TrimSpace(trk.Desc); desc != "" {
+			t.Notes = desc
+		}
+		for _, segment := range trk.Segments {
+			for _, trkpt := range segment.Points {
+				point := Point{
+					HasPosition: true,
+					Lat:         trkpt.Lat,
+					Lng:         trkpt.Lon,
+					Altitude:    trkpt.Elevation,
+					HeartRate:   trkpt.HeartRate,
+					Cadence:     trkpt.Cadence,
+					Power:       trkpt.Power,
+				}
+				point.Time, _ = parseXMLTime(trkpt.Time)
+				t.Points = append(t.Points, point)
+			}
+		}
+	}
+	return t, nil
+}
+
+// decodeXML reads an XML file, tolerating the byte order mark some devices start it with.
+func decodeXML(data []byte, v interface{}) error {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// Some devices declare a charset such as ISO-8859-1, but only ever write ASCII in it
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) { return input, nil }
+	return decoder.Decode(v)
+}
+
+// parseXMLTime reads a time as GPX and TCX files write them.
+func parseXMLTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(value))
+}
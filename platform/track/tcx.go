@@ -0,0 +1,59 @@
+package track
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tcxFile is the part of a Training Center file a track is read from. Power and running cadence
+// come from Garmin's activity extension.
+type tcxFile struct {
+	Activities []struct {
+		Sport string `xml:"Sport,attr"`
+		Notes string `xml:"Notes"`
+		Laps  []struct {
+			Points []struct {
+				Time       string   `xml:"Time"`
+				Lat        *float64 `xml:"Position>LatitudeDegrees"`
+				Lng        *float64 `xml:"Position>LongitudeDegrees"`
+				Altitude   *float64 `xml:"AltitudeMeters"`
+				Distance   *float64 `xml:"DistanceMeters"`
+				HeartRate  int      `xml:"HeartRateBpm>Value"`
+				Cadence    int      `xml:"Cadence"`
+				RunCadence int      `xml:"Extensions>TPX>RunCadence"`
+				Watts      int      `xml:"Extensions>TPX>Watts"`
+			} `xml:"Track>Trackpoint"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+func parseTCX(data []byte) (*Track, error) {
+	var file tcxFile
+	if err := decodeXML(data, &file); err != nil {
+		return nil, fmt.Errorf("the TCX file can't be read: %w", err)
+	}
+	if len(file.Activities) == 0 {
+		return nil, fmt.Errorf("the TCX file has no activity in it")
+	}
+
+	// A file can hold several activities, but devices only ever write one
+	activity := file.Activities[0]
+	t := &Track{SportType: sportTypeOf(activity.Sport), Notes: strings.TrimSpace(activity.Notes)}
+	for _, lap := range activity.Laps {
+		for _, trackpoint := range lap.Points {
+			point := Point{
+				Altitude:  trackpoint.Altitude,
+				Distance:  trackpoint.Distance,
+				HeartRate: trackpoint.HeartRate,
+				Cadence:   max(trackpoint.Cadence, trackpoint.RunCadence),
+				Power:     trackpoint.Watts,
+			}
+			if trackpoint.Lat != nil && trackpoint.Lng != nil {
+				point.HasPosition, point.Lat, point.Lng = true, *trackpoint.Lat, *trackpoint.Lng
+			}
+			point.Time, _ = parseXMLTime(trackpoint.Time)
+			t.Points = append(t.Points, point)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,393 @@
+// Package track reads activities recorded on a watch or bike computer from GPX, TCX and FIT
+// files, and works out the distance, times, elevation and pace they add up to.
+package track
+
+import (
+	"bytes"
+	"errors"
+	"fitness/platform/database"
+	"fitness/platform/geo"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// movingSpeed is the slowest a stretch can go, in metres per second, and still count as
+	// moving. Slower than that is standing at a crossing or a stop on a ride.
+	movingSpeed = 0.5
+	// climbThreshold is how far, in metres, altitude has to rise before it counts as a climb,
+	// so the noise in GPS and barometric readings doesn't add up to hills that aren't there.
+	climbThreshold = 2.0
+	// maxSpeedWindow is the shortest time max speed is measured over, to smooth out GPS jumps.
+	maxSpeedWindow = 5 * time.Second
+	// routeSpacing is how close together, in metres, route points are kept in the polyline.
+	routeSpacing = 5.0
+)
+
+// ErrUnknownFormat is returned by Detect for a file that isn't GPX, TCX or FIT.
+var ErrUnknownFormat = errors.New("the file isn't a GPX, TCX or FIT file")
+
+// Point is one reading along a track. Readings the device didn't take are zero, or nil for
+// altitude and distance, where zero is a real value.
+type Point struct {
+	Time        time.Time
+	HasPosition bool
+	Lat         float64
+	Lng         float64
+	Altitude    *float64
+	Distance    *float64 // How far the device says it had gone, in metres
+	HeartRate   int
+	Cadence     int
+	Power       int
+}
+
+// Track is a recorded activity.
+type Track struct {
+	Name string
+	// SportType is the sport in the form Strava uses, such as "Run" or "Ride".
+	SportType string
+	Notes     string
+	Points    []Point
+}
+
+// Detect tells which of the track formats a file is in.
+func Detect(data []byte) (database.DataFormat, error) {
+	if len(data) >= 12 && string(data[8:12]) == ".FIT" {
+		return database.DataFormatFIT, nil
+	}
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	switch {
+	case bytes.Contains(head, []byte("<gpx")):
+		return database.DataFormatGPX, nil
+	case bytes.Contains(head, []byte("<TrainingCenterDatabase")):
+		return database.DataFormatTCX, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// Parse reads a track from a file in the given format.
+func Parse(data []byte, format database.DataFormat) (*Track, error) {
+	var (
+		t   *Track
+		err error
+	)
+	switch format {
+	case database.DataFormatGPX:
+		t, err = parseGPX(data)
+	case database.DataFormatTCX:
+		t, err = parseTCX(data)
+	case database.DataFormatFIT:
+		t, err = parseFIT(data)
+	default:
+		return nil, fmt.Errorf("%q isn't a track format", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Points without a time can't be placed, which is how planned routes are saved
+	points := t.Points[:0]
+	for _, point := range t.Points {
+		if !point.Time.IsZero() {
+			points = append(points, point)
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	t.Points = points
+	if len(t.Points) < 2 {
+		return nil, errors.New("the file has no recorded track in it")
+	}
+	if t.SportType == "" {
+		t.SportType = "Workout"
+	}
+	return t, nil
+}
+
+// sportTypeOf turns a sport as a file names it, such as "running" or "Biking", into a Strava
+// sport type.
+func sportTypeOf(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.Contains(name, "run"):
+		return "Run"
+	case strings.Contains(name, "cycl"), strings.Contains(name, "bik"), strings.Contains(name, "ride"):
+		return "Ride"
+	case strings.Contains(name, "swim"):
+		return "Swim"
+	case strings.Contains(name, "walk"):
+		return "Walk"
+	case strings.Contains(name, "hik"):
+		return "Hike"
+	case strings.Contains(name, "row"):
+		return "Rowing"
+	}
+	return ""
+}
+
+// Start is when the track began.
+func (t *Track) Start() time.Time {
+	return t.Points[0].Time
+}
+
+// distances returns how far along the track each point is. The device's own distance is used
+// when it recorded one, as it is usually steadier than adding up GPS positions.
+func (t *Track) distances() []float64 {
+	distances := make([]float64, len(t.Points))
+	recorded := t.Points[len(t.Points)-1].Distance != nil
+	for i := 1; i < len(t.Points); i++ {
+		point, previous := t.Points[i], t.Points[i-1]
+		switch {
+		case recorded && point.Distance != nil:
+			distances[i] = math.Max(*point.Distance, distances[i-1])
+		case point.HasPosition && previous.HasPosition:
+			distances[i] = distances[i-1] + geo.Distance(previous.position(), point.position())
+		default:
+			distances[i] = distances[i-1]
+		}
+	}
+	return distances
+}
+
+// ToActivity works out what the track adds up to and makes a finished activity of it.
+func (t *Track) ToActivity(userID uint) *database.Activity {
+	distances := t.distances()
+	total := distances[len(distances)-1]
+	start, finish := t.Start(), t.Points[len(t.Points)-1].Time
+	elapsed := finish.Sub(start)
+
+	moving := time.Duration(0)
+	for i := 1; i < len(t.Points); i++ {
+		dt := t.Points[i].Time.Sub(t.Points[i-1].Time)
+		if dt > 0 && (distances[i]-distances[i-1])/dt.Seconds() >= movingSpeed {
+			moving += dt
+		}
+	}
+	if total == 0 {
+		// Nothing says how far it went, as on a treadmill without a footpod, so it all counts
+		moving = elapsed
+	}
+
+	details := &database.CardioDetails{
+		ElapsedSeconds: int(elapsed.Seconds()),
+		MaxSpeed:       database.Speed(t.maxSpeed(distances)),
+		Detailed:       true,
+		Splits:         t.splits(distances),
+	}
+	if moving > 0 {
+		details.AverageSpeed = database.Speed(total / moving.Seconds())
+	}
+	details.AverageHeartrate, details.MaxHeartrate = t.average(func(p Point) int { return p.HeartRate })
+	details.AverageCadence, _ = t.average(func(p Point) int { return p.Cadence })
+	var maxWatts float64
+	details.AverageWatts, maxWatts = t.averagePower()
+	details.MaxWatts = int(maxWatts)
+
+	name := t.Name
+	if name == "" {
+		name = t.SportType
+	}
+	return &database.Activity{
+		UserID:              userID,
+		Type:                database.ActivityTypeOf(t.SportType),
+		SportType:           t.SportType,
+		Name:                name,
+		Notes:               t.Notes,
+		ActivityTime:        start,
+		StartTime:           &start,
+		FinishTime:          &finish,
+		DistanceMeters:      total,
+		MovingSeconds:       int(moving.Seconds()),
+		ElevationGainMeters: t.elevationGain(),
+		Polyline:            t.polyline(),
+		Cardio:              details,
+	}
+}
+
+// Streams returns the readings through the track, with a stream for each kind of reading the
+// device took. Speed is smoothed over maxSpeedWindow, as it is for max speed.
+func (t *Track) Streams() database.Streams {
+	distances := t.distances()
+	start := t.Start()
+	streams := database.Streams{}
+	add := func(kind database.StreamKind, reading func(i int, p Point) (float64, bool)) {
+		values := make([]float64, len(t.Points))
+		taken := false
+		for i, point := range t.Points {
+			value, ok := reading(i, point)
+			values[i] = value
+			taken = taken || ok
+		}
+		if taken {
+			streams[kind] = values
+		}
+	}
+
+	add(database.StreamTime, func(_ int, p Point) (float64, bool) { return p.Time.Sub(start).Seconds(), true })
+	if distances[len(distances)-1] > 0 {
+		add(database.StreamDistance, func(i int, _ Point) (float64, bool) { return distances[i], true })
+		from := 0
+		add(database.StreamSpeed, func(i int, p Point) (float64, bool) {
+			for from < i-1 && p.Time.Sub(t.Points[from+1].Time) >= maxSpeedWindow {
+				from++
+			}
+			if dt := p.Time.Sub(t.Points[from].Time); dt > 0 {
+				return (distances[i] - distances[from]) / dt.Seconds(), true
+			}
+			return 0, true
+		})
+	}
+	add(database.StreamAltitude, func(_ int, p Point) (float64, bool) {
+		if p.Altitude == nil {
+			return 0, false
+		}
+		return *p.Altitude, true
+	})
+	add(database.StreamHeartRate, func(_ int, p Point) (float64, bool) { return float64(p.HeartRate), p.HeartRate > 0 })
+	add(database.StreamCadence, func(_ int, p Point) (float64, bool) { return float64(p.Cadence), p.Cadence > 0 })
+	add(database.StreamWatts, func(_ int, p Point) (float64, bool) { return float64(p.Power), p.Power > 0 })
+	return streams
+}
+
+// average returns the mean and highest of a reading over the points that have it.
+func (t *Track) average(reading func(Point) int) (float64, float64) {
+	var sum, count, highest int
+	for _, point := range t.Points {
+		if value := reading(point); value > 0 {
+			sum += value
+			count++
+			highest = max(highest, value)
+		}
+	}
+	if count == 0 {
+		return 0, 0
+	}
+	return float64(sum) / float64(count), float64(highest)
+}
+
+// averagePower returns the mean and highest power. Unlike heart rate, zero power is a real reading,
+// from freewheeling, so every point counts once the device reads power at all.
+func (t *Track) averagePower() (float64, float64) {
+	var sum, highest int
+	for _, point := range t.Points {
+		sum += point.Power
+		highest = max(highest, point.Power)
+	}
+	if highest == 0 {
+		return 0, 0
+	}
+	return float64(sum) / float64(len(t.Points)), float64(highest)
+}
+
+// elevationGain adds up the climbs along the track, ignoring rises smaller than climbThreshold.
+func (t *Track) elevationGain() float64 {
+	var (
+		gain      float64
+		reference *float64
+	)
+	for _, point := range t.Points {
+		altitude := point.Altitude
+		switch {
+		case altitude == nil:
+		case reference == nil, *altitude < *reference:
+			reference = altitude
+		case *altitude-*reference >= climbThreshold:
+			gain += *altitude - *reference
+			reference = altitude
+		}
+	}
+	return gain
+}
+
+// maxSpeed is the fastest the track went over any stretch of at least maxSpeedWindow.
+func (t *Track) maxSpeed(distances []float64) float64 {
+	var fastest float64
+	from := 0
+	for to := 1; to < len(t.Points); to++ {
+		for from < to-1 && t.Points[to].Time.Sub(t.Points[from+1].Time) >= maxSpeedWindow {
+			from++
+		}
+		dt := t.Points[to].Time.Sub(t.Points[from].Time)
+		if dt >= maxSpeedWindow {
+			fastest = math.Max(fastest, (distances[to]-distances[from])/dt.Seconds())
+		}
+	}
+	return fastest
+}
+
+// splits cuts the track into kilometres, with a shorter one for whatever is left at the end.
+func (t *Track) splits(distances []float64) []database.Split {
+	var splits []database.Split
+	begin := 0
+	for i := 1; i < len(t.Points); i++ {
+		last := i == len(t.Points)-1
+		if distances[i] < float64(len(splits)+1)*1000 && !last {
+			continue
+		}
+		if distances[i] == distances[begin] {
+			break
+		}
+		split := database.Split{
+			Split:          len(splits) + 1,
+			DistanceMeters: distances[i] - distances[begin],
+			ElapsedSeconds: int(t.Points[i].Time.Sub(t.Points[begin].Time).Seconds()),
+		}
+		var moving time.Duration
+		var heartRate, readings int
+		for j := begin + 1; j <= i; j++ {
+			dt := t.Points[j].Time.Sub(t.Points[j-1].Time)
+			if dt > 0 && (distances[j]-distances[j-1])/dt.Seconds() >= movingSpeed {
+				moving += dt
+			}
+			if t.Points[j].HeartRate > 0 {
+				heartRate += t.Points[j].HeartRate
+				readings++
+			}
+		}
+		split.MovingSeconds = int(moving.Seconds())
+		if moving > 0 {
+			split.AverageSpeed = database.Speed(split.DistanceMeters / moving.Seconds())
+		}
+		if readings > 0 {
+			split.AverageHeartrate = float64(heartRate) / float64(readings)
+		}
+		if from, to := t.Points[begin].Altitude, t.Points[i].Altitude; from != nil && to != nil {
+			split.ElevationDifference = *to - *from
+		}
+		splits = append(splits, split)
+		begin = i
+	}
+	return splits
+}
+
+// polyline encodes the route, leaving out points too close to the last one kept to matter on a
+// map. It is empty for a track without positions.
+func (t *Track) polyline() string {
+	var (
+		route []geo.Point
+		last  Point
+	)
+	for i, point := range t.Points {
+		if !point.HasPosition {
+			continue
+		}
+		if len(route) > 0 && geo.Distance(last.position(), point.position()) < routeSpacing && i < len(t.Points)-1 {
+			continue
+		}
+		route = append(route, point.position())
+		last = point
+	}
+	if len(route) < 2 {
+		return ""
+	}
+	return geo.EncodePolyline(route)
+}
+
+func (p Point) position() geo.Point {
+	return geo.Point{Lat: p.Lat, Lng: p.Lng}
+}
@@ -0,0 +1,259 @@
+package track
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fitness/platform/database"
+	"fitness/platform/geo"
+	"math"
+	"testing"
+	"time"
+)
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx creator="StravaGPX" version="1.1" xmlns="http://www.topografix.com/GPX/1/1"
+     xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1">
+ <metadata><time>2026-10-18T07:00:00Z</time></metadata>
+ <trk>
+  <name>Morning Run</name>
+  <type>running</type>
+  <trkseg>
+   <trkpt lat="51.50000" lon="-0.10000"><ele>10.0</ele><time>2026-10-18T07:00:00Z</time>
+    <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>120</gpxtpx:hr><gpxtpx:cad>80</gpxtpx:cad></gpxtpx:TrackPointExtension></extensions></trkpt>
+   <trkpt lat="51.50450" lon="-0.10000"><ele>15.0</ele><time>2026-10-18T07:02:30Z</time>
+    <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>150</gpxtpx:hr><gpxtpx:cad>90</gpxtpx:cad></gpxtpx:TrackPointExtension></extensions></trkpt>
+   <trkpt lat="51.50450" lon="-0.10000"><ele>15.5</ele><time>2026-10-18T07:03:30Z</time></trkpt>
+   <trkpt lat="51.50900" lon="-0.10000"><ele>11.0</ele><time>2026-10-18T07:06:00Z</time>
+    <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>160</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt>
+  </trkseg>
+ </trk>
+</gpx>`
+
+func TestParseGPX(t *testing.T) {
+	track := parse(t, []byte(testGPX), database.DataFormatGPX)
+	if track.Name != "Morning Run" || track.SportType != "Run" || len(track.Points) != 4 {
+		t.Fatalf("track = %q, %q with %d points", track.Name, track.SportType, len(track.Points))
+	}
+
+	activity := track.ToActivity(7)
+	// Two stretches of 0.0045 degrees of latitude, about 500 m each, with a minute's stop between
+	if math.Abs(activity.DistanceMeters-1000.8) > 1 {
+		t.Errorf("distance = %v, want about 1000.8", activity.DistanceMeters)
+	}
+	if activity.MovingSeconds != 300 || activity.Cardio.ElapsedSeconds != 360 {
+		t.Errorf("moving = %d s, elapsed = %d s, want 300 and 360", activity.MovingSeconds, activity.Cardio.ElapsedSeconds)
+	}
+	// The half metre rise while stopped is too small to count
+	if activity.ElevationGainMeters != 5 {
+		t.Errorf("elevation gain = %v, want 5", activity.ElevationGainMeters)
+	}
+	if activity.Cardio.AverageHeartrate != 430.0/3 || activity.Cardio.MaxHeartrate != 160 || activity.Cardio.AverageCadence != 85 {
+		t.Errorf("heart rate = %v avg, %v max, cadence = %v", activity.Cardio.AverageHeartrate, activity.Cardio.MaxHeartrate, activity.Cardio.AverageCadence)
+	}
+	if activity.Type != "RUN" || activity.UserID != 7 || !activity.StartTime.Equal(time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("activity = %s for user %d at %v", activity.Type, activity.UserID, activity.StartTime)
+	}
+	if len(activity.Cardio.Splits) != 1 || activity.Cardio.Splits[0].MovingSeconds != 300 || activity.Cardio.Splits[0].AverageHeartrate != 155 {
+		t.Errorf("splits = %+v", activity.Cardio.Splits)
+	}
+
+	route, err := geo.DecodePolyline(activity.Polyline)
+	if err != nil || len(route) != 3 {
+		t.Fatalf("route = %v, %v; want the three distinct points", route, err)
+	}
+}
+
+const testTCX = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2" xmlns:ns3="http://www.garmin.com/xmlschemas/ActivityExtension/v2">
+ <Activities>
+  <Activity Sport="Biking">
+   <Id>2026-10-18T17:00:00Z</Id>
+   <Lap StartTime="2026-10-18T17:00:00Z">
+    <Track>
+     <Trackpoint><Time>2026-10-18T17:00:00Z</Time><DistanceMeters>0</DistanceMeters><HeartRateBpm><Value>110</Value></HeartRateBpm>
+      <Extensions><ns3:TPX><ns3:Watts>150</ns3:Watts></ns3:TPX></Extensions></Trackpoint>
+     <Trackpoint><Time>2026-10-18T17:01:00Z</Time><DistanceMeters>500</DistanceMeters><HeartRateBpm><Value>130</Value></HeartRateBpm>
+      <Extensions><ns3:TPX><ns3:Watts>250</ns3:Watts></ns3:TPX></Extensions></Trackpoint>
+     <Trackpoint><Time>2026-10-18T17:01:30Z</Time><DistanceMeters>800</DistanceMeters><HeartRateBpm><Value>0</Value></HeartRateBpm>
+      <Extensions><ns3:TPX><ns3:Watts>0</ns3:Watts></ns3:TPX></Extensions></Trackpoint>
+     <Trackpoint><Time>2026-10-18T17:02:00Z</Time><DistanceMeters>1200</DistanceMeters>
+      <Extensions><ns3:TPX><ns3:Watts>200</ns3:Watts></ns3:TPX></Extensions></Trackpoint>
+    </Track>
+   </Lap>
+   <Notes>Turbo session</Notes>
+  </Activity>
+ </Activities>
+</TrainingCenterDatabase>`
+
+func TestParseTCXWithoutPositions(t *testing.T) {
+	track := parse(t, []byte(testTCX), database.DataFormatTCX)
+	activity := track.ToActivity(1)
+	if activity.SportType != "Ride" || activity.Name != "Ride" || activity.Notes != "Turbo session" {
+		t.Errorf("activity = %q %q %q", activity.SportType, activity.Name, activity.Notes)
+	}
+	if activity.DistanceMeters != 1200 || activity.MovingSeconds != 120 || activity.Polyline != "" {
+		t.Errorf("distance = %v, moving = %d, polyline = %q", activity.DistanceMeters, activity.MovingSeconds, activity.Polyline)
+	}
+	// Freewheeling at zero watts counts towards the average power, but the heart rate gap doesn't.
+	if activity.Cardio.AverageWatts != 150 || activity.Cardio.MaxWatts != 250 || activity.Cardio.AverageHeartrate != 120 {
+		t.Errorf("cardio = %+v", activity.Cardio)
+	}
+	if kmh := activity.Cardio.AverageSpeed.KMH(); kmh != 36 {
+		t.Errorf("speed = %v km/h, want 36", kmh)
+	}
+}
+
+func TestStreams(t *testing.T) {
+	streams := parse(t, []byte(testGPX), database.DataFormatGPX).Streams()
+	if got := streams[database.StreamTime]; len(got) != 4 || got[3] != 360 {
+		t.Fatalf("times = %v", got)
+	}
+	if _, ok := streams[database.StreamWatts]; ok {
+		t.Error("a power stream was made without any power readings")
+	}
+	if hr := streams[database.StreamHeartRate]; hr[2] != 0 || hr[3] != 160 {
+		t.Errorf("heart rate = %v", hr)
+	}
+	if speed := streams[database.StreamSpeed]; speed[2] != 0 || math.Abs(speed[1]-500.4/150) > 0.01 {
+		t.Errorf("speed = %v", speed)
+	}
+
+	// They are stored to the decimetre and the centimetre a second
+	value, err := streams.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored database.Streams
+	if err := stored.Scan(value); err != nil {
+		t.Fatal(err)
+	}
+	for kind, values := range streams {
+		for i, want := range values {
+			if got := stored[kind][i]; math.Abs(got-want) > 0.05 {
+				t.Errorf("%s[%d] = %v after storing, want %v", kind, i, got, want)
+			}
+		}
+	}
+
+	// The first half of the time has the first two readings, and the second half the others
+	downsampled := streams.Downsample(2)
+	if downsampled.Len() != 2 || downsampled[database.StreamTime][1] != 285 || downsampled[database.StreamHeartRate][0] != 135 {
+		t.Errorf("downsampled = %v", downsampled)
+	}
+}
+
+// fitBuilder writes small FIT files for tests.
+type fitBuilder struct {
+	body bytes.Buffer
+}
+
+func (b *fitBuilder) define(local byte, global uint16, fields ...[3]byte) {
+	b.body.WriteByte(0x40 | local)
+	b.body.Write([]byte{0, 0})
+	_ = binary.Write(&b.body, binary.LittleEndian, global)
+	b.body.WriteByte(byte(len(fields)))
+	for _, field := range fields {
+		b.body.Write(field[:])
+	}
+}
+
+func (b *fitBuilder) data(header byte, values ...interface{}) {
+	b.body.WriteByte(header)
+	for _, value := range values {
+		_ = binary.Write(&b.body, binary.LittleEndian, value)
+	}
+}
+
+func (b *fitBuilder) bytes() []byte {
+	var file bytes.Buffer
+	file.Write([]byte{14, 0x20, 0x08, 0x08})
+	_ = binary.Write(&file, binary.LittleEndian, uint32(b.body.Len()))
+	file.WriteString(".FIT")
+	file.Write([]byte{0, 0})
+	file.Write(b.body.Bytes())
+	file.Write([]byte{0, 0}) // CRC, which isn't checked
+	return file.Bytes()
+}
+
+func semicircles(degrees float64) int32 {
+	return int32(math.Round(degrees * (1 << 31) / 180))
+}
+
+func TestParseFIT(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	timestamp := uint32(start.Sub(fitEpoch).Seconds())
+
+	var b fitBuilder
+	b.define(0, fitMessageRecord,
+		[3]byte{fitFieldTimestamp, 4, 0x86},
+		[3]byte{fitRecordLat, 4, 0x85},
+		[3]byte{fitRecordLng, 4, 0x85},
+		[3]byte{fitRecordAltitude, 2, 0x84},
+		[3]byte{fitRecordHeartRate, 1, 0x02},
+		[3]byte{fitRecordDistance, 4, 0x86},
+	)
+	b.data(0x00, timestamp, semicircles(51.5), semicircles(-0.1), uint16((20+500)*5), uint8(140), uint32(0))
+	// No heart rate in this one, and only a compressed timestamp header 10 seconds on
+	b.define(2, fitMessageRecord,
+		[3]byte{fitRecordLat, 4, 0x85},
+		[3]byte{fitRecordLng, 4, 0x85},
+		[3]byte{fitRecordAltitude, 2, 0x84},
+		[3]byte{fitRecordHeartRate, 1, 0x02},
+		[3]byte{fitRecordDistance, 4, 0x86},
+	)
+	b.data(0x80|2<<5|byte((timestamp+10)&0x1f), semicircles(51.5005), semicircles(-0.1), uint16((25+500)*5), uint8(0xff), uint32(5600))
+	b.define(1, fitMessageSession, [3]byte{fitSessionSport, 1, 0x00})
+	b.data(0x01, uint8(1))
+
+	track := parse(t, b.bytes(), database.DataFormatFIT)
+	if track.SportType != "Run" || len(track.Points) != 2 {
+		t.Fatalf("track = %q with %d points", track.SportType, len(track.Points))
+	}
+	second := track.Points[1]
+	if !second.Time.Equal(start.Add(10*time.Second)) || second.HeartRate != 0 || *second.Altitude != 25 || *second.Distance != 56 {
+		t.Errorf("second point = %+v", second)
+	}
+	if math.Abs(second.Lat-51.5005) > 1e-6 || math.Abs(second.Lng+0.1) > 1e-6 {
+		t.Errorf("position = %v, %v", second.Lat, second.Lng)
+	}
+
+	activity := track.ToActivity(1)
+	if activity.DistanceMeters != 56 || activity.ElevationGainMeters != 5 || activity.Cardio.MaxHeartrate != 140 {
+		t.Errorf("distance = %v, gain = %v, max heart rate = %v", activity.DistanceMeters, activity.ElevationGainMeters, activity.Cardio.MaxHeartrate)
+	}
+}
+
+func TestParseFITTruncated(t *testing.T) {
+	var b fitBuilder
+	b.define(0, fitMessageRecord, [3]byte{fitFieldTimestamp, 4, 0x86})
+	data := b.bytes()
+	binary.LittleEndian.PutUint32(data[4:8], uint32(len(data)))
+	if _, err := Parse(data, database.DataFormatFIT); err == nil {
+		t.Error("a FIT file shorter than its header says was read")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	var b fitBuilder
+	for data, want := range map[string]database.DataFormat{
+		testGPX:           database.DataFormatGPX,
+		testTCX:           database.DataFormatTCX,
+		string(b.bytes()): database.DataFormatFIT,
+	} {
+		if format, err := Detect([]byte(data)); err != nil || format != want {
+			t.Errorf("Detect = %q, %v; want %q", format, err, want)
+		}
+	}
+	if _, err := Detect([]byte("Date,Workout Name\n")); err != ErrUnknownFormat {
+		t.Errorf("err = %v, want ErrUnknownFormat", err)
+	}
+}
+
+func parse(t *testing.T, data []byte, format database.DataFormat) *Track {
+	t.Helper()
+	track, err := Parse(data, format)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return track
+}
@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestPublicAddress(t *testing.T) {
+	for address, want := range map[string]bool{
+		"93.184.216.34":        true,
+		"2606:4700::1111":      true,
+		"127.0.0.1":            false,
+		"::1":                  false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false, // Cloud metadata
+		"fe80::1":              false,
+		"fd00::1":              false,
+		"100.64.0.1":           false,
+		"0.0.0.0":              false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:93.184.216.34": true,
+	} {
+		if got := PublicAddress(netip.MustParseAddr(address)); got != want {
+			t.Errorf("PublicAddress(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	for rawURL, want := range map[string]error{
+		"https://example.com/hook":       nil,
+		"https://93.184.216.34/hook":     nil,
+		"http://localhost:8080/hook":     ErrPrivateAddress,
+		"http://api.localhost./hook":     ErrPrivateAddress,
+		"http://127.0.0.1/hook":          ErrPrivateAddress,
+		"http://[::1]:9000/hook":         ErrPrivateAddress,
+		"http://169.254.169.254/latest/": ErrPrivateAddress,
+	} {
+		u, _ := url.Parse(rawURL)
+		if got := CheckURL(u); got != want {
+			t.Errorf("CheckURL(%s) = %v, want %v", rawURL, got, want)
+		}
+	}
+}
+
+func TestPublicClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// The test server is on loopback, so the public client mustn't reach it, even by name.
+	if _, err := http.Post(server.URL, "application/json", nil); err != nil {
+		t.Fatalf("the test server can't be reached at all: %v", err)
+	}
+	for _, rawURL := range []string{server.URL, "http://localhost:" + strconv.Itoa(server.Listener.Addr().(*net.TCPAddr).Port)} {
+		_, err := publicClient().Post(rawURL, "application/json", nil)
+		if !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("posting to %s: err = %v, want %v", rawURL, err, ErrPrivateAddress)
+		}
+	}
+}
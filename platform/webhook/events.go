@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"fitness/platform/database"
+	"fmt"
+	"time"
+)
+
+// Workout is how a workout is described in event payloads. It is a summary; the full workout
+// can be fetched from the API at APIPath.
+type Workout struct {
+	ID           uint       `json:"id"`
+	Name         string     `json:"name"`
+	Type         string     `json:"type"`
+	ActivityTime time.Time  `json:"activity_time"`
+	StartTime    *time.Time `json:"start_time"`
+	FinishTime   *time.Time `json:"finish_time"`
+	Version      int        `json:"version"`
+	Exercises    int        `json:"exercises"`
+	Sets         int        `json:"sets"`
+	VolumeKG     float64    `json:"volume_kg"`
+	APIPath      string     `json:"api_path"`
+}
+
+// Record is a personal best in a record.achieved payload.
+type Record struct {
+	ExerciseDefinitionID uint    `json:"exercise_definition_id"`
+	Exercise             string  `json:"exercise"`
+	RecordType           string  `json:"record_type"`
+	Label                string  `json:"label"`
+	Value                float64 `json:"value"`
+}
+
+func newWorkout(activity *database.Activity) Workout {
+	workout := Workout{
+		ID:           activity.ID,
+		Name:         activity.Name,
+		Type:         activity.Type,
+		ActivityTime: activity.ActivityTime,
+		StartTime:    activity.StartTime,
+		FinishTime:   activity.FinishTime,
+		Version:      activity.Version,
+		Exercises:    len(activity.GymExercises),
+		APIPath:      fmt.Sprintf("/api/v1/activities/%d", activity.ID),
+	}
+	for _, gymExercise := range activity.GymExercises {
+		workout.Sets += len(gymExercise.Sets)
+		for _, set := range gymExercise.Sets {
+			workout.VolumeKG += float64(set.Reps) * set.WeightKG
+		}
+	}
+	return workout
+}
+
+// WorkoutSaved announces a finished workout: workout.finished for a new one, workout.updated
+// for one that was edited or reverted.
+func (d *Dispatcher) WorkoutSaved(activity *database.Activity, event database.WebhookEvent) {
+	d.Publish(event, activity.UserID, map[string]interface{}{"workout": newWorkout(activity)})
+}
+
+// WorkoutDeleted announces that a finished workout was deleted.
+func (d *Dispatcher) WorkoutDeleted(activity *database.Activity) {
+	d.Publish(database.EventWorkoutDeleted, activity.UserID, map[string]interface{}{"workout": newWorkout(activity)})
+}
+
+// RecordsAchieved announces the personal bests set by a workout.
+func (d *Dispatcher) RecordsAchieved(activity *database.Activity, records []*database.PersonalRecord) {
+	if len(records) == 0 {
+		return
+	}
+	data := make([]Record, 0, len(records))
+	for _, record := range records {
+		data = append(data, Record{
+			ExerciseDefinitionID: record.ExerciseDefinitionID,
+			Exercise:             record.ExerciseDefinition.Name,
+			RecordType:           record.RecordType,
+			Label:                record.Label(),
+			Value:                record.Value,
+		})
+	}
+	d.Publish(database.EventRecordAchieved, activity.UserID, map[string]interface{}{
+		"workout": newWorkout(activity),
+		"records": data,
+	})
+}
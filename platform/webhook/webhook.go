@@ -0,0 +1,284 @@
+// Package webhook sends workout events to the endpoints users register. Events are queued in
+// the database and delivered in the background, with retries, so a slow or broken endpoint
+// never holds up a request.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fitness/platform/database"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every delivery. The signature is "sha256=" followed by the hex HMAC-SHA256,
+// keyed with the endpoint's secret, of the timestamp, a ".", and the request body.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	defaultInterval    = 30 * time.Second
+	defaultMaxAttempts = 8
+	firstRetryDelay    = 30 * time.Second
+	maxRetryDelay      = 6 * time.Hour
+	requestTimeout     = 10 * time.Second
+	claimLease         = 5 * time.Minute
+	claimBatchSize     = 20
+	responseBodyLimit  = 1024
+)
+
+// Envelope is the JSON body of every delivery. ID is the same for every delivery of an event,
+// including replays, so receivers can ignore ones they have already handled.
+type Envelope struct {
+	ID        string                `json:"id"`
+	Event     database.WebhookEvent `json:"event"`
+	CreatedAt time.Time             `json:"created_at"`
+	UserID    uint                  `json:"user_id"`
+	Data      interface{}           `json:"data"`
+}
+
+// Dispatcher queues events and delivers them to webhook endpoints in the background.
+type Dispatcher struct {
+	Repo *database.WebhookRepo
+
+	// Client sends to admins' endpoints, which can be anywhere, such as a service on the same
+	// network. PublicClient sends to everyone else's, and refuses to connect to private
+	// addresses so that users can't use webhooks to reach the server's own network.
+	Client       *http.Client
+	PublicClient *http.Client
+
+	// Interval is how often to look for deliveries that are due. Publishing an event also
+	// wakes the dispatcher, so this mostly matters for retries.
+	Interval time.Duration
+	// MaxAttempts is how many times a delivery is tried before it is given up on.
+	MaxAttempts int
+
+	wake chan struct{}
+}
+
+// New creates a Dispatcher.
+func New(repo *database.WebhookRepo) *Dispatcher {
+	return &Dispatcher{
+		Repo:         repo,
+		Client:       &http.Client{Timeout: requestTimeout},
+		PublicClient: publicClient(),
+		Interval:     defaultInterval,
+		MaxAttempts:  defaultMaxAttempts,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// NewSecret returns a random secret for signing an endpoint's payloads.
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value for a body sent at the given time.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// RetryDelay is how long to wait after the given number of failed attempts, doubling each
+// time up to a limit.
+func RetryDelay(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// Publish queues an event about a user for every endpoint subscribed to it. Failing to queue
+// an event is logged rather than returned, as it shouldn't fail whatever caused it.
+func (d *Dispatcher) Publish(event database.WebhookEvent, userID uint, data interface{}) {
+	if d == nil {
+		return
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Printf("Webhooks: failed to create ID for %s event: %v", event, err)
+		return
+	}
+	now := time.Now()
+	payload, err := json.Marshal(Envelope{
+		ID:        hex.EncodeToString(id),
+		Event:     event,
+		CreatedAt: now.UTC(),
+		UserID:    userID,
+		Data:      data,
+	})
+	if err != nil {
+		log.Printf("Webhooks: failed to encode %s event: %v", event, err)
+		return
+	}
+
+	queued, err := d.Repo.Enqueue(event, userID, string(payload), now)
+	if err != nil {
+		log.Printf("Webhooks: failed to queue %s event for user %d: %v", event, userID, err)
+		return
+	}
+	if queued > 0 {
+		d.Wake()
+	}
+}
+
+// Wake makes the dispatcher look for due deliveries now rather than at its next interval.
+func (d *Dispatcher) Wake() {
+	if d == nil {
+		return
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start delivers queued events in the background until the context is cancelled.
+func (d *Dispatcher) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(d.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := d.RunOnce(ctx, time.Now()); err != nil {
+				log.Printf("Webhooks: failed to deliver events: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+// RunOnce attempts every delivery that is due.
+func (d *Dispatcher) RunOnce(ctx context.Context, now time.Time) error {
+	for {
+		deliveries, err := d.Repo.ClaimDueDeliveries(now, claimLease, claimBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, delivery := range deliveries {
+			d.attempt(ctx, delivery)
+			if err := d.Repo.RecordAttempt(delivery); err != nil {
+				log.Printf("Webhooks: failed to record attempt at delivery %d: %v", delivery.ID, err)
+			}
+		}
+		if len(deliveries) < claimBatchSize || ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// attempt sends a delivery once and updates it with the outcome.
+func (d *Dispatcher) attempt(ctx context.Context, delivery *database.WebhookDelivery) {
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = 0
+	delivery.ResponseBody = ""
+	delivery.LastError = ""
+
+	err := d.send(ctx, delivery, now)
+	if err == nil {
+		delivery.Status = database.DeliverySucceeded
+		return
+	}
+
+	delivery.LastError = truncate(err.Error())
+	switch {
+	case delivery.Endpoint.DeletedAt.Valid || !delivery.Endpoint.Active:
+		delivery.Status = database.DeliveryFailed
+	case delivery.Attempts >= d.MaxAttempts:
+		delivery.Status = database.DeliveryFailed
+		log.Printf("Webhooks: giving up on delivery %d to endpoint %d after %d attempts: %v",
+			delivery.ID, delivery.EndpointID, delivery.Attempts, err)
+	default:
+		delivery.Status = database.DeliveryPending
+		delivery.NextAttemptAt = now.Add(RetryDelay(delivery.Attempts))
+	}
+}
+
+// send posts the delivery's payload to its endpoint, returning an error unless it answers with a 2xx.
+func (d *Dispatcher) send(ctx context.Context, delivery *database.WebhookDelivery, now time.Time) error {
+	endpoint := delivery.Endpoint
+	if endpoint.DeletedAt.Valid {
+		return fmt.Errorf("the endpoint has been deleted")
+	}
+	if !endpoint.Active {
+		return fmt.Errorf("the endpoint is disabled")
+	}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "fitness-webhooks/1")
+	req.Header.Set(HeaderEvent, string(delivery.Event))
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, timestamp, body))
+
+	client := d.PublicClient
+	if trusted(endpoint) {
+		client = d.Client
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	start, _ := io.ReadAll(io.LimitReader(res.Body, responseBodyLimit))
+	delivery.ResponseStatus = res.StatusCode
+	delivery.ResponseBody = truncate(string(start))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("the endpoint answered %s", res.Status)
+	}
+	return nil
+}
+
+// trusted reports whether an endpoint was registered by an admin: either one for every user's
+// events, which only admins can make, or an admin's own.
+func trusted(endpoint database.WebhookEndpoint) bool {
+	return endpoint.UserID == nil || endpoint.User != nil && endpoint.User.IsAdmin
+}
+
+// truncate shortens a response or error to fit in the delivery log.
+func truncate(s string) string {
+	if len(s) > responseBodyLimit {
+		s = s[:responseBodyLimit]
+	}
+	return strings.ToValidUTF8(s, "")
+}
@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"context"
+	"fitness/platform/database"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestSign(t *testing.T) {
+	// Receivers check deliveries by working out the same signature, so it mustn't change.
+	for _, test := range []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		want      string
+	}{
+		{"an event", "whsec_test", 1760868000, `{"id":"abc","event":"workout.finished"}`, "sha256=8d54422571ed45e29a544f5c1ee68f0cf7f1aa2593b89c3ff4420415d02869ca"},
+		{"an empty body", "whsec_test", 1760868000, "", "sha256=b182c615063543ebd1a6ebf7e62859aeb3e1431dd4c0eab535c9919afc9b1f7f"},
+	} {
+		if got := Sign(test.secret, test.timestamp, []byte(test.body)); got != test.want {
+			t.Errorf("%s: Sign = %s, want %s", test.name, got, test.want)
+		}
+	}
+
+	want := Sign("whsec_test", 1760868000, []byte("{}"))
+	for _, other := range []string{
+		Sign("whsec_other", 1760868000, []byte("{}")),
+		Sign("whsec_test", 1760868001, []byte("{}")),
+		Sign("whsec_test", 1760868000, []byte("{ }")),
+	} {
+		if other == want {
+			t.Errorf("a different secret, time or body was signed the same: %s", other)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		0:   30 * time.Second,
+		1:   30 * time.Second,
+		2:   time.Minute,
+		3:   2 * time.Minute,
+		10:  256 * time.Minute,
+		11:  6 * time.Hour,
+		100: 6 * time.Hour,
+	} {
+		if got := RetryDelay(attempts); got != want {
+			t.Errorf("RetryDelay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestAttempt(t *testing.T) {
+	var (
+		status   int
+		requests int
+		received *http.Request
+		body     string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		received = r
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("answer"))
+	}))
+	defer server.Close()
+	dispatcher := &Dispatcher{Client: server.Client(), MaxAttempts: 3}
+
+	for _, test := range []struct {
+		name     string
+		status   int
+		attempts int // Made before this one
+		disabled bool
+		deleted  bool
+		want     database.DeliveryStatus
+		retry    time.Duration // How long until the next attempt, if there is one
+		sent     bool
+	}{
+		{name: "answered", status: http.StatusAccepted, want: database.DeliverySucceeded, sent: true},
+		{name: "failed the first time", status: http.StatusInternalServerError, want: database.DeliveryPending, retry: 30 * time.Second, sent: true},
+		{name: "failed again", status: http.StatusBadGateway, attempts: 1, want: database.DeliveryPending, retry: time.Minute, sent: true},
+		{name: "failed for the last time", status: http.StatusNotFound, attempts: 2, want: database.DeliveryFailed, sent: true},
+		{name: "to a disabled endpoint", status: http.StatusOK, disabled: true, want: database.DeliveryFailed},
+		{name: "to a deleted endpoint", status: http.StatusOK, deleted: true, want: database.DeliveryFailed},
+	} {
+		status, requests = test.status, 0
+		delivery := &database.WebhookDelivery{
+			EndpointID: 4,
+			Event:      database.EventWorkoutFinished,
+			Payload:    `{"id":"abc"}`,
+			Status:     database.DeliveryPending,
+			Attempts:   test.attempts,
+			Endpoint:   database.WebhookEndpoint{URL: server.URL, Secret: "whsec_test", Active: !test.disabled},
+		}
+		delivery.ID = 9
+		if test.deleted {
+			delivery.Endpoint.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		}
+
+		before := time.Now()
+		dispatcher.attempt(context.Background(), delivery)
+
+		if delivery.Status != test.want || delivery.Attempts != test.attempts+1 {
+			t.Errorf("%s: status %s after %d attempts, want %s after %d", test.name, delivery.Status, delivery.Attempts, test.want, test.attempts+1)
+		}
+		if (requests > 0) != test.sent {
+			t.Errorf("%s: made %d requests", test.name, requests)
+		}
+		if test.retry > 0 {
+			if next := delivery.NextAttemptAt.Sub(*delivery.LastAttemptAt); next != test.retry || delivery.LastAttemptAt.Before(before) {
+				t.Errorf("%s: next attempt in %v, want %v", test.name, next, test.retry)
+			}
+		}
+		if (delivery.LastError == "") != (test.want == database.DeliverySucceeded) {
+			t.Errorf("%s: last error %q", test.name, delivery.LastError)
+		}
+		if !test.sent {
+			continue
+		}
+		if delivery.ResponseStatus != test.status || delivery.ResponseBody != "answer" {
+			t.Errorf("%s: recorded response %d %q", test.name, delivery.ResponseStatus, delivery.ResponseBody)
+		}
+
+		timestamp, err := strconv.ParseInt(received.Header.Get(HeaderTimestamp), 10, 64)
+		if err != nil || received.Header.Get(HeaderSignature) != Sign("whsec_test", timestamp, []byte(body)) || body != delivery.Payload {
+			t.Errorf("%s: received %q signed %q at %q", test.name, body, received.Header.Get(HeaderSignature), received.Header.Get(HeaderTimestamp))
+		}
+		if received.Header.Get(HeaderEvent) != string(database.EventWorkoutFinished) || received.Header.Get(HeaderDelivery) != "9" {
+			t.Errorf("%s: received event %q for delivery %q", test.name, received.Header.Get(HeaderEvent), received.Header.Get(HeaderDelivery))
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Package zones works out a user's heart rate and power training zones, and how long activities
+// spent in each.
+package zones
+
+import (
+	"fitness/platform/database"
+	"fmt"
+	"math"
+	"time"
+)
+
+// maxReadingGap is the longest gap between two readings that is counted. A longer one is the
+// device paused, and the time isn't spent in any zone.
+const maxReadingGap = 30 * time.Second
+
+// Zone is a band of heart rate or power.
+type Zone struct {
+	Number int
+	Name   string
+	Min    int // The lowest reading in the zone
+	Max    int // Where the next zone starts, or zero for the top zone
+}
+
+// Range describes the readings in the zone, such as "120–139".
+func (z Zone) Range() string {
+	switch {
+	case z.Min == 0:
+		return fmt.Sprintf("< %d", z.Max)
+	case z.Max == 0:
+		return fmt.Sprintf("%d+", z.Min)
+	}
+	return fmt.Sprintf("%d–%d", z.Min, z.Max-1)
+}
+
+// Zones are the bands a reading can fall in, lowest first. The first starts at zero.
+type Zones []Zone
+
+// bound is where a zone starts, as a share of the reference its method measures from.
+type bound struct {
+	name  string
+	share float64
+}
+
+var (
+	// maxHeartRateZones are the five zones in common use, as shares of max heart rate or of
+	// heart rate reserve.
+	maxHeartRateZones = []bound{{"Recovery", 0}, {"Endurance", 0.6}, {"Tempo", 0.7}, {"Threshold", 0.8}, {"Maximum", 0.9}}
+	// thresholdHeartRateZones are Joe Friel's zones for lactate threshold heart rate.
+	thresholdHeartRateZones = []bound{{"Recovery", 0}, {"Aerobic", 0.85}, {"Tempo", 0.9}, {"Threshold", 0.95}, {"Anaerobic", 1}}
+	// powerZones are Andrew Coggan's zones for functional threshold power.
+	powerZones = []bound{
+		{"Active Recovery", 0},
+		{"Endurance", 0.56},
+		{"Tempo", 0.76},
+		{"Threshold", 0.91},
+		{"VO2 Max", 1.06},
+		{"Anaerobic", 1.21},
+		{"Neuromuscular", 1.51},
+	}
+)
+
+// MaxHeartRate is the user's max heart rate if they set it, or else 220 less their age. It is
+// zero if they haven't given their date of birth either.
+func MaxHeartRate(user *database.User, now time.Time) int {
+	if user.MaxHeartRate > 0 {
+		return user.MaxHeartRate
+	}
+	if user.Dob.IsZero() || !user.Dob.Before(now) {
+		return 0
+	}
+	age := now.Year() - user.Dob.Year()
+	if now.Month() < user.Dob.Month() || now.Month() == user.Dob.Month() && now.Day() < user.Dob.Day() {
+		age--
+	}
+	return 220 - age
+}
+
+// HeartRate returns the user's heart rate zones by the method they chose. It returns false if
+// their settings aren't enough for it: the reserve method needs a resting heart rate as well as
+// a max, and the threshold method needs a threshold heart rate.
+func HeartRate(user *database.User, now time.Time) (Zones, bool) {
+	switch user.HeartRateZoneMethod {
+	case database.ZonesFromThreshold:
+		if user.ThresholdHeartRate <= 0 {
+			return nil, false
+		}
+		return makeZones(thresholdHeartRateZones, 0, float64(user.ThresholdHeartRate)), true
+	case database.ZonesFromReserve:
+		max := MaxHeartRate(user, now)
+		if max <= 0 || user.RestingHeartRate <= 0 || user.RestingHeartRate >= max {
+			return nil, false
+		}
+		return makeZones(maxHeartRateZones, float64(user.RestingHeartRate), float64(max-user.RestingHeartRate)), true
+	default:
+		max := MaxHeartRate(user, now)
+		if max <= 0 {
+			return nil, false
+		}
+		return makeZones(maxHeartRateZones, 0, float64(max)), true
+	}
+}
+
+// Power returns the user's cycling power zones, or false if they haven't set their FTP.
+func Power(user *database.User) (Zones, bool) {
+	if user.FTP <= 0 {
+		return nil, false
+	}
+	return makeZones(powerZones, 0, float64(user.FTP)), true
+}
+
+// makeZones places the bounds at base plus their share of reference, to the nearest whole beat
+// or watt.
+func makeZones(bounds []bound, base, reference float64) Zones {
+	zones := make(Zones, len(bounds))
+	for i, b := range bounds {
+		zones[i] = Zone{Number: i + 1, Name: b.name}
+		if i > 0 {
+			zones[i].Min = int(math.Round(base + b.share*reference))
+			zones[i-1].Max = zones[i].Min
+		}
+	}
+	return zones
+}
+
+// Of returns the index of the zone a reading falls in.
+func (z Zones) Of(reading float64) int {
+	for i := len(z) - 1; i > 0; i-- {
+		if reading >= float64(z[i].Min) {
+			return i
+		}
+	}
+	return 0
+}
+
+// ZoneTime is how long was spent in a zone.
+type ZoneTime struct {
+	Zone
+	Seconds float64
+	Percent float64 // Of the time spent in any of the zones
+}
+
+// Duration is the time spent in the zone.
+func (t ZoneTime) Duration() time.Duration {
+	return time.Duration(t.Seconds * float64(time.Second))
+}
+
+// Distribution is how long was spent in each of a set of zones.
+type Distribution []ZoneTime
+
+// TimeIn works out how long the given stream spent in each zone. Each reading counts for the
+// time since the one before. Heart rate readings of zero are gaps in the recording, but power
+// readings of zero are freewheeling, so they count.
+func (z Zones) TimeIn(streams database.Streams, kind database.StreamKind) Distribution {
+	distribution := make(Distribution, len(z))
+	for i, zone := range z {
+		distribution[i].Zone = zone
+	}
+	times, readings := streams[database.StreamTime], streams[kind]
+	if len(readings) != len(times) {
+		return distribution
+	}
+	for i := 1; i < len(times); i++ {
+		dt := times[i] - times[i-1]
+		if dt <= 0 || dt > maxReadingGap.Seconds() {
+			continue
+		}
+		if readings[i] <= 0 && kind == database.StreamHeartRate {
+			continue
+		}
+		distribution[z.Of(readings[i])].Seconds += dt
+	}
+	distribution.percentages()
+	return distribution
+}
+
+// Add adds the time in each zone of another distribution over the same zones.
+func (d Distribution) Add(other Distribution) {
+	for i := range d {
+		if i < len(other) {
+			d[i].Seconds += other[i].Seconds
+		}
+	}
+	d.percentages()
+}
+
+// Total is the time spent in any of the zones.
+func (d Distribution) Total() time.Duration {
+	var seconds float64
+	for _, t := range d {
+		seconds += t.Seconds
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func (d Distribution) percentages() {
+	total := d.Total().Seconds()
+	for i := range d {
+		d[i].Percent = 0
+		if total > 0 {
+			d[i].Percent = 100 * d[i].Seconds / total
+		}
+	}
+}
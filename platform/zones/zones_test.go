@@ -0,0 +1,88 @@
+package zones
+
+import (
+	"fitness/platform/database"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func TestHeartRateZones(t *testing.T) {
+	dob := time.Date(1986, 11, 2, 0, 0, 0, 0, time.UTC) // 39, turning 40 next month
+	for _, test := range []struct {
+		name string
+		user database.User
+		mins []int
+	}{
+		{"age", database.User{Dob: dob}, []int{0, 109, 127, 145, 163}},
+		{"max", database.User{Dob: dob, MaxHeartRate: 190}, []int{0, 114, 133, 152, 171}},
+		{"reserve", database.User{HeartRateZoneMethod: database.ZonesFromReserve, MaxHeartRate: 190, RestingHeartRate: 50}, []int{0, 134, 148, 162, 176}},
+		{"threshold", database.User{HeartRateZoneMethod: database.ZonesFromThreshold, ThresholdHeartRate: 170}, []int{0, 145, 153, 162, 170}},
+	} {
+		zones, ok := HeartRate(&test.user, now)
+		if !ok || len(zones) != len(test.mins) {
+			t.Errorf("%s: zones = %v, %v", test.name, zones, ok)
+			continue
+		}
+		for i, zone := range zones {
+			if zone.Min != test.mins[i] {
+				t.Errorf("%s: zone %d starts at %d, want %d", test.name, zone.Number, zone.Min, test.mins[i])
+			}
+		}
+		if zones[len(zones)-1].Max != 0 || zones[0].Max != zones[1].Min {
+			t.Errorf("%s: zones = %+v", test.name, zones)
+		}
+		if got, want := zones[0].Range()+", "+zones[1].Range()+", "+zones[4].Range(),
+			fmt.Sprintf("< %d, %d–%d, %d+", test.mins[1], test.mins[1], test.mins[2]-1, test.mins[4]); got != want {
+			t.Errorf("%s: ranges = %q, want %q", test.name, got, want)
+		}
+	}
+
+	for _, user := range []database.User{
+		{},
+		{HeartRateZoneMethod: database.ZonesFromReserve, MaxHeartRate: 190},
+		{HeartRateZoneMethod: database.ZonesFromThreshold, MaxHeartRate: 190},
+	} {
+		if zones, ok := HeartRate(&user, now); ok {
+			t.Errorf("zones = %v for %+v, which isn't enough to go on", zones, user)
+		}
+	}
+}
+
+func TestTimeInZones(t *testing.T) {
+	user := database.User{FTP: 200}
+	zones, _ := Power(&user)
+	if zones[3].Min != 182 || len(zones) != 7 {
+		t.Fatalf("zones = %+v", zones)
+	}
+
+	streams := database.Streams{
+		database.StreamTime:      {0, 10, 20, 30, 130, 140},
+		database.StreamWatts:     {0, 0, 150, 190, 400, 190},
+		database.StreamHeartRate: {120, 0, 140, 150, 150, 150},
+	}
+	// The 100 second gap while paused isn't counted, and neither are the 0 readings for heart rate
+	power := zones.TimeIn(streams, database.StreamWatts)
+	if power[0].Seconds != 10 || power[1].Seconds != 10 || power[3].Seconds != 20 || power.Total() != 40*time.Second {
+		t.Errorf("power distribution = %+v", power)
+	}
+	if power[3].Percent != 50 {
+		t.Errorf("threshold percent = %v, want 50", power[3].Percent)
+	}
+
+	heartRate, _ := HeartRate(&database.User{MaxHeartRate: 200}, now)
+	distribution := heartRate.TimeIn(streams, database.StreamHeartRate)
+	if distribution.Total() != 30*time.Second || distribution[2].Seconds != 30 {
+		t.Errorf("heart rate distribution = %+v", distribution)
+	}
+
+	distribution.Add(heartRate.TimeIn(database.Streams{
+		database.StreamTime:      {0, 30},
+		database.StreamHeartRate: {170, 185},
+	}, database.StreamHeartRate))
+	if distribution[4].Seconds != 30 || distribution[4].Percent != 50 {
+		t.Errorf("added distribution = %+v", distribution)
+	}
+}
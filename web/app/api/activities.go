@@ -0,0 +1,317 @@
+package api
+
+import (
+	"errors"
+	"fitness/platform/database"
+	"fitness/platform/strava"
+	"fitness/platform/webhook"
+	"fitness/web/app/workout"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ownedActivity loads an activity with its exercises and sets, ending the request with a 404 if it
+// doesn't exist or belongs to someone else.
+func ownedActivity(ctx *gin.Context, activityRepo *database.ActivityRepo, activityID uint) (*database.Activity, bool) {
+	activity, err := activityRepo.GetActivityByID(activityID)
+	if err != nil {
+		abortWithDBError(ctx, err, "Activity")
+		return nil, false
+	}
+	if activity.UserID != currentUserID(ctx) {
+		abortWithError(ctx, http.StatusNotFound, "not_found", "Activity not found")
+		return nil, false
+	}
+	return activity, true
+}
+
+// requireDraft ends the request unless the activity is a draft. Finished workouts are changed by
+// making an edit draft of them and finalizing it, just as on the web.
+func requireDraft(ctx *gin.Context, activity *database.Activity) bool {
+	if activity.Status != database.StatusDraft {
+		abortWithError(ctx, http.StatusConflict, "not_draft", "Only drafts can be changed. Create an edit draft of this activity first")
+		return false
+	}
+	return true
+}
+
+// ListActivitiesHandler lists the user's activities, newest first. The status query parameter
+// limits it to "draft" or "active" (finished) activities.
+// Route: GET /api/v1/activities
+func ListActivitiesHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		status := database.ExerciseStatus(ctx.Query("status"))
+		if status != "" && status != database.StatusDraft && status != database.StatusActive {
+			abortWithValidation(ctx, map[string]string{"status": "must be draft or active"})
+			return
+		}
+		pagination, offset, limit, ok := pageParams(ctx)
+		if !ok {
+			return
+		}
+
+		activities, total, err := activityRepo.ListActivitiesByUserID(currentUserID(ctx), status, offset, limit)
+		if err != nil {
+			log.Printf("API: failed to list activities: %v", err)
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Something went wrong loading activities")
+			return
+		}
+
+		data := make([]Activity, 0, len(activities))
+		for _, activity := range activities {
+			data = append(data, newActivity(activity))
+		}
+		pagination.Total = total
+		respondList(ctx, data, pagination)
+	}
+}
+
+// CreateActivityHandler starts a new draft workout and makes it the user's active one. If there
+// is already an active draft it answers with a 409, unless discard=true is given to throw it away.
+// Route: POST /api/v1/activities
+func CreateActivityHandler(activityRepo *database.ActivityRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID := currentUserID(ctx)
+
+		var body struct {
+			Name string `json:"name"`
+		}
+		if ctx.Request.ContentLength > 0 && !bindJSON(ctx, &body) {
+			return
+		}
+
+		active, err := activityRepo.GetActiveDraft(userID)
+		if err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to check for an active workout")
+			return
+		}
+		if active != nil {
+			if ctx.Query("discard") != "true" {
+				abortWithError(ctx, http.StatusConflict, "active_draft_exists", "There is already an active draft. Finish it, or retry with discard=true to throw it away")
+				return
+			}
+			if err := activityRepo.DeleteActivityAndChildren(active.ID); err != nil {
+				abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to discard previous workout")
+				return
+			}
+		}
+
+		name := strings.TrimSpace(body.Name)
+		if name == "" {
+			name = "Gym Workout"
+		}
+		now := time.Now()
+		activity := &database.Activity{
+			UserID:       userID,
+			Type:         "GYM_WORKOUT",
+			ActivityTime: now,
+			StartTime:    &now,
+			Name:         name,
+			Status:       database.StatusDraft,
+		}
+		if err := activityRepo.CreateActivity(activity); err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to create workout")
+			return
+		}
+		if err := userRepo.SetActiveActivity(userID, &activity.ID); err != nil {
+			log.Printf("Failed to set active workout for user %d: %v", userID, err)
+		}
+
+		respond(ctx, http.StatusCreated, newActivity(activity))
+	}
+}
+
+// GetActivityHandler returns an activity with its exercises and sets.
+// Route: GET /api/v1/activities/:id
+func GetActivityHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		activityID, ok := idParam(ctx, "id")
+		if !ok {
+			return
+		}
+		activity, ok := ownedActivity(ctx, activityRepo, activityID)
+		if !ok {
+			return
+		}
+		respond(ctx, http.StatusOK, newActivity(activity))
+	}
+}
+
+// UpdateActivityHandler changes the name, notes or time of a draft. Fields left out are unchanged.
+// Route: PATCH /api/v1/activities/:id
+func UpdateActivityHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		activityID, ok := idParam(ctx, "id")
+		if !ok {
+			return
+		}
+		var body struct {
+			Name         *string    `json:"name"`
+			Notes        *string    `json:"notes"`
+			ActivityTime *time.Time `json:"activity_time"`
+		}
+		if !bindJSON(ctx, &body) {
+			return
+		}
+
+		fields := map[string]string{}
+		if body.Name != nil && strings.TrimSpace(*body.Name) == "" {
+			fields["name"] = "cannot be empty"
+		}
+		if body.ActivityTime != nil && body.ActivityTime.After(time.Now()) {
+			fields["activity_time"] = "cannot be in the future"
+		}
+		if len(fields) > 0 {
+			abortWithValidation(ctx, fields)
+			return
+		}
+
+		activity, ok := ownedActivity(ctx, activityRepo, activityID)
+		if !ok || !requireDraft(ctx, activity) {
+			return
+		}
+
+		var err error
+		if body.Name != nil {
+			_, err = activityRepo.UpdateActivityName(activityID, strings.TrimSpace(*body.Name))
+		}
+		if err == nil && body.Notes != nil {
+			_, err = activityRepo.UpdateActivityNotes(activityID, *body.Notes)
+		}
+		if err == nil && body.ActivityTime != nil {
+			_, err = activityRepo.UpdateActivityTime(activityID, *body.ActivityTime)
+		}
+		if err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to update activity")
+			return
+		}
+
+		activity, ok = ownedActivity(ctx, activityRepo, activityID)
+		if !ok {
+			return
+		}
+		respond(ctx, http.StatusOK, newActivity(activity))
+	}
+}
+
+// DeleteActivityHandler deletes an activity, whether it is a draft or finished.
+// Route: DELETE /api/v1/activities/:id
+func DeleteActivityHandler(activityRepo *database.ActivityRepo, streakRepo *database.StreakRepo, webhooks *webhook.Dispatcher) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		activityID, ok := idParam(ctx, "id")
+		if !ok {
+			return
+		}
+		activity, ok := ownedActivity(ctx, activityRepo, activityID)
+		if !ok {
+			return
+		}
+		if err := activityRepo.DeleteActivityAndChildren(activity.ID); err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to delete activity")
+			return
+		}
+
+		if activity.Status == database.StatusActive {
+			if _, err := streakRepo.RecalculateStreak(activity.UserID); err != nil {
+				log.Printf("Failed to recalculate streak for user %d: %v", activity.UserID, err)
+			}
+			webhooks.WorkoutDeleted(activity)
+		}
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+// CreateEditDraftHandler copies a finished workout into a draft that can be changed and then
+// finalized over the original.
+// Route: POST /api/v1/activities/:id/edit-draft
+func CreateEditDraftHandler(activityRepo *database.ActivityRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		activityID, ok := idParam(ctx, "id")
+		if !ok {
+			return
+		}
+		original, ok := ownedActivity(ctx, activityRepo, activityID)
+		if !ok {
+			return
+		}
+		if original.Status != database.StatusActive {
+			abortWithError(ctx, http.StatusConflict, "not_finished", "Only finished activities can be edited through a draft")
+			return
+		}
+
+		draftID, err := activityRepo.CreateDraftCopy(original.ID)
+		if err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Could not create draft")
+			return
+		}
+		if err := userRepo.SetActiveActivity(original.UserID, &draftID); err != nil {
+			log.Printf("Failed to set active workout for user %d: %v", original.UserID, err)
+		}
+
+		draft, ok := ownedActivity(ctx, activityRepo, draftID)
+		if !ok {
+			return
+		}
+		respond(ctx, http.StatusCreated, newActivity(draft))
+	}
+}
+
+// FinalizeActivityHandler finishes a draft. A new workout becomes finished in place, while an edit
+// draft is saved over its original and removed. If the original changed since the draft was made
+// it answers with a 409 and the conflict has to be resolved on the web.
+// Route: POST /api/v1/activities/:id/finalize
+func FinalizeActivityHandler(activityRepo *database.ActivityRepo, streakRepo *database.StreakRepo, recordRepo *database.PersonalRecordRepo, webhooks *webhook.Dispatcher, poster *strava.Poster) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		draftID, ok := idParam(ctx, "id")
+		if !ok {
+			return
+		}
+		var body struct {
+			Notes *string `json:"notes"`
+		}
+		if ctx.Request.ContentLength > 0 && !bindJSON(ctx, &body) {
+			return
+		}
+
+		draft, ok := ownedActivity(ctx, activityRepo, draftID)
+		if !ok || !requireDraft(ctx, draft) {
+			return
+		}
+		notes := draft.Notes
+		if body.Notes != nil {
+			notes = *body.Notes
+		}
+
+		finalID, err := activityRepo.FinalizeDraft(draft.ID, notes)
+		if errors.Is(err, database.ErrVersionConflict) {
+			if _, err := activityRepo.UpdateActivityNotes(draft.ID, notes); err != nil {
+				log.Printf("Failed to save notes for draft %d: %v", draft.ID, err)
+			}
+			abortWithError(ctx, http.StatusConflict, "version_conflict", "The workout was changed since this draft was made. Resolve the conflict before finishing")
+			return
+		}
+		if err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to finalize workout")
+			return
+		}
+
+		if _, err := streakRepo.RecalculateStreak(draft.UserID); err != nil {
+			log.Printf("Failed to recalculate streak for user %d: %v", draft.UserID, err)
+		}
+
+		final, ok := ownedActivity(ctx, activityRepo, finalID)
+		if !ok {
+			return
+		}
+		event := database.EventWorkoutFinished
+		if finalID != draft.ID {
+			event = database.EventWorkoutUpdated
+		}
+		workout.AfterSave(final, event, recordRepo, webhooks, poster)
+		respond(ctx, http.StatusOK, newActivity(final))
+	}
+}
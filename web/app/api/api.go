@@ -0,0 +1,172 @@
+// Package api serves the versioned JSON API under /api/v1. It works on the same repos as the
+// web pages, so drafts are created, edited and finalized in exactly the same way.
+package api
+
+import (
+	"errors"
+	"fitness/platform/database"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// ErrorBody is the body of every error response.
+type ErrorBody struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// Pagination describes which page of a list was returned.
+type Pagination struct {
+	Page    int   `json:"page"`
+	PerPage int   `json:"per_page"`
+	Total   int64 `json:"total"`
+}
+
+// abortWithError ends the request with an error body.
+func abortWithError(ctx *gin.Context, status int, code, message string) {
+	ctx.AbortWithStatusJSON(status, ErrorBody{Error: ErrorDetail{Code: code, Message: message}})
+}
+
+// abortWithValidation ends the request with the problems found in the request body, keyed by field.
+func abortWithValidation(ctx *gin.Context, fields map[string]string) {
+	ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, ErrorBody{Error: ErrorDetail{
+		Code:    "validation_failed",
+		Message: "The request has invalid fields",
+		Fields:  fields,
+	}})
+}
+
+// abortWithDBError ends the request for an error from a repo, telling a missing record apart
+// from anything else.
+func abortWithDBError(ctx *gin.Context, err error, what string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		abortWithError(ctx, http.StatusNotFound, "not_found", what+" not found")
+		return
+	}
+	abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Something went wrong loading "+what)
+}
+
+// TokenStore looks up the personal access tokens clients present. It is satisfied by
+// *database.TokenRepo.
+type TokenStore interface {
+	GetTokenByValue(value string) (*database.PersonalAccessToken, error)
+	TouchToken(tokenID uint, now time.Time) error
+}
+
+// Authenticate works out which user is making the request, rejecting it with a 401 if it can't.
+// Browsers are recognised by their session cookie, which is tried first, while scripts and apps
+// send a personal access token as "Authorization: Bearer <token>". Read-only tokens can only
+// make GET requests.
+func Authenticate(tokenRepo TokenStore) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if userID, ok := sessions.Default(ctx).Get("user").(uint); ok {
+			ctx.Set("userID", userID)
+			ctx.Next()
+			return
+		}
+
+		header := ctx.GetHeader("Authorization")
+		if header == "" {
+			abortWithError(ctx, http.StatusUnauthorized, "unauthorized", "Sign in or send a personal access token to use the API")
+			return
+		}
+
+		value, found := strings.CutPrefix(header, "Bearer ")
+		if !found || strings.TrimSpace(value) == "" {
+			abortWithError(ctx, http.StatusUnauthorized, "unauthorized", "The Authorization header must be \"Bearer <token>\"")
+			return
+		}
+		token, err := tokenRepo.GetTokenByValue(strings.TrimSpace(value))
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("API: failed to look up access token: %v", err)
+			}
+			abortWithError(ctx, http.StatusUnauthorized, "invalid_token", "The access token is invalid or has been revoked")
+			return
+		}
+		if token.Scope != database.TokenScopeWrite && ctx.Request.Method != http.MethodGet && ctx.Request.Method != http.MethodHead {
+			abortWithError(ctx, http.StatusForbidden, "insufficient_scope", "This access token can only read")
+			return
+		}
+
+		if err := tokenRepo.TouchToken(token.ID, time.Now()); err != nil {
+			log.Printf("API: failed to record use of access token %d: %v", token.ID, err)
+		}
+		ctx.Set("userID", token.UserID)
+		ctx.Next()
+	}
+}
+
+// currentUserID returns the ID of the user making the request, as set by Authenticate.
+func currentUserID(ctx *gin.Context) uint {
+	return ctx.GetUint("userID")
+}
+
+// idParam reads a numeric ID from the path, ending the request if it isn't one.
+func idParam(ctx *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(ctx.Param(name), 10, 64)
+	if err != nil {
+		abortWithError(ctx, http.StatusBadRequest, "invalid_id", "The "+name+" in the path must be a number")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// bindJSON decodes the request body, ending the request if it isn't valid JSON.
+func bindJSON(ctx *gin.Context, body interface{}) bool {
+	if err := ctx.ShouldBindJSON(body); err != nil {
+		abortWithError(ctx, http.StatusBadRequest, "invalid_body", "The request body must be valid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// pageParams reads the page and per_page query parameters, returning the page details and the
+// offset and limit to query with.
+func pageParams(ctx *gin.Context) (Pagination, int, int, bool) {
+	page, perPage := 1, defaultPerPage
+	if value := ctx.Query("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			abortWithValidation(ctx, map[string]string{"page": "must be a whole number of at least 1"})
+			return Pagination{}, 0, 0, false
+		}
+		page = parsed
+	}
+	if value := ctx.Query("per_page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPerPage {
+			abortWithValidation(ctx, map[string]string{"per_page": "must be between 1 and " + strconv.Itoa(maxPerPage)})
+			return Pagination{}, 0, 0, false
+		}
+		perPage = parsed
+	}
+	return Pagination{Page: page, PerPage: perPage}, (page - 1) * perPage, perPage, true
+}
+
+// respond sends a single resource.
+func respond(ctx *gin.Context, status int, data interface{}) {
+	ctx.JSON(status, gin.H{"data": data})
+}
+
+// respondList sends one page of a list.
+func respondList(ctx *gin.Context, data interface{}, pagination Pagination) {
+	ctx.JSON(http.StatusOK, gin.H{"data": data, "pagination": pagination})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"fitness/platform/database"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// fakeTokens keeps access tokens by their value. Revoked tokens are soft deleted, so they are
+// no longer found.
+type fakeTokens struct {
+	tokens  map[string]*database.PersonalAccessToken
+	touched []uint
+}
+
+func (f *fakeTokens) GetTokenByValue(value string) (*database.PersonalAccessToken, error) {
+	token, ok := f.tokens[value]
+	if !ok || token.DeletedAt.Valid {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return token, nil
+}
+
+func (f *fakeTokens) TouchToken(tokenID uint, now time.Time) error {
+	f.touched = append(f.touched, tokenID)
+	return nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	token := func(id, userID uint, scope database.TokenScope) *database.PersonalAccessToken {
+		token := &database.PersonalAccessToken{UserID: userID, Scope: scope}
+		token.ID = id
+		return token
+	}
+	revoked := token(3, 9, database.TokenScopeWrite)
+	revoked.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	tokens := map[string]*database.PersonalAccessToken{
+		"read-token":    token(1, 7, database.TokenScopeRead),
+		"write-token":   token(2, 8, database.TokenScopeWrite),
+		"revoked-token": revoked,
+	}
+
+	for _, test := range []struct {
+		name     string
+		method   string
+		session  uint // The signed-in user, if any
+		header   string
+		status   int
+		user     uint
+		touching uint
+	}{
+		{name: "nobody", method: http.MethodGet, status: http.StatusUnauthorized},
+		{name: "signed in", method: http.MethodPost, session: 5, status: http.StatusOK, user: 5},
+		{name: "signed in with a revoked token", method: http.MethodDelete, session: 5, header: "Bearer revoked-token", status: http.StatusOK, user: 5},
+		{name: "signed in with another user's token", method: http.MethodGet, session: 5, header: "Bearer write-token", status: http.StatusOK, user: 5},
+		{name: "read token getting", method: http.MethodGet, header: "Bearer read-token", status: http.StatusOK, user: 7, touching: 1},
+		{name: "read token heading", method: http.MethodHead, header: "Bearer read-token", status: http.StatusOK, user: 7, touching: 1},
+		{name: "read token posting", method: http.MethodPost, header: "Bearer read-token", status: http.StatusForbidden},
+		{name: "read token patching", method: http.MethodPatch, header: "Bearer read-token", status: http.StatusForbidden},
+		{name: "read token deleting", method: http.MethodDelete, header: "Bearer read-token", status: http.StatusForbidden},
+		{name: "write token posting", method: http.MethodPost, header: "Bearer write-token", status: http.StatusOK, user: 8, touching: 2},
+		{name: "write token deleting", method: http.MethodDelete, header: "Bearer  write-token ", status: http.StatusOK, user: 8, touching: 2},
+		{name: "revoked token", method: http.MethodGet, header: "Bearer revoked-token", status: http.StatusUnauthorized},
+		{name: "unknown token", method: http.MethodGet, header: "Bearer guessed-token", status: http.StatusUnauthorized},
+		{name: "not a bearer token", method: http.MethodGet, header: "Basic read-token", status: http.StatusUnauthorized},
+		{name: "an empty bearer token", method: http.MethodGet, header: "Bearer  ", status: http.StatusUnauthorized},
+	} {
+		store := &fakeTokens{tokens: tokens}
+		router := gin.New()
+		router.Use(sessions.Sessions("auth-session", cookie.NewStore([]byte("secret"))))
+		router.Use(func(ctx *gin.Context) {
+			if test.session != 0 {
+				sessions.Default(ctx).Set("user", test.session)
+			}
+		})
+		router.Handle(test.method, "/api/v1/activities", Authenticate(store), func(ctx *gin.Context) {
+			ctx.String(http.StatusOK, strconv.Itoa(int(currentUserID(ctx))))
+		})
+
+		request := httptest.NewRequest(test.method, "/api/v1/activities", nil)
+		if test.header != "" {
+			request.Header.Set("Authorization", test.header)
+		}
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+
+		if response.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.name, response.Code, test.status)
+			continue
+		}
+		if test.status == http.StatusOK && response.Body.String() != strconv.Itoa(int(test.user)) {
+			t.Errorf("%s: made by user %s, want %d", test.name, response.Body.String(), test.user)
+		}
+		if touched := len(store.touched) > 0; touched != (test.touching != 0) || (touched && store.touched[0] != test.touching) {
+			t.Errorf("%s: touched tokens %v, want %d", test.name, store.touched, test.touching)
+		}
+	}
+}
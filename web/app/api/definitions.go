@@ -0,0 +1,104 @@
+package api
+
+import (
+	"fitness/platform/database"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListExerciseDefinitionsHandler lists the exercise library by name. The q and muscle_group query
+// parameters filter it the same way as the exercise picker.
+// Route: GET /api/v1/exercise-definitions
+func ListExerciseDefinitionsHandler(exerciseRepo *database.ExerciseRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		pagination, offset, limit, ok := pageParams(ctx)
+		if !ok {
+			return
+		}
+		definitions, total, err := exerciseRepo.ListExercises(ctx.Query("q"), ctx.Query("muscle_group"), offset, limit)
+		if err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Something went wrong loading exercises")
+			return
+		}
+
+		data := make([]ExerciseDefinition, 0, len(definitions))
+		for _, definition := range definitions {
+			data = append(data, newExerciseDefinition(definition))
+		}
+		pagination.Total = total
+		respondList(ctx, data, pagination)
+	}
+}
+
+// GetExerciseDefinitionHandler returns a single exercise from the library.
+// Route: GET /api/v1/exercise-definitions/:id
+func GetExerciseDefinitionHandler(exerciseRepo *database.ExerciseRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		definitionID, ok := idParam(ctx, "id")
+		if !ok {
+			return
+		}
+		definition, err := exerciseRepo.GetExerciseByID(definitionID)
+		if err != nil {
+			abortWithDBError(ctx, err, "Exercise")
+			return
+		}
+		respond(ctx, http.StatusOK, newExerciseDefinition(definition))
+	}
+}
+
+// ListFavouritesHandler lists the exercises the user has favourited.
+// Route: GET /api/v1/favourites
+func ListFavouritesHandler(exerciseRepo *database.ExerciseRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		definitions, err := exerciseRepo.GetFavourites(currentUserID(ctx))
+		if err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Something went wrong loading favourites")
+			return
+		}
+
+		data := make([]ExerciseDefinition, 0, len(definitions))
+		for _, definition := range definitions {
+			data = append(data, newExerciseDefinition(definition))
+		}
+		respond(ctx, http.StatusOK, data)
+	}
+}
+
+// AddFavouriteHandler favourites an exercise. Favouriting one twice is not an error.
+// Route: PUT /api/v1/favourites/:definitionId
+func AddFavouriteHandler(exerciseRepo *database.ExerciseRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		definitionID, ok := idParam(ctx, "definitionId")
+		if !ok {
+			return
+		}
+		definition, err := exerciseRepo.GetExerciseByID(definitionID)
+		if err != nil {
+			abortWithDBError(ctx, err, "Exercise")
+			return
+		}
+		if err := exerciseRepo.AddFavourite(currentUserID(ctx), definition.ID); err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to favourite exercise")
+			return
+		}
+		respond(ctx, http.StatusOK, newExerciseDefinition(definition))
+	}
+}
+
+// RemoveFavouriteHandler un-favourites an exercise.
+// Route: DELETE /api/v1/favourites/:definitionId
+func RemoveFavouriteHandler(exerciseRepo *database.ExerciseRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		definitionID, ok := idParam(ctx, "definitionId")
+		if !ok {
+			return
+		}
+		if err := exerciseRepo.RemoveFavourite(currentUserID(ctx), definitionID); err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to remove favourite")
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,336 @@
+package api
+
+import (
+	"fitness/platform/database"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ownedGymExercise loads an exercise in a workout along with its activity, ending the request with a
+// 404 unless the activity belongs to the user.
+func ownedGymExercise(ctx *gin.Context, gymExerciseRepo *database.GymExerciseRepo, activityRepo *database.ActivityRepo, gymExerciseID uint) (*database.GymExercise, *database.Activity, bool) {
+	gymExercise, err := gymExerciseRepo.GetExerciseByID(uint64(gymExerciseID))
+	if err != nil {
+		abortWithDBError(ctx, err, "Exercise")
+		return nil, nil, false
+	}
+	activity, err := activityRepo.GetActivityByID(gymExercise.ActivityID)
+	if err != nil || activity.UserID != currentUserID(ctx) {
+		abortWithError(ctx, http.StatusNotFound, "not_found", "Exercise not found")
+		return nil, nil, false
+	}
+	return gymExercise, activity, true
+}
+
+// ownedSet loads a set along with the activity it belongs to, ending the request with a 404 unless
+// the activity belongs to the user.
+func ownedSet(ctx *gin.Context, gymSetRepo *database.GymSetRepo, gymExerciseRepo *database.GymExerciseRepo, activityRepo *database.ActivityRepo, setID uint) (*database.GymSet, *database.Activity, bool) {
+	gymSet, err := gymSetRepo.GetGymSetByID(setID)
+	if err != nil {
+		abortWithDBError(ctx, err, "Set")
+		return nil, nil, false
+	}
+	gymExercise, err := gymExerciseRepo.GetExerciseByID(uint64(gymSet.GymExerciseID))
+	if err != nil {
+		abortWithError(ctx, http.StatusNotFound, "not_found", "Set not found")
+		return nil, nil, false
+	}
+	activity, err := activityRepo.GetActivityByID(gymExercise.ActivityID)
+	if err != nil || activity.UserID != currentUserID(ctx) {
+		abortWithError(ctx, http.StatusNotFound, "not_found", "Set not found")
+		return nil, nil, false
+	}
+	return gymSet, activity, true
+}
+
+// findGymExercise picks an exercise out of a loaded activity so it is returned with its sets.
+func findGymExercise(activity *database.Activity, gymExerciseID uint) *database.GymExercise {
+	for i := range activity.GymExercises {
+		if activity.GymExercises[i].ID == gymExerciseID {
+			return &activity.GymExercises[i]
+		}
+	}
+	return nil
+}
+
+// AddExerciseHandler adds an exercise to the end of a draft, with the given number of empty sets.
+// Route: POST /api/v1/activities/:id/exercises
+func AddExerciseHandler(activityRepo *database.ActivityRepo, gymExerciseRepo *database.GymExerciseRepo, gymSetRepo *database.GymSetRepo, exerciseRepo *database.ExerciseRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		activityID, ok := idParam(ctx, "id")
+		if !ok {
+			return
+		}
+		var body struct {
+			ExerciseDefinitionID uint `json:"exercise_definition_id"`
+			Sets                 *int `json:"sets"`
+		}
+		if !bindJSON(ctx, &body) {
+			return
+		}
+		sets := 1
+		if body.Sets != nil {
+			sets = *body.Sets
+		}
+
+		fields := map[string]string{}
+		if body.ExerciseDefinitionID == 0 {
+			fields["exercise_definition_id"] = "is required"
+		} else if _, err := exerciseRepo.GetExerciseByID(body.ExerciseDefinitionID); err != nil {
+			fields["exercise_definition_id"] = "does not match an exercise"
+		}
+		if sets < 0 || sets > 20 {
+			fields["sets"] = "must be between 0 and 20"
+		}
+		if len(fields) > 0 {
+			abortWithValidation(ctx, fields)
+			return
+		}
+
+		activity, ok := ownedActivity(ctx, activityRepo, activityID)
+		if !ok || !requireDraft(ctx, activity) {
+			return
+		}
+
+		gymExercise := &database.GymExercise{
+			ActivityID:           activity.ID,
+			ExerciseDefinitionID: body.ExerciseDefinitionID,
+			SortNumber:           len(activity.GymExercises) + 1,
+		}
+		if err := gymExerciseRepo.CreateGymExercise(gymExercise); err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to create exercise")
+			return
+		}
+		for setNumber := 1; setNumber <= sets; setNumber++ {
+			if err := gymSetRepo.CreateGymSet(&database.GymSet{GymExerciseID: gymExercise.ID, SetNumber: setNumber}); err != nil {
+				abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to create sets")
+				return
+			}
+		}
+
+		activity, ok = ownedActivity(ctx, activityRepo, activity.ID)
+		if !ok {
+			return
+		}
+		respond(ctx, http.StatusCreated, newGymExercise(findGymExercise(activity, gymExercise.ID)))
+	}
+}
+
+// UpdateExerciseHandler swaps which exercise is done or moves it within the workout.
+// Route: PATCH /api/v1/exercises/:id
+func UpdateExerciseHandler(activityRepo *database.ActivityRepo, gymExerciseRepo *database.GymExerciseRepo, exerciseRepo *database.ExerciseRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		gymExerciseID, ok := idParam(ctx, "id")
+		if !ok {
+			return
+		}
+		var body struct {
+			ExerciseDefinitionID *uint `json:"exercise_definition_id"`
+			SortNumber           *int  `json:"sort_number"`
+		}
+		if !bindJSON(ctx, &body) {
+			return
+		}
+
+		fields := map[string]string{}
+		if body.ExerciseDefinitionID != nil {
+			if _, err := exerciseRepo.GetExerciseByID(*body.ExerciseDefinitionID); err != nil {
+				fields["exercise_definition_id"] = "does not match an exercise"
+			}
+		}
+		if body.SortNumber != nil && *body.SortNumber < 1 {
+			fields["sort_number"] = "must be at least 1"
+		}
+		if len(fields) > 0 {
+			abortWithValidation(ctx, fields)
+			return
+		}
+
+		gymExercise, activity, ok := ownedGymExercise(ctx, gymExerciseRepo, activityRepo, gymExerciseID)
+		if !ok || !requireDraft(ctx, activity) {
+			return
+		}
+
+		update := &database.GymExercise{}
+		update.ID = gymExercise.ID
+		if body.ExerciseDefinitionID != nil {
+			update.ExerciseDefinitionID = *body.ExerciseDefinitionID
+		}
+		if body.SortNumber != nil {
+			update.SortNumber = *body.SortNumber
+		}
+		if err := gymExerciseRepo.UpdateExercise(update); err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to update exercise")
+			return
+		}
+
+		activity, ok = ownedActivity(ctx, activityRepo, activity.ID)
+		if !ok {
+			return
+		}
+		respond(ctx, http.StatusOK, newGymExercise(findGymExercise(activity, gymExercise.ID)))
+	}
+}
+
+// DeleteExerciseHandler removes an exercise and its sets from a draft.
+// Route: DELETE /api/v1/exercises/:id
+func DeleteExerciseHandler(activityRepo *database.ActivityRepo, gymExerciseRepo *database.GymExerciseRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		gymExerciseID, ok := idParam(ctx, "id")
+		if !ok {
+			return
+		}
+		gymExercise, activity, ok := ownedGymExercise(ctx, gymExerciseRepo, activityRepo, gymExerciseID)
+		if !ok || !requireDraft(ctx, activity) {
+			return
+		}
+		if err := gymExerciseRepo.DeleteExercise(gymExercise.ID); err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to delete exercise")
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+// setBody is the request body for creating or changing a set. Fields left out are unchanged.
+type setBody struct {
+	Reps      *int     `json:"reps"`
+	WeightKG  *float64 `json:"weight_kg"`
+	SetType   *string  `json:"set_type"`
+	Notes     *string  `json:"notes"`
+	Completed *bool    `json:"completed"`
+}
+
+// values checks the body and turns it into the columns to update.
+func (b setBody) values() (map[string]interface{}, map[string]string) {
+	values := map[string]interface{}{}
+	fields := map[string]string{}
+	if b.Reps != nil {
+		if *b.Reps < 0 {
+			fields["reps"] = "cannot be negative"
+		}
+		values["reps"] = *b.Reps
+	}
+	if b.WeightKG != nil {
+		if *b.WeightKG < 0 {
+			fields["weight_kg"] = "cannot be negative"
+		}
+		values["weight_kg"] = *b.WeightKG
+	}
+	if b.SetType != nil {
+		if len(*b.SetType) > 50 {
+			fields["set_type"] = "must be at most 50 characters"
+		}
+		values["set_type"] = *b.SetType
+	}
+	if b.Notes != nil {
+		values["notes"] = *b.Notes
+	}
+	if b.Completed != nil {
+		var completedAt *time.Time
+		if *b.Completed {
+			now := time.Now()
+			completedAt = &now
+		}
+		values["completed_at"] = completedAt
+	}
+	return values, fields
+}
+
+// AddSetHandler adds a set to the end of an exercise in a draft.
+// Route: POST /api/v1/exercises/:id/sets
+func AddSetHandler(activityRepo *database.ActivityRepo, gymExerciseRepo *database.GymExerciseRepo, gymSetRepo *database.GymSetRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		gymExerciseID, ok := idParam(ctx, "id")
+		if !ok {
+			return
+		}
+		var body setBody
+		if ctx.Request.ContentLength > 0 && !bindJSON(ctx, &body) {
+			return
+		}
+		values, fields := body.values()
+		if len(fields) > 0 {
+			abortWithValidation(ctx, fields)
+			return
+		}
+
+		gymExercise, activity, ok := ownedGymExercise(ctx, gymExerciseRepo, activityRepo, gymExerciseID)
+		if !ok || !requireDraft(ctx, activity) {
+			return
+		}
+		existing, err := gymSetRepo.GetGymSetsByExerciseID(gymExercise.ID)
+		if err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Could not count sets")
+			return
+		}
+
+		gymSet := &database.GymSet{GymExerciseID: gymExercise.ID, SetNumber: len(existing) + 1}
+		if err := gymSetRepo.CreateGymSet(gymSet); err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to create set")
+			return
+		}
+		if len(values) > 0 {
+			if gymSet, err = gymSetRepo.UpdateSetValues(gymSet.ID, values); err != nil {
+				abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to create set")
+				return
+			}
+		}
+		respond(ctx, http.StatusCreated, newSet(gymSet))
+	}
+}
+
+// UpdateSetHandler changes the values of a set in a draft, or marks it completed.
+// Route: PATCH /api/v1/sets/:id
+func UpdateSetHandler(activityRepo *database.ActivityRepo, gymExerciseRepo *database.GymExerciseRepo, gymSetRepo *database.GymSetRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		setID, ok := idParam(ctx, "id")
+		if !ok {
+			return
+		}
+		var body setBody
+		if !bindJSON(ctx, &body) {
+			return
+		}
+		values, fields := body.values()
+		if len(fields) > 0 {
+			abortWithValidation(ctx, fields)
+			return
+		}
+
+		gymSet, activity, ok := ownedSet(ctx, gymSetRepo, gymExerciseRepo, activityRepo, setID)
+		if !ok || !requireDraft(ctx, activity) {
+			return
+		}
+		if len(values) > 0 {
+			var err error
+			if gymSet, err = gymSetRepo.UpdateSetValues(gymSet.ID, values); err != nil {
+				abortWithDBError(ctx, err, "Set")
+				return
+			}
+		}
+		respond(ctx, http.StatusOK, newSet(gymSet))
+	}
+}
+
+// DeleteSetHandler removes a set from a draft.
+// Route: DELETE /api/v1/sets/:id
+func DeleteSetHandler(activityRepo *database.ActivityRepo, gymExerciseRepo *database.GymExerciseRepo, gymSetRepo *database.GymSetRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		setID, ok := idParam(ctx, "id")
+		if !ok {
+			return
+		}
+		gymSet, activity, ok := ownedSet(ctx, gymSetRepo, gymExerciseRepo, activityRepo, setID)
+		if !ok || !requireDraft(ctx, activity) {
+			return
+		}
+		if err := gymSetRepo.DeleteSet(gymSet.ID); err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to delete set")
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	}
+}
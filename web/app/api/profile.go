@@ -0,0 +1,136 @@
+package api
+
+import (
+	"fitness/platform/database"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetProfileHandler returns the signed in user's profile and training settings.
+// Route: GET /api/v1/profile
+func GetProfileHandler(userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := userRepo.GetUserById(uint64(currentUserID(ctx)))
+		if err != nil {
+			abortWithDBError(ctx, err, "User")
+			return
+		}
+		respond(ctx, http.StatusOK, newProfile(user))
+	}
+}
+
+// UpdateProfileHandler changes the user's profile and training settings, with the same limits as
+// the profile page. Names come from the login provider, so they can only be changed on the web.
+// Route: PATCH /api/v1/profile
+func UpdateProfileHandler(userRepo *database.UserRepo, streakRepo *database.StreakRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var body struct {
+			Username               *string  `json:"username"`
+			Bio                    *string  `json:"bio"`
+			Location               *string  `json:"location"`
+			HeightCM               *int     `json:"height_cm"`
+			CurrentWeightKG        *float64 `json:"current_weight_kg"`
+			StreakRestDays         *int     `json:"streak_rest_days"`
+			StreakWeeklyTarget     *int     `json:"streak_weekly_target"`
+			ProgressionIncrementKG *float64 `json:"progression_increment_kg"`
+			ProgressionTargetReps  *int     `json:"progression_target_reps"`
+			DefaultRestSeconds     *int     `json:"default_rest_seconds"`
+			DraftCleanup           *string  `json:"draft_cleanup"`
+		}
+		if !bindJSON(ctx, &body) {
+			return
+		}
+
+		user, err := userRepo.GetUserById(uint64(currentUserID(ctx)))
+		if err != nil {
+			abortWithDBError(ctx, err, "User")
+			return
+		}
+
+		fields := map[string]string{}
+		if body.Username != nil {
+			if strings.TrimSpace(*body.Username) == "" {
+				fields["username"] = "cannot be empty"
+			}
+			user.Username = strings.TrimSpace(*body.Username)
+		}
+		if body.Bio != nil {
+			user.Bio = *body.Bio
+		}
+		if body.Location != nil {
+			user.Location = *body.Location
+		}
+		if body.HeightCM != nil {
+			if *body.HeightCM < 0 {
+				fields["height_cm"] = "cannot be negative"
+			}
+			user.HeightCM = *body.HeightCM
+		}
+		if body.CurrentWeightKG != nil {
+			if *body.CurrentWeightKG < 0 {
+				fields["current_weight_kg"] = "cannot be negative"
+			}
+			user.CurrentWeightKG = *body.CurrentWeightKG
+		}
+		if body.StreakRestDays != nil {
+			if *body.StreakRestDays < 0 || *body.StreakRestDays > 6 {
+				fields["streak_rest_days"] = "must be between 0 and 6"
+			}
+			user.StreakRestDays = *body.StreakRestDays
+		}
+		if body.StreakWeeklyTarget != nil {
+			if *body.StreakWeeklyTarget < 1 || *body.StreakWeeklyTarget > 7 {
+				fields["streak_weekly_target"] = "must be between 1 and 7"
+			}
+			user.StreakWeeklyTarget = *body.StreakWeeklyTarget
+		}
+		if body.ProgressionIncrementKG != nil {
+			if *body.ProgressionIncrementKG < 0 {
+				fields["progression_increment_kg"] = "cannot be negative"
+			}
+			user.ProgressionIncrementKG = *body.ProgressionIncrementKG
+		}
+		if body.ProgressionTargetReps != nil {
+			if *body.ProgressionTargetReps < 1 {
+				fields["progression_target_reps"] = "must be at least 1"
+			}
+			user.ProgressionTargetReps = *body.ProgressionTargetReps
+		}
+		if body.DefaultRestSeconds != nil {
+			if *body.DefaultRestSeconds < 0 || *body.DefaultRestSeconds > 3600 {
+				fields["default_rest_seconds"] = "must be between 0 and 3600"
+			}
+			user.DefaultRestSeconds = *body.DefaultRestSeconds
+		}
+		if body.DraftCleanup != nil {
+			switch cleanup := database.DraftCleanup(*body.DraftCleanup); cleanup {
+			case database.DraftCleanupFinish, database.DraftCleanupDiscard, database.DraftCleanupKeep:
+				user.DraftCleanup = cleanup
+			default:
+				fields["draft_cleanup"] = "must be finish, discard or keep"
+			}
+		}
+		if len(fields) > 0 {
+			abortWithValidation(ctx, fields)
+			return
+		}
+
+		if err := userRepo.UpdateUser(user); err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to update profile")
+			return
+		}
+		// Updates skips zero values, so the training settings are saved separately to allow zeros.
+		if err := userRepo.UpdateTrainingSettings(user); err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, "internal_error", "Failed to update profile")
+			return
+		}
+		if _, err := streakRepo.RecalculateStreak(user.ID); err != nil {
+			log.Printf("Failed to recalculate streak for user %d: %v", user.ID, err)
+		}
+
+		respond(ctx, http.StatusOK, newProfile(user))
+	}
+}
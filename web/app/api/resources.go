@@ -0,0 +1,188 @@
+package api
+
+import (
+	"fitness/platform/database"
+	"sort"
+	"time"
+)
+
+// The types below are how each model is shown in the API, so the database models can
+// change without changing what clients see.
+
+type Activity struct {
+	ID                 uint          `json:"id"`
+	Type               string        `json:"type"`
+	Name               string        `json:"name"`
+	Status             string        `json:"status"`
+	ActivityTime       time.Time     `json:"activity_time"`
+	Notes              string        `json:"notes"`
+	StartTime          *time.Time    `json:"start_time"`
+	FinishTime         *time.Time    `json:"finish_time"`
+	Version            int           `json:"version"`
+	OriginalActivityID *uint         `json:"original_activity_id"`
+	Exercises          []GymExercise `json:"exercises,omitempty"`
+}
+
+type GymExercise struct {
+	ID                   uint    `json:"id"`
+	ActivityID           uint    `json:"activity_id"`
+	ExerciseDefinitionID uint    `json:"exercise_definition_id"`
+	ExerciseName         string  `json:"exercise_name,omitempty"`
+	SortNumber           int     `json:"sort_number"`
+	SupersetID           *string `json:"superset_id"`
+	Sets                 []Set   `json:"sets"`
+}
+
+type Set struct {
+	ID            uint       `json:"id"`
+	GymExerciseID uint       `json:"gym_exercise_id"`
+	SetNumber     int        `json:"set_number"`
+	Reps          int        `json:"reps"`
+	WeightKG      float64    `json:"weight_kg"`
+	SetType       string     `json:"set_type"`
+	Notes         string     `json:"notes"`
+	CompletedAt   *time.Time `json:"completed_at"`
+	RestSeconds   *int       `json:"rest_seconds"`
+}
+
+type ExerciseDefinition struct {
+	ID                 uint     `json:"id"`
+	Name               string   `json:"name"`
+	Description        string   `json:"description"`
+	PrimaryMuscleGroup string   `json:"primary_muscle_group"`
+	SecondaryMuscles   []string `json:"secondary_muscles"`
+	BodyPart           string   `json:"body_part"`
+	Equipment          string   `json:"equipment"`
+	VideoUrl           string   `json:"video_url"`
+	ImageUrlStart      string   `json:"image_url_start"`
+	ImageUrlEnd        string   `json:"image_url_end"`
+	DefaultRestSeconds *int     `json:"default_rest_seconds"`
+}
+
+type Profile struct {
+	ID                     uint      `json:"id"`
+	Username               string    `json:"username"`
+	Email                  string    `json:"email"`
+	FirstName              string    `json:"first_name"`
+	LastName               string    `json:"last_name"`
+	Bio                    string    `json:"bio"`
+	Location               string    `json:"location"`
+	ProfilePictureUrl      string    `json:"profile_picture_url"`
+	Dob                    time.Time `json:"dob"`
+	Gender                 string    `json:"gender"`
+	PrimarySport           string    `json:"primary_sport"`
+	HeightCM               int       `json:"height_cm"`
+	CurrentWeightKG        float64   `json:"current_weight_kg"`
+	UnitSystem             string    `json:"unit_system"`
+	StreakRestDays         int       `json:"streak_rest_days"`
+	StreakWeeklyTarget     int       `json:"streak_weekly_target"`
+	ProgressionIncrementKG float64   `json:"progression_increment_kg"`
+	ProgressionTargetReps  int       `json:"progression_target_reps"`
+	DefaultRestSeconds     int       `json:"default_rest_seconds"`
+	DraftCleanup           string    `json:"draft_cleanup"`
+	ActiveActivityID       *uint     `json:"active_activity_id"`
+}
+
+// newActivity converts an activity, including its exercises and sets if they were loaded.
+func newActivity(activity *database.Activity) Activity {
+	result := Activity{
+		ID:                 activity.ID,
+		Type:               activity.Type,
+		Name:               activity.Name,
+		Status:             string(activity.Status),
+		ActivityTime:       activity.ActivityTime,
+		Notes:              activity.Notes,
+		StartTime:          activity.StartTime,
+		FinishTime:         activity.FinishTime,
+		Version:            activity.Version,
+		OriginalActivityID: activity.OriginalActivityID,
+	}
+
+	exercises := make([]database.GymExercise, len(activity.GymExercises))
+	copy(exercises, activity.GymExercises)
+	sort.SliceStable(exercises, func(i, j int) bool { return exercises[i].SortNumber < exercises[j].SortNumber })
+	for i := range exercises {
+		result.Exercises = append(result.Exercises, newGymExercise(&exercises[i]))
+	}
+	return result
+}
+
+func newGymExercise(gymExercise *database.GymExercise) GymExercise {
+	result := GymExercise{
+		ID:                   gymExercise.ID,
+		ActivityID:           gymExercise.ActivityID,
+		ExerciseDefinitionID: gymExercise.ExerciseDefinitionID,
+		ExerciseName:         gymExercise.ExerciseDefinition.Name,
+		SortNumber:           gymExercise.SortNumber,
+		SupersetID:           gymExercise.SupersetID,
+		Sets:                 []Set{},
+	}
+
+	sets := make([]database.GymSet, len(gymExercise.Sets))
+	copy(sets, gymExercise.Sets)
+	sort.SliceStable(sets, func(i, j int) bool { return sets[i].SetNumber < sets[j].SetNumber })
+	for i := range sets {
+		result.Sets = append(result.Sets, newSet(&sets[i]))
+	}
+	return result
+}
+
+func newSet(set *database.GymSet) Set {
+	return Set{
+		ID:            set.ID,
+		GymExerciseID: set.GymExerciseID,
+		SetNumber:     set.SetNumber,
+		Reps:          set.Reps,
+		WeightKG:      set.WeightKG,
+		SetType:       set.SetType,
+		Notes:         set.Notes,
+		CompletedAt:   set.CompletedAt,
+		RestSeconds:   set.RestSeconds,
+	}
+}
+
+func newExerciseDefinition(definition *database.ExerciseDefinition) ExerciseDefinition {
+	secondary := []string(definition.SecondaryMuscles)
+	if secondary == nil {
+		secondary = []string{}
+	}
+	return ExerciseDefinition{
+		ID:                 definition.ID,
+		Name:               definition.Name,
+		Description:        definition.Description,
+		PrimaryMuscleGroup: definition.PrimaryMuscleGroup,
+		SecondaryMuscles:   secondary,
+		BodyPart:           definition.BodyPart,
+		Equipment:          definition.Equipment,
+		VideoUrl:           definition.VideoUrl,
+		ImageUrlStart:      definition.ImageUrlStart,
+		ImageUrlEnd:        definition.ImageUrlEnd,
+		DefaultRestSeconds: definition.DefaultRestSeconds,
+	}
+}
+
+func newProfile(user *database.User) Profile {
+	return Profile{
+		ID:                     user.ID,
+		Username:               user.Username,
+		Email:                  user.Email,
+		FirstName:              user.FirstName,
+		LastName:               user.LastName,
+		Bio:                    user.Bio,
+		Location:               user.Location,
+		ProfilePictureUrl:      user.ProfilePictureUrl,
+		Dob:                    user.Dob,
+		Gender:                 user.Gender,
+		PrimarySport:           user.PrimarySport,
+		HeightCM:               user.HeightCM,
+		CurrentWeightKG:        user.CurrentWeightKG,
+		UnitSystem:             user.UnitSystem,
+		StreakRestDays:         user.StreakRestDays,
+		StreakWeeklyTarget:     user.StreakWeeklyTarget,
+		ProgressionIncrementKG: user.ProgressionIncrementKG,
+		ProgressionTargetReps:  user.ProgressionTargetReps,
+		DefaultRestSeconds:     user.DefaultRestSeconds,
+		DraftCleanup:           string(user.DraftCleanup),
+		ActiveActivityID:       user.ActiveActivityID,
+	}
+}
@@ -0,0 +1,259 @@
+// Package data has the page where users export their workouts and import them again.
+package data
+
+import (
+	"bytes"
+	"errors"
+	"fitness/platform/database"
+	"fitness/platform/export"
+	"fitness/platform/jobs"
+	"fitness/platform/track"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// syncExportLimit is the most workouts exported straight away. Bigger exports are queued.
+	syncExportLimit = 250
+	// maxUploadSize is the largest file that can be imported.
+	maxUploadSize = 50 << 20
+	// previewExpiry is how long an import that needs checking waits for the user to check it.
+	previewExpiry = 24 * time.Hour
+)
+
+// PageHandler shows the export and import options along with the user's recent jobs.
+// Route: GET /data
+func PageHandler(jobRepo *database.DataJobRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not find user.")
+			return
+		}
+		jobList, err := jobRepo.GetJobsByUserID(sessionUser.ID)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not load exports and imports")
+			return
+		}
+
+		ctx.HTML(http.StatusOK, "data.html", gin.H{
+			"User":  sessionUser,
+			"Jobs":  jobList,
+			"Error": ctx.Query("error"),
+		})
+	}
+}
+
+// JobsHandler renders the list of jobs, which keeps refreshing while any are unfinished.
+// Route: GET /ui/data-jobs
+func JobsHandler(jobRepo *database.DataJobRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		jobList, err := jobRepo.GetJobsByUserID(sessionUserId)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not load exports and imports")
+			return
+		}
+		ctx.HTML(http.StatusOK, "_data-jobs.html", gin.H{"Jobs": jobList})
+	}
+}
+
+// ExportHandler exports all of the user's finished workouts and cardio activities as a CSV zip
+// or a JSON document.
+// Small exports are downloaded straight away; big ones are queued and linked from the page
+// when they are ready.
+// Route: POST /data/export
+func ExportHandler(jobRepo *database.DataJobRepo, activityRepo *database.ActivityRepo, runner *jobs.Runner) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		format := database.DataFormat(ctx.PostForm("Format"))
+		if format != database.DataFormatCSV && format != database.DataFormatJSON {
+			ctx.String(http.StatusBadRequest, "Choose CSV or JSON.")
+			return
+		}
+
+		count, err := activityRepo.CountFinishedActivities(sessionUserId)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not count workouts")
+			return
+		}
+
+		if count <= syncExportLimit {
+			now := time.Now()
+			file, _, err := jobs.Export(activityRepo, sessionUserId, format, now)
+			if err != nil {
+				log.Printf("Failed to export workouts of user %d: %v", sessionUserId, err)
+				ctx.String(http.StatusInternalServerError, "Could not export workouts")
+				return
+			}
+			ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.FileName(format, now)))
+			ctx.Data(http.StatusOK, export.ContentType(format), file)
+			return
+		}
+
+		job := &database.DataJob{UserID: sessionUserId, Kind: database.DataJobExport, Format: format, Status: database.DataJobPending}
+		if err := jobRepo.CreateJob(job); err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not queue export")
+			return
+		}
+		runner.Wake()
+		ctx.Redirect(http.StatusSeeOther, "/data")
+	}
+}
+
+// ImportHandler takes an uploaded file to import. Exports from here are queued straight away
+// if every exercise in them is in the library, and GPX, TCX and FIT files from a watch or bike
+// computer are checked and queued the same way. Exports from Strong and Hevy, and exports from
+// here with exercises the library doesn't have, are read first, so the user can check what will
+// be imported and which exercises they are, before it is queued. Strong and Hevy write local
+// times without a zone, so they are read in the time zone the user's browser sends.
+// Route: POST /data/import
+func ImportHandler(jobRepo *database.DataJobRepo, exerciseRepo *database.ExerciseRepo, runner *jobs.Runner) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+
+		header, err := ctx.FormFile("File")
+		if err != nil {
+			importError(ctx, "Choose a file to import.")
+			return
+		}
+		if header.Size > maxUploadSize {
+			importError(ctx, "That file is too big to import.")
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not read the file")
+			return
+		}
+		defer file.Close()
+		contents, err := io.ReadAll(io.LimitReader(file, maxUploadSize))
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not read the file")
+			return
+		}
+
+		job := &database.DataJob{
+			UserID:   sessionUserId,
+			Kind:     database.DataJobImport,
+			Status:   database.DataJobPending,
+			FileName: header.Filename,
+			Input:    contents,
+		}
+		trackFormat, trackErr := track.Detect(contents)
+		switch trimmed := bytes.TrimSpace(contents); {
+		case bytes.HasPrefix(trimmed, []byte("PK\x03\x04")), bytes.HasPrefix(trimmed, []byte("{")):
+			doc, format, err := export.Read(contents)
+			if err != nil {
+				importError(ctx, "That file can't be imported: "+err.Error())
+				return
+			}
+			job.Format = format
+			unknown, err := unknownExercises(doc, exerciseRepo)
+			if err != nil {
+				ctx.String(http.StatusInternalServerError, "Could not check the exercises in the file")
+				return
+			}
+			if len(unknown) > 0 {
+				expiresAt := time.Now().Add(previewExpiry)
+				job.Status = database.DataJobPreview
+				job.ExpiresAt = &expiresAt
+			}
+		case trackErr == nil:
+			if _, err := track.Parse(contents, trackFormat); err != nil {
+				importError(ctx, "That file can't be imported: "+err.Error())
+				return
+			}
+			job.Format = trackFormat
+		default:
+			if job.Format, err = export.DetectApp(contents); err != nil {
+				importError(ctx, "That file isn't an export from here, Strong or Hevy, or a GPX, TCX or FIT file.")
+				return
+			}
+			job.WeightUnit = export.UnitKG
+			if ctx.PostForm("WeightUnit") == export.UnitLBS {
+				job.WeightUnit = export.UnitLBS
+			}
+			if _, err := time.LoadLocation(ctx.PostForm("TimeZone")); err == nil {
+				job.TimeZone = ctx.PostForm("TimeZone")
+			}
+			if _, err := export.ReadApp(contents, job.Format, job.WeightUnit, export.Location(job.TimeZone)); err != nil {
+				importError(ctx, "That file can't be imported: "+err.Error())
+				return
+			}
+			expiresAt := time.Now().Add(previewExpiry)
+			job.Status = database.DataJobPreview
+			job.ExpiresAt = &expiresAt
+		}
+
+		if err := jobRepo.CreateJob(job); err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not queue import")
+			return
+		}
+		if job.Status == database.DataJobPreview {
+			ctx.Redirect(http.StatusSeeOther, fmt.Sprintf("/data/import/%d", job.ID))
+			return
+		}
+		runner.Wake()
+		ctx.Redirect(http.StatusSeeOther, "/data")
+	}
+}
+
+// unknownExercises returns the names of the exercises in a document that aren't in the library.
+func unknownExercises(doc *export.Document, exerciseRepo *database.ExerciseRepo) ([]string, error) {
+	var unknown []string
+	for _, name := range doc.ExerciseNames() {
+		_, err := exerciseRepo.GetExerciseByName(name)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			unknown = append(unknown, name)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return unknown, nil
+}
+
+// importError sends the user back to the data page with an error about their upload.
+func importError(ctx *gin.Context, message string) {
+	ctx.Redirect(http.StatusSeeOther, "/data?error="+url.QueryEscape(message))
+}
+
+// DownloadHandler downloads the file made by a finished export.
+// Route: GET /data/jobs/:id/download
+func DownloadHandler(jobRepo *database.DataJobRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		jobID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid export ID")
+			return
+		}
+
+		job, err := jobRepo.GetJobByID(uint(jobID))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				ctx.String(http.StatusNotFound, "Export not found")
+				return
+			}
+			ctx.String(http.StatusInternalServerError, "Could not load export")
+			return
+		}
+		if job.UserID != sessionUserId || job.Kind != database.DataJobExport || job.Status != database.DataJobDone {
+			ctx.String(http.StatusNotFound, "Export not found")
+			return
+		}
+
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", job.FileName))
+		ctx.Data(http.StatusOK, export.ContentType(job.Format), job.Output)
+	}
+}
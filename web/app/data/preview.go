@@ -0,0 +1,274 @@
+package data
+
+import (
+	"errors"
+	"fitness/platform/database"
+	"fitness/platform/export"
+	"fitness/platform/jobs"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// previewWorkoutLimit is how many of the workouts in a file the preview lists.
+const previewWorkoutLimit = 20
+
+// choiceSkip is the choice to leave out an exercise that isn't matched to a library exercise.
+const choiceSkip = "skip"
+
+// previewWorkout is a workout in a file being imported.
+type previewWorkout struct {
+	Name      string
+	Time      time.Time
+	Exercises int
+	Sets      int
+	Duplicate bool // The user already has it, so it will be skipped
+}
+
+// previewExercise is an exercise in a file being imported, and what it will be imported as.
+type previewExercise struct {
+	Index       int
+	Name        string
+	Workouts    int
+	Sets        int
+	Choice      string // choiceSkip or the ID of a library exercise
+	Saved       bool   // Choice is what the user chose last time
+	Suggestions []export.Match
+}
+
+// PreviewHandler shows what an import will add, and lets the user say which library exercise
+// each of the file's exercises is. The choice they made last time is selected, and otherwise the
+// closest library exercise by name. Exercises with no close match are left out unless the user
+// picks one, as the library is shared by everyone and imports don't add to it.
+// Route: GET /data/import/:id
+func PreviewHandler(jobRepo *database.DataJobRepo, userRepo *database.UserRepo, activityRepo *database.ActivityRepo, exerciseRepo *database.ExerciseRepo, mappingRepo *database.ExerciseMappingRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not find user.")
+			return
+		}
+		job, doc, ok := previewJob(ctx, jobRepo, sessionUserId)
+		if !ok {
+			return
+		}
+
+		definitions, err := exerciseRepo.GetExerciseList()
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not load exercises")
+			return
+		}
+		mappings, err := mappingRepo.GetMappings(sessionUserId, job.Format)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not load exercise matches")
+			return
+		}
+
+		first, last := doc.Activities[0].ActivityTime, doc.Activities[0].ActivityTime
+		for _, activity := range doc.Activities {
+			if activity.ActivityTime.Before(first) {
+				first = activity.ActivityTime
+			}
+			if activity.ActivityTime.After(last) {
+				last = activity.ActivityTime
+			}
+		}
+		existing, err := activityRepo.GetActivityTimesBetween(sessionUserId, first, last)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not check for workouts you already have")
+			return
+		}
+		have := map[string]bool{}
+		for _, activity := range existing {
+			have[export.Key(activity)] = true
+		}
+
+		var (
+			workouts   []previewWorkout
+			duplicates int
+			totalSets  int
+			counts     = map[string]*previewExercise{}
+		)
+		for _, activity := range doc.Activities {
+			workout := previewWorkout{
+				Name:      activity.Name,
+				Time:      activity.ActivityTime,
+				Exercises: len(activity.Exercises),
+				Duplicate: have[activity.Key()],
+			}
+			seen := map[string]bool{}
+			for _, exercise := range activity.Exercises {
+				workout.Sets += len(exercise.Sets)
+				key := export.MappingKey(exercise.Name)
+				if counts[key] == nil {
+					counts[key] = &previewExercise{}
+				}
+				counts[key].Sets += len(exercise.Sets)
+				if !seen[key] {
+					seen[key] = true
+					counts[key].Workouts++
+				}
+			}
+			if workout.Duplicate {
+				duplicates++
+			} else {
+				totalSets += workout.Sets
+			}
+			if len(workouts) < previewWorkoutLimit {
+				workouts = append(workouts, workout)
+			}
+		}
+
+		matcher := export.NewMatcher(definitions)
+		var exercises []*previewExercise
+		for i, name := range doc.ExerciseNames() {
+			exercise := counts[export.MappingKey(name)]
+			exercise.Index = i
+			exercise.Name = name
+			exercise.Suggestions = matcher.Top(name, 3)
+			exercise.Choice = choiceSkip
+			if mapping, ok := mappings[export.MappingKey(name)]; ok {
+				exercise.Saved = true
+				exercise.Choice = choiceSkip
+				if mapping.ExerciseDefinitionID != nil {
+					exercise.Choice = strconv.FormatUint(uint64(*mapping.ExerciseDefinitionID), 10)
+				}
+			} else if len(exercise.Suggestions) > 0 && exercise.Suggestions[0].Score >= export.SuggestThreshold {
+				exercise.Choice = strconv.FormatUint(uint64(exercise.Suggestions[0].Definition.ID), 10)
+			}
+			exercises = append(exercises, exercise)
+		}
+
+		ctx.HTML(http.StatusOK, "data-import.html", gin.H{
+			"User":        sessionUser,
+			"Job":         job,
+			"Source":      sourceName(job.Format),
+			"Total":       len(doc.Activities),
+			"New":         len(doc.Activities) - duplicates,
+			"Duplicates":  duplicates,
+			"Sets":        totalSets,
+			"First":       first,
+			"Last":        last,
+			"Workouts":    workouts,
+			"More":        len(doc.Activities) - len(workouts),
+			"Exercises":   exercises,
+			"Definitions": definitions,
+		})
+	}
+}
+
+// ConfirmHandler saves the exercises the user matched up, so this import and later ones from
+// the same app use them, and queues the import.
+// Route: POST /data/import/:id/confirm
+func ConfirmHandler(jobRepo *database.DataJobRepo, exerciseRepo *database.ExerciseRepo, mappingRepo *database.ExerciseMappingRepo, runner *jobs.Runner) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		job, doc, ok := previewJob(ctx, jobRepo, sessionUserId)
+		if !ok {
+			return
+		}
+
+		for i, name := range doc.ExerciseNames() {
+			key := export.MappingKey(name)
+			choice := ctx.PostForm(fmt.Sprintf("Exercise%d", i))
+			var err error
+			switch choice {
+			case choiceSkip:
+				err = mappingRepo.SaveMapping(&database.ExerciseMapping{UserID: sessionUserId, Source: job.Format, ExternalName: key})
+			default:
+				definitionID, parseErr := strconv.ParseUint(choice, 10, 64)
+				if parseErr != nil {
+					ctx.String(http.StatusBadRequest, fmt.Sprintf("Choose what to import %s as", name))
+					return
+				}
+				if _, err := exerciseRepo.GetExerciseByID(uint(definitionID)); err != nil {
+					ctx.String(http.StatusBadRequest, fmt.Sprintf("The exercise chosen for %s doesn't exist", name))
+					return
+				}
+				id := uint(definitionID)
+				err = mappingRepo.SaveMapping(&database.ExerciseMapping{UserID: sessionUserId, Source: job.Format, ExternalName: key, ExerciseDefinitionID: &id})
+			}
+			if err != nil {
+				log.Printf("Failed to save exercise mapping %q for user %d: %v", key, sessionUserId, err)
+				ctx.String(http.StatusInternalServerError, "Could not save exercise matches")
+				return
+			}
+		}
+
+		if _, err := jobRepo.QueueJob(job.ID); err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not queue import")
+			return
+		}
+		runner.Wake()
+		ctx.Redirect(http.StatusSeeOther, "/data")
+	}
+}
+
+// CancelHandler throws away an import from another app that the user decided against.
+// Route: POST /data/import/:id/cancel
+func CancelHandler(jobRepo *database.DataJobRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		job, ok := loadPreviewJob(ctx, jobRepo, sessionUserId)
+		if !ok {
+			return
+		}
+		if err := jobRepo.DeleteJob(job.ID); err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not cancel import")
+			return
+		}
+		ctx.Redirect(http.StatusSeeOther, "/data")
+	}
+}
+
+// loadPreviewJob loads the user's import that is waiting to be checked, writing an error
+// response if there isn't one.
+func loadPreviewJob(ctx *gin.Context, jobRepo *database.DataJobRepo, userID uint) (*database.DataJob, bool) {
+	jobID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.String(http.StatusBadRequest, "Invalid import ID")
+		return nil, false
+	}
+	job, err := jobRepo.GetJobByID(uint(jobID))
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.String(http.StatusInternalServerError, "Could not load import")
+		return nil, false
+	}
+	if err != nil || job.UserID != userID || job.Kind != database.DataJobImport || job.Status != database.DataJobPreview {
+		ctx.String(http.StatusNotFound, "Import not found")
+		return nil, false
+	}
+	return job, true
+}
+
+// previewJob loads the user's import that is waiting to be checked, along with the workouts in it.
+func previewJob(ctx *gin.Context, jobRepo *database.DataJobRepo, userID uint) (*database.DataJob, *export.Document, bool) {
+	job, ok := loadPreviewJob(ctx, jobRepo, userID)
+	if !ok {
+		return nil, nil, false
+	}
+	doc, err := export.ReadFile(job.Input, job.Format, job.WeightUnit, export.Location(job.TimeZone))
+	if err != nil {
+		ctx.String(http.StatusUnprocessableEntity, "The file can't be imported: "+err.Error())
+		return nil, nil, false
+	}
+	return job, doc, true
+}
+
+// sourceName is what to call the app an import came from.
+func sourceName(format database.DataFormat) string {
+	switch format {
+	case database.DataFormatStrong:
+		return "Strong"
+	case database.DataFormatHevy:
+		return "Hevy"
+	}
+	return "your export"
+}
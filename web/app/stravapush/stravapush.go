@@ -0,0 +1,58 @@
+// Package stravapush receives the events Strava pushes to the app's webhook subscription. Strava
+// calls these routes itself, so they don't use the session.
+package stravapush
+
+import (
+	"fitness/platform/database"
+	"fitness/platform/strava"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChallengeHandler answers the request Strava makes to check the callback when a subscription is
+// created, echoing its challenge if the verify token matches the one the subscription was
+// created with. Without a verify token, no subscription can be created.
+// Route: GET /strava/webhook
+func ChallengeHandler(verifyToken string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if verifyToken == "" || ctx.Query("hub.mode") != "subscribe" || ctx.Query("hub.verify_token") != verifyToken {
+			ctx.String(http.StatusForbidden, "Invalid subscription request")
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"hub.challenge": ctx.Query("hub.challenge")})
+	}
+}
+
+// EventHandler queues an event pushed by Strava and wakes the processor to apply it. Strava
+// wants an answer within two seconds, so nothing is fetched here. Events for another
+// subscription, when subscriptionID is set, or that the app doesn't handle are acknowledged
+// and dropped so Strava doesn't retry them.
+// Route: POST /strava/webhook
+func EventHandler(stravaRepo *database.StravaRepo, events *strava.EventProcessor, subscriptionID int64) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var event strava.Event
+		if err := ctx.ShouldBindJSON(&event); err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid event")
+			return
+		}
+		if subscriptionID != 0 && event.SubscriptionID != subscriptionID {
+			log.Printf("Strava: ignoring event for unknown subscription %d", event.SubscriptionID)
+			ctx.Status(http.StatusOK)
+			return
+		}
+		if !event.Valid() {
+			ctx.Status(http.StatusOK)
+			return
+		}
+
+		if err := stravaRepo.EnqueueEvent(event.ToStravaEvent()); err != nil {
+			log.Printf("Strava: failed to queue %s %s event for athlete %d: %v", event.ObjectType, event.AspectType, event.OwnerID, err)
+			ctx.String(http.StatusInternalServerError, "Could not queue event")
+			return
+		}
+		events.Wake()
+		ctx.Status(http.StatusOK)
+	}
+}
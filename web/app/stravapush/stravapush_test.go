@@ -0,0 +1,84 @@
+package stravapush
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/strava/webhook", ChallengeHandler("s3cret"))
+	router.POST("/strava/webhook", EventHandler(nil, nil, 99))
+	return router
+}
+
+func TestChallengeHandlerEchoesChallenge(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/strava/webhook?hub.mode=subscribe&hub.challenge=15f7d1a91c1f40f8a748fd134752feb3&hub.verify_token=s3cret", nil)
+	newTestRouter().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if got := body["hub.challenge"]; got != "15f7d1a91c1f40f8a748fd134752feb3" {
+		t.Errorf("hub.challenge = %q", got)
+	}
+}
+
+func TestChallengeHandlerRejectsWrongToken(t *testing.T) {
+	for _, query := range []string{
+		"hub.mode=subscribe&hub.challenge=abc&hub.verify_token=wrong",
+		"hub.mode=unsubscribe&hub.challenge=abc&hub.verify_token=s3cret",
+		"hub.mode=subscribe&hub.challenge=abc",
+	} {
+		w := httptest.NewRecorder()
+		newTestRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/strava/webhook?"+query, nil))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want 403", query, w.Code)
+		}
+	}
+}
+
+func TestChallengeHandlerWithoutVerifyToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/strava/webhook", ChallengeHandler(""))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/strava/webhook?hub.mode=subscribe&hub.challenge=abc&hub.verify_token=", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", w.Code)
+	}
+}
+
+// Events that are never queued are answered without touching the database.
+func TestEventHandlerDropsUnwantedEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"malformed", `{"object_type":`, http.StatusBadRequest},
+		{"other subscription", `{"aspect_type":"create","object_id":1,"object_type":"activity","owner_id":2,"subscription_id":100}`, http.StatusOK},
+		{"unhandled object", `{"aspect_type":"create","object_id":1,"object_type":"route","owner_id":2,"subscription_id":99}`, http.StatusOK},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/strava/webhook", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		newTestRouter().ServeHTTP(w, req)
+		if w.Code != test.want {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.want)
+		}
+	}
+}
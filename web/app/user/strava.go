@@ -0,0 +1,188 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fitness/platform/database"
+	"fitness/platform/strava"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// stravaStateKey is where the OAuth state for connecting Strava is kept in the session.
+const stravaStateKey = "strava_state"
+
+// renderStrava renders the Strava section of the profile page, along with anything extra in data.
+func renderStrava(ctx *gin.Context, stravaRepo *database.StravaRepo, auth *strava.Auth, userID uint, data gin.H) {
+	account, err := stravaRepo.GetAccountByUserID(userID)
+	if err != nil {
+		ctx.String(http.StatusInternalServerError, "Could not load Strava account.")
+		return
+	}
+	data["Account"] = account
+	data["Configured"] = auth != nil
+	ctx.HTML(http.StatusOK, "_strava.html", data)
+}
+
+// StravaHandler renders the user's connected Strava account and how its sync is going.
+// Route: GET /profile/strava
+func StravaHandler(stravaRepo *database.StravaRepo, auth *strava.Auth) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		renderStrava(ctx, stravaRepo, auth, sessionUserId, gin.H{})
+	}
+}
+
+// ConnectStravaHandler sends the user to Strava to allow access to their activities.
+// Route: GET /strava/connect
+func ConnectStravaHandler(auth *strava.Auth) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if auth == nil {
+			ctx.String(http.StatusNotFound, "Strava isn't set up on this server.")
+			return
+		}
+
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not start connecting Strava.")
+			return
+		}
+		state := base64.RawURLEncoding.EncodeToString(b)
+
+		session := sessions.Default(ctx)
+		session.Set(stravaStateKey, state)
+		if err := session.Save(); err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not start connecting Strava.")
+			return
+		}
+		ctx.Redirect(http.StatusTemporaryRedirect, auth.AuthCodeURL(state))
+	}
+}
+
+// StravaCallbackHandler is where Strava sends the user back to. It connects their athlete and
+// starts syncing their activities.
+// Route: GET /strava/callback
+func StravaCallbackHandler(auth *strava.Auth, syncer *strava.Syncer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if auth == nil {
+			ctx.String(http.StatusNotFound, "Strava isn't set up on this server.")
+			return
+		}
+		session := sessions.Default(ctx)
+		sessionUserId := session.Get("user").(uint)
+
+		state, _ := session.Get(stravaStateKey).(string)
+		session.Delete(stravaStateKey)
+		if err := session.Save(); err != nil {
+			log.Printf("Failed to clear Strava state for user %d: %v", sessionUserId, err)
+		}
+		if state == "" || ctx.Query("state") != state {
+			ctx.String(http.StatusBadRequest, "Invalid state parameter.")
+			return
+		}
+		if ctx.Query("error") != "" {
+			// The user chose not to allow access
+			ctx.Redirect(http.StatusSeeOther, "/profile")
+			return
+		}
+
+		account, err := auth.Connect(ctx.Request.Context(), sessionUserId, ctx.Query("code"), ctx.Query("scope"))
+		if err != nil {
+			log.Printf("Failed to connect Strava for user %d: %v", sessionUserId, err)
+			ctx.String(http.StatusBadRequest, "Could not connect Strava: "+err.Error())
+			return
+		}
+		log.Printf("Connected Strava athlete %d to user %d", account.AthleteID, sessionUserId)
+		syncer.Wake()
+		ctx.Redirect(http.StatusSeeOther, "/profile")
+	}
+}
+
+// SyncStravaHandler syncs every connected account now rather than waiting for the next sync.
+// Route: POST /profile/strava/sync
+func SyncStravaHandler(stravaRepo *database.StravaRepo, auth *strava.Auth, syncer *strava.Syncer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		syncer.Wake()
+		renderStrava(ctx, stravaRepo, auth, sessionUserId, gin.H{"Syncing": true})
+	}
+}
+
+// PostToStravaHandler turns posting the user's finished workouts to Strava on or off. Only
+// workouts finished from now on are posted.
+// Route: POST /profile/strava/post
+func PostToStravaHandler(stravaRepo *database.StravaRepo, auth *strava.Auth) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		account, err := stravaRepo.GetAccountByUserID(sessionUserId)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not load Strava account.")
+			return
+		}
+		if account == nil {
+			renderStrava(ctx, stravaRepo, auth, sessionUserId, gin.H{})
+			return
+		}
+
+		var since *time.Time
+		if ctx.PostForm("PostWorkouts") != "" {
+			if !account.CanPostWorkouts() {
+				renderStrava(ctx, stravaRepo, auth, sessionUserId, gin.H{"Error": "Reconnect Strava and allow it to upload activities to post your workouts."})
+				return
+			}
+			start := time.Now()
+			if account.PostWorkoutsSince != nil {
+				start = *account.PostWorkoutsSince
+			}
+			since = &start
+		}
+		if err := stravaRepo.SetPostWorkouts(account.ID, since); err != nil {
+			log.Printf("Failed to change Strava posting for user %d: %v", sessionUserId, err)
+			renderStrava(ctx, stravaRepo, auth, sessionUserId, gin.H{"Error": "Could not save the setting."})
+			return
+		}
+		renderStrava(ctx, stravaRepo, auth, sessionUserId, gin.H{})
+	}
+}
+
+// DisconnectStravaHandler revokes access to the user's Strava account. Their synced activities
+// are kept unless they ask for them to be removed.
+// Route: POST /profile/strava/disconnect
+func DisconnectStravaHandler(stravaRepo *database.StravaRepo, auth *strava.Auth) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		account, err := stravaRepo.GetAccountByUserID(sessionUserId)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not load Strava account.")
+			return
+		}
+		if account == nil {
+			renderStrava(ctx, stravaRepo, auth, sessionUserId, gin.H{})
+			return
+		}
+
+		if auth != nil {
+			err = auth.Disconnect(ctx.Request.Context(), account)
+		} else {
+			err = stravaRepo.DeleteAccount(account.ID)
+		}
+		if err != nil {
+			log.Printf("Failed to disconnect Strava for user %d: %v", sessionUserId, err)
+			renderStrava(ctx, stravaRepo, auth, sessionUserId, gin.H{"Error": "Could not disconnect Strava."})
+			return
+		}
+
+		if ctx.PostForm("RemoveActivities") != "" {
+			if _, err := stravaRepo.DeleteStravaActivities(sessionUserId); err != nil {
+				log.Printf("Failed to remove Strava activities of user %d: %v", sessionUserId, err)
+				renderStrava(ctx, stravaRepo, auth, sessionUserId, gin.H{"Error": "Strava was disconnected, but its activities could not be removed."})
+				return
+			}
+		}
+		renderStrava(ctx, stravaRepo, auth, sessionUserId, gin.H{})
+	}
+}
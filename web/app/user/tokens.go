@@ -0,0 +1,111 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fitness/platform/database"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// tokenPrefix starts every personal access token so they are easy to spot, e.g. in leaked config.
+const tokenPrefix = "fit_"
+
+// generateAccessToken returns a new random personal access token.
+func generateAccessToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// renderAccessTokens renders the token list on the profile page, along with anything extra in data.
+func renderAccessTokens(ctx *gin.Context, tokenRepo *database.TokenRepo, userID uint, data gin.H) {
+	tokens, err := tokenRepo.GetTokensByUserID(userID)
+	if err != nil {
+		ctx.String(http.StatusInternalServerError, "Could not load access tokens.")
+		return
+	}
+	data["Tokens"] = tokens
+	ctx.HTML(http.StatusOK, "_access-tokens.html", data)
+}
+
+// AccessTokensHandler renders the user's personal access tokens.
+// Route: GET /profile/tokens
+func AccessTokensHandler(tokenRepo *database.TokenRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		renderAccessTokens(ctx, tokenRepo, sessionUserId, gin.H{})
+	}
+}
+
+// CreateAccessTokenHandler creates a personal access token and shows it to the user, once.
+// Route: POST /profile/tokens
+func CreateAccessTokenHandler(tokenRepo *database.TokenRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+
+		name := strings.TrimSpace(ctx.PostForm("Name"))
+		if name == "" || len(name) > 100 {
+			renderAccessTokens(ctx, tokenRepo, sessionUserId, gin.H{"Error": "Give the token a name of up to 100 characters."})
+			return
+		}
+		scope := database.TokenScope(ctx.PostForm("Scope"))
+		if scope != database.TokenScopeRead && scope != database.TokenScopeWrite {
+			renderAccessTokens(ctx, tokenRepo, sessionUserId, gin.H{"Error": "Choose what the token can access."})
+			return
+		}
+
+		value, err := generateAccessToken()
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not create token.")
+			return
+		}
+		token := &database.PersonalAccessToken{
+			UserID:    sessionUserId,
+			Name:      name,
+			TokenHash: database.HashToken(value),
+			Prefix:    value[:len(tokenPrefix)+4],
+			Scope:     scope,
+		}
+		if err := tokenRepo.CreateToken(token); err != nil {
+			log.Printf("Failed to create access token for user %d: %v", sessionUserId, err)
+			ctx.String(http.StatusInternalServerError, "Could not create token.")
+			return
+		}
+
+		renderAccessTokens(ctx, tokenRepo, sessionUserId, gin.H{"NewToken": value, "NewTokenName": name})
+	}
+}
+
+// RevokeAccessTokenHandler revokes one of the user's personal access tokens.
+// Route: DELETE /profile/tokens/:id
+func RevokeAccessTokenHandler(tokenRepo *database.TokenRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		tokenID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid token ID")
+			return
+		}
+
+		if err := tokenRepo.RevokeToken(sessionUserId, uint(tokenID)); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				ctx.String(http.StatusNotFound, "Token not found")
+				return
+			}
+			ctx.String(http.StatusInternalServerError, "Could not revoke token.")
+			return
+		}
+
+		renderAccessTokens(ctx, tokenRepo, sessionUserId, gin.H{})
+	}
+}
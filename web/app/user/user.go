@@ -6,6 +6,9 @@ import (
 	"errors"
 	"fitness/platform/auth0"
 	"fitness/platform/database"
+	"fitness/platform/janitor"
+	"fitness/platform/streak"
+	"fitness/platform/zones"
 	"gorm.io/gorm"
 	"log"
 	"net/http"
@@ -31,8 +34,16 @@ func getThemeForMilestone(count int) string {
 	return "default"
 }
 
+// StaleDraft is an unfinished workout the user is warned about before the janitor cleans it up.
+type StaleDraft struct {
+	Activity      *database.Activity
+	LastTouchedAt time.Time
+	CleanupAt     time.Time
+	Cleanup       database.DraftCleanup
+}
+
 // UserHandler for our logged-in user page.
-func UserHandler(activityRepo *database.ActivityRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+func UserHandler(activityRepo *database.ActivityRepo, userRepo *database.UserRepo, draftMaxAge time.Duration) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 
 		sessionUserId := sessions.Default(ctx).Get("user").(uint)
@@ -40,8 +51,7 @@ func UserHandler(activityRepo *database.ActivityRepo, userRepo *database.UserRep
 		if err != nil {
 			ctx.String(http.StatusInternalServerError, err.Error())
 		}
-		session := sessions.Default(ctx)
-		activeID := session.Get("active_workout_id")
+		activeID, _ := ctx.Get("ActiveWorkoutID")
 
 		activityList, err := activityRepo.GetActivitiesByUserID(sessionUser.ID)
 		if err != nil {
@@ -59,23 +69,124 @@ func UserHandler(activityRepo *database.ActivityRepo, userRepo *database.UserRep
 			}
 		}
 
+		// Warn about drafts that have been left alone before the janitor gets to them.
+		var staleDrafts []StaleDraft
+		drafts, err := activityRepo.GetStaleDrafts(sessionUser.ID, time.Now().Add(-janitor.StaleAfter))
+		if err != nil {
+			log.Printf("Failed to load stale drafts for user %d: %v", sessionUser.ID, err)
+		}
+		for _, draft := range drafts {
+			staleDrafts = append(staleDrafts, StaleDraft{
+				Activity:      draft.Activity,
+				LastTouchedAt: draft.LastTouchedAt,
+				CleanupAt:     draft.LastTouchedAt.Add(draftMaxAge),
+				Cleanup:       janitor.CleanupFor(draft.Activity),
+			})
+		}
+
+		// How hard this week's runs and rides were, from Monday on
+		weekStart := streak.WeekStart(streak.Day(time.Now()))
+		weekStreams, err := activityRepo.GetStreamsBetween(sessionUser.ID, weekStart, weekStart.AddDate(0, 0, 7))
+		if err != nil {
+			log.Printf("Failed to load this week's streams for user %d: %v", sessionUser.ID, err)
+		}
+		// Synced activities are only counted once their readings have been fetched in the background
+		weekWithoutStreams, err := activityRepo.CountWithoutStreamsBetween(sessionUser.ID, weekStart, weekStart.AddDate(0, 0, 7))
+		if err != nil {
+			log.Printf("Failed to count this week's activities without streams for user %d: %v", sessionUser.ID, err)
+		}
+		heartRateZones, hasHeartRateZones := zones.HeartRate(sessionUser, time.Now())
+		powerZones, _ := zones.Power(sessionUser)
+
 		ctx.HTML(http.StatusOK, "user.html", gin.H{
-			"ActiveWorkoutID": activeID,
-			"User":            sessionUser,
-			"ActivityList":    activityList,
+			"ActiveWorkoutID":    activeID,
+			"User":               sessionUser,
+			"ActivityList":       activityList,
+			"StaleDrafts":        staleDrafts,
+			"WeekHeartRateZones": weeklyZones(weekStreams, heartRateZones, database.StreamHeartRate, false),
+			"WeekPowerZones":     weeklyZones(weekStreams, powerZones, database.StreamWatts, true),
+			"ZonesMissing":       len(weekStreams) > 0 && !hasHeartRateZones,
+			"WeekWithoutStreams": weekWithoutStreams,
 		})
 	}
 }
 
-func ProfileHandler(userRepo *database.UserRepo) gin.HandlerFunc {
+// weeklyZones adds up the time the week's activities spent in each zone, counting only rides if
+// ridesOnly is set. It is nil if there are no zones or no time in them.
+func weeklyZones(streams []*database.ActivityStream, bands zones.Zones, kind database.StreamKind, ridesOnly bool) zones.Distribution {
+	if len(bands) == 0 {
+		return nil
+	}
+	week := bands.TimeIn(database.Streams{}, kind)
+	for _, stream := range streams {
+		if ridesOnly && stream.Activity.CardioKind() != database.CardioRide {
+			continue
+		}
+		week.Add(bands.TimeIn(stream.Streams, kind))
+	}
+	if week.Total() == 0 {
+		return nil
+	}
+	return week
+}
+
+// CalendarDay is a single cell in the profile's workout calendar.
+type CalendarDay struct {
+	Date    time.Time
+	Count   int
+	Level   int
+	InRange bool
+}
+
+// buildCalendar lays out the last year of workout counts as Monday-first weeks,
+// oldest first, ready to be drawn as a contribution grid.
+func buildCalendar(counts map[string]int, today time.Time) [][]CalendarDay {
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+	first := today.AddDate(-1, 0, 1)
+	start := first.AddDate(0, 0, -((int(first.Weekday()) + 6) % 7))
+
+	var weeks [][]CalendarDay
+	for weekStart := start; !weekStart.After(today); weekStart = weekStart.AddDate(0, 0, 7) {
+		week := make([]CalendarDay, 7)
+		for i := range week {
+			date := weekStart.AddDate(0, 0, i)
+			count := counts[date.Format("2006-01-02")]
+			week[i] = CalendarDay{
+				Date:    date,
+				Count:   count,
+				Level:   min(count, 3),
+				InRange: !date.Before(first) && !date.After(today),
+			}
+		}
+		weeks = append(weeks, week)
+	}
+	return weeks
+}
+
+func ProfileHandler(userRepo *database.UserRepo, streakRepo *database.StreakRepo) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		sessionUserId := sessions.Default(ctx).Get("user").(uint)
 		sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
 		if err != nil {
 			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		userStreak, err := streakRepo.GetStreakByUserID(sessionUser.ID)
+		if err != nil {
+			log.Printf("Failed to load streak for user %d: %v", sessionUser.ID, err)
+		}
+
+		today := streak.Day(time.Now())
+		counts, err := streakRepo.GetDailyActivityCounts(sessionUser.ID, today.AddDate(-1, 0, -7))
+		if err != nil {
+			log.Printf("Failed to load activity calendar for user %d: %v", sessionUser.ID, err)
 		}
+
 		ctx.HTML(http.StatusOK, "profile.html", gin.H{
-			"User": sessionUser,
+			"User":     sessionUser,
+			"Streak":   userStreak,
+			"Calendar": buildCalendar(counts, today),
 		})
 	}
 }
@@ -98,15 +209,21 @@ func EditProfileGetHandler(userRepo *database.UserRepo) gin.HandlerFunc {
 		// 2. Determine if the user signed up via a social connection
 		isSocialUser := !strings.HasPrefix(sessionUser.Auth0Sub, "auth0|")
 
-		// 3. Render the edit page, passing in the user and the new flag
+		// 3. Render the edit page, passing in the user and the new flag, with the zones their
+		// settings give so they can check them
+		heartRateZones, _ := zones.HeartRate(sessionUser, time.Now())
+		powerZones, _ := zones.Power(sessionUser)
 		ctx.HTML(http.StatusOK, "edit-profile.html", gin.H{
-			"User":         sessionUser,
-			"IsSocialUser": isSocialUser,
+			"User":                  sessionUser,
+			"IsSocialUser":          isSocialUser,
+			"EstimatedMaxHeartRate": zones.MaxHeartRate(&database.User{Dob: sessionUser.Dob}, time.Now()),
+			"HeartRateZones":        heartRateZones,
+			"PowerZones":            powerZones,
 		})
 	}
 }
 
-func EditProfilePostHandler(userRepo *database.UserRepo) gin.HandlerFunc {
+func EditProfilePostHandler(userRepo *database.UserRepo, streakRepo *database.StreakRepo) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		// 1. Get the current user from the session and database
 		sessionUserId := sessions.Default(ctx).Get("user").(uint)
@@ -196,12 +313,131 @@ func EditProfilePostHandler(userRepo *database.UserRepo) gin.HandlerFunc {
 			sessionUser.Dob = dob
 		}
 
+		restDaysStr := ctx.PostForm("StreakRestDays")
+		if restDaysStr != "" {
+			restDays, err := strconv.Atoi(restDaysStr)
+			if err != nil || restDays < 0 || restDays > 6 {
+				ctx.String(http.StatusBadRequest, "Rest days must be between 0 and 6.")
+				return
+			}
+			sessionUser.StreakRestDays = restDays
+		}
+
+		weeklyTargetStr := ctx.PostForm("StreakWeeklyTarget")
+		if weeklyTargetStr != "" {
+			weeklyTarget, err := strconv.Atoi(weeklyTargetStr)
+			if err != nil || weeklyTarget < 1 || weeklyTarget > 7 {
+				ctx.String(http.StatusBadRequest, "Weekly target must be between 1 and 7.")
+				return
+			}
+			sessionUser.StreakWeeklyTarget = weeklyTarget
+		}
+
+		incrementStr := ctx.PostForm("ProgressionIncrementKG")
+		if incrementStr != "" {
+			increment, err := strconv.ParseFloat(incrementStr, 64)
+			if err != nil || increment < 0 {
+				ctx.String(http.StatusBadRequest, "Invalid progression increment provided.")
+				return
+			}
+			sessionUser.ProgressionIncrementKG = increment
+		}
+
+		targetRepsStr := ctx.PostForm("ProgressionTargetReps")
+		if targetRepsStr != "" {
+			targetReps, err := strconv.Atoi(targetRepsStr)
+			if err != nil || targetReps < 1 {
+				ctx.String(http.StatusBadRequest, "Invalid progression target reps provided.")
+				return
+			}
+			sessionUser.ProgressionTargetReps = targetReps
+		}
+
+		restSecondsStr := ctx.PostForm("DefaultRestSeconds")
+		if restSecondsStr != "" {
+			restSeconds, err := strconv.Atoi(restSecondsStr)
+			if err != nil || restSeconds < 0 || restSeconds > 3600 {
+				ctx.String(http.StatusBadRequest, "Rest timer must be between 0 and 3600 seconds.")
+				return
+			}
+			sessionUser.DefaultRestSeconds = restSeconds
+		}
+
+		switch cleanup := database.DraftCleanup(ctx.PostForm("DraftCleanup")); cleanup {
+		case "":
+		case database.DraftCleanupFinish, database.DraftCleanupDiscard, database.DraftCleanupKeep:
+			sessionUser.DraftCleanup = cleanup
+		default:
+			ctx.String(http.StatusBadRequest, "Invalid choice for unfinished workouts.")
+			return
+		}
+
+		switch method := database.HeartRateZoneMethod(ctx.PostForm("HeartRateZoneMethod")); method {
+		case "":
+		case database.ZonesFromMax, database.ZonesFromReserve, database.ZonesFromThreshold:
+			sessionUser.HeartRateZoneMethod = method
+		default:
+			ctx.String(http.StatusBadRequest, "Invalid heart rate zone method.")
+			return
+		}
+
+		maxHeartRateStr := ctx.PostForm("MaxHeartRate")
+		if maxHeartRateStr != "" {
+			maxHeartRate, err := strconv.Atoi(maxHeartRateStr)
+			if err != nil || maxHeartRate != 0 && (maxHeartRate < 30 || maxHeartRate > 250) {
+				ctx.String(http.StatusBadRequest, "Max heart rate must be between 30 and 250 bpm, or 0 to clear it.")
+				return
+			}
+			sessionUser.MaxHeartRate = maxHeartRate
+		}
+
+		restingHeartRateStr := ctx.PostForm("RestingHeartRate")
+		if restingHeartRateStr != "" {
+			restingHeartRate, err := strconv.Atoi(restingHeartRateStr)
+			if err != nil || restingHeartRate != 0 && (restingHeartRate < 30 || restingHeartRate > 250) {
+				ctx.String(http.StatusBadRequest, "Resting heart rate must be between 30 and 250 bpm, or 0 to clear it.")
+				return
+			}
+			sessionUser.RestingHeartRate = restingHeartRate
+		}
+
+		thresholdHeartRateStr := ctx.PostForm("ThresholdHeartRate")
+		if thresholdHeartRateStr != "" {
+			thresholdHeartRate, err := strconv.Atoi(thresholdHeartRateStr)
+			if err != nil || thresholdHeartRate != 0 && (thresholdHeartRate < 30 || thresholdHeartRate > 250) {
+				ctx.String(http.StatusBadRequest, "Threshold heart rate must be between 30 and 250 bpm, or 0 to clear it.")
+				return
+			}
+			sessionUser.ThresholdHeartRate = thresholdHeartRate
+		}
+
+		ftpStr := ctx.PostForm("FTP")
+		if ftpStr != "" {
+			ftp, err := strconv.Atoi(ftpStr)
+			if err != nil || ftp < 0 || ftp > 2000 {
+				ctx.String(http.StatusBadRequest, "FTP must be between 0 and 2000 watts.")
+				return
+			}
+			sessionUser.FTP = ftp
+		}
+
 		// 5. Save the updated user object to your local database
 		if err := userRepo.UpdateUser(sessionUser); err != nil {
 			ctx.String(http.StatusInternalServerError, "Failed to update profile in local database.")
 			return
 		}
 
+		// Updates skips zero values, so the training settings are saved separately to allow zeros.
+		if err := userRepo.UpdateTrainingSettings(sessionUser); err != nil {
+			ctx.String(http.StatusInternalServerError, "Failed to update profile in local database.")
+			return
+		}
+
+		// The streak rules may have changed, so rebuild it with the new settings.
+		if _, err := streakRepo.RecalculateStreak(sessionUser.ID); err != nil {
+			log.Printf("Failed to recalculate streak for user %d: %v", sessionUser.ID, err)
+		}
+
 		// 6. Redirect back to the profile page on success
 		ctx.Redirect(http.StatusFound, "/profile")
 	}
@@ -0,0 +1,250 @@
+// Package webhooks has the pages where users register webhook endpoints and watch deliveries.
+package webhooks
+
+import (
+	"errors"
+	"fitness/platform/database"
+	"fitness/platform/webhook"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// deliveryLogSize is how many of an endpoint's latest deliveries are shown.
+const deliveryLogSize = 50
+
+// loadEndpoint loads the endpoint in the path, answering with a 404 unless the user may manage it.
+func loadEndpoint(ctx *gin.Context, webhookRepo *database.WebhookRepo, user *database.User) (*database.WebhookEndpoint, bool) {
+	endpointID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.String(http.StatusBadRequest, "Invalid webhook ID")
+		return nil, false
+	}
+	endpoint, err := webhookRepo.GetEndpointByID(uint(endpointID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.String(http.StatusNotFound, "Webhook not found")
+			return nil, false
+		}
+		ctx.String(http.StatusInternalServerError, "Could not load webhook")
+		return nil, false
+	}
+
+	owned := endpoint.UserID != nil && *endpoint.UserID == user.ID
+	global := endpoint.UserID == nil && user.IsAdmin
+	if !owned && !global {
+		ctx.String(http.StatusNotFound, "Webhook not found")
+		return nil, false
+	}
+	return endpoint, true
+}
+
+// sessionUser loads the signed in user.
+func sessionUser(ctx *gin.Context, userRepo *database.UserRepo) (*database.User, bool) {
+	sessionUserId := sessions.Default(ctx).Get("user").(uint)
+	user, err := userRepo.GetUserById(uint64(sessionUserId))
+	if err != nil {
+		ctx.String(http.StatusInternalServerError, "Could not find user.")
+		return nil, false
+	}
+	return user, true
+}
+
+// renderList renders the list of endpoints, along with anything extra in data.
+func renderList(ctx *gin.Context, webhookRepo *database.WebhookRepo, user *database.User, status int, data gin.H) {
+	endpoints, err := webhookRepo.GetEndpointsForUser(user.ID, user.IsAdmin)
+	if err != nil {
+		ctx.String(http.StatusInternalServerError, "Could not load webhooks")
+		return
+	}
+	data["User"] = user
+	data["Endpoints"] = endpoints
+	data["Events"] = database.WebhookEvents
+	ctx.HTML(status, "webhooks.html", data)
+}
+
+// ListHandler shows the user's webhook endpoints and a form to add one.
+// Route: GET /webhooks
+func ListHandler(webhookRepo *database.WebhookRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, ok := sessionUser(ctx, userRepo)
+		if !ok {
+			return
+		}
+		renderList(ctx, webhookRepo, user, http.StatusOK, gin.H{})
+	}
+}
+
+// CreateHandler registers a webhook endpoint. Admins can tick "AllUsers" to hear about every
+// user's workouts rather than just their own.
+// Route: POST /webhooks
+func CreateHandler(webhookRepo *database.WebhookRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, ok := sessionUser(ctx, userRepo)
+		if !ok {
+			return
+		}
+
+		rawURL := strings.TrimSpace(ctx.PostForm("URL"))
+		parsed, err := url.Parse(rawURL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" || len(rawURL) > 2048 {
+			renderList(ctx, webhookRepo, user, http.StatusBadRequest, gin.H{"Error": "Enter a full http or https URL."})
+			return
+		}
+		if !user.IsAdmin && webhook.CheckURL(parsed) != nil {
+			renderList(ctx, webhookRepo, user, http.StatusBadRequest, gin.H{"Error": "Webhooks can only be sent to public addresses."})
+			return
+		}
+
+		var events []string
+		for _, value := range ctx.PostFormArray("Events") {
+			for _, event := range database.WebhookEvents {
+				if value == string(event) {
+					events = append(events, value)
+				}
+			}
+		}
+		if len(events) == 0 {
+			renderList(ctx, webhookRepo, user, http.StatusBadRequest, gin.H{"Error": "Choose at least one event."})
+			return
+		}
+
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not create webhook")
+			return
+		}
+		endpoint := &database.WebhookEndpoint{
+			UserID:      &user.ID,
+			URL:         rawURL,
+			Description: strings.TrimSpace(ctx.PostForm("Description")),
+			Secret:      secret,
+			Events:      events,
+			Active:      true,
+		}
+		if user.IsAdmin && ctx.PostForm("AllUsers") == "on" {
+			endpoint.UserID = nil
+		}
+		if err := webhookRepo.CreateEndpoint(endpoint); err != nil {
+			log.Printf("Failed to create webhook for user %d: %v", user.ID, err)
+			ctx.String(http.StatusInternalServerError, "Could not create webhook")
+			return
+		}
+
+		ctx.Redirect(http.StatusSeeOther, fmt.Sprintf("/webhooks/%d", endpoint.ID))
+	}
+}
+
+// ViewHandler shows a webhook endpoint, its signing secret and its latest deliveries.
+// Route: GET /webhooks/:id
+func ViewHandler(webhookRepo *database.WebhookRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, ok := sessionUser(ctx, userRepo)
+		if !ok {
+			return
+		}
+		endpoint, ok := loadEndpoint(ctx, webhookRepo, user)
+		if !ok {
+			return
+		}
+
+		deliveries, err := webhookRepo.GetDeliveriesByEndpointID(endpoint.ID, deliveryLogSize)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not load deliveries")
+			return
+		}
+
+		ctx.HTML(http.StatusOK, "webhook.html", gin.H{
+			"User":       user,
+			"Endpoint":   endpoint,
+			"Deliveries": deliveries,
+			"Now":        time.Now(),
+		})
+	}
+}
+
+// SetActiveHandler turns delivery to an endpoint on or off.
+// Route: POST /webhooks/:id/active
+func SetActiveHandler(webhookRepo *database.WebhookRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, ok := sessionUser(ctx, userRepo)
+		if !ok {
+			return
+		}
+		endpoint, ok := loadEndpoint(ctx, webhookRepo, user)
+		if !ok {
+			return
+		}
+
+		if err := webhookRepo.SetEndpointActive(endpoint.ID, ctx.PostForm("Active") == "true"); err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not update webhook")
+			return
+		}
+		ctx.Header("HX-Redirect", fmt.Sprintf("/webhooks/%d", endpoint.ID))
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// DeleteHandler removes a webhook endpoint.
+// Route: DELETE /webhooks/:id
+func DeleteHandler(webhookRepo *database.WebhookRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, ok := sessionUser(ctx, userRepo)
+		if !ok {
+			return
+		}
+		endpoint, ok := loadEndpoint(ctx, webhookRepo, user)
+		if !ok {
+			return
+		}
+
+		if err := webhookRepo.DeleteEndpoint(endpoint.ID); err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not delete webhook")
+			return
+		}
+		ctx.Header("HX-Redirect", "/webhooks")
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// ReplayHandler sends a past delivery to its endpoint again, whether or not it succeeded.
+// Route: POST /webhooks/:id/deliveries/:deliveryId/replay
+func ReplayHandler(webhookRepo *database.WebhookRepo, userRepo *database.UserRepo, dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, ok := sessionUser(ctx, userRepo)
+		if !ok {
+			return
+		}
+		endpoint, ok := loadEndpoint(ctx, webhookRepo, user)
+		if !ok {
+			return
+		}
+		deliveryID, err := strconv.ParseUint(ctx.Param("deliveryId"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid delivery ID")
+			return
+		}
+
+		delivery, err := webhookRepo.GetDeliveryByID(uint(deliveryID))
+		if err != nil || delivery.EndpointID != endpoint.ID {
+			ctx.String(http.StatusNotFound, "Delivery not found")
+			return
+		}
+		if _, err := webhookRepo.ReplayDelivery(delivery.ID, time.Now()); err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not replay delivery")
+			return
+		}
+		dispatcher.Wake()
+
+		ctx.Header("HX-Redirect", fmt.Sprintf("/webhooks/%d", endpoint.ID))
+		ctx.Status(http.StatusOK)
+	}
+}
@@ -0,0 +1,104 @@
+package workout
+
+import (
+	"context"
+	"fitness/platform/database"
+	"fitness/platform/strava"
+	"fitness/platform/zones"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// cardioFetchTimeout is how long the page waits on Strava for an activity's splits and laps
+// before showing what it already has.
+const cardioFetchTimeout = 10 * time.Second
+
+// CardioHandler renders a run, ride, swim or other activity, synced from Strava or imported from
+// a device's file, with its pace or speed, its splits and laps, and its route. The first time a
+// Strava activity is viewed the full activity is fetched, as syncing only brings in a summary.
+// Route: GET /activities/:id
+func CardioHandler(activityRepo *database.ActivityRepo, stravaRepo *database.StravaRepo, userRepo *database.UserRepo, syncer *strava.Syncer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid activity ID")
+			return
+		}
+
+		activity, err := activityRepo.GetActivityByID(uint(id))
+		if err != nil || activity.UserID != sessionUserId || !activity.IsCardio() {
+			ctx.String(http.StatusNotFound, "Activity not found")
+			return
+		}
+
+		if activity.FromStrava() && (activity.Cardio == nil || !activity.Cardio.Detailed) {
+			if err := fetchCardioDetails(ctx.Request.Context(), stravaRepo, syncer, sessionUserId, *activity.StravaID); err != nil {
+				log.Printf("Failed to fetch Strava activity %d for user %d: %v", *activity.StravaID, sessionUserId, err)
+			} else if fetched, err := activityRepo.GetActivityByID(activity.ID); err == nil {
+				activity = fetched
+			}
+		}
+
+		// Time in zones needs the activity's streams, which are fetched from Strava with its details
+		stream, err := activityRepo.GetStreams(activity.ID)
+		if err != nil {
+			log.Printf("Failed to get the streams of activity %d: %v", activity.ID, err)
+		} else if stream == nil && activity.FromStrava() {
+			if stream, err = fetchStreams(ctx.Request.Context(), activityRepo, stravaRepo, syncer, activity); err != nil {
+				log.Printf("Failed to fetch the streams of Strava activity %d for user %d: %v", *activity.StravaID, sessionUserId, err)
+			}
+		}
+		var heartRateZones, powerZones zones.Distribution
+		if stream != nil {
+			heartRateZones, powerZones = timeInZones(sessionUser, activity, stream.Streams)
+		}
+
+		ctx.HTML(http.StatusOK, "view-cardio.html", gin.H{
+			"Activity":       activity,
+			"Kind":           activity.CardioKind(),
+			"User":           sessionUser,
+			"HeartRateZones": heartRateZones,
+			"PowerZones":     powerZones,
+		})
+	}
+}
+
+// timeInZones works out how long an activity spent in each of the user's heart rate zones, and
+// each of their power zones for a ride. A distribution is nil if the user's zones can't be worked
+// out or the activity wasn't recorded with the readings for it.
+func timeInZones(user *database.User, activity *database.Activity, streams database.Streams) (zones.Distribution, zones.Distribution) {
+	var heartRate, power zones.Distribution
+	if bands, ok := zones.HeartRate(user, activity.ActivityTime); ok {
+		if distribution := bands.TimeIn(streams, database.StreamHeartRate); distribution.Total() > 0 {
+			heartRate = distribution
+		}
+	}
+	if bands, ok := zones.Power(user); ok && activity.CardioKind() == database.CardioRide {
+		if distribution := bands.TimeIn(streams, database.StreamWatts); distribution.Total() > 0 {
+			power = distribution
+		}
+	}
+	return heartRate, power
+}
+
+// fetchCardioDetails saves the full Strava activity, if the user's account is still connected.
+func fetchCardioDetails(ctx context.Context, stravaRepo *database.StravaRepo, syncer *strava.Syncer, userID uint, stravaID int64) error {
+	account, err := stravaRepo.GetAccountByUserID(userID)
+	if err != nil || account == nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cardioFetchTimeout)
+	defer cancel()
+	return syncer.SyncActivity(ctx, account, stravaID)
+}
@@ -0,0 +1,244 @@
+package workout
+
+import (
+	"fitness/platform/database"
+	"fmt"
+	"strings"
+)
+
+// ChangeStatus says which side of a three-way comparison changed something.
+type ChangeStatus string
+
+const (
+	ChangeNone   ChangeStatus = "unchanged" // Neither side changed it, or both made the same change
+	ChangeMine   ChangeStatus = "mine"      // Only this draft changed it
+	ChangeTheirs ChangeStatus = "theirs"    // Only the saved workout changed it
+	ChangeBoth   ChangeStatus = "both"      // Both changed it differently, so the user has to choose
+)
+
+// FieldConflict compares one of the workout's own fields across the three versions.
+type FieldConflict struct {
+	Key    string
+	Label  string
+	Base   string
+	Theirs string
+	Mine   string
+	Status ChangeStatus
+}
+
+// ExerciseConflict compares one exercise across the three versions. A nil version means
+// the exercise isn't in it, because it was added or removed.
+type ExerciseConflict struct {
+	Key    string
+	Name   string
+	Base   *database.ExerciseSnapshot
+	Theirs *database.ExerciseSnapshot
+	Mine   *database.ExerciseSnapshot
+	Status ChangeStatus
+}
+
+// WorkoutConflict is a three-way comparison of an edit draft ("mine") with the workout
+// it was copied from ("base") and that workout as it has since been saved ("theirs").
+type WorkoutConflict struct {
+	Fields    []FieldConflict
+	Exercises []ExerciseConflict
+}
+
+// DefaultChoice is the version picked unless the user says otherwise: theirs if only
+// they changed it, mine in every other case.
+func (s ChangeStatus) DefaultChoice() string {
+	if s == ChangeTheirs {
+		return "theirs"
+	}
+	return "mine"
+}
+
+func changeStatus(changedTheirs, changedMine, sameChange bool) ChangeStatus {
+	switch {
+	case changedTheirs && changedMine && !sameChange:
+		return ChangeBoth
+	case changedTheirs && !changedMine:
+		return ChangeTheirs
+	case changedMine && !changedTheirs:
+		return ChangeMine
+	default:
+		return ChangeNone
+	}
+}
+
+// exerciseKeys keys each exercise by its definition and how many times that definition
+// came before it, so the same exercise can be matched up across versions.
+func exerciseKeys(exercises []database.ExerciseSnapshot) []string {
+	seen := make(map[uint]int)
+	keys := make([]string, len(exercises))
+	for i, exercise := range exercises {
+		keys[i] = fmt.Sprintf("%d-%d", exercise.ExerciseDefinitionID, seen[exercise.ExerciseDefinitionID])
+		seen[exercise.ExerciseDefinitionID]++
+	}
+	return keys
+}
+
+func exercisesByKey(exercises []database.ExerciseSnapshot) map[string]*database.ExerciseSnapshot {
+	byKey := make(map[string]*database.ExerciseSnapshot)
+	for i, key := range exerciseKeys(exercises) {
+		byKey[key] = &exercises[i]
+	}
+	return byKey
+}
+
+func sameExercise(a, b *database.ExerciseSnapshot) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.SameSets(*b)
+}
+
+// buildConflict compares the three versions field by field and exercise by exercise.
+// Exercises are listed in the draft's order, followed by any only the saved workout has.
+func buildConflict(base, theirs, mine database.WorkoutSnapshot) WorkoutConflict {
+	var conflict WorkoutConflict
+
+	fields := []struct {
+		key, label         string
+		base, theirs, mine string
+	}{
+		{"name", "Name", base.Name, theirs.Name, mine.Name},
+		{"notes", "Notes", base.Notes, theirs.Notes, mine.Notes},
+		{"activity_time", "Date",
+			base.ActivityTime.Format("Jan 2, 2006 15:04"),
+			theirs.ActivityTime.Format("Jan 2, 2006 15:04"),
+			mine.ActivityTime.Format("Jan 2, 2006 15:04")},
+	}
+	for _, field := range fields {
+		conflict.Fields = append(conflict.Fields, FieldConflict{
+			Key:    field.key,
+			Label:  field.label,
+			Base:   field.base,
+			Theirs: field.theirs,
+			Mine:   field.mine,
+			Status: changeStatus(field.theirs != field.base, field.mine != field.base, field.theirs == field.mine),
+		})
+	}
+
+	baseByKey := exercisesByKey(base.Exercises)
+	theirsByKey := exercisesByKey(theirs.Exercises)
+	mineByKey := exercisesByKey(mine.Exercises)
+
+	keys := exerciseKeys(mine.Exercises)
+	for _, key := range exerciseKeys(theirs.Exercises) {
+		if mineByKey[key] == nil {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		exercise := ExerciseConflict{
+			Key:    key,
+			Base:   baseByKey[key],
+			Theirs: theirsByKey[key],
+			Mine:   mineByKey[key],
+		}
+		for _, version := range []*database.ExerciseSnapshot{exercise.Mine, exercise.Theirs, exercise.Base} {
+			if version != nil {
+				exercise.Name = version.Name
+				break
+			}
+		}
+		exercise.Status = changeStatus(
+			!sameExercise(exercise.Base, exercise.Theirs),
+			!sameExercise(exercise.Base, exercise.Mine),
+			sameExercise(exercise.Theirs, exercise.Mine),
+		)
+		conflict.Exercises = append(conflict.Exercises, exercise)
+	}
+	return conflict
+}
+
+// HasConflicts reports whether anything was changed differently on both sides.
+func (c WorkoutConflict) HasConflicts() bool {
+	for _, field := range c.Fields {
+		if field.Status == ChangeBoth {
+			return true
+		}
+	}
+	for _, exercise := range c.Exercises {
+		if exercise.Status == ChangeBoth {
+			return true
+		}
+	}
+	return false
+}
+
+// merge builds the workout to save from the user's choices. choose returns "mine" or
+// "theirs" for a field or exercise key.
+func (c WorkoutConflict) merge(theirs, mine database.WorkoutSnapshot, choose func(key string, status ChangeStatus) string) database.WorkoutSnapshot {
+	merged := database.WorkoutSnapshot{
+		Name:         mine.Name,
+		Notes:        mine.Notes,
+		ActivityTime: mine.ActivityTime,
+	}
+	for _, field := range c.Fields {
+		if choose(field.Key, field.Status) != "theirs" {
+			continue
+		}
+		switch field.Key {
+		case "name":
+			merged.Name = theirs.Name
+		case "notes":
+			merged.Notes = theirs.Notes
+		case "activity_time":
+			merged.ActivityTime = theirs.ActivityTime
+		}
+	}
+
+	// Superset partners are kept by position, so each is looked up by its key in the version the
+	// exercise came from and pointed at wherever that exercise ended up.
+	mineKeys, theirsKeys := exerciseKeys(mine.Exercises), exerciseKeys(theirs.Exercises)
+	var sourceKeys [][]string
+	mergedAt := make(map[string]int)
+	for _, exercise := range c.Exercises {
+		chosen, keys := exercise.Mine, mineKeys
+		if choose(exercise.Key, exercise.Status) == "theirs" {
+			chosen, keys = exercise.Theirs, theirsKeys
+		}
+		if chosen != nil {
+			mergedAt[exercise.Key] = len(merged.Exercises)
+			merged.Exercises = append(merged.Exercises, *chosen)
+			sourceKeys = append(sourceKeys, keys)
+		}
+	}
+	for i := range merged.Exercises {
+		partner := merged.Exercises[i].SupersetPartner
+		if partner == nil {
+			continue
+		}
+		merged.Exercises[i].SupersetPartner = nil
+		if *partner < 0 || *partner >= len(sourceKeys[i]) {
+			continue
+		}
+		if position, ok := mergedAt[sourceKeys[i][*partner]]; ok {
+			merged.Exercises[i].SupersetPartner = &position
+		}
+	}
+	return merged
+}
+
+// BaseSets, TheirsSets and MineSets describe each version's sets for display.
+func (e ExerciseConflict) BaseSets() string   { return setsText(e.Base) }
+func (e ExerciseConflict) TheirsSets() string { return setsText(e.Theirs) }
+func (e ExerciseConflict) MineSets() string   { return setsText(e.Mine) }
+
+// setsText describes an exercise's sets in one line, e.g. "8 × 60kg, 8 × 60kg".
+func setsText(exercise *database.ExerciseSnapshot) string {
+	if exercise == nil {
+		return "Not in this version"
+	}
+	if len(exercise.Sets) == 0 {
+		return "No sets"
+	}
+	sets := make([]string, len(exercise.Sets))
+	for i, set := range exercise.Sets {
+		sets[i] = fmt.Sprintf("%d × %gkg", set.Reps, set.WeightKG)
+	}
+	return strings.Join(sets, ", ")
+}
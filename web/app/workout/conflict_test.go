@@ -0,0 +1,173 @@
+package workout
+
+import (
+	"fitness/platform/database"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// exercise returns a snapshot of an exercise with a set of 5 reps at each weight.
+func exercise(definitionID uint, weights ...float64) database.ExerciseSnapshot {
+	snapshot := database.ExerciseSnapshot{ExerciseDefinitionID: definitionID, Name: "Exercise"}
+	for _, weight := range weights {
+		snapshot.Sets = append(snapshot.Sets, database.SetSnapshot{Reps: 5, WeightKG: weight})
+	}
+	return snapshot
+}
+
+func workoutSnapshot(name, notes string, exercises ...database.ExerciseSnapshot) database.WorkoutSnapshot {
+	return database.WorkoutSnapshot{
+		Name:         name,
+		Notes:        notes,
+		ActivityTime: time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC),
+		Exercises:    exercises,
+	}
+}
+
+func TestBuildConflict(t *testing.T) {
+	base := workoutSnapshot("Push", "", exercise(1, 60, 60), exercise(2, 20))
+	for _, test := range []struct {
+		name         string
+		theirs, mine database.WorkoutSnapshot
+		statuses     map[string]ChangeStatus // By field or exercise key; any not listed are unchanged
+		conflicts    bool
+	}{
+		{
+			name:   "nothing changed",
+			theirs: base,
+			mine:   base,
+		},
+		{
+			name:     "only they renamed it",
+			theirs:   workoutSnapshot("Push day", "", exercise(1, 60, 60), exercise(2, 20)),
+			mine:     base,
+			statuses: map[string]ChangeStatus{"name": ChangeTheirs},
+		},
+		{
+			name:     "only I added notes and a set",
+			theirs:   base,
+			mine:     workoutSnapshot("Push", "Felt good", exercise(1, 60, 60, 60), exercise(2, 20)),
+			statuses: map[string]ChangeStatus{"notes": ChangeMine, "1-0": ChangeMine},
+		},
+		{
+			name:   "both made the same change",
+			theirs: workoutSnapshot("Push day", "", exercise(1, 60, 65), exercise(2, 20)),
+			mine:   workoutSnapshot("Push day", "", exercise(1, 60, 65), exercise(2, 20)),
+		},
+		{
+			name:      "both changed the same things differently",
+			theirs:    workoutSnapshot("Push day", "", exercise(1, 60, 65), exercise(2, 20)),
+			mine:      workoutSnapshot("Chest", "", exercise(1, 60, 70), exercise(2, 20)),
+			statuses:  map[string]ChangeStatus{"name": ChangeBoth, "1-0": ChangeBoth},
+			conflicts: true,
+		},
+		{
+			name:     "I added an exercise and they added another",
+			theirs:   workoutSnapshot("Push", "", exercise(1, 60, 60), exercise(2, 20), exercise(4, 10)),
+			mine:     workoutSnapshot("Push", "", exercise(1, 60, 60), exercise(2, 20), exercise(3, 30)),
+			statuses: map[string]ChangeStatus{"3-0": ChangeMine, "4-0": ChangeTheirs},
+		},
+		{
+			name:     "they removed an exercise I left alone",
+			theirs:   workoutSnapshot("Push", "", exercise(1, 60, 60)),
+			mine:     base,
+			statuses: map[string]ChangeStatus{"2-0": ChangeTheirs},
+		},
+		{
+			name:      "they removed an exercise I changed",
+			theirs:    workoutSnapshot("Push", "", exercise(1, 60, 60)),
+			mine:      workoutSnapshot("Push", "", exercise(1, 60, 60), exercise(2, 25)),
+			statuses:  map[string]ChangeStatus{"2-0": ChangeBoth},
+			conflicts: true,
+		},
+		{
+			name:     "the same exercise twice is matched in order",
+			theirs:   workoutSnapshot("Push", "", exercise(1, 60, 60), exercise(2, 20), exercise(1, 40)),
+			mine:     base,
+			statuses: map[string]ChangeStatus{"1-1": ChangeTheirs},
+		},
+	} {
+		conflict := buildConflict(base, test.theirs, test.mine)
+		got := make(map[string]ChangeStatus)
+		for _, field := range conflict.Fields {
+			got[field.Key] = field.Status
+		}
+		for _, exercise := range conflict.Exercises {
+			got[exercise.Key] = exercise.Status
+		}
+		for key, status := range got {
+			want, ok := test.statuses[key]
+			if !ok {
+				want = ChangeNone
+			}
+			if status != want {
+				t.Errorf("%s: %s is %s, want %s", test.name, key, status, want)
+			}
+		}
+		for key := range test.statuses {
+			if _, ok := got[key]; !ok {
+				t.Errorf("%s: %s isn't compared", test.name, key)
+			}
+		}
+		if conflict.HasConflicts() != test.conflicts {
+			t.Errorf("%s: HasConflicts = %v, want %v", test.name, conflict.HasConflicts(), test.conflicts)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := workoutSnapshot("Push", "", exercise(1, 60, 60), exercise(2, 20), exercise(3, 30))
+	theirs := workoutSnapshot("Push day", "", exercise(1, 60, 65), exercise(2, 20), exercise(4, 10))
+	theirs.ActivityTime = theirs.ActivityTime.Add(-time.Hour)
+	mine := workoutSnapshot("Chest", "Felt good", exercise(1, 60, 70), exercise(2, 25), exercise(3, 30))
+	conflict := buildConflict(base, theirs, mine)
+
+	// By default each side's own changes are kept, and mine win where both changed something.
+	merged := conflict.merge(theirs, mine, func(key string, status ChangeStatus) string { return status.DefaultChoice() })
+	want := workoutSnapshot("Chest", "Felt good", exercise(1, 60, 70), exercise(2, 25), exercise(4, 10))
+	want.ActivityTime = theirs.ActivityTime
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("default merge = %+v, want %+v", merged, want)
+	}
+
+	// Choosing theirs for a conflict takes their version, or drops what they removed.
+	merged = conflict.merge(theirs, mine, func(key string, status ChangeStatus) string {
+		if key == "name" || key == "1-0" || key == "3-0" {
+			return "theirs"
+		}
+		return status.DefaultChoice()
+	})
+	want = workoutSnapshot("Push day", "Felt good", exercise(1, 60, 65), exercise(2, 25), exercise(4, 10))
+	want.ActivityTime = theirs.ActivityTime
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("merge choosing theirs = %+v, want %+v", merged, want)
+	}
+}
+
+func TestMergeKeepsSupersets(t *testing.T) {
+	// superset pairs two exercises, the first at position first and the second at second.
+	superset := func(exercises []database.ExerciseSnapshot, first, second int) {
+		id := "a1"
+		exercises[first].SupersetID, exercises[first].SupersetOrder, exercises[first].SupersetPartner = &id, 0, &second
+		exercises[second].SupersetID, exercises[second].SupersetOrder, exercises[second].SupersetPartner = &id, 1, &first
+	}
+
+	base := workoutSnapshot("Push", "", exercise(1, 60), exercise(2, 20), exercise(3, 30))
+	superset(base.Exercises, 1, 2)
+	// They added an exercise at the start, moving the superset along.
+	theirs := workoutSnapshot("Push", "", exercise(4, 10), exercise(1, 60), exercise(2, 20), exercise(3, 35))
+	superset(theirs.Exercises, 2, 3)
+	mine := workoutSnapshot("Push", "", exercise(1, 60), exercise(2, 25), exercise(3, 30))
+	superset(mine.Exercises, 1, 2)
+
+	merged := buildConflict(base, theirs, mine).merge(theirs, mine, func(key string, status ChangeStatus) string {
+		return status.DefaultChoice()
+	})
+	// Mine for exercise 2, theirs for exercise 3, then their new exercise 4.
+	want := workoutSnapshot("Push", "", exercise(1, 60), exercise(2, 25), exercise(3, 35), exercise(4, 10))
+	superset(want.Exercises, 1, 2)
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("merge = %+v, want %+v", merged, want)
+	}
+}
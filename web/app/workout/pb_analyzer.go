@@ -0,0 +1,120 @@
+package workout
+
+import (
+	"fitness/platform/database"
+	"fmt"
+	"sort"
+)
+
+const recordTypeTotalVolume = "TOTAL_VOLUME"
+
+// repMaxRecordType returns the record type for the heaviest weight lifted for a number of reps, e.g. "5_REP_MAX".
+func repMaxRecordType(reps int) string {
+	return fmt.Sprintf("%d_REP_MAX", reps)
+}
+
+// AnalyzeWorkoutForPBs checks a finished workout for new personal bests and stores any it finds.
+// The activity must have its GymExercises, their Sets and ExerciseDefinitions preloaded.
+// It returns a description of each new record.
+func AnalyzeWorkoutForPBs(activity *database.Activity, recordRepo *database.PersonalRecordRepo) ([]string, error) {
+	// Re-analysing an edited workout replaces the records it set before.
+	if err := recordRepo.DeleteRecordsByActivityID(activity.ID); err != nil {
+		return nil, err
+	}
+
+	type exerciseTotals struct {
+		name     string
+		volume   float64
+		repMaxes map[int]float64
+	}
+
+	// Group the sets by exercise definition, as the same exercise may appear more than once.
+	totals := make(map[uint]*exerciseTotals)
+	var order []uint
+	for _, gymExercise := range activity.GymExercises {
+		defID := gymExercise.ExerciseDefinitionID
+		if defID == 0 {
+			continue
+		}
+		if _, ok := totals[defID]; !ok {
+			order = append(order, defID)
+			totals[defID] = &exerciseTotals{
+				name:     gymExercise.ExerciseDefinition.Name,
+				repMaxes: make(map[int]float64),
+			}
+		}
+		for _, set := range gymExercise.Sets {
+			if set.Reps <= 0 || set.WeightKG <= 0 {
+				continue
+			}
+			entry := totals[defID]
+			entry.volume += float64(set.Reps) * set.WeightKG
+			if set.WeightKG > entry.repMaxes[set.Reps] {
+				entry.repMaxes[set.Reps] = set.WeightKG
+			}
+		}
+	}
+
+	var newPBs []string
+	// record stores the value if it beats both the user's record and the best of their earlier
+	// sets, as workouts from before records were kept have none.
+	record := func(defID uint, recordType string, value float64, bestFromSets func() (float64, error)) (bool, error) {
+		best, err := recordRepo.GetBestValue(activity.UserID, defID, recordType, activity.ID)
+		if err != nil {
+			return false, err
+		}
+		if value <= best {
+			return false, nil
+		}
+		best, err = bestFromSets()
+		if err != nil {
+			return false, err
+		}
+		if value <= best {
+			return false, nil
+		}
+		return true, recordRepo.CreateRecord(&database.PersonalRecord{
+			UserID:               activity.UserID,
+			ExerciseDefinitionID: defID,
+			ActivityID:           activity.ID,
+			RecordType:           recordType,
+			Value:                value,
+		})
+	}
+
+	for _, defID := range order {
+		entry := totals[defID]
+		if entry.volume > 0 {
+			isPB, err := record(defID, recordTypeTotalVolume, entry.volume, func() (float64, error) {
+				return recordRepo.GetBestVolumeFromSets(activity.UserID, defID, activity.ActivityTime, activity.ID)
+			})
+			if err != nil {
+				return nil, err
+			}
+			if isPB {
+				newPBs = append(newPBs, fmt.Sprintf("%s: new total volume of %g kg", entry.name, entry.volume))
+			}
+		}
+
+		var repCounts []int
+		for reps := range entry.repMaxes {
+			repCounts = append(repCounts, reps)
+		}
+		sort.Ints(repCounts)
+
+		for _, reps := range repCounts {
+			weight := entry.repMaxes[reps]
+			isPB, err := record(defID, repMaxRecordType(reps), weight, func() (float64, error) {
+				return recordRepo.GetHeaviestFromSets(activity.UserID, defID, reps, activity.ActivityTime, activity.ID)
+			})
+			if err != nil {
+				return nil, err
+			}
+			if isPB {
+				newPBs = append(newPBs, fmt.Sprintf("%s: new %d rep max of %g kg", entry.name, reps, weight))
+			}
+		}
+	}
+
+	return newPBs, nil
+}
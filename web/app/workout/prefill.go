@@ -0,0 +1,86 @@
+package workout
+
+import (
+	"errors"
+	"fitness/platform/database"
+	"fitness/platform/progression"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PreviousSession is the last time an exercise was done, used to pre-fill new sets
+// and to show "ghost" values beside the inputs.
+type PreviousSession struct {
+	Date      time.Time
+	Sets      []database.GymSet
+	Suggested []float64
+}
+
+// SetFor returns the set with the same number from the previous session, if there was one.
+func (p *PreviousSession) SetFor(setNumber int) *database.GymSet {
+	if p == nil || setNumber < 1 || setNumber > len(p.Sets) {
+		return nil
+	}
+	return &p.Sets[setNumber-1]
+}
+
+// SuggestedWeightFor returns the suggested weight for a set number, or 0 if there is no suggestion.
+func (p *PreviousSession) SuggestedWeightFor(setNumber int) float64 {
+	if p == nil || setNumber < 1 || setNumber > len(p.Suggested) {
+		return 0
+	}
+	return p.Suggested[setNumber-1]
+}
+
+// loadPreviousSession finds the last session of an exercise before the given time and works out
+// the suggested weights for this one. It returns nil if the user hasn't done the exercise before.
+func loadPreviousSession(
+	gymExerciseRepo *database.GymExerciseRepo,
+	user *database.User,
+	exerciseDefinitionID uint,
+	before time.Time,
+	activityID uint,
+) (*PreviousSession, error) {
+	if exerciseDefinitionID == 0 {
+		return nil, nil
+	}
+
+	previous, err := gymExerciseRepo.GetPreviousExercise(user.ID, exerciseDefinitionID, before, activityID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(previous.Sets) == 0 {
+		return nil, nil
+	}
+
+	rule := progression.RuleForUser(user)
+	return &PreviousSession{
+		Date:      previous.Activity.ActivityTime,
+		Sets:      previous.Sets,
+		Suggested: rule.SuggestWeights(previous.Sets),
+	}, nil
+}
+
+// prefillSets builds the sets for a new exercise block from the previous session,
+// using the suggested weights. With no previous session it returns a single blank set.
+func prefillSets(gymExerciseID uint, previous *PreviousSession) []*database.GymSet {
+	if previous == nil {
+		return []*database.GymSet{{GymExerciseID: gymExerciseID, SetNumber: 1}}
+	}
+
+	sets := make([]*database.GymSet, len(previous.Sets))
+	for i, previousSet := range previous.Sets {
+		sets[i] = &database.GymSet{
+			GymExerciseID: gymExerciseID,
+			SetNumber:     i + 1,
+			Reps:          previousSet.Reps,
+			WeightKG:      previous.Suggested[i],
+			SetType:       previousSet.SetType,
+		}
+	}
+	return sets
+}
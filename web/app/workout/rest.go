@@ -0,0 +1,244 @@
+package workout
+
+import (
+	"fitness/platform/database"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// restStreamRecheck is how often the rest timer stream checks on the workout between the changes
+// it is told about, to notice it being finished or changed by another server.
+const restStreamRecheck = 30 * time.Second
+
+// updateRestTimer starts the rest timer after a set is completed, or cancels it if the set it
+// was running for is un-marked. Only live sessions have a timer, not edits of finished workouts.
+func updateRestTimer(gymExerciseRepo *database.GymExerciseRepo, restRepo *database.RestRepo, userID uint, gymSet *database.GymSet) error {
+	gymExercise, err := gymExerciseRepo.GetExerciseByID(uint64(gymSet.GymExerciseID))
+	if err != nil {
+		return err
+	}
+	activity, err := restRepo.GetRestTimer(gymExercise.ActivityID)
+	if err != nil {
+		return err
+	}
+	if activity.Status != database.StatusDraft || activity.FinishTime != nil {
+		return nil
+	}
+
+	if gymSet.CompletedAt == nil {
+		if activity.RestGymSetID != nil && *activity.RestGymSetID == gymSet.ID {
+			return restRepo.CancelRest(activity.ID)
+		}
+		return nil
+	}
+
+	restSeconds, err := restRepo.GetRestSeconds(userID, gymExercise.ExerciseDefinitionID)
+	if err != nil {
+		return err
+	}
+	if restSeconds <= 0 {
+		// The timer is off for this exercise, but the rest after the last set has still ended.
+		return restRepo.StopRest(activity.ID)
+	}
+	return restRepo.StartRest(activity.ID, gymSet.ID, restSeconds)
+}
+
+// RestTimerHandler renders the current rest timer of a workout.
+// Route: GET /activity/:id/rest
+func RestTimerHandler(restRepo *database.RestRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		activityID, ok := ownRestTimer(ctx, restRepo)
+		if !ok {
+			return
+		}
+		renderRestTimer(ctx, restRepo, activityID)
+	}
+}
+
+// RestStreamHandler sends a "rest" server-sent event whenever the rest timer of a workout is
+// started, changed or stopped, so every open copy of the workout can refresh its countdown.
+// The countdown itself runs in the browser, so nothing is sent while the timer is left alone.
+// Route: GET /activity/:id/rest/stream
+func RestStreamHandler(restRepo *database.RestRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		activityID, ok := ownRestTimer(ctx, restRepo)
+		if !ok {
+			return
+		}
+
+		ctx.Header("Content-Type", "text/event-stream")
+		ctx.Header("Cache-Control", "no-cache")
+		ctx.Header("Connection", "keep-alive")
+
+		changes, stopWatching := restRepo.Watch(activityID)
+		defer stopWatching()
+		ticker := time.NewTicker(restStreamRecheck)
+		defer ticker.Stop()
+
+		lastState := ""
+		ctx.Stream(func(w io.Writer) bool {
+			activity, err := restRepo.GetRestTimer(activityID)
+			if err != nil || activity.Status != database.StatusDraft {
+				// The workout is gone or finished, so there is nothing left to count down.
+				return false
+			}
+
+			state := "stopped"
+			if activity.RestStartedAt != nil {
+				state = fmt.Sprintf("%d:%d", activity.RestStartedAt.UnixMilli(), activity.RestTargetSeconds)
+			}
+			if state != lastState {
+				ctx.SSEvent("rest", state)
+				lastState = state
+			}
+
+			select {
+			case <-ctx.Request.Context().Done():
+				return false
+			case <-changes:
+				return true
+			case <-ticker.C:
+				return true
+			}
+		})
+	}
+}
+
+// StopRestHandler ends the rest timer early, recording the rest taken so far.
+// Route: POST /activity/:id/rest/stop
+func StopRestHandler(restRepo *database.RestRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		activityID, ok := ownRestTimer(ctx, restRepo)
+		if !ok {
+			return
+		}
+
+		if err := restRepo.StopRest(activityID); err != nil {
+			ctx.String(http.StatusInternalServerError, "Failed to stop rest timer")
+			return
+		}
+		renderRestTimer(ctx, restRepo, activityID)
+	}
+}
+
+// ExtendRestHandler adds time to, or takes time off, the running rest timer.
+// Route: POST /activity/:id/rest/extend
+func ExtendRestHandler(restRepo *database.RestRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		activityID, ok := ownRestTimer(ctx, restRepo)
+		if !ok {
+			return
+		}
+		seconds, err := strconv.Atoi(ctx.PostForm("seconds"))
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid number of seconds")
+			return
+		}
+
+		if err := restRepo.ExtendRest(activityID, seconds); err != nil {
+			ctx.String(http.StatusInternalServerError, "Failed to change rest timer")
+			return
+		}
+		renderRestTimer(ctx, restRepo, activityID)
+	}
+}
+
+// UpdateExerciseRestHandler saves the user's own rest timer length for an exercise.
+// Route: POST /exercise-definition/:id/rest
+func UpdateExerciseRestHandler(restRepo *database.RestRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		definitionID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid exercise ID")
+			return
+		}
+		seconds, err := strconv.Atoi(ctx.PostForm("rest_seconds"))
+		if err != nil || seconds < 0 || seconds > 3600 {
+			ctx.String(http.StatusBadRequest, "Rest timer must be between 0 and 3600 seconds")
+			return
+		}
+
+		if err := restRepo.SetUserRestSeconds(sessionUserId, uint(definitionID), seconds); err != nil {
+			ctx.String(http.StatusInternalServerError, "Failed to save rest timer")
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// UpdateExerciseDefaultRestHandler sets the rest timer length an exercise starts with for
+// everyone who hasn't chosen their own. Leaving it empty goes back to each user's default.
+// Only admins can change it, as exercises are shared.
+// Route: POST /exercise-definition/:id/default-rest
+func UpdateExerciseDefaultRestHandler(exerciseRepo *database.ExerciseRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !sessionUser.IsAdmin {
+			ctx.String(http.StatusForbidden, "Only admins can change an exercise's default rest timer")
+			return
+		}
+		definitionID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid exercise ID")
+			return
+		}
+
+		var restSeconds *int
+		if value := strings.TrimSpace(ctx.PostForm("default_rest_seconds")); value != "" {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 || seconds > 3600 {
+				ctx.String(http.StatusBadRequest, "Rest timer must be between 0 and 3600 seconds")
+				return
+			}
+			restSeconds = &seconds
+		}
+
+		if err := exerciseRepo.SetDefaultRestSeconds(uint(definitionID), restSeconds); err != nil {
+			ctx.String(http.StatusInternalServerError, "Failed to save default rest timer")
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// ownRestTimer reads the workout ID from the route and checks that it is the session user's,
+// replying if not, so nobody can watch or change another user's rest timer.
+func ownRestTimer(ctx *gin.Context, restRepo *database.RestRepo) (uint, bool) {
+	activityID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.String(http.StatusBadRequest, "Invalid activity ID")
+		return 0, false
+	}
+	sessionUserId := sessions.Default(ctx).Get("user").(uint)
+	if activity, err := restRepo.GetRestTimer(uint(activityID)); err != nil || activity.UserID != sessionUserId {
+		ctx.String(http.StatusNotFound, "Activity not found")
+		return 0, false
+	}
+	return uint(activityID), true
+}
+
+// renderRestTimer renders the countdown and controls for a workout's rest timer.
+func renderRestTimer(ctx *gin.Context, restRepo *database.RestRepo, activityID uint) {
+	activity, err := restRepo.GetRestTimer(activityID)
+	if err != nil {
+		ctx.String(http.StatusNotFound, "Activity not found")
+		return
+	}
+	ctx.HTML(http.StatusOK, "_rest-timer.html", gin.H{
+		"Activity":         activity,
+		"RemainingSeconds": int(activity.RestRemaining(time.Now()).Seconds()),
+	})
+}
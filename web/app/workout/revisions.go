@@ -0,0 +1,115 @@
+package workout
+
+import (
+	"fitness/platform/database"
+	"time"
+)
+
+// FieldChange is a change to one of a workout's own fields between two versions.
+type FieldChange struct {
+	Label  string
+	Before string
+	After  string
+}
+
+// ExerciseChange is an exercise that was added, removed or had its sets changed between two versions.
+type ExerciseChange struct {
+	Name   string
+	Kind   string // "added", "removed" or "changed"
+	Before string
+	After  string
+}
+
+// RevisionDiff lists what changed from one version of a workout to the next.
+type RevisionDiff struct {
+	Fields    []FieldChange
+	Exercises []ExerciseChange
+}
+
+// Empty reports whether nothing changed.
+func (d RevisionDiff) Empty() bool {
+	return len(d.Fields) == 0 && len(d.Exercises) == 0
+}
+
+// RevisionEntry is one version of a workout in its edit history.
+type RevisionEntry struct {
+	Version int
+	SavedAt time.Time
+	Current bool
+	// Changes is what this version changed from the one before it. The first version has none.
+	Changes *RevisionDiff
+}
+
+// diffSnapshots compares two versions of a workout, matching exercises up the same way
+// the conflict comparison does.
+func diffSnapshots(before, after database.WorkoutSnapshot) RevisionDiff {
+	var diff RevisionDiff
+
+	const timeLayout = "Jan 2, 2006 15:04"
+	fields := []FieldChange{
+		{"Name", before.Name, after.Name},
+		{"Notes", before.Notes, after.Notes},
+		{"Date", before.ActivityTime.Format(timeLayout), after.ActivityTime.Format(timeLayout)},
+	}
+	for _, field := range fields {
+		if field.Before != field.After {
+			diff.Fields = append(diff.Fields, field)
+		}
+	}
+
+	beforeByKey := exercisesByKey(before.Exercises)
+	afterByKey := exercisesByKey(after.Exercises)
+	for _, key := range exerciseKeys(after.Exercises) {
+		old, updated := beforeByKey[key], afterByKey[key]
+		switch {
+		case old == nil:
+			diff.Exercises = append(diff.Exercises, ExerciseChange{Name: updated.Name, Kind: "added", After: setsText(updated)})
+		case !old.SameSets(*updated):
+			diff.Exercises = append(diff.Exercises, ExerciseChange{Name: updated.Name, Kind: "changed", Before: setsText(old), After: setsText(updated)})
+		}
+	}
+	for _, key := range exerciseKeys(before.Exercises) {
+		if afterByKey[key] == nil {
+			old := beforeByKey[key]
+			diff.Exercises = append(diff.Exercises, ExerciseChange{Name: old.Name, Kind: "removed", Before: setsText(old)})
+		}
+	}
+	return diff
+}
+
+// buildRevisionHistory lists every version of a workout, newest first, with what each
+// version changed. revisions must be ordered newest first.
+func buildRevisionHistory(activity *database.Activity, revisions []*database.ActivityRevision) ([]RevisionEntry, error) {
+	if len(revisions) == 0 {
+		return nil, nil
+	}
+
+	type version struct {
+		number   int
+		savedAt  time.Time
+		snapshot database.WorkoutSnapshot
+	}
+	// A version was saved when the one before it was replaced.
+	versions := []version{{number: activity.Version, savedAt: revisions[0].CreatedAt, snapshot: database.SnapshotOf(activity)}}
+	for i, revision := range revisions {
+		snapshot, err := database.DecodeSnapshot(revision.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+		savedAt := activity.CreatedAt
+		if i+1 < len(revisions) {
+			savedAt = revisions[i+1].CreatedAt
+		}
+		versions = append(versions, version{number: revision.Version, savedAt: savedAt, snapshot: snapshot})
+	}
+
+	entries := make([]RevisionEntry, len(versions))
+	for i, v := range versions {
+		entries[i] = RevisionEntry{Version: v.number, SavedAt: v.savedAt, Current: i == 0}
+		if i+1 < len(versions) {
+			changes := diffSnapshots(versions[i+1].snapshot, v.snapshot)
+			entries[i].Changes = &changes
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,72 @@
+package workout
+
+import (
+	"fitness/platform/database"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	before := workoutSnapshot("Push", "", exercise(1, 60, 60), exercise(2, 20))
+	later := before
+	later.ActivityTime = before.ActivityTime.Add(24 * time.Hour)
+
+	for _, test := range []struct {
+		name      string
+		after     database.WorkoutSnapshot
+		fields    []FieldChange
+		exercises []ExerciseChange
+	}{
+		{
+			name:  "nothing changed",
+			after: before,
+		},
+		{
+			name:  "renamed with notes",
+			after: workoutSnapshot("Push day", "Felt good", exercise(1, 60, 60), exercise(2, 20)),
+			fields: []FieldChange{
+				{"Name", "Push", "Push day"},
+				{"Notes", "", "Felt good"},
+			},
+		},
+		{
+			name:   "re-dated",
+			after:  later,
+			fields: []FieldChange{{"Date", "Oct 19, 2026 10:00", "Oct 20, 2026 10:00"}},
+		},
+		{
+			name:  "a set changed",
+			after: workoutSnapshot("Push", "", exercise(1, 60, 65), exercise(2, 20)),
+			exercises: []ExerciseChange{
+				{Name: "Exercise", Kind: "changed", Before: "5 × 60kg, 5 × 60kg", After: "5 × 60kg, 5 × 65kg"},
+			},
+		},
+		{
+			name:  "one exercise swapped for another",
+			after: workoutSnapshot("Push", "", exercise(1, 60, 60), exercise(3)),
+			exercises: []ExerciseChange{
+				{Name: "Exercise", Kind: "added", After: "No sets"},
+				{Name: "Exercise", Kind: "removed", Before: "5 × 20kg"},
+			},
+		},
+		{
+			name:  "the same exercise again",
+			after: workoutSnapshot("Push", "", exercise(1, 60, 60), exercise(2, 20), exercise(1, 40)),
+			exercises: []ExerciseChange{
+				{Name: "Exercise", Kind: "added", After: "5 × 40kg"},
+			},
+		},
+	} {
+		diff := diffSnapshots(before, test.after)
+		if !reflect.DeepEqual(diff.Fields, test.fields) {
+			t.Errorf("%s: fields = %+v, want %+v", test.name, diff.Fields, test.fields)
+		}
+		if !reflect.DeepEqual(diff.Exercises, test.exercises) {
+			t.Errorf("%s: exercises = %+v, want %+v", test.name, diff.Exercises, test.exercises)
+		}
+		if diff.Empty() != (test.fields == nil && test.exercises == nil) {
+			t.Errorf("%s: Empty = %v", test.name, diff.Empty())
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package workout
+
+import (
+	"fitness/platform/database"
+	"fitness/platform/geo"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// geoJSONType is the media type of GeoJSON.
+const geoJSONType = "application/geo+json"
+
+// RouteHandler returns an activity's route as a GeoJSON line, with its bounding box and its
+// start and end points.
+// Route: GET /activities/:id/route
+func RouteHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid activity ID")
+			return
+		}
+
+		activity, err := activityRepo.GetActivityByID(uint(id))
+		if err != nil || activity.UserID != sessionUserId || activity.Polyline == "" {
+			ctx.String(http.StatusNotFound, "Route not found")
+			return
+		}
+		points, err := geo.DecodePolyline(activity.Polyline)
+		if err != nil {
+			log.Printf("Failed to decode the route of activity %d: %v", activity.ID, err)
+			ctx.String(http.StatusInternalServerError, "Could not read the route")
+			return
+		}
+
+		ctx.Header("Content-Type", geoJSONType)
+		ctx.JSON(http.StatusOK, geo.RouteFeature(points, map[string]interface{}{
+			"id":         activity.ID,
+			"name":       activity.Name,
+			"sport_type": activity.SportType,
+		}))
+	}
+}
+
+// HeatmapHandler renders a map of everywhere the user has been, brighter where they go often.
+// Route: GET /heatmap
+func HeatmapHandler(userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		ctx.HTML(http.StatusOK, "heatmap.html", gin.H{"User": sessionUser})
+	}
+}
+
+// HeatmapDataHandler adds up all of the user's routes into heatmap points of
+// [lat, lng, intensity]. Routes that can't be read are left out.
+// Route: GET /heatmap/data
+func HeatmapDataHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		activities, err := activityRepo.GetRoutes(sessionUserId)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not load routes")
+			return
+		}
+
+		routes := make([][]geo.Point, 0, len(activities))
+		for _, activity := range activities {
+			points, err := geo.DecodePolyline(activity.Polyline)
+			if err != nil {
+				log.Printf("Skipping the route of activity %d in the heatmap: %v", activity.ID, err)
+				continue
+			}
+			routes = append(routes, points)
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"routes": len(routes),
+			"points": geo.Heatmap(routes, geo.DefaultHeatCell),
+		})
+	}
+}
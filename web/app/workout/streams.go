@@ -0,0 +1,98 @@
+package workout
+
+import (
+	"context"
+	"fitness/platform/database"
+	"fitness/platform/strava"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultStreamPoints is how many readings of each stream are sent if the request doesn't
+	// say, which is about as many as a chart the width of a screen can show.
+	defaultStreamPoints = 1000
+	// maxStreamPoints is the most readings of each stream that can be asked for.
+	maxStreamPoints = 10000
+)
+
+// StreamsHandler returns the readings through an activity, such as its heart rate and altitude,
+// averaged down to at most ?points= of each. ?keys= picks which streams, by their Strava names;
+// the time stream is always sent. A Strava activity's streams are fetched the first time they
+// are asked for.
+// Route: GET /activities/:id/streams
+func StreamsHandler(activityRepo *database.ActivityRepo, stravaRepo *database.StravaRepo, syncer *strava.Syncer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid activity ID")
+			return
+		}
+		points := defaultStreamPoints
+		if value := ctx.Query("points"); value != "" {
+			if points, err = strconv.Atoi(value); err != nil || points < 2 || points > maxStreamPoints {
+				ctx.String(http.StatusBadRequest, "points must be between 2 and "+strconv.Itoa(maxStreamPoints))
+				return
+			}
+		}
+
+		activity, err := activityRepo.GetActivityByID(uint(id))
+		if err != nil || activity.UserID != sessionUserId || !activity.IsCardio() {
+			ctx.String(http.StatusNotFound, "Activity not found")
+			return
+		}
+		stream, err := activityRepo.GetStreams(activity.ID)
+		if err != nil {
+			log.Printf("Failed to get the streams of activity %d: %v", activity.ID, err)
+			ctx.String(http.StatusInternalServerError, "Could not get the streams")
+			return
+		}
+		if stream == nil && activity.FromStrava() {
+			if stream, err = fetchStreams(ctx.Request.Context(), activityRepo, stravaRepo, syncer, activity); err != nil {
+				log.Printf("Failed to fetch the streams of Strava activity %d for user %d: %v", *activity.StravaID, sessionUserId, err)
+				ctx.String(http.StatusBadGateway, "Could not fetch the streams from Strava")
+				return
+			}
+		}
+
+		streams := database.Streams{}
+		if stream != nil && stream.Streams != nil {
+			streams = stream.Streams
+		}
+		if keys := ctx.Query("keys"); keys != "" {
+			var kinds []database.StreamKind
+			for _, key := range strings.Split(keys, ",") {
+				kinds = append(kinds, database.StreamKind(strings.TrimSpace(key)))
+			}
+			streams = streams.Only(kinds...)
+		}
+		downsampled := streams.Downsample(points)
+		ctx.JSON(http.StatusOK, gin.H{
+			"original_points": streams.Len(),
+			"points":          downsampled.Len(),
+			"streams":         downsampled,
+		})
+	}
+}
+
+// fetchStreams fetches and saves a Strava activity's streams, if the user's account is still
+// connected. It returns nil if it isn't.
+func fetchStreams(ctx context.Context, activityRepo *database.ActivityRepo, stravaRepo *database.StravaRepo, syncer *strava.Syncer, activity *database.Activity) (*database.ActivityStream, error) {
+	account, err := stravaRepo.GetAccountByUserID(activity.UserID)
+	if err != nil || account == nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cardioFetchTimeout)
+	defer cancel()
+	streams, err := syncer.FetchStreams(ctx, account, *activity.StravaID)
+	if err != nil {
+		return nil, err
+	}
+	return activityRepo.SaveStreams(activity.ID, streams)
+}
@@ -0,0 +1,130 @@
+package workout
+
+import (
+	"errors"
+	"fitness/platform/database"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExerciseComparison compares one exercise in a workout with the last time it was done.
+type ExerciseComparison struct {
+	Name         string
+	Time         time.Duration
+	Sets         int
+	TopWeightKG  float64
+	Reps         int
+	VolumeKG     float64
+	HasPrevious  bool
+	PreviousDate time.Time
+	PrevWeightKG float64
+	PrevReps     int
+	PrevVolumeKG float64
+}
+
+// WeightDelta is the change in top set weight since last time.
+func (c ExerciseComparison) WeightDelta() float64 { return c.TopWeightKG - c.PrevWeightKG }
+
+// RepsDelta is the change in total reps since last time.
+func (c ExerciseComparison) RepsDelta() int { return c.Reps - c.PrevReps }
+
+// VolumeDelta is the change in total volume since last time.
+func (c ExerciseComparison) VolumeDelta() float64 { return c.VolumeKG - c.PrevVolumeKG }
+
+// WorkoutSummary holds the figures shown on the post-workout summary screen.
+type WorkoutSummary struct {
+	Duration      time.Duration
+	TotalVolumeKG float64
+	SetCount      int
+	ExerciseCount int
+	Muscles       []string
+	Comparisons   []ExerciseComparison
+	Timings       WorkoutTimings
+}
+
+// DurationText formats the workout duration for display, e.g. "1h 05m".
+func (s WorkoutSummary) DurationText() string {
+	if s.Duration <= 0 {
+		return "-"
+	}
+	minutes := int(s.Duration.Round(time.Minute).Minutes())
+	if minutes < 60 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh %02dm", minutes/60, minutes%60)
+}
+
+// setTotals adds up the working figures for a list of sets.
+func setTotals(sets []database.GymSet) (topWeight float64, reps int, volume float64) {
+	for _, set := range sets {
+		reps += set.Reps
+		volume += float64(set.Reps) * set.WeightKG
+		if set.WeightKG > topWeight {
+			topWeight = set.WeightKG
+		}
+	}
+	return topWeight, reps, volume
+}
+
+// BuildSummary works out the summary of a finished workout. The activity must have its
+// GymExercises, their Sets and ExerciseDefinitions preloaded.
+func BuildSummary(activity *database.Activity, gymExerciseRepo *database.GymExerciseRepo) (*WorkoutSummary, error) {
+	summary := &WorkoutSummary{
+		Duration: activity.ActiveDuration(time.Now()),
+		Timings:  buildTimings(activity),
+	}
+
+	muscles := make(map[string]bool)
+	seenExercises := make(map[uint]bool)
+	for _, gymExercise := range activity.GymExercises {
+		if gymExercise.ExerciseDefinitionID == 0 {
+			continue
+		}
+		definition := gymExercise.ExerciseDefinition
+		if definition.PrimaryMuscleGroup != "" {
+			muscles[definition.PrimaryMuscleGroup] = true
+		}
+		for _, muscle := range definition.SecondaryMuscles {
+			muscles[muscle] = true
+		}
+
+		topWeight, reps, volume := setTotals(gymExercise.Sets)
+		summary.SetCount += len(gymExercise.Sets)
+		summary.TotalVolumeKG += volume
+		if !seenExercises[gymExercise.ExerciseDefinitionID] {
+			seenExercises[gymExercise.ExerciseDefinitionID] = true
+			summary.ExerciseCount++
+		}
+
+		comparison := ExerciseComparison{
+			Name:        definition.Name,
+			Time:        summary.Timings.TimeFor(gymExercise.ID),
+			Sets:        len(gymExercise.Sets),
+			TopWeightKG: topWeight,
+			Reps:        reps,
+			VolumeKG:    volume,
+		}
+
+		previous, err := gymExerciseRepo.GetPreviousExercise(activity.UserID, gymExercise.ExerciseDefinitionID, activity.ActivityTime, activity.ID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if previous != nil {
+			comparison.HasPrevious = true
+			comparison.PreviousDate = previous.Activity.ActivityTime
+			comparison.PrevWeightKG, comparison.PrevReps, comparison.PrevVolumeKG = setTotals(previous.Sets)
+		}
+
+		summary.Comparisons = append(summary.Comparisons, comparison)
+	}
+
+	for muscle := range muscles {
+		summary.Muscles = append(summary.Muscles, muscle)
+	}
+	sort.Strings(summary.Muscles)
+
+	return summary, nil
+}
@@ -0,0 +1,84 @@
+package workout
+
+import (
+	"fitness/platform/database"
+	"sort"
+	"time"
+)
+
+// WorkoutTimings breaks a session down using the times its sets were completed.
+type WorkoutTimings struct {
+	// SetRests is the rest taken before each completed set, keyed by set ID. It is the rest
+	// timer's record when there is one, else the gap since the previous set was completed.
+	// The first completed set of the session has no rest.
+	SetRests map[uint]time.Duration
+	// ExerciseTimes is the time spent on each exercise, keyed by GymExercise ID. It runs
+	// from the end of the previous set (or the start of the session) to its last set.
+	ExerciseTimes map[uint]time.Duration
+	AverageRest   time.Duration
+}
+
+// RestFor returns the rest taken before a set, or 0 if it wasn't timed.
+func (t WorkoutTimings) RestFor(setID uint) time.Duration {
+	return t.SetRests[setID]
+}
+
+// TimeFor returns the time spent on an exercise, or 0 if it wasn't timed.
+func (t WorkoutTimings) TimeFor(gymExerciseID uint) time.Duration {
+	return t.ExerciseTimes[gymExerciseID]
+}
+
+// buildTimings works out rests and time per exercise from the set completion times.
+// Time spent paused is not taken out of the rests.
+func buildTimings(activity *database.Activity) WorkoutTimings {
+	timings := WorkoutTimings{
+		SetRests:      make(map[uint]time.Duration),
+		ExerciseTimes: make(map[uint]time.Duration),
+	}
+
+	type completedSet struct {
+		setID         uint
+		gymExerciseID uint
+		completedAt   time.Time
+		restAfter     *int
+	}
+	var completed []completedSet
+	for _, gymExercise := range activity.GymExercises {
+		for _, set := range gymExercise.Sets {
+			if set.CompletedAt != nil {
+				completed = append(completed, completedSet{set.ID, gymExercise.ID, *set.CompletedAt, set.RestSeconds})
+			}
+		}
+	}
+	sort.Slice(completed, func(i, j int) bool { return completed[i].completedAt.Before(completed[j].completedAt) })
+
+	var totalRest time.Duration
+	var rests int
+	var lastFinished *time.Time
+	if activity.StartTime != nil {
+		lastFinished = activity.StartTime
+	}
+	for i, set := range completed {
+		if i > 0 {
+			rest := set.completedAt.Sub(completed[i-1].completedAt)
+			if recorded := completed[i-1].restAfter; recorded != nil {
+				rest = time.Duration(*recorded) * time.Second
+			}
+			timings.SetRests[set.setID] = rest
+			totalRest += rest
+			rests++
+		}
+
+		// An exercise's time runs up to its last completed set.
+		if lastFinished != nil {
+			timings.ExerciseTimes[set.gymExerciseID] += set.completedAt.Sub(*lastFinished)
+		}
+		finished := set.completedAt
+		lastFinished = &finished
+	}
+
+	if rests > 0 {
+		timings.AverageRest = totalRest / time.Duration(rests)
+	}
+	return timings
+}
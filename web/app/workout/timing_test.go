@@ -0,0 +1,79 @@
+package workout
+
+import (
+	"fitness/platform/database"
+	"gorm.io/gorm"
+	"maps"
+	"testing"
+	"time"
+)
+
+func TestBuildTimings(t *testing.T) {
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) *time.Time {
+		t := start.Add(time.Duration(minutes) * time.Minute)
+		return &t
+	}
+	ninety := 90
+
+	for _, test := range []struct {
+		name      string
+		startTime *time.Time
+		exercises []database.GymExercise
+		rests     map[uint]time.Duration
+		times     map[uint]time.Duration
+		average   time.Duration
+	}{
+		{
+			name:      "rests are the gaps between sets unless the timer recorded one",
+			startTime: &start,
+			exercises: []database.GymExercise{
+				{Model: model(1), Sets: []database.GymSet{
+					{Model: model(11), CompletedAt: at(2)},
+					{Model: model(12), CompletedAt: at(5), RestSeconds: &ninety},
+				}},
+				{Model: model(2), Sets: []database.GymSet{
+					{Model: model(21), CompletedAt: at(8)},
+					{Model: model(22)},
+				}},
+			},
+			rests:   map[uint]time.Duration{12: 3 * time.Minute, 21: 90 * time.Second},
+			times:   map[uint]time.Duration{1: 5 * time.Minute, 2: 3 * time.Minute},
+			average: 135 * time.Second,
+		},
+		{
+			name: "sets are taken in the order they were done",
+			exercises: []database.GymExercise{
+				{Model: model(1), Sets: []database.GymSet{{Model: model(11), CompletedAt: at(10)}}},
+				{Model: model(2), Sets: []database.GymSet{{Model: model(21), CompletedAt: at(4)}}},
+			},
+			rests:   map[uint]time.Duration{11: 6 * time.Minute},
+			times:   map[uint]time.Duration{1: 6 * time.Minute},
+			average: 6 * time.Minute,
+		},
+		{
+			name: "nothing done",
+			exercises: []database.GymExercise{
+				{Model: model(1), Sets: []database.GymSet{{Model: model(11)}}},
+			},
+			rests: map[uint]time.Duration{},
+			times: map[uint]time.Duration{},
+		},
+	} {
+		timings := buildTimings(&database.Activity{StartTime: test.startTime, GymExercises: test.exercises})
+		if !maps.Equal(timings.SetRests, test.rests) {
+			t.Errorf("%s: rests = %v, want %v", test.name, timings.SetRests, test.rests)
+		}
+		if !maps.Equal(timings.ExerciseTimes, test.times) {
+			t.Errorf("%s: exercise times = %v, want %v", test.name, timings.ExerciseTimes, test.times)
+		}
+		if timings.AverageRest != test.average {
+			t.Errorf("%s: average rest = %v, want %v", test.name, timings.AverageRest, test.average)
+		}
+	}
+}
+
+// model returns a gorm.Model with only the ID set.
+func model(id uint) gorm.Model {
+	return gorm.Model{ID: id}
+}
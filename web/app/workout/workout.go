@@ -1,10 +1,19 @@
 package workout
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fitness/platform/database"
+	"fitness/platform/progression"
+	"fitness/platform/strava"
+	"fitness/platform/streak"
+	"fitness/platform/webhook"
 	"fmt"
 	"gorm.io/gorm"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -16,14 +25,19 @@ import (
 // CreateHandler handles the POST /workouts/new request
 func CreateHandler(activityRepo *database.ActivityRepo, userRepo *database.UserRepo) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		session := sessions.Default(ctx)
-		activeIDInterface := session.Get("active_workout_id")
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
 		discard := ctx.Query("discard") == "true"
 
+		// The active draft is kept against the user, so it is found whichever device it was started on.
+		active, err := activityRepo.GetActiveDraft(sessionUserId)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Failed to check for an active workout")
+			return
+		}
+
 		// This confirmation flow is good, no changes needed here.
-		if activeIDInterface != nil && !discard {
-			activeID := activeIDInterface.(uint)
-			returnURL := fmt.Sprintf("/workouts/%d/edit", activeID)
+		if active != nil && !discard {
+			returnURL := fmt.Sprintf("/workouts/%d/edit", active.ID)
 			discardAndStartNewUrl := "/workouts/new?discard=true"
 			ctx.HTML(http.StatusOK, "_create_workout_confirm.html", gin.H{
 				"DiscardURL": discardAndStartNewUrl,
@@ -33,29 +47,30 @@ func CreateHandler(activityRepo *database.ActivityRepo, userRepo *database.UserR
 		}
 
 		// If a draft is being discarded, use the new robust delete method.
-		if activeIDInterface != nil {
-			if err := activityRepo.DeleteActivityAndChildren(activeIDInterface.(uint)); err != nil {
+		if active != nil {
+			if err := activityRepo.DeleteActivityAndChildren(active.ID); err != nil {
 				ctx.String(http.StatusInternalServerError, "Failed to discard previous workout")
 				return // Important to return here
 			}
 		}
 
 		// The logic for creating the new activity is correct.
-		sessionUserId := session.Get("user").(uint)
 		sessionUser, _ := userRepo.GetUserById(uint64(sessionUserId))
 
+		now := time.Now()
 		newActivity := &database.Activity{
 			UserID:       sessionUser.ID,
 			Type:         "GYM_WORKOUT",
-			ActivityTime: time.Now(),
+			ActivityTime: now,
+			StartTime:    &now,
 			Name:         "Gym Workout",
 			Status:       database.StatusDraft,
 		}
 		activityRepo.CreateActivity(newActivity) // Assuming Create is a simple create method
 
-		// The logic for setting the session and redirecting is also correct.
-		session.Set("active_workout_id", newActivity.ID)
-		session.Save()
+		if err := userRepo.SetActiveActivity(sessionUser.ID, &newActivity.ID); err != nil {
+			log.Printf("Failed to set active workout for user %d: %v", sessionUser.ID, err)
+		}
 
 		redirectURL := fmt.Sprintf("/workouts/%d/edit", newActivity.ID)
 		ctx.Header("HX-Redirect", redirectURL)
@@ -63,23 +78,142 @@ func CreateHandler(activityRepo *database.ActivityRepo, userRepo *database.UserR
 	}
 }
 
-func DeleteActivityHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
+func DeleteActivityHandler(activityRepo *database.ActivityRepo, streakRepo *database.StreakRepo, webhooks *webhook.Dispatcher) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 
 		idStr := ctx.Param("id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
 			ctx.String(http.StatusInternalServerError, "Failed to parse id")
+			return
 		}
-		err = activityRepo.DeleteActivityAndChildren(uint(id))
-		if err != nil {
+
+		// Loaded first to check it is the session user's, and so the webhook can say what was deleted.
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		activity, err := activityRepo.GetActivityByID(uint(id))
+		if err != nil || activity.UserID != sessionUserId {
+			ctx.String(http.StatusNotFound, "Activity not found")
+			return
+		}
+
+		if err := activityRepo.DeleteActivityAndChildren(activity.ID); err != nil {
 			ctx.String(http.StatusInternalServerError, "Failed to delete activity")
+			return
+		}
+
+		if _, err := streakRepo.RecalculateStreak(activity.UserID); err != nil {
+			log.Printf("Failed to recalculate streak for user %d: %v", activity.UserID, err)
+		}
+		if activity.Status == database.StatusActive {
+			webhooks.WorkoutDeleted(activity)
 		}
 		ctx.Status(http.StatusOK)
 	}
 }
 
-func ViewHandler(activityRepo *database.ActivityRepo, gymSetRepo *database.GymSetRepo, exerciseRepo *database.ExerciseRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+// DayHandler lists the finished workouts for a single day.
+// Route: GET /workouts/day/:date
+func DayHandler(activityRepo *database.ActivityRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// The day is the calendar's, so it is read in the time zone streaks count days in.
+		day, err := time.ParseInLocation("2006-01-02", ctx.Param("date"), streak.Location)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "invalid date")
+			return
+		}
+
+		activities, err := activityRepo.GetActivitiesByUserIDForDay(sessionUser.ID, day)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not load workouts")
+			return
+		}
+
+		ctx.HTML(http.StatusOK, "workout-day.html", gin.H{
+			"Day":          day,
+			"ActivityList": activities,
+			"User":         sessionUser,
+		})
+	}
+}
+
+// ActiveWorkoutBannerHandler renders the "resume workout" banner shown on every page. It is
+// left out on a workout's edit page, and points to the drafts page when there are several drafts.
+// Route: GET /ui/active-workout-banner
+func ActiveWorkoutBannerHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+
+		if currentURL, err := url.Parse(ctx.GetHeader("HX-Current-URL")); err == nil &&
+			strings.HasPrefix(currentURL.Path, "/workouts/") && strings.HasSuffix(currentURL.Path, "/edit") {
+			ctx.Status(http.StatusOK)
+			return
+		}
+
+		drafts, err := activityRepo.GetDraftsByUserID(sessionUserId)
+		if err != nil {
+			log.Printf("Failed to load drafts for user %d: %v", sessionUserId, err)
+			ctx.Status(http.StatusOK)
+			return
+		}
+		if len(drafts) == 0 {
+			ctx.Status(http.StatusOK)
+			return
+		}
+
+		active, err := activityRepo.GetActiveDraft(sessionUserId)
+		if err != nil || active == nil {
+			active = drafts[0]
+		}
+
+		ctx.HTML(http.StatusOK, "_active-workout-banner.html", gin.H{
+			"Active":     active,
+			"DraftCount": len(drafts),
+		})
+	}
+}
+
+// DraftsHandler lists a user's unfinished workouts so they can pick one to carry on with
+// and discard the rest.
+// Route: GET /workouts/drafts
+func DraftsHandler(activityRepo *database.ActivityRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		drafts, err := activityRepo.GetDraftsByUserID(sessionUser.ID)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not load drafts")
+			return
+		}
+		active, err := activityRepo.GetActiveDraft(sessionUser.ID)
+		if err != nil {
+			log.Printf("Failed to load active workout for user %d: %v", sessionUser.ID, err)
+		}
+		var activeID uint
+		if active != nil {
+			activeID = active.ID
+		}
+
+		ctx.HTML(http.StatusOK, "workout-drafts.html", gin.H{
+			"Drafts":   drafts,
+			"ActiveID": activeID,
+			"User":     sessionUser,
+		})
+	}
+}
+
+func ViewHandler(activityRepo *database.ActivityRepo, gymSetRepo *database.GymSetRepo, exerciseRepo *database.ExerciseRepo, userRepo *database.UserRepo, revisionRepo *database.RevisionRepo) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		sessionUserId := sessions.Default(ctx).Get("user").(uint)
 		sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
@@ -99,14 +233,225 @@ func ViewHandler(activityRepo *database.ActivityRepo, gymSetRepo *database.GymSe
 			return
 		}
 
+		var history []RevisionEntry
+		revisions, err := revisionRepo.GetRevisionsByActivityID(activity.ID)
+		if err == nil {
+			history, err = buildRevisionHistory(activity, revisions)
+		}
+		if err != nil {
+			log.Printf("Failed to load edit history for workout %d: %v", activity.ID, err)
+		}
+
 		ctx.HTML(http.StatusOK, "view-workout.html", gin.H{
 			"Activity": activity,
+			"Duration": activity.ActiveDuration(time.Now()),
+			"Timings":  buildTimings(activity),
+			"History":  history,
+			"User":     sessionUser,
+		})
+	}
+}
+
+// RevertRevisionHandler puts a finished workout back to an earlier version from its edit history.
+// Route: POST /workouts/:id/revisions/:version/revert
+func RevertRevisionHandler(activityRepo *database.ActivityRepo, revisionRepo *database.RevisionRepo, streakRepo *database.StreakRepo, recordRepo *database.PersonalRecordRepo, webhooks *webhook.Dispatcher, poster *strava.Poster) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		activityID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid workout ID")
+			return
+		}
+		version, err := strconv.Atoi(ctx.Param("version"))
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid version")
+			return
+		}
+
+		activity, err := activityRepo.GetActivityByID(uint(activityID))
+		if err != nil || activity.UserID != sessionUserId || activity.Status != database.StatusActive {
+			ctx.String(http.StatusNotFound, "Workout not found")
+			return
+		}
+
+		if err := revisionRepo.RevertToRevision(activity.ID, version); err != nil {
+			ctx.String(http.StatusInternalServerError, "Failed to revert workout")
+			return
+		}
+
+		// The date and sets may have changed, so the streak and records are worked out again.
+		if _, err := streakRepo.RecalculateStreak(sessionUserId); err != nil {
+			log.Printf("Failed to recalculate streak for user %d: %v", sessionUserId, err)
+		}
+		if reverted, err := activityRepo.GetActivityByID(activity.ID); err == nil {
+			AfterSave(reverted, database.EventWorkoutUpdated, recordRepo, webhooks, poster)
+		} else {
+			log.Printf("Failed to load reverted workout %d: %v", activity.ID, err)
+		}
+
+		ctx.Header("HX-Redirect", fmt.Sprintf("/workouts/%d", activity.ID))
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// SummaryHandler shows the post-workout summary with comparisons, records and the share link,
+// if the workout has been shared.
+// Route: GET /workouts/:id/summary
+func SummaryHandler(
+	activityRepo *database.ActivityRepo,
+	gymExerciseRepo *database.GymExerciseRepo,
+	recordRepo *database.PersonalRecordRepo,
+	userRepo *database.UserRepo,
+) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "invalid workout id")
+			return
+		}
+
+		activity, err := activityRepo.GetActivityByID(uint(id))
+		if err != nil || activity.UserID != sessionUser.ID {
+			ctx.String(http.StatusNotFound, "Workout not found")
+			return
+		}
+
+		summary, err := BuildSummary(activity, gymExerciseRepo)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not build workout summary")
+			return
+		}
+
+		records, err := recordRepo.GetRecordsByActivityID(activity.ID)
+		if err != nil {
+			log.Printf("Failed to load records for activity %d: %v", activity.ID, err)
+		}
+
+		shareURL := ""
+		if activity.ShareToken != nil {
+			scheme := "http"
+			if ctx.Request.TLS != nil {
+				scheme = "https"
+			}
+			shareURL = fmt.Sprintf("%s://%s/shared/%s", scheme, ctx.Request.Host, *activity.ShareToken)
+		}
+
+		ctx.HTML(http.StatusOK, "workout-summary.html", gin.H{
+			"Activity": activity,
+			"Summary":  summary,
+			"Records":  records,
+			"ShareURL": shareURL,
+			"CanShare": activity.Status == database.StatusActive,
 			"User":     sessionUser,
 		})
 	}
 }
 
-func EditHandler(activityRepo *database.ActivityRepo, gymSetRepo *database.GymSetRepo, exerciseRepo *database.ExerciseRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+// ShareWorkoutHandler creates a public share link for a finished workout, if it doesn't have one
+// already, and goes back to its summary to show it.
+// Route: POST /workouts/:id/share
+func ShareWorkoutHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "invalid workout id")
+			return
+		}
+
+		activity, err := activityRepo.GetActivityByID(uint(id))
+		if err != nil || activity.UserID != sessionUserId {
+			ctx.String(http.StatusNotFound, "Workout not found")
+			return
+		}
+		if activity.Status != database.StatusActive {
+			ctx.String(http.StatusBadRequest, "Only finished workouts can be shared")
+			return
+		}
+
+		if activity.ShareToken == nil {
+			token, err := generateShareToken()
+			if err == nil {
+				err = activityRepo.SetShareToken(activity.ID, token)
+			}
+			if err != nil {
+				log.Printf("Failed to create share token for activity %d: %v", activity.ID, err)
+				ctx.String(http.StatusInternalServerError, "Could not share workout")
+				return
+			}
+		}
+
+		ctx.Redirect(http.StatusSeeOther, fmt.Sprintf("/workouts/%d/summary", activity.ID))
+	}
+}
+
+// UnshareWorkoutHandler revokes a workout's share link, so that it no longer shows the workout.
+// Sharing it again makes a new link.
+// Route: DELETE /workouts/:id/share
+func UnshareWorkoutHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "invalid workout id")
+			return
+		}
+
+		activity, err := activityRepo.GetActivityByID(uint(id))
+		if err != nil || activity.UserID != sessionUserId {
+			ctx.String(http.StatusNotFound, "Workout not found")
+			return
+		}
+
+		if err := activityRepo.ClearShareToken(activity.ID); err != nil {
+			log.Printf("Failed to revoke share token for activity %d: %v", activity.ID, err)
+			ctx.String(http.StatusInternalServerError, "Could not stop sharing workout")
+			return
+		}
+
+		ctx.Header("HX-Redirect", fmt.Sprintf("/workouts/%d/summary", activity.ID))
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// SharedWorkoutHandler shows a read-only view of a workout to anyone with its share link.
+// Route: GET /shared/:token
+func SharedWorkoutHandler(activityRepo *database.ActivityRepo, gymExerciseRepo *database.GymExerciseRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		activity, err := activityRepo.GetActivityByShareToken(ctx.Param("token"))
+		if err != nil {
+			ctx.String(http.StatusNotFound, "Workout not found")
+			return
+		}
+
+		summary, err := BuildSummary(activity, gymExerciseRepo)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not build workout summary")
+			return
+		}
+
+		ctx.HTML(http.StatusOK, "shared-workout.html", gin.H{
+			"Activity": activity,
+			"Summary":  summary,
+		})
+	}
+}
+
+func generateShareToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func EditHandler(activityRepo *database.ActivityRepo, gymSetRepo *database.GymSetRepo, exerciseRepo *database.ExerciseRepo, userRepo *database.UserRepo, gymExerciseRepo *database.GymExerciseRepo, restRepo *database.RestRepo) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		sessionUserId := sessions.Default(ctx).Get("user").(uint)
 		sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
@@ -127,10 +472,39 @@ func EditHandler(activityRepo *database.ActivityRepo, gymSetRepo *database.GymSe
 		}
 		allExercises, _ := exerciseRepo.GetExerciseList()
 
+		// Opening one of your drafts makes it the workout to come back to.
+		if activity.Status == database.StatusDraft && activity.UserID == sessionUser.ID {
+			if err := userRepo.SetActiveActivity(sessionUser.ID, &activity.ID); err != nil {
+				log.Printf("Failed to set active workout for user %d: %v", sessionUser.ID, err)
+			}
+		}
+
+		// Look up the last session of each exercise so the sets can show last time's values.
+		previousSessions := make(map[uint]*PreviousSession)
+		for _, gymExercise := range activity.GymExercises {
+			previous, err := loadPreviousSession(gymExerciseRepo, sessionUser, gymExercise.ExerciseDefinitionID, activity.ActivityTime, activity.ID)
+			if err != nil {
+				log.Printf("Failed to load previous session for exercise %d: %v", gymExercise.ID, err)
+			}
+			previousSessions[gymExercise.ID] = previous
+		}
+
+		restSeconds := make(map[uint]int)
+		for _, gymExercise := range activity.GymExercises {
+			seconds, err := restRepo.GetRestSeconds(sessionUser.ID, gymExercise.ExerciseDefinitionID)
+			if err != nil {
+				log.Printf("Failed to load rest timer for exercise %d: %v", gymExercise.ID, err)
+			}
+			restSeconds[gymExercise.ID] = seconds
+		}
+
 		ctx.HTML(http.StatusOK, "edit-workout.html", gin.H{
-			"Activity":     activity,
-			"AllExercises": allExercises,
-			"User":         sessionUser,
+			"Activity":         activity,
+			"AllExercises":     allExercises,
+			"PreviousSessions": previousSessions,
+			"RestSeconds":      restSeconds,
+			"ElapsedSeconds":   int(activity.ActiveDuration(time.Now()).Seconds()),
+			"User":             sessionUser,
 		})
 	}
 }
@@ -161,6 +535,59 @@ func UpdateSetHandler(gymSetRepo *database.GymSetRepo) gin.HandlerFunc {
 	}
 }
 
+// CompleteSetHandler marks a set as done, stamping the time so rests can be measured, and
+// starts the rest timer for the workout. Posting again for a completed set un-marks it.
+// Route: POST /gym-set/:id/complete
+func CompleteSetHandler(gymSetRepo *database.GymSetRepo, gymExerciseRepo *database.GymExerciseRepo, restRepo *database.RestRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		setID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid set ID")
+			return
+		}
+
+		gymSet, err := gymSetRepo.GetGymSetByID(uint(setID))
+		if err != nil {
+			ctx.String(http.StatusNotFound, "Set not found")
+			return
+		}
+		// The set's workout must be the session user's, as completing it starts the workout's rest timer.
+		gymExercise, err := gymExerciseRepo.GetExerciseByID(uint64(gymSet.GymExerciseID))
+		if err != nil {
+			ctx.String(http.StatusNotFound, "Set not found")
+			return
+		}
+		if activity, err := restRepo.GetRestTimer(gymExercise.ActivityID); err != nil || activity.UserID != sessionUserId {
+			ctx.String(http.StatusNotFound, "Set not found")
+			return
+		}
+
+		var completedAt *time.Time
+		if gymSet.CompletedAt == nil {
+			now := time.Now()
+			completedAt = &now
+		}
+
+		updatedSet, err := gymSetRepo.SetCompletedAt(gymSet.ID, completedAt)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Failed to update set")
+			return
+		}
+
+		if err := updateRestTimer(gymExerciseRepo, restRepo, sessionUserId, updatedSet); err != nil {
+			log.Printf("Failed to update rest timer for set %d: %v", updatedSet.ID, err)
+		} else {
+			// Let the rest timer on this page refresh straight away rather than on the next stream check.
+			ctx.Header("HX-Trigger", "rest-changed")
+		}
+
+		ctx.HTML(http.StatusOK, "_set-complete-button.html", gin.H{
+			"Set": updatedSet,
+		})
+	}
+}
+
 // UpdateExerciseHandler handles changing the selected exercise definition.
 // Route: PUT /gym-exercise/:id
 func UpdateExerciseHandler(gymExerciseRepo *database.GymExerciseRepo) gin.HandlerFunc {
@@ -238,8 +665,14 @@ func AddExerciseToActivityHandler(
 	}
 }
 
-// AddSetToExerciseHandler creates a new, blank GymSet for a GymExercise.
-func AddSetToExerciseHandler(gymSetRepo *database.GymSetRepo) gin.HandlerFunc {
+// AddSetToExerciseHandler creates a new GymSet for a GymExercise, pre-filled from the
+// matching set last session or, failing that, from the exercise's current last set.
+func AddSetToExerciseHandler(
+	gymSetRepo *database.GymSetRepo,
+	gymExerciseRepo *database.GymExerciseRepo,
+	activityRepo *database.ActivityRepo,
+	userRepo *database.UserRepo,
+) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		gymExerciseID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
 		if err != nil {
@@ -248,17 +681,29 @@ func AddSetToExerciseHandler(gymSetRepo *database.GymSetRepo) gin.HandlerFunc {
 		}
 
 		// 1. Determine the next set number.
-		setCount, err := gymSetRepo.CountByExerciseID(uint64(uint(gymExerciseID)))
+		existingSets, err := gymSetRepo.GetGymSetsByExerciseID(uint(gymExerciseID))
 		if err != nil {
 			ctx.String(http.StatusInternalServerError, "Could not count sets")
 			return
 		}
-		nextSetNumber := setCount + 1
+		nextSetNumber := len(existingSets) + 1
 
-		// 2. Create the new GymSet record.
+		// 2. Create the new GymSet record, copying the last set so far.
 		newSet := &database.GymSet{
 			GymExerciseID: uint(gymExerciseID),
-			SetNumber:     int(nextSetNumber),
+			SetNumber:     nextSetNumber,
+		}
+		if len(existingSets) > 0 {
+			lastSet := existingSets[len(existingSets)-1]
+			newSet.Reps = lastSet.Reps
+			newSet.WeightKG = lastSet.WeightKG
+		}
+
+		// 3. Prefer last session's values for this set number where there are any.
+		previous := findPreviousSession(ctx, gymExerciseRepo, activityRepo, userRepo, uint64(gymExerciseID))
+		if previousSet := previous.SetFor(nextSetNumber); previousSet != nil {
+			newSet.Reps = previousSet.Reps
+			newSet.WeightKG = previous.SuggestedWeightFor(nextSetNumber)
 		}
 
 		if err := gymSetRepo.CreateGymSet(newSet); err != nil {
@@ -266,14 +711,45 @@ func AddSetToExerciseHandler(gymSetRepo *database.GymSetRepo) gin.HandlerFunc {
 			return
 		}
 
-		// 3. Return just the new set row HTML.
+		// 4. Return just the new set row HTML.
 		// HTMX will append this to the container of sets.
 		ctx.HTML(http.StatusOK, "_exercise-set.html", gin.H{
-			"Set": newSet,
+			"Set":      newSet,
+			"Previous": previous,
 		})
 	}
 }
 
+// findPreviousSession loads the last session for the exercise behind a GymExercise. Failures are
+// logged and treated as having no history, since pre-filling is only a convenience.
+func findPreviousSession(
+	ctx *gin.Context,
+	gymExerciseRepo *database.GymExerciseRepo,
+	activityRepo *database.ActivityRepo,
+	userRepo *database.UserRepo,
+	gymExerciseID uint64,
+) *PreviousSession {
+	gymExercise, err := gymExerciseRepo.GetExerciseByID(gymExerciseID)
+	if err != nil {
+		return nil
+	}
+	activity, err := activityRepo.GetActivityByID(gymExercise.ActivityID)
+	if err != nil {
+		return nil
+	}
+	sessionUserId := sessions.Default(ctx).Get("user").(uint)
+	sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
+	if err != nil {
+		return nil
+	}
+
+	previous, err := loadPreviousSession(gymExerciseRepo, sessionUser, gymExercise.ExerciseDefinitionID, activity.ActivityTime, activity.ID)
+	if err != nil {
+		log.Printf("Failed to load previous session for exercise %d: %v", gymExerciseID, err)
+	}
+	return previous
+}
+
 // AddExerciseModalHandler serves the modal container.
 // The modal itself then loads its content via hx-get.
 // Route: GET /ui/add-exercise-modal/:id
@@ -344,6 +820,11 @@ func ExerciseInfoHandler(
 		activityID := ctx.Query("activityID")
 
 		exercise, _ := exerciseRepo.GetExerciseByID(uint(exerciseID))
+		sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
 
 		// This still returns the flat list of all sets, which is what we want
 		historySets, _ := gymSetRepo.GetExerciseHistoryForUser(sessionUserId, uint(exerciseID))
@@ -383,17 +864,23 @@ func ExerciseInfoHandler(
 			"Exercise":       exercise,
 			"GroupedHistory": groupedHistory, // Pass the newly grouped data
 			"ActivityID":     activityID,
+			"IsAdmin":        sessionUser.IsAdmin,
 		})
 	}
 }
 
-// AddExerciseToFormHandler creates the new GymExercise and its first set.
+// AddExerciseToFormHandler creates the new GymExercise and its sets, pre-filled from
+// the last time the user did the exercise.
 func AddExerciseToFormHandler(
 	gymExerciseRepo *database.GymExerciseRepo,
 	gymSetRepo *database.GymSetRepo,
 	exerciseRepo *database.ExerciseRepo,
+	activityRepo *database.ActivityRepo,
+	userRepo *database.UserRepo,
+	restRepo *database.RestRepo,
 ) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
 		activityID, _ := strconv.ParseUint(ctx.Param("id"), 10, 64)
 		exerciseDefinitionID_uint64, _ := strconv.ParseUint(ctx.PostForm("exercise_id"), 10, 64)
 
@@ -408,11 +895,14 @@ func AddExerciseToFormHandler(
 		}
 		gymExerciseRepo.CreateGymExercise(newGymExercise)
 
-		firstSet := &database.GymSet{
-			GymExerciseID: newGymExercise.ID,
-			SetNumber:     1,
+		previous := findPreviousSession(ctx, gymExerciseRepo, activityRepo, userRepo, uint64(newGymExercise.ID))
+		for _, set := range prefillSets(newGymExercise.ID, previous) {
+			if err := gymSetRepo.CreateGymSet(set); err != nil {
+				ctx.String(http.StatusInternalServerError, "Failed to create sets")
+				return
+			}
+			newGymExercise.Sets = append(newGymExercise.Sets, *set)
 		}
-		gymSetRepo.CreateGymSet(firstSet)
 
 		definition, err := exerciseRepo.GetExerciseByID(defID)
 		if err != nil {
@@ -421,14 +911,20 @@ func AddExerciseToFormHandler(
 		}
 
 		newGymExercise.ExerciseDefinition = *definition
-		newGymExercise.Sets = []database.GymSet{*firstSet}
 		allExercises, _ := exerciseRepo.GetExerciseList()
 
+		restSeconds, err := restRepo.GetRestSeconds(sessionUserId, defID)
+		if err != nil {
+			log.Printf("Failed to load rest timer for exercise %d: %v", defID, err)
+		}
+
 		ctx.HTML(http.StatusOK, "_exercise-block.html", gin.H{
 			"Index":        currentExerciseCount,
 			"GymExercise":  newGymExercise,
 			"AllExercises": allExercises,
 			"ActivityID":   activityID,
+			"Previous":     previous,
+			"RestSeconds":  restSeconds,
 		})
 	}
 }
@@ -466,8 +962,9 @@ func DeleteExerciseHandler(gymExerciseRepo *database.GymExerciseRepo) gin.Handle
 
 // CreateEditDraftHandler makes a draft copy of an existing active workout.
 // Route: POST /workouts/:id/create-edit-draft
-func CreateEditDraftHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
+func CreateEditDraftHandler(activityRepo *database.ActivityRepo, userRepo *database.UserRepo) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
 		originalID, _ := strconv.ParseUint(ctx.Param("id"), 10, 64)
 
 		// Create a deep copy and get the new draft's ID
@@ -477,11 +974,8 @@ func CreateEditDraftHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc
 			return
 		}
 
-		session := sessions.Default(ctx)
-		session.Set("active_workout_id", draftID)
-		if err := session.Save(); err != nil {
-			ctx.String(http.StatusInternalServerError, "Failed to save session")
-			return
+		if err := userRepo.SetActiveActivity(sessionUserId, &draftID); err != nil {
+			log.Printf("Failed to set active workout for user %d: %v", sessionUserId, err)
 		}
 
 		// Redirect to the edit page for the new draft
@@ -489,33 +983,316 @@ func CreateEditDraftHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc
 	}
 }
 
+// RepeatWorkoutHandler starts a new workout as a copy of a finished one.
+// The "weights" form value chooses how the weights are carried over: "same" keeps them,
+// "progress" applies the user's progression rule and anything else leaves them blank.
+// Route: POST /workouts/:id/repeat
+func RepeatWorkoutHandler(activityRepo *database.ActivityRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		originalID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid workout ID")
+			return
+		}
+		// The discard confirmation posts back with the choice in the query string.
+		weights := ctx.PostForm("weights")
+		if weights == "" {
+			weights = ctx.Query("weights")
+		}
+
+		session := sessions.Default(ctx)
+		sessionUserId := session.Get("user").(uint)
+		sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		original, err := activityRepo.GetActivityByID(uint(originalID))
+		if err != nil || original.UserID != sessionUser.ID || original.Status != database.StatusActive {
+			ctx.String(http.StatusNotFound, "Workout not found")
+			return
+		}
+
+		// Same confirmation flow as starting a new workout when one is already in progress.
+		active, err := activityRepo.GetActiveDraft(sessionUser.ID)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Failed to check for an active workout")
+			return
+		}
+		if active != nil && ctx.Query("discard") != "true" {
+			ctx.HTML(http.StatusOK, "_create_workout_confirm.html", gin.H{
+				"DiscardURL": fmt.Sprintf("/workouts/%d/repeat?discard=true&weights=%s", originalID, url.QueryEscape(weights)),
+				"ReturnURL":  fmt.Sprintf("/workouts/%d/edit", active.ID),
+			})
+			return
+		}
+		if active != nil {
+			if err := activityRepo.DeleteActivityAndChildren(active.ID); err != nil {
+				ctx.String(http.StatusInternalServerError, "Failed to discard previous workout")
+				return
+			}
+		}
+
+		var weightsFor func(sets []database.GymSet) []float64
+		switch weights {
+		case "same":
+			weightsFor = func(sets []database.GymSet) []float64 {
+				same := make([]float64, len(sets))
+				for i, set := range sets {
+					same[i] = set.WeightKG
+				}
+				return same
+			}
+		case "progress":
+			weightsFor = progression.RuleForUser(sessionUser).SuggestWeights
+		default:
+			weightsFor = func(sets []database.GymSet) []float64 { return make([]float64, len(sets)) }
+		}
+
+		draftID, err := activityRepo.CreateRepeatCopy(original.ID, weightsFor)
+		if err != nil {
+			ctx.String(http.StatusInternalServerError, "Could not create workout")
+			return
+		}
+
+		if err := userRepo.SetActiveActivity(sessionUser.ID, &draftID); err != nil {
+			log.Printf("Failed to set active workout for user %d: %v", sessionUser.ID, err)
+		}
+
+		ctx.Header("HX-Redirect", fmt.Sprintf("/workouts/%d/edit", draftID))
+		ctx.Status(http.StatusOK)
+	}
+}
+
 // FinishWorkoutHandler promotes a draft, updating notes and session in the process.
 // Route: POST /activity/:id/finish
-func FinishWorkoutHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
+func FinishWorkoutHandler(activityRepo *database.ActivityRepo, streakRepo *database.StreakRepo, recordRepo *database.PersonalRecordRepo, webhooks *webhook.Dispatcher, poster *strava.Poster) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		draftID, _ := strconv.ParseUint(ctx.Param("id"), 10, 64)
 		notes := ctx.PostForm("notes")
 
-		// This one call now handles all database logic
-		finalID, err := activityRepo.FinalizeDraft(uint(draftID), notes)
+		finishDraft(ctx, activityRepo, streakRepo, recordRepo, webhooks, poster, uint(draftID), notes)
+	}
+}
+
+// finishDraft saves a draft and redirects to the workout's summary. If the draft is an edit of
+// a workout that has been saved since the draft was made, it redirects to the conflict page instead.
+func finishDraft(ctx *gin.Context, activityRepo *database.ActivityRepo, streakRepo *database.StreakRepo, recordRepo *database.PersonalRecordRepo, webhooks *webhook.Dispatcher, poster *strava.Poster, draftID uint, notes string) {
+	// This one call now handles all database logic
+	finalID, err := activityRepo.FinalizeDraft(draftID, notes)
+	if errors.Is(err, database.ErrVersionConflict) {
+		// Keep the notes from the form so they are part of the comparison.
+		if _, err := activityRepo.UpdateActivityNotes(draftID, notes); err != nil {
+			log.Printf("Failed to save notes for draft %d: %v", draftID, err)
+		}
+		ctx.Header("HX-Redirect", fmt.Sprintf("/workouts/%d/conflict", draftID))
+		ctx.Status(http.StatusOK)
+		return
+	}
+	if err != nil {
+		ctx.String(http.StatusInternalServerError, "Failed to finalize workout: "+err.Error())
+		return
+	}
+
+	sessionUserId := sessions.Default(ctx).Get("user").(uint)
+	if _, err := streakRepo.RecalculateStreak(sessionUserId); err != nil {
+		log.Printf("Failed to recalculate streak for user %d: %v", sessionUserId, err)
+	}
+
+	// Check the finished workout for new personal bests. These are shown on the summary.
+	event := database.EventWorkoutFinished
+	if finalID != draftID {
+		event = database.EventWorkoutUpdated
+	}
+	if finalActivity, err := activityRepo.GetActivityByID(finalID); err == nil {
+		AfterSave(finalActivity, event, recordRepo, webhooks, poster)
+	} else {
+		log.Printf("Failed to load finished workout %d: %v", finalID, err)
+	}
+
+	// Redirect to the summary of the final, active workout
+	ctx.Header("HX-Redirect", fmt.Sprintf("/workouts/%d/summary", finalID))
+	ctx.Status(http.StatusOK)
+}
+
+// AfterSave checks a saved workout for new personal bests, then announces it and any records it
+// set to webhooks, and has it posted to Strava if the user wants that. event says whether it is
+// a new workout or a changed one.
+func AfterSave(activity *database.Activity, event database.WebhookEvent, recordRepo *database.PersonalRecordRepo, webhooks *webhook.Dispatcher, poster *strava.Poster) {
+	poster.Wake()
+
+	newPBs, err := AnalyzeWorkoutForPBs(activity, recordRepo)
+	if err != nil {
+		log.Printf("Failed to analyze workout %d for PBs: %v", activity.ID, err)
+	}
+
+	webhooks.WorkoutSaved(activity, event)
+	if len(newPBs) > 0 {
+		records, err := recordRepo.GetRecordsByActivityID(activity.ID)
+		if err != nil {
+			log.Printf("Failed to load records of workout %d: %v", activity.ID, err)
+			return
+		}
+		webhooks.RecordsAchieved(activity, records)
+	}
+}
+
+// loadConflict loads an edit draft along with the three versions to compare: the workout
+// as the draft was copied from it, as it is saved now, and the draft itself.
+func loadConflict(activityRepo *database.ActivityRepo, userID uint, draftID uint) (draft, original *database.Activity, base, theirs, mine database.WorkoutSnapshot, err error) {
+	draft, err = activityRepo.GetActivityByID(draftID)
+	if err != nil {
+		return
+	}
+	if draft.UserID != userID || draft.Status != database.StatusDraft || draft.OriginalActivityID == nil || draft.BaseSnapshot == nil {
+		err = gorm.ErrRecordNotFound
+		return
+	}
+	original, err = activityRepo.GetActivityByID(*draft.OriginalActivityID)
+	if err != nil {
+		return
+	}
+	base, err = database.DecodeSnapshot(*draft.BaseSnapshot)
+	if err != nil {
+		return
+	}
+	theirs = database.SnapshotOf(original)
+	mine = database.SnapshotOf(draft)
+	return
+}
+
+// ConflictHandler shows a three-way comparison when an edit draft can't be saved because
+// the workout was changed after the draft was made, so the user can pick what to keep.
+// Route: GET /workouts/:id/conflict
+func ConflictHandler(activityRepo *database.ActivityRepo, userRepo *database.UserRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		sessionUser, err := userRepo.GetUserById(uint64(sessionUserId))
 		if err != nil {
-			ctx.String(http.StatusInternalServerError, "Failed to finalize workout: "+err.Error())
+			ctx.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		draftID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid workout ID")
 			return
 		}
 
-		session := sessions.Default(ctx)
-		session.Delete("active_workout_id")
-		if err := session.Save(); err != nil {
-			ctx.String(http.StatusInternalServerError, "Failed to save session")
+		draft, original, base, theirs, mine, err := loadConflict(activityRepo, sessionUser.ID, uint(draftID))
+		if err != nil {
+			ctx.String(http.StatusNotFound, "Workout not found")
 			return
 		}
 
-		// Redirect to the final, active workout's view page
-		ctx.Header("HX-Redirect", fmt.Sprintf("/workouts/%d", finalID))
-		ctx.Status(http.StatusOK)
+		ctx.HTML(http.StatusOK, "workout-conflict.html", gin.H{
+			"Draft":    draft,
+			"Original": original,
+			"Conflict": buildConflict(base, theirs, mine),
+			"User":     sessionUser,
+		})
+	}
+}
+
+// ResolveConflictHandler merges an edit draft with the changes saved since it was made, using
+// the version the user chose for each field and exercise, and then saves it.
+// Posting "all" as "mine" keeps the draft as it is.
+// Route: POST /workouts/:id/conflict
+func ResolveConflictHandler(activityRepo *database.ActivityRepo, streakRepo *database.StreakRepo, recordRepo *database.PersonalRecordRepo, webhooks *webhook.Dispatcher, poster *strava.Poster) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		draftID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid workout ID")
+			return
+		}
+
+		_, original, base, theirs, mine, err := loadConflict(activityRepo, sessionUserId, uint(draftID))
+		if err != nil {
+			ctx.String(http.StatusNotFound, "Workout not found")
+			return
+		}
+
+		all := ctx.PostForm("all")
+		conflict := buildConflict(base, theirs, mine)
+		merged := conflict.merge(theirs, mine, func(key string, status ChangeStatus) string {
+			if all != "" {
+				return all
+			}
+			if choice := ctx.PostForm("choice_" + key); choice != "" {
+				return choice
+			}
+			return status.DefaultChoice()
+		})
+
+		// The draft now builds on the workout as it is saved, so it can go over the top of it.
+		if err := activityRepo.RebaseDraft(uint(draftID), original.Version, theirs, merged); err != nil {
+			ctx.String(http.StatusInternalServerError, "Failed to merge workout")
+			return
+		}
+		finishDraft(ctx, activityRepo, streakRepo, recordRepo, webhooks, poster, uint(draftID), merged.Notes)
+	}
+}
+
+// PauseWorkoutHandler pauses the session clock of a workout in progress.
+// Route: POST /activity/:id/pause
+func PauseWorkoutHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		activityID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid activity ID")
+			return
+		}
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		if activity, err := activityRepo.GetActivityByID(uint(activityID)); err != nil || activity.UserID != sessionUserId {
+			ctx.String(http.StatusNotFound, "Activity not found")
+			return
+		}
+
+		if err := activityRepo.PauseActivity(uint(activityID)); err != nil {
+			ctx.String(http.StatusInternalServerError, "Failed to pause workout")
+			return
+		}
+		renderSessionClock(ctx, activityRepo, uint(activityID))
 	}
 }
 
+// ResumeWorkoutHandler restarts the session clock of a paused workout.
+// Route: POST /activity/:id/resume
+func ResumeWorkoutHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		activityID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid activity ID")
+			return
+		}
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		if activity, err := activityRepo.GetActivityByID(uint(activityID)); err != nil || activity.UserID != sessionUserId {
+			ctx.String(http.StatusNotFound, "Activity not found")
+			return
+		}
+
+		if err := activityRepo.ResumeActivity(uint(activityID)); err != nil {
+			ctx.String(http.StatusInternalServerError, "Failed to resume workout")
+			return
+		}
+		renderSessionClock(ctx, activityRepo, uint(activityID))
+	}
+}
+
+// renderSessionClock renders the elapsed time and pause/resume control for a workout.
+func renderSessionClock(ctx *gin.Context, activityRepo *database.ActivityRepo, activityID uint) {
+	activity, err := activityRepo.GetActivityByID(activityID)
+	if err != nil {
+		ctx.String(http.StatusNotFound, "Activity not found")
+		return
+	}
+	ctx.HTML(http.StatusOK, "_session-clock.html", gin.H{
+		"Activity":       activity,
+		"ElapsedSeconds": int(activity.ActiveDuration(time.Now()).Seconds()),
+	})
+}
+
 // DiscardWorkoutHandler deletes a draft and redirects appropriately.
 // Route: POST /activity/:id/discard
 func DiscardWorkoutHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
@@ -528,8 +1305,11 @@ func DiscardWorkoutHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc
 			return
 		}
 
-		// Delete the draft record
-		activityRepo.DeleteActivity(uint(draftID)) // Use your existing DeleteActivity
+		// Delete the draft record along with its exercises and sets
+		if err := activityRepo.DeleteActivityAndChildren(uint(draftID)); err != nil {
+			ctx.String(http.StatusInternalServerError, "Failed to discard workout")
+			return
+		}
 
 		// If this draft was a copy of an original, redirect to the original.
 		// Otherwise, it was a new workout, so redirect home.
@@ -538,13 +1318,6 @@ func DiscardWorkoutHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc
 			redirectURL = fmt.Sprintf("/workouts/%d", *draft.OriginalActivityID)
 		}
 
-		session := sessions.Default(ctx)
-		session.Delete("active_workout_id")
-		if err := session.Save(); err != nil {
-			ctx.String(http.StatusInternalServerError, "Failed to save session")
-			return
-		}
-
 		ctx.Header("HX-Redirect", redirectURL)
 		ctx.Status(http.StatusOK)
 	}
@@ -587,6 +1360,52 @@ func GetActivityNameHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc
 	}
 }
 
+// UpdateActivityTimeHandler changes when a workout took place so it can be backdated.
+// Route: POST /activity/:id/time
+func UpdateActivityTimeHandler(activityRepo *database.ActivityRepo, streakRepo *database.StreakRepo) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		activityID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid activity ID")
+			return
+		}
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		if activity, err := activityRepo.GetActivityByID(uint(activityID)); err != nil || activity.UserID != sessionUserId {
+			ctx.String(http.StatusNotFound, "Activity not found")
+			return
+		}
+
+		activityTime, err := time.ParseInLocation("2006-01-02T15:04", ctx.PostForm("activity_time"), time.Local)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "Invalid date provided.")
+			return
+		}
+		if activityTime.After(time.Now()) {
+			ctx.String(http.StatusBadRequest, "A workout cannot be dated in the future.")
+			return
+		}
+
+		updatedActivity, err := activityRepo.UpdateActivityTime(uint(activityID), activityTime)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				ctx.String(http.StatusNotFound, "Activity not found")
+				return
+			}
+			ctx.String(http.StatusInternalServerError, "Failed to update activity date")
+			return
+		}
+
+		// Drafts don't count towards streaks until they are finished.
+		if updatedActivity.Status == database.StatusActive {
+			if _, err := streakRepo.RecalculateStreak(updatedActivity.UserID); err != nil {
+				log.Printf("Failed to recalculate streak for user %d: %v", updatedActivity.UserID, err)
+			}
+		}
+
+		ctx.Status(http.StatusOK)
+	}
+}
+
 func UpdateActivityNameHandler(activityRepo *database.ActivityRepo) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		activityIDParam := ctx.Param("id")
@@ -595,6 +1414,11 @@ func UpdateActivityNameHandler(activityRepo *database.ActivityRepo) gin.HandlerF
 			ctx.String(http.StatusBadRequest, "Invalid activity ID")
 			return
 		}
+		sessionUserId := sessions.Default(ctx).Get("user").(uint)
+		if activity, err := activityRepo.GetActivityByID(uint(activityID)); err != nil || activity.UserID != sessionUserId {
+			ctx.String(http.StatusNotFound, "Activity not found")
+			return
+		}
 
 		// FIX: Added input validation
 		newName := ctx.PostForm("name")